@@ -1,9 +1,11 @@
-// Package tnze provides a tiny adapter to feed packets from github.com/Tnze/go-mc
+// Package adapters provides a tiny adapter to feed packets from github.com/Tnze/go-mc
 // (pk.Packet) into an MCPR recorder.
 package adapters
 
 import (
 	"log"
+	"sync"
+	"time"
 
 	pk "github.com/Tnze/go-mc/net/packet"
 
@@ -23,6 +25,46 @@ import (
 //
 // If bundleDelimiterID is -1, no bundle filtering is applied.
 func PacketFunc(rec *recorder.Recorder, bundleDelimiterID int32) func(pk.Packet) error {
+	return PacketFuncAt(rec, bundleDelimiterID, nil)
+}
+
+// ReceiveTime returns the time a packet was received at the network layer,
+// or the zero time if it is not known.
+type ReceiveTime func(p pk.Packet) time.Time
+
+// ReceiveQueue carries receive times from a network read loop to handlers
+// that run later but in the same order: call Mark right after reading each
+// packet and pass Next as the ReceiveTime of PacketFuncAt.
+type ReceiveQueue struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+// Mark records that a packet was received now.
+func (q *ReceiveQueue) Mark() {
+	q.mu.Lock()
+	q.times = append(q.times, time.Now())
+	q.mu.Unlock()
+}
+
+// Next returns the receive time of the oldest packet not yet handled, or the
+// zero time if none was marked.
+func (q *ReceiveQueue) Next(pk.Packet) time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.times) == 0 {
+		return time.Time{}
+	}
+	t := q.times[0]
+	q.times = q.times[1:]
+	return t
+}
+
+// PacketFuncAt is PacketFunc timestamping each packet with the time returned
+// by receivedAt instead of the time the handler runs, so packets that queued
+// up behind slow handlers keep their original spacing. Packets for which
+// receivedAt is nil or returns the zero time are timestamped now.
+func PacketFuncAt(rec *recorder.Recorder, bundleDelimiterID int32, receivedAt ReceiveTime) func(pk.Packet) error {
 	recordCount := 0
 
 	if bundleDelimiterID != -1 {
@@ -47,6 +89,11 @@ func PacketFunc(rec *recorder.Recorder, bundleDelimiterID int32) func(pk.Packet)
 		if recordCount%100 == 0 {
 			log.Printf("[Recorder] Recorded %d packets (latest: ID=%d len=%d)", recordCount, p.ID, len(data))
 		}
+		if receivedAt != nil {
+			if t := receivedAt(p); !t.IsZero() {
+				return rec.RecordAtTime(t, int32(p.ID), data)
+			}
+		}
 		return rec.RecordNow(int32(p.ID), data)
 	}
 }
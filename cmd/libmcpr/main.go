@@ -0,0 +1,127 @@
+// Command libmcpr builds the replay writer as a C shared library, so server
+// plugins written in Java, Python, Rust or C can write .mcpr files with this
+// implementation:
+//
+//	go build -buildmode=c-shared -o libmcpr.so ./cmd/libmcpr
+//
+// which also writes libmcpr.h; without -o the library is named libmcpr. Both
+// are build output and not committed. A recording is referred to by an opaque handle.
+// Functions return NULL on success or an error message the caller releases
+// with mcpr_free:
+//
+//	uintptr_t h;
+//	char *err = mcpr_create("session.mcpr", "{\"protocol\":764}", &h);
+//	err = mcpr_write_packet(h, 1500, 0x26, payload, payload_len);
+//	err = mcpr_add_marker(h, 1500, "Boss fight");
+//	err = mcpr_close(h); // finalizes and validates; h is invalid afterwards
+//
+// Calls for one handle are serialized; different handles may be used from
+// different threads.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+func main() {}
+
+// cerr returns err as a C string owned by the caller, or NULL.
+func cerr(err error) *C.char {
+	if err == nil {
+		return nil
+	}
+	return C.CString(err.Error())
+}
+
+// lookup returns the writer of h, or nil for an invalid handle.
+func lookup(h C.uintptr_t) (w *mcpr.Writer) {
+	if h == 0 {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			w = nil
+		}
+	}()
+	w, _ = cgo.Handle(h).Value().(*mcpr.Writer)
+	return w
+}
+
+var errHandle = errors.New("mcpr: invalid handle")
+
+// closeMu makes looking up and deleting a handle one step, so that of two
+// threads closing the same handle one closes the writer and the other gets
+// errHandle; deleting a handle twice would panic across the FFI boundary.
+var closeMu sync.Mutex
+
+//export mcpr_create
+func mcpr_create(path, metaJSON *C.char, out *C.uintptr_t) *C.char {
+	var meta mcpr.Meta
+	if metaJSON != nil {
+		if err := json.Unmarshal([]byte(C.GoString(metaJSON)), &meta); err != nil {
+			return cerr(fmt.Errorf("parse metadata: %w", err))
+		}
+	}
+	// Callers may share a handle between threads
+	w, err := mcpr.Create(C.GoString(path), meta, mcpr.WithLocking())
+	if err != nil {
+		return cerr(err)
+	}
+	*out = C.uintptr_t(cgo.NewHandle(w))
+	return nil
+}
+
+//export mcpr_write_packet
+func mcpr_write_packet(h C.uintptr_t, ts C.uint32_t, id C.int32_t, data *C.uint8_t, n C.size_t) *C.char {
+	w := lookup(h)
+	if w == nil {
+		return cerr(errHandle)
+	}
+	var payload []byte
+	if n > 0 {
+		payload = unsafe.Slice((*byte)(unsafe.Pointer(data)), int(n))
+	}
+	return cerr(w.WritePacket(uint32(ts), int32(id), payload))
+}
+
+//export mcpr_add_marker
+func mcpr_add_marker(h C.uintptr_t, ts C.int32_t, name *C.char) *C.char {
+	w := lookup(h)
+	if w == nil {
+		return cerr(errHandle)
+	}
+	w.AddMarker(mcpr.Marker{Time: int(ts), Name: C.GoString(name)})
+	return nil
+}
+
+//export mcpr_close
+func mcpr_close(h C.uintptr_t) *C.char {
+	closeMu.Lock()
+	w := lookup(h)
+	if w != nil {
+		cgo.Handle(h).Delete()
+	}
+	closeMu.Unlock()
+	if w == nil {
+		return cerr(errHandle)
+	}
+	return cerr(w.Close())
+}
+
+//export mcpr_free
+func mcpr_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/backfill"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr|dir>...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Fills in missing metadata of old replays (duration, players, selfId,\n")
+		fmt.Fprintf(os.Stderr, "mcversion, protocol) from their packets, and a missing date from the file's\n")
+		fmt.Fprintf(os.Stderr, "modification time, rewriting each replay in place.\n")
+		fmt.Fprintf(os.Stderr, "Directories are searched for .mcpr files recursively.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	dryRun := flag.Bool("n", false, "Only report what would be filled in")
+	overwrite := flag.Bool("overwrite", false, "Also replace fields that disagree with the packets")
+	catalogPath := flag.String("catalog", "", "Also update the backfilled replays in this catalog file")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	paths, err := replays(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	var cat *catalog.Catalog
+	if *catalogPath != "" && !*dryRun {
+		if cat, err = catalog.Load(*catalogPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	failed := false
+	filled := 0
+	for _, path := range paths {
+		res, err := backfill.File(path, backfill.Options{Overwrite: *overwrite, DryRun: *dryRun})
+		if err == nil && cat != nil && len(res.Filled) > 0 {
+			err = cat.Refresh(path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if len(res.Filled) == 0 {
+			fmt.Printf("   %s: complete\n", path)
+			continue
+		}
+		filled++
+		verb := "filled"
+		if *dryRun {
+			verb = "would fill"
+		}
+		fmt.Printf("✅ %s: %s %s\n", path, verb, describe(res))
+	}
+	if cat != nil {
+		if err := cat.Save(*catalogPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failed = true
+		}
+	}
+	fmt.Printf("%d of %d replays backfilled\n", filled, len(paths))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// describe lists the filled fields with their values.
+func describe(res backfill.Result) string {
+	d := res.Derived
+	var out []string
+	for _, f := range res.Filled {
+		switch f {
+		case "duration":
+			out = append(out, fmt.Sprintf("duration %d ms", d.Duration))
+		case "date":
+			out = append(out, "date "+time.UnixMilli(d.Date).Format(time.RFC3339))
+		case "protocol":
+			out = append(out, fmt.Sprintf("protocol %d", d.Protocol))
+		case "mcversion":
+			out = append(out, "mcversion "+d.MCVersion)
+		case "selfId":
+			out = append(out, fmt.Sprintf("selfId %d", d.SelfID))
+		case "players":
+			out = append(out, fmt.Sprintf("players (%d)", len(d.Players)))
+		default:
+			out = append(out, f)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// replays expands directories in args to the .mcpr files below them.
+func replays(args []string) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			out = append(out, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !e.IsDir() && strings.EqualFold(filepath.Ext(path), ".mcpr") {
+				out = append(out, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <dir>...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Indexes the replays under each directory into a catalog file, re-reading\n")
+		fmt.Fprintf(os.Stderr, "only new and changed replays. Search it with mcpr-search.\n\n")
+		fmt.Fprintf(os.Stderr, "Replays deleted with a tombstone (e.g. by proxyrec -tombstones) stay in the\n")
+		fmt.Fprintf(os.Stderr, "catalog until -purge removes their tombstones.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	db := flag.String("db", catalog.DefaultFile, "Catalog file")
+	purge := flag.Bool("purge", false, "Remove the tombstones of deleted replays under each directory, and their entries")
+	purgeAge := flag.Duration("purge-age", 0, "With -purge, only remove tombstones of replays deleted longer ago than this (e.g. 720h)")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	c, err := catalog.Load(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	failed := false
+	for _, dir := range flag.Args() {
+		if *purge {
+			var before time.Time
+			if *purgeAge > 0 {
+				before = time.Now().Add(-*purgeAge)
+			}
+			purged, err := c.PurgeTombstones(dir, before)
+			for _, p := range purged {
+				fmt.Printf("✅ %s: purged\n", p)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: purge: %v\n", dir, err)
+				os.Exit(1)
+			}
+		}
+		st, err := c.Update(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		paths := make([]string, 0, len(st.Failed))
+		for p := range st.Failed {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", p, st.Failed[p])
+			failed = true
+		}
+		fmt.Printf("✅ %s: %d added, %d updated, %d removed, %d unchanged, %d deleted with tombstones\n",
+			dir, st.Added, st.Updated, st.Removed, st.Unchanged, st.Tombstones)
+	}
+	if err := c.Save(*db); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: %d replays\n", *db, len(c.Entries))
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -7,6 +7,7 @@ import (
     "log"
     "strconv"
     "strings"
+    "time"
 
     "github.com/reallyoldfogie/mc-replay-go/mcpr"
 )
@@ -63,14 +64,33 @@ func main() {
     var protocol int
     var generator string
     var pkts packetFlags
+    var sidecar bool
+    var indexInterval uint
+    var strict bool
+    var date string
 
     flag.StringVar(&out, "out", "example.mcpr", "Output .mcpr path")
     flag.IntVar(&protocol, "protocol", 754, "MC network protocol (e.g. 754 for 1.16.5)")
     flag.StringVar(&generator, "generator", "mc-replay-go", "Generator string in metadata")
     flag.Var(&pkts, "packet", "Packet spec ts:id:hexpayload (repeatable)")
+    flag.BoolVar(&sidecar, "sidecar", false, "Also write <out>.json with metadata, stats and checksums")
+    flag.UintVar(&indexInterval, "index-interval", 0, "Write a seek index with one entry per N ms (0 = none)")
+    flag.StringVar(&date, "date", "", "Recording date: ISO 8601 (2024-05-01T18:30:00+02:00, 2024-05-01 18:30 in local time), unix ms or @unix seconds (default now)")
+    flag.BoolVar(&strict, "strict", false, "Fail on packet ids outside the protocol's clientbound range and on validation warnings instead of warning")
     flag.Parse()
 
-    w, err := mcpr.Create(out, mcpr.Meta{Protocol: protocol, Generator: generator})
+    meta := mcpr.Meta{Protocol: protocol, Generator: generator}
+    if date != "" {
+        t, err := mcpr.ParseDate(date, time.Local)
+        if err != nil {
+            log.Fatalf("-date: %v", err)
+        }
+        meta.Date = t.UnixMilli()
+    }
+    w, err := mcpr.Create(out, meta,
+        mcpr.WithSidecar(sidecar),
+        mcpr.WithIndexInterval(uint32(indexInterval)),
+        mcpr.WithStrict(strict))
     if err != nil {
         log.Fatalf("create writer: %v", err)
     }
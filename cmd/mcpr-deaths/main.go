@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/deaths"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/markers"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr> [out.mcpr]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lists the deaths in a replay with their killers, prints kill/death stats,\n")
+		fmt.Fprintf(os.Stderr, "or adds a marker per death (rewriting in place when out.mcpr is omitted).\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	asJSON := flag.Bool("json", false, "Print the deaths as JSON")
+	stats := flag.Bool("stats", false, "Print kills and deaths per player")
+	addMarkers := flag.Bool("markers", false, "Add a marker for every death to the replay")
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 || flag.NArg() == 2 && !*addMarkers {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	in := flag.Arg(0)
+	ds, err := deaths.Extract(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *addMarkers:
+		existing, err := mcpr.ReadMarkers(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		ms := markers.Merge(existing, deaths.Markers(ds))
+		if ms == nil {
+			ms = []mcpr.Marker{}
+		}
+		out := in
+		if flag.NArg() == 2 {
+			out = flag.Arg(1)
+		}
+		p, _ := transform.ParsePipeline("")
+		if _, err := transform.RewriteFile(in, out, p, transform.Options{Markers: ms}); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s: %d death markers added\n", out, len(ds))
+	case *asJSON:
+		if err := deaths.WriteJSON(os.Stdout, ds); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	case *stats:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PLAYER\tKILLS\tDEATHS")
+		for _, s := range deaths.Stats(ds) {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Name, s.Kills, s.Deaths)
+		}
+		_ = tw.Flush()
+	default:
+		for _, d := range ds {
+			line := d.Description()
+			if d.Attribution == "damage" {
+				line += " (last damage)"
+			}
+			fmt.Printf("%s  %s\n", markers.FormatTime(int(d.Time), false), line)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/evidence"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] -o bundle.zip <replay.mcpr>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -verify [-pub key.pub] <bundle.zip> [bundle2.zip ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -genkey key.pem\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Packages a replay with its validation report, processing log and checksums into\n")
+		fmt.Fprintf(os.Stderr, "an evidence bundle for handing it to third parties, optionally signed, or\n")
+		fmt.Fprintf(os.Stderr, "verifies such bundles.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	out := flag.String("o", "", "Bundle to write (default: <replay>.evidence.zip)")
+	caseRef := flag.String("case", "", "Case or ticket reference to record in the manifest")
+	by := flag.String("by", "", "Who is making the bundle")
+	note := flag.String("note", "", "Free-form note to record in the manifest")
+	keyPath := flag.String("key", "", "Sign the manifest with this Ed25519 private key (PKCS #8 PEM)")
+	verify := flag.Bool("verify", false, "Verify bundles instead of creating one")
+	pubPath := flag.String("pub", "", "With -verify, require a signature by this Ed25519 public key (PEM)")
+	genkey := flag.String("genkey", "", "Generate a signing key pair at this path and path.pub, then exit")
+	flag.Parse()
+
+	if *genkey != "" {
+		pub, err := evidence.GenerateKey(*genkey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ wrote %s and %s.pub (fingerprint %s)\n", *genkey, *genkey, evidence.KeyFingerprint(pub))
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *verify {
+		var pub ed25519.PublicKey
+		if *pubPath != "" {
+			var err error
+			if pub, err = evidence.LoadPublicKey(*pubPath); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		exitCode := 0
+		for _, path := range flag.Args() {
+			if !verifyBundle(path, pub) {
+				exitCode = 1
+			}
+		}
+		os.Exit(exitCode)
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "❌ give exactly one replay to bundle\n")
+		os.Exit(1)
+	}
+	src := flag.Arg(0)
+	opts := evidence.Options{Case: *caseRef, By: *by, Note: *note}
+	if *keyPath != "" {
+		var err error
+		if opts.Key, err = evidence.LoadPrivateKey(*keyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dst := *out
+	if dst == "" {
+		dst = strings.TrimSuffix(src, filepath.Ext(src)) + ".evidence.zip"
+	}
+	m, err := evidence.Create(dst, src, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", src, err)
+		os.Exit(1)
+	}
+	signed := "unsigned"
+	if opts.Key != nil {
+		signed = "signed, key " + evidence.KeyFingerprint(opts.Key.Public().(ed25519.PublicKey))
+	}
+	fmt.Printf("✅ %s: %d files, %s\n", dst, len(m.Files), signed)
+	if !m.Valid {
+		fmt.Printf("⚠️  %s does not validate; see %s in the bundle\n", filepath.Base(src), evidence.ValidationName)
+	}
+}
+
+// verifyBundle verifies the bundle at path and reports the outcome.
+func verifyBundle(path string, pub ed25519.PublicKey) bool {
+	m, err := evidence.Verify(path, pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", filepath.Base(path), err)
+		return false
+	}
+	fmt.Printf("✅ %s: intact, %s, made %s", filepath.Base(path), m.Replay, m.Created.Format("2006-01-02 15:04:05 MST"))
+	if m.Case != "" {
+		fmt.Printf(", case %s", m.Case)
+	}
+	if m.By != "" {
+		fmt.Printf(", by %s", m.By)
+	}
+	fmt.Println()
+	if m.Signer == nil {
+		fmt.Printf("⚠️  %s is not signed\n", filepath.Base(path))
+	} else if pub == nil {
+		fmt.Printf("⚠️  %s: signed by the key it carries (fingerprint %s); use -pub to check it is the sender's\n", filepath.Base(path), evidence.KeyFingerprint(m.Signer))
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/importer"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -format <format> [options] <replay.mcpr> <capture>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Exports a replay's packets to another capture format.\n\n")
+		fmt.Fprintf(os.Stderr, "Formats: %s\n\n", strings.Join(importer.ExportFormats(), ", "))
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	format := flag.String("format", "", "Output format")
+	times := flag.String("times", "", "Timestamp file to write (lenlog formats; default <capture>.times)")
+	flag.Parse()
+
+	if flag.NArg() != 2 || *format == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	in, out := flag.Arg(0), flag.Arg(1)
+	if *times == "" && strings.HasPrefix(*format, "lenlog") {
+		*times = out + ".times"
+	}
+	n, caveats, err := importer.ExportFile(*format, in, out, *times)
+	for _, c := range caveats {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: exported %d packets\n", out, n)
+}
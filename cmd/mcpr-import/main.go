@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/importer"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -format <format> [options] <capture> <out.mcpr>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Converts packet captures from other tools into .mcpr replays.\n\n")
+		fmt.Fprintf(os.Stderr, "Formats: %s\n\n", strings.Join(importer.Formats(), ", "))
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	format := flag.String("format", "", "Input format")
+	times := flag.String("times", "", "Timestamp file (one ms value per frame) for lenlog formats")
+	protocol := flag.Int("protocol", 0, "MC network protocol of the captured packets (0 = guess from the packets)")
+	generator := flag.String("generator", "mc-replay-go/import", "Generator string in metadata")
+	secret := flag.String("secret", "", "Shared secret of an encrypted wire or pcap capture, in hex (32 digits)")
+	port := flag.Int("port", importer.DefaultPort, "Server port of the connection to import from a pcap capture")
+	flag.Parse()
+
+	if flag.NArg() != 2 || *format == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var key []byte
+	if *secret != "" {
+		var err error
+		if key, err = hex.DecodeString(*secret); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -secret: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	in, out := flag.Arg(0), flag.Arg(1)
+	n, err := importer.Convert(*format, in, *times, importer.Input{Secret: key, Port: *port}, out, mcpr.Meta{Protocol: *protocol, Generator: *generator})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: imported %d packets\n", out, n)
+	if *protocol == 0 {
+		reportGuess(out)
+	}
+}
+
+// reportGuess prints the protocol the importer guessed for out.
+func reportGuess(out string) {
+	ext, err := mcpr.ReadExtMeta(out)
+	if err != nil || ext.ProtocolGuess == nil {
+		return
+	}
+	g := ext.ProtocolGuess
+	meta, err := mcpr.ReadMeta(out)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", out, err)
+	case meta.Protocol == 0:
+		fmt.Fprintf(os.Stderr, "⚠️  could not guess the protocol; set it with -protocol\n")
+	case !g.Certain:
+		fmt.Fprintf(os.Stderr, "⚠️  guessed protocol %d, but the packets also fit %v; set it with -protocol if wrong\n", meta.Protocol, g.Candidates)
+	default:
+		fmt.Printf("   protocol %d, guessed from %s\n", meta.Protocol, strings.Join(g.Evidence, ", "))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/inventory"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/markers"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the recording player's inventory timeline as JSON, or the\n")
+		fmt.Fprintf(os.Stderr, "inventory at one point in time with -at.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	at := flag.String("at", "", "Print the inventory at this replay time (e.g. 1:23 or 83s)")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	tl, err := inventory.Extract(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+	if *at == "" {
+		if err := tl.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ms, err := markers.ParseTime(*at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -at: %v\n", err)
+		os.Exit(1)
+	}
+	s := tl.At(uint32(ms))
+	fmt.Printf("Inventory at %s (holding hotbar %d):\n", markers.FormatTime(ms, false), s.Hotbar+1)
+	show := func(slot int, it *inventory.Item) {
+		if it == nil {
+			return
+		}
+		fmt.Printf("  %-16s item %d ×%d", inventory.SlotName(slot), it.ID, it.Count)
+		if it.Tag != nil {
+			fmt.Printf(" %v", it.Tag)
+		}
+		fmt.Println()
+	}
+	for slot, it := range s.Slots {
+		show(slot, it)
+	}
+	show(inventory.SlotCursor, s.Cursor)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/markers"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -import <markers.csv|chapters.txt> [options] <in.mcpr> [out.mcpr]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints a replay's markers as CSV or YouTube chapters, or injects markers\n")
+		fmt.Fprintf(os.Stderr, "from such a file (rewriting in place when out.mcpr is omitted).\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	format := flag.String("format", "", "csv or chapters (default: csv, or from the -import file extension)")
+	importPath := flag.String("import", "", "Markers file to inject into the replay")
+	replace := flag.Bool("replace", false, "With -import, replace existing markers instead of merging")
+	offset := flag.Duration("offset", 0, "Replay time of video start: subtracted on export, added on import")
+	flag.Parse()
+
+	if *importPath == "" && flag.NArg() != 1 || *importPath != "" && (flag.NArg() < 1 || flag.NArg() > 2) {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *format == "" {
+		*format = "csv"
+		if ext := strings.ToLower(filepath.Ext(*importPath)); *importPath != "" && ext != ".csv" {
+			*format = "chapters"
+		}
+	}
+	if *format != "csv" && *format != "chapters" {
+		fmt.Fprintf(os.Stderr, "❌ unknown format %q (want csv or chapters)\n", *format)
+		os.Exit(1)
+	}
+
+	in := flag.Arg(0)
+	existing, err := mcpr.ReadMarkers(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	delta := int(*offset / time.Millisecond)
+
+	if *importPath == "" {
+		ms := markers.Shift(existing, -delta)
+		if *format == "csv" {
+			err = markers.WriteCSV(os.Stdout, ms)
+		} else {
+			err = markers.WriteChapters(os.Stdout, ms)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	added, err := readFile(*importPath, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", *importPath, err)
+		os.Exit(1)
+	}
+	added = markers.Shift(added, delta)
+	ms := added
+	if !*replace {
+		ms = markers.Merge(existing, added)
+	}
+	if ms == nil {
+		ms = []mcpr.Marker{}
+	}
+	out := in
+	if flag.NArg() == 2 {
+		out = flag.Arg(1)
+	}
+	p, _ := transform.ParsePipeline("")
+	if _, err := transform.RewriteFile(in, out, p, transform.Options{Markers: ms}); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: %d markers (%d imported)\n", out, len(ms), len(added))
+}
+
+func readFile(path, format string) ([]mcpr.Marker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if format == "csv" {
+		return markers.ReadCSV(f)
+	}
+	return markers.ReadChapters(f)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr|URL>...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the metadata and tags of replays, or adds and removes tags and\n")
+		fmt.Fprintf(os.Stderr, "sets the recording date (rewriting each replay in place). Replays given\n")
+		fmt.Fprintf(os.Stderr, "as http(s) URLs are read with range requests, downloading only what is\n")
+		fmt.Fprintf(os.Stderr, "printed; they cannot be edited.\n\n")
+		fmt.Fprintf(os.Stderr, "Dates may be given as ISO 8601 (2024-05-01, 2024-05-01 18:30,\n")
+		fmt.Fprintf(os.Stderr, "2024-05-01T18:30:00+02:00), unix milliseconds, @unix seconds or \"now\";\n")
+		fmt.Fprintf(os.Stderr, "times without a zone are in -tz.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	var addTags, removeTags listFlag
+	flag.Var(&addTags, "add-tag", "Add a tag (repeatable)")
+	flag.Var(&removeTags, "remove-tag", "Remove a tag (repeatable)")
+	setDate := flag.String("set-date", "", "Set the recording date")
+	dateFormat := flag.String("date-format", mcpr.DateISO, "Print dates as iso, human or epoch (unix ms)")
+	tz := flag.String("tz", "Local", "Time zone for printing and parsing dates, e.g. UTC or Europe/Berlin")
+	asJSON := flag.Bool("json", false, "Print metadata and tags as JSON")
+	packets := flag.Int("packets", 0, "Also list the first N packets")
+	catalogPath := flag.String("catalog", "", "Also update the edited replays in this catalog file")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -tz: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := mcpr.FormatDate(1, *dateFormat, loc); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -date-format: %v\n", err)
+		os.Exit(1)
+	}
+	var date *int64
+	if *setDate != "" {
+		t, err := mcpr.ParseDate(*setDate, loc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -set-date: %v\n", err)
+			os.Exit(1)
+		}
+		ms := t.UnixMilli()
+		date = &ms
+	}
+
+	edit := len(addTags) > 0 || len(removeTags) > 0 || date != nil
+	var cat *catalog.Catalog
+	if edit && *catalogPath != "" {
+		var err error
+		if cat, err = catalog.Load(*catalogPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		var err error
+		switch {
+		case edit && isURL(path):
+			err = fmt.Errorf("remote replays cannot be edited")
+		case edit:
+			err = update(path, addTags, removeTags, date, *dateFormat, loc)
+			if err == nil && cat != nil {
+				err = cat.Refresh(path)
+			}
+		default:
+			err = show(path, *asJSON, *dateFormat, loc, *packets)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if cat != nil {
+		if err := cat.Save(*catalogPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// update rewrites the replay at path with the tags changed and, if date is
+// set, the recording date replaced.
+func update(path string, add, remove []string, date *int64, dateFormat string, loc *time.Location) error {
+	var opts transform.Options
+	var ops []string
+	if len(add) > 0 || len(remove) > 0 {
+		ext, err := mcpr.ReadExtMeta(path)
+		if err != nil {
+			return err
+		}
+		drop := map[string]bool{}
+		for _, t := range mcpr.NormalizeTags(remove) {
+			drop[t] = true
+		}
+		opts.Tags = []string{}
+		for _, t := range mcpr.NormalizeTags(append(ext.Tags, add...)) {
+			if !drop[t] {
+				opts.Tags = append(opts.Tags, t)
+			}
+		}
+		for _, t := range mcpr.NormalizeTags(add) {
+			ops = append(ops, "add-tag "+t)
+		}
+		for _, t := range mcpr.NormalizeTags(remove) {
+			ops = append(ops, "remove-tag "+t)
+		}
+	}
+	if date != nil {
+		opts.Meta = &mcpr.MetaPatch{Date: date}
+		ops = append(ops, fmt.Sprintf("set-date %d", *date))
+	}
+	opts.Operation = strings.Join(ops, ", ")
+	p, _ := transform.ParsePipeline("")
+	if _, err := transform.RewriteFile(path, path, p, opts); err != nil {
+		return err
+	}
+	if opts.Tags != nil {
+		fmt.Printf("✅ %s: tags [%s]\n", path, strings.Join(opts.Tags, ", "))
+	}
+	if date != nil {
+		d, _ := mcpr.FormatDate(*date, dateFormat, loc)
+		fmt.Printf("✅ %s: date %s\n", path, d)
+	}
+	return nil
+}
+
+// packetInfo is a packet as listed by -packets.
+type packetInfo struct {
+	Time uint32 `json:"time"`
+	ID   int32  `json:"id"`
+	Name string `json:"name,omitempty"`
+	Size int    `json:"size"`
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+func show(path string, asJSON bool, dateFormat string, loc *time.Location, packets int) error {
+	var (
+		meta   mcpr.Meta
+		tags   []string
+		r      *mcpr.Reader
+		remote *mcpr.RemoteFile
+		err    error
+	)
+	if isURL(path) {
+		if remote, err = mcpr.OpenRemote(context.Background(), nil, path); err != nil {
+			return err
+		}
+		if r, err = mcpr.NewReader(remote, remote.Size()); err != nil {
+			return err
+		}
+		ext, err := r.ExtMeta()
+		if err != nil {
+			return err
+		}
+		meta, tags = r.Meta, ext.Tags
+	} else {
+		e, err := catalog.Read(path)
+		if err != nil {
+			return err
+		}
+		meta, tags = e.Meta, e.Tags
+		if packets > 0 {
+			if r, err = mcpr.OpenReader(path); err != nil {
+				return err
+			}
+		}
+	}
+	var list []packetInfo
+	if r != nil {
+		defer r.Close()
+		_ = r.SetPacketNames(true)
+		for len(list) < packets {
+			p, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			list = append(list, packetInfo{p.Time, p.ID, p.Name, len(p.Payload)})
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Path    string       `json:"path"`
+			Meta    mcpr.Meta    `json:"meta"`
+			Tags    []string     `json:"tags"`
+			Packets []packetInfo `json:"packets,omitempty"`
+		}{path, meta, mcpr.NormalizeTags(tags), list})
+	}
+	fmt.Printf("%s\n", path)
+	fmt.Printf("  id:        %s\n", meta.ID)
+	if meta.Date != 0 {
+		d, _ := mcpr.FormatDate(meta.Date, dateFormat, loc)
+		fmt.Printf("  date:      %s\n", d)
+	}
+	fmt.Printf("  duration:  %s\n", time.Duration(meta.Duration)*time.Millisecond)
+	fmt.Printf("  protocol:  %d %s\n", meta.Protocol, meta.MCVersion)
+	if meta.ServerName != "" || meta.CustomServerName != "" {
+		fmt.Printf("  server:    %s %s\n", meta.ServerName, meta.CustomServerName)
+	}
+	fmt.Printf("  players:   %d\n", len(meta.Players))
+	fmt.Printf("  generator: %s\n", meta.Generator)
+	fmt.Printf("  tags:      %s\n", strings.Join(tags, ", "))
+	if len(list) > 0 {
+		fmt.Printf("  packets:\n")
+		for _, p := range list {
+			fmt.Printf("    %9s  0x%02X %-28s %d bytes\n", time.Duration(p.Time)*time.Millisecond, p.ID, p.Name, p.Size)
+		}
+	}
+	if remote != nil {
+		n, reqs := remote.Fetched()
+		fmt.Printf("  fetched:   %d of %d bytes in %d requests\n", n, remote.Size(), reqs)
+	}
+	return nil
+}
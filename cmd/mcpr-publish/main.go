@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/publish"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Writes a share-safe copy of a replay: players get pseudonyms and new UUIDs,\n")
+		fmt.Fprintf(os.Stderr, "the world is moved, chat and other free text is removed, and the copy is\n")
+		fmt.Fprintf(os.Stderr, "watermarked, given a map thumbnail and validated.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	out := flag.String("o", "", "Copy to write (default: <replay>.public.mcpr)")
+	watermark := flag.String("watermark", "", "Name of a marker at the start of the copy, e.g. \"example.org, CC BY 4.0\"")
+	server := flag.String("server", "", "Server name to put in the copy's metadata (default: none)")
+	offset := flag.String("offset", "", "Move the world by X,Z chunks (default: random)")
+	key := flag.String("key", "", "Secret deriving the players' UUIDs, to give them the same UUIDs across copies (default: random)")
+	noThumb := flag.Bool("no-thumbnail", false, "Do not render a map thumbnail")
+	play := flag.Bool("play", false, "The recording starts in the play state (captured after login)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	src := flag.Arg(0)
+	opts := publish.Options{
+		Watermark:   *watermark,
+		ServerName:  *server,
+		NoThumbnail: *noThumb,
+		StartInPlay: *play,
+	}
+	if *key != "" {
+		opts.Key = []byte(*key)
+	}
+	if *offset != "" {
+		o, err := parseOffset(*offset)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -offset: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Offset = &o
+	}
+	dst := *out
+	if dst == "" {
+		dst = strings.TrimSuffix(src, filepath.Ext(src)) + ".public.mcpr"
+	}
+
+	rep, err := publish.Publish(src, dst, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", filepath.Base(src), err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: kept %d of %d packets, %d players renamed, world moved by %d, %d blocks\n",
+		dst, rep.PacketsOut, rep.PacketsIn, rep.Players, rep.Offset[0], rep.Offset[1])
+	if len(rep.Dropped) > 0 {
+		names := make([]string, 0, len(rep.Dropped))
+		for n := range rep.Dropped {
+			names = append(names, n)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if rep.Dropped[names[i]] != rep.Dropped[names[j]] {
+				return rep.Dropped[names[i]] > rep.Dropped[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		fmt.Println("   dropped:")
+		for _, n := range names {
+			fmt.Printf("   %8d  %s\n", rep.Dropped[n], n)
+		}
+	}
+	if rep.Malformed > 0 {
+		fmt.Printf("⚠️  %d packets could not be parsed and were dropped\n", rep.Malformed)
+	}
+	if !opts.NoThumbnail && !rep.Thumbnail {
+		fmt.Printf("⚠️  no thumbnail: the replay has no chunks to render\n")
+	}
+	for _, w := range rep.Validation.Warnings {
+		fmt.Printf("⚠️  %s\n", w)
+	}
+}
+
+// parseOffset parses "X,Z".
+func parseOffset(s string) ([2]int32, error) {
+	xs, zs, ok := strings.Cut(s, ",")
+	if !ok {
+		return [2]int32{}, fmt.Errorf("want X,Z, got %q", s)
+	}
+	var o [2]int32
+	for i, v := range []string{xs, zs} {
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+		if err != nil {
+			return [2]int32{}, fmt.Errorf("want X,Z, got %q", s)
+		}
+		o[i] = int32(n)
+	}
+	return o, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/quarantine"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -dir <quarantine> [options] <command> [name...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Manages replays that failed validation (see mcpr-validate -quarantine).\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  list           list quarantined replays with the reason\n")
+		fmt.Fprintf(os.Stderr, "  retry NAME...  validate again; replays that pass leave the quarantine\n")
+		fmt.Fprintf(os.Stderr, "  delete NAME... delete replays and their reports\n")
+		fmt.Fprintf(os.Stderr, "  serve          serve the JSON API on -listen\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	dir := flag.String("dir", "", "Quarantine directory")
+	accepted := flag.String("accepted", "", "Move replays passing retry here (default: back where they came from)")
+	listen := flag.String("listen", "127.0.0.1:8088", "Address for serve")
+	flag.Parse()
+	if *dir == "" || flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	s := &quarantine.Store{Dir: *dir, Accepted: *accepted}
+
+	cmd, names := flag.Arg(0), flag.Args()[1:]
+	failed := false
+	switch cmd {
+	case "list":
+		reports, err := s.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		for _, r := range reports {
+			fmt.Printf("%s  %s  %s\n", r.Time.Local().Format(time.DateTime), r.Name, r.Error)
+			if len(r.Warnings) > 0 {
+				fmt.Printf("    warnings: %s\n", strings.Join(r.Warnings, "; "))
+			}
+		}
+		fmt.Printf("%d quarantined\n", len(reports))
+	case "retry":
+		for _, name := range names {
+			dst, _, err := s.Retry(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", name, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("✅ %s: valid, moved to %s\n", name, dst)
+		}
+	case "delete":
+		for _, name := range names {
+			if err := s.Delete(name); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", name, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("✅ %s: deleted\n", name)
+		}
+	case "serve":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := serve(ctx, *listen, s.Handler()); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func serve(ctx context.Context, addr string, h http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("serving quarantine API on http://%s/\n", ln.Addr())
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lists the replays in a catalog (see mcpr-catalog) matching all given filters.\n")
+		fmt.Fprintf(os.Stderr, "Example: --player <uuid> --server mc.example --after 2024-01-01 --tag pvp --marker boss\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	db := flag.String("db", catalog.DefaultFile, "Catalog file")
+	var q catalog.Query
+	var tags listFlag
+	flag.StringVar(&q.Player, "player", "", "Player UUID")
+	flag.StringVar(&q.Server, "server", "", "Server name (substring)")
+	after := flag.String("after", "", "Recorded at or after this date (YYYY-MM-DD or RFC 3339)")
+	before := flag.String("before", "", "Recorded before this date (YYYY-MM-DD or RFC 3339)")
+	flag.Var(&tags, "tag", "Tag (repeatable; all must match)")
+	flag.StringVar(&q.Marker, "marker", "", "Marker name (substring)")
+	flag.IntVar(&q.Protocol, "protocol", 0, "Protocol version")
+	flag.BoolVar(&q.IncludeDeleted, "deleted", false, "Include replays deleted with a tombstone")
+	asJSON := flag.Bool("json", false, "Print matching entries as JSON")
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	q.Tags = tags
+	var err error
+	if q.After, err = parseDate(*after); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -after: %v\n", err)
+		os.Exit(1)
+	}
+	if q.Before, err = parseDate(*before); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -before: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(*db); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v (build it with mcpr-catalog)\n", err)
+		os.Exit(1)
+	}
+	c, err := catalog.Load(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	found := c.Search(q)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(found); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	for _, e := range found {
+		server := e.Meta.CustomServerName
+		if server == "" {
+			server = e.Meta.ServerName
+		}
+		dur := (time.Duration(e.Meta.Duration) * time.Millisecond).Round(time.Second)
+		path := e.Path
+		if e.Deleted != nil {
+			path += fmt.Sprintf(" (deleted %s", e.Deleted.Local().Format("2006-01-02 15:04"))
+			if e.DeleteReason != "" {
+				path += ": " + e.DeleteReason
+			}
+			path += ")"
+		}
+		fmt.Printf("%s  %8s  %-20s  [%s]  %s\n", e.Time().Format("2006-01-02 15:04"), dur, server,
+			strings.Join(e.Tags, ", "), path)
+	}
+	if len(found) == 0 {
+		fmt.Println("⚠️  no matching replays")
+	}
+}
+
+// parseDate parses a date in local time or an RFC 3339 timestamp.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
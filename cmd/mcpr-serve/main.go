@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/debugserver"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/replayserver"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serves a replay to vanilla Minecraft clients: connect to the listen\n")
+		fmt.Fprintf(os.Stderr, "address with a client of the same version to watch the recording.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	listen := flag.String("listen", ":25565", "Listen address")
+	motd := flag.String("motd", "", "Server list message (default: replay of <server>)")
+	speed := flag.Float64("speed", 1.0, "Playback speed (2.0 = twice as fast)")
+	debugAddr := flag.String("debug-addr", "", "Serve pprof and expvar diagnostics on this address (e.g. localhost:6060)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *debugAddr != "" {
+		go func() {
+			if err := debugserver.ListenAndServe(ctx, *debugAddr); err != nil {
+				log.Printf("debug server: %v", err)
+			}
+		}()
+		log.Printf("diagnostics on http://%s/debug/pprof/", *debugAddr)
+	}
+
+	srv := &replayserver.Server{Path: flag.Arg(0), MOTD: *motd, Speed: *speed}
+	log.Printf("serving %s on %s", flag.Arg(0), *listen)
+	if err := srv.ListenAndServe(ctx, *listen); err != nil {
+		log.Fatalf("serve: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/markers"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/splits"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr> [out.mcpr]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the speedrun splits reached in a replay, or adds a marker per split\n")
+		fmt.Fprintf(os.Stderr, "(rewriting in place when out.mcpr is omitted).\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	asJSON := flag.Bool("json", false, "Print the report as JSON")
+	addMarkers := flag.Bool("markers", false, "Add a marker for every split to the replay")
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 || flag.NArg() == 2 && !*addMarkers {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	in := flag.Arg(0)
+	r, err := splits.Extract(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *addMarkers:
+		existing, err := mcpr.ReadMarkers(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		ms := markers.Merge(existing, r.Markers())
+		if ms == nil {
+			ms = []mcpr.Marker{}
+		}
+		out := in
+		if flag.NArg() == 2 {
+			out = flag.Arg(1)
+		}
+		p, _ := transform.ParsePipeline("")
+		if _, err := transform.RewriteFile(in, out, p, transform.Options{Markers: ms}); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s: %d split markers added\n", out, len(r.Splits))
+	case *asJSON:
+		err = r.WriteJSON(os.Stdout)
+	case len(r.Splits) == 0:
+		fmt.Println("⚠️  no splits reached")
+	default:
+		err = r.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+}
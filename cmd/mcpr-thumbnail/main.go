@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/thumbnail"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr> [out.mcpr]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Renders a top-down map of the terrain loaded at the start of a replay and sets\n")
+		fmt.Fprintf(os.Stderr, "it as the replay's thumbnail (rewriting in place when out.mcpr is omitted).\n")
+		fmt.Fprintf(os.Stderr, "With -tiles, exports the whole recorded area as Leaflet map tiles instead.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+	pngOut := flag.String("png", "", "Only write the image to this PNG file")
+	tilesDir := flag.String("tiles", "", "Write map tiles ({z}/{x}/{y}.png and tiles.json) to this directory")
+	zooms := flag.Int("zooms", 0, "Number of tile zoom levels (default 5)")
+	window := flag.Duration("window", 0, "How long after the first chunk to collect chunks (default 10s)")
+	width := flag.Int("width", 0, "Image width in pixels (default 640)")
+	height := flag.Int("height", 0, "Image height in pixels (default 360)")
+	scale := flag.Int("scale", 0, "Pixels per block (default 2)")
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 || flag.NArg() == 2 && (*pngOut != "" || *tilesDir != "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	in := flag.Arg(0)
+	if *tilesDir != "" {
+		ts, err := thumbnail.Tiles(in, *tilesDir, thumbnail.TileOptions{Zooms: *zooms})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s: %d tiles, zoom %d-%d, blocks %v to %v\n", *tilesDir, ts.Tiles, ts.MinZoom, ts.MaxZoom, ts.Bounds[0], ts.Bounds[1])
+		return
+	}
+
+	opts := thumbnail.Options{Window: *window, Width: *width, Height: *height, Scale: *scale}
+	if *pngOut != "" {
+		img, err := thumbnail.Render(in, opts)
+		if err == nil {
+			err = os.WriteFile(*pngOut, img, 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s: %d bytes\n", *pngOut, len(img))
+		return
+	}
+
+	out := in
+	if flag.NArg() == 2 {
+		out = flag.Arg(1)
+	}
+	if err := thumbnail.Set(in, out, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ %s: thumbnail set\n", out)
+}
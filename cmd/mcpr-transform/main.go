@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s --pipeline <stages> <in.mcpr> <out.mcpr>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --concat <in.mcpr>... <out.mcpr>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s --flatten <in.mcpr> <out.mcpr>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Rewrites a replay through a pipeline of stages in one streaming pass,\n")
+		fmt.Fprintf(os.Stderr, "or joins replays back to back.\n")
+		fmt.Fprintf(os.Stderr, "Example: --pipeline \"trim(0,5m)|filter(preset=cinematic)|scrub-chat|rescale(2.0)\"\n\n")
+		fmt.Fprintf(os.Stderr, "Stages: %s\n\n", strings.Join(transform.Stages(), ", "))
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	pipeline := flag.String("pipeline", "", "Pipeline of stages separated by '|'")
+	concat := flag.Bool("concat", false, "Join the input replays back to back, merging their metadata")
+	pack := flag.Int("pack", 0, "Store payloads of at least this many bytes compressed, for archival copies ReplayMod cannot read (0 = off)")
+	flatten := flag.Bool("flatten", false, "Rewrite a packed replay (see -pack) so that ReplayMod can read it")
+	level := flag.Int("level", 0, "Deflate level of the output's recording, 1 (least CPU) to 9 (smallest); 0 for the default, -1 to store it uncompressed for fast seeking")
+	lenient := flag.Bool("lenient", false, "Skip corrupt frames of a damaged recording instead of failing, to salvage the rest")
+	startInPlay := flag.Bool("play", false, "Recording starts in the play state (captured after login)")
+	strict := flag.Bool("strict", false, "Fail on anything the library would only warn about (odd packet ids, validation warnings)")
+	var dropEntries, keepOnly, plugins listFlag
+	flag.Var(&dropEntries, "drop-entry", "Do not carry entries matching pattern (repeatable; \"dir/\" matches a directory)")
+	flag.Var(&keepOnly, "keep-only", "Carry only entries matching pattern (repeatable)")
+	flag.Var(&plugins, "plugin", "Register an external stage as name=path-to-executable (repeatable)")
+	flag.DurationVar(&transform.PluginTimeout, "plugin-timeout", transform.PluginTimeout, "Kill a plugin that takes longer to start or to answer a batch of packets")
+	flag.Parse()
+	mcpr.SetStrictMode(*strict)
+
+	for _, pl := range plugins {
+		name, path, ok := strings.Cut(pl, "=")
+		if !ok || name == "" || path == "" {
+			fmt.Fprintf(os.Stderr, "❌ -plugin %q: want name=path\n", pl)
+			os.Exit(1)
+		}
+		for _, s := range transform.Stages() {
+			if s == name {
+				fmt.Fprintf(os.Stderr, "❌ -plugin %q: stage %s already exists\n", pl, name)
+				os.Exit(1)
+			}
+		}
+		transform.RegisterPlugin(name, path)
+	}
+
+	switch {
+	case *concat && (flag.NArg() < 2 || *pipeline != ""):
+		flag.Usage()
+		os.Exit(1)
+	case *flatten && (*concat || *pack > 0):
+		fmt.Fprintf(os.Stderr, "❌ -flatten cannot be combined with -concat or -pack\n")
+		os.Exit(1)
+	case !*concat && (flag.NArg() != 2 || *pipeline == "" && !*flatten && *pack <= 0 && !*lenient && *level == 0):
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	opts := transform.Options{StartInPlay: *startInPlay, PackThreshold: *pack, Lenient: *lenient}
+	if *flatten {
+		opts.Operation = "flatten"
+	}
+	if *level < 0 {
+		opts.Compression.Store = true
+	} else {
+		opts.Compression.Level = *level
+	}
+	var filters []transform.EntryFilter
+	if len(keepOnly) > 0 {
+		filters = append(filters, transform.KeepOnly(keepOnly...))
+	}
+	if len(dropEntries) > 0 {
+		filters = append(filters, transform.DropEntries(dropEntries...))
+	}
+	if len(filters) > 0 {
+		opts.Entries = transform.AllEntries(filters...)
+	}
+
+	if *concat {
+		ins, out := flag.Args()[:flag.NArg()-1], flag.Arg(flag.NArg()-1)
+		stats, err := transform.Concat(out, ins, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", out, err)
+			os.Exit(1)
+		}
+		for _, sk := range stats.Skipped {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: skipped %d bytes at offset %d: %v\n", out, sk.Length, sk.Offset, sk.Err)
+		}
+		fmt.Printf("✅ %s: %d packets from %d replays, %d entries carried, %d dropped\n",
+			out, stats.PacketsOut, len(ins), stats.EntriesCopied, stats.EntriesDropped)
+		return
+	}
+
+	p, err := transform.ParsePipeline(*pipeline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ pipeline: %v\n", err)
+		os.Exit(1)
+	}
+	in, out := flag.Arg(0), flag.Arg(1)
+	// Interrupting stops the plugins too instead of leaving them behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	opts.Context = ctx
+	stats, err := transform.RewriteFile(in, out, p, opts)
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", in, err)
+		os.Exit(1)
+	}
+	for _, sk := range stats.Skipped {
+		fmt.Fprintf(os.Stderr, "⚠️  %s: skipped %d bytes at offset %d: %v\n", in, sk.Length, sk.Offset, sk.Err)
+	}
+	label := p.String()
+	switch {
+	case *flatten:
+		label = "flatten"
+	case label == "" && *pack > 0:
+		label = "pack"
+	case label == "" && *level != 0:
+		label = "recompress"
+	case label == "":
+		label = "copy"
+	}
+	fmt.Printf("✅ %s: %d/%d packets kept (%s), %d entries carried, %d dropped\n",
+		out, stats.PacketsOut, stats.PacketsIn, label, stats.EntriesCopied, stats.EntriesDropped)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/upload"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -endpoint <tus-url> [options] <replay.mcpr>...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Uploads replays to a tus server. Interrupted uploads resume on the next run.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	endpoint := flag.String("endpoint", "", "tus upload endpoint")
+	chunk := flag.Int64("chunk", upload.DefaultChunkSize, "Chunk size in bytes")
+	retries := flag.Int("retries", upload.DefaultMaxRetries, "Attempts per request")
+	var headers listFlag
+	flag.Var(&headers, "header", "Extra request header \"Name: value\" (repeatable)")
+	flag.Parse()
+
+	if flag.NArg() == 0 || *endpoint == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	u := &upload.Uploader{Endpoint: *endpoint, ChunkSize: *chunk, MaxRetries: *retries, Header: http.Header{}}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "❌ invalid header %q\n", h)
+			os.Exit(1)
+		}
+		u.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := false
+	for _, path := range flag.Args() {
+		url, err := u.Upload(ctx, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("✅ %s → %s\n", path, url)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
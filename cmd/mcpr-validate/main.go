@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/quarantine"
 )
 
 func main() {
@@ -19,7 +22,28 @@ func main() {
 
 	verbose := flag.Bool("v", false, "Verbose output")
 	quiet := flag.Bool("q", false, "Quiet mode (errors only)")
+	clean := flag.Bool("clean", false, "Strip OS metadata, directory and duplicate entries before validating (rewrites in place)")
+	crc := flag.Bool("crc", false, "Also check recording.tmcpr against recording.tmcpr.crc32 (reads the whole recording)")
+	fixCRC := flag.Bool("fix-crc", false, "Rewrite a mismatching recording.tmcpr.crc32 after legitimate edits to the recording (implies -crc; refused if the recording looks corrupt)")
+	strict := flag.Bool("strict", false, "Treat warnings as errors")
+	quarantineDir := flag.String("quarantine", "", "Move invalid replays into this directory with a report (see mcpr-quarantine)")
+	notify := flag.String("notify", "", "With -quarantine, POST each report as JSON to this URL")
 	flag.Parse()
+	mcpr.SetStrictMode(*strict)
+
+	var q *quarantine.Store
+	if *quarantineDir != "" {
+		q = &quarantine.Store{Dir: *quarantineDir, Logf: func(format string, args ...any) {
+			// Quarantined replays are reported below; only failed
+			// notifications need telling
+			if strings.HasPrefix(format, "quarantine: notify") {
+				fmt.Fprintf(os.Stderr, "⚠️  "+format+"\n", args...)
+			}
+		}}
+		if *notify != "" {
+			q.Notify = q.Webhook(*notify)
+		}
+	}
 
 	if flag.NArg() == 0 {
 		flag.Usage()
@@ -42,20 +66,55 @@ func main() {
 			fmt.Printf("Validating %s...\n", file)
 		}
 
+		if *clean {
+			removed, err := mcpr.CleanFile(file, file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: clean: %v\n", filepath.Base(file), err)
+				exitCode = 1
+				continue
+			}
+			for _, p := range removed {
+				if !*quiet {
+					fmt.Printf("✅ %s: removed %s\n", filepath.Base(file), p)
+				}
+			}
+		}
+
 		var err error
 		if *quiet {
-			err = mcpr.ValidateFileQuiet(file)
+			_, err = mcpr.ValidatePath(file)
 		} else {
 			err = mcpr.ValidateFile(file)
 		}
+		if err == nil && (*crc || *fixCRC) {
+			err = verifyChecksum(file)
+			var bad *mcpr.ChecksumError
+			if errors.As(err, &bad) {
+				if *fixCRC {
+					err = fixChecksum(file, err, *quiet)
+				} else {
+					err = fmt.Errorf("%w (rerun with -fix-crc if the recording was edited on purpose)", err)
+				}
+			}
+		}
 
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", filepath.Base(file), err)
 			exitCode = 1
+			if q != nil {
+				if r, qerr := q.Put(file, "", err); qerr != nil {
+					fmt.Fprintf(os.Stderr, "❌ %s: quarantine: %v\n", filepath.Base(file), qerr)
+				} else {
+					fmt.Fprintf(os.Stderr, "⚠️  %s: quarantined as %s\n", filepath.Base(file), r.Name)
+				}
+			}
 		} else {
 			if !*quiet {
 				fmt.Printf("✅ %s: valid\n", filepath.Base(file))
 			}
+			if ext, err := mcpr.ReadExtMeta(file); err == nil && ext.Packed {
+				fmt.Fprintf(os.Stderr, "⚠️  %s: has packed frames; run mcpr-transform -flatten before opening it in ReplayMod\n", filepath.Base(file))
+			}
 		}
 	}
 
@@ -67,3 +126,27 @@ func main() {
 
 	os.Exit(exitCode)
 }
+
+// verifyChecksum checks the recording of the replay at path against its
+// stored CRC-32.
+func verifyChecksum(path string) error {
+	r, err := mcpr.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.VerifyChecksum()
+}
+
+// fixChecksum rewrites the stored CRC-32 of the replay at path, whose
+// mismatch was reported as mismatch, and returns nil once it matches.
+func fixChecksum(path string, mismatch error, quiet bool) error {
+	fixed, err := mcpr.FixChecksum(path)
+	if err != nil {
+		return fmt.Errorf("%v; not fixed: %w", mismatch, err)
+	}
+	if fixed != nil && !quiet {
+		fmt.Printf("✅ %s: rewrote recording.tmcpr.crc32 (stored %d, now %d)\n", filepath.Base(path), fixed.Want, fixed.Got)
+	}
+	return nil
+}
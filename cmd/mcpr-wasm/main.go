@@ -0,0 +1,61 @@
+//go:build js && wasm
+
+// Command mcpr-wasm exposes the replay validator to web pages, so a site can
+// check a .mcpr file in the browser before uploading it. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o mcpr.wasm ./cmd/mcpr-wasm
+//
+// and load it with the wasm_exec.js shipped in $(go env GOROOT)/lib/wasm.
+// It defines a global function
+//
+//	mcprValidate(bytes: Uint8Array) -> {valid, error, warnings, meta}
+//
+// where meta is the parsed metaData.json of a valid replay.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"syscall/js"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+func main() {
+	js.Global().Set("mcprValidate", js.FuncOf(validate))
+	select {}
+}
+
+func validate(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeObject {
+		return result(nil, errUsage)
+	}
+	b := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(b, args[0])
+	v, err := mcpr.Validate(bytes.NewReader(b), int64(len(b)))
+	return result(v, err)
+}
+
+var errUsage = errors.New("mcprValidate expects one Uint8Array")
+
+// result converts a validation to a plain JS object by way of JSON.
+func result(v *mcpr.Validation, err error) any {
+	out := map[string]any{"valid": err == nil, "warnings": []string{}}
+	if err != nil {
+		out["error"] = err.Error()
+	}
+	if v != nil {
+		if v.Warnings != nil {
+			out["warnings"] = v.Warnings
+		}
+		if err == nil {
+			out["meta"] = v.Meta
+		}
+	}
+	data, jerr := json.Marshal(out)
+	if jerr != nil {
+		return map[string]any{"valid": false, "error": jerr.Error()}
+	}
+	return js.Global().Get("JSON").Call("parse", string(data))
+}
@@ -0,0 +1,198 @@
+//go:build e2e
+
+// Command e2e is an end-to-end check of the recording path against a real
+// server. It starts a Paper server in Docker, connects a go-mc bot through the
+// proxyrec example, records for a while, and asserts that the replays validate
+// and contain the packet classes every session must have. It also records the
+// same session through the tnze adapter.
+//
+// Requires Docker and network access to pull the server image:
+//
+//	go run -tags e2e ./e2e -duration 1m
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Tnze/go-mc/bot"
+	"github.com/Tnze/go-mc/bot/basic"
+
+	"github.com/reallyoldfogie/mc-replay-go/adapters"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/playback"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/recorder"
+)
+
+// The bot library speaks exactly one protocol version.
+const (
+	mcVersion       = "1.20.2"
+	protocolVersion = 764
+)
+
+// required lists clientbound play packets every recorded session must contain.
+var required = []string{"Login", "LevelChunkWithLight", "PlayerPosition", "KeepAlive", "SetTime"}
+
+func main() {
+	duration := flag.Duration("duration", time.Minute, "How long to record")
+	image := flag.String("image", "itzg/minecraft-server", "Server Docker image")
+	keep := flag.Bool("keep", false, "Keep the output directory")
+	flag.Parse()
+
+	if err := run(*duration, *image, *keep); err != nil {
+		log.Fatalf("FAIL: %v", err)
+	}
+	log.Printf("PASS")
+}
+
+func run(duration time.Duration, image string, keep bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration+10*time.Minute)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "mcpr-e2e-")
+	if err != nil {
+		return err
+	}
+	if keep {
+		log.Printf("output in %s", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	serverPort, proxyPort := freePort(), freePort()
+	name := fmt.Sprintf("mcpr-e2e-%d", os.Getpid())
+	log.Printf("starting %s (%s) on port %d", image, mcVersion, serverPort)
+	if out, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm", "--name", name,
+		"-p", fmt.Sprintf("127.0.0.1:%d:25565", serverPort),
+		"-e", "EULA=TRUE", "-e", "TYPE=PAPER", "-e", "VERSION="+mcVersion,
+		"-e", "ONLINE_MODE=FALSE", "-e", "NETWORK_COMPRESSION_THRESHOLD=256",
+		image).CombinedOutput(); err != nil {
+		return fmt.Errorf("docker run: %v: %s", err, out)
+	}
+	defer exec.Command("docker", "rm", "-f", name).Run()
+
+	upstream := fmt.Sprintf("127.0.0.1:%d", serverPort)
+	if err := waitForServer(ctx, upstream); err != nil {
+		return err
+	}
+
+	// Proxy recorder, built from the example
+	proxyBin := filepath.Join(dir, "proxyrec")
+	if out, err := exec.CommandContext(ctx, "go", "build", "-o", proxyBin, "./examples/proxyrec").CombinedOutput(); err != nil {
+		return fmt.Errorf("build proxyrec: %v: %s", err, out)
+	}
+	proxyOut := filepath.Join(dir, "proxy.mcpr")
+	proxy := exec.CommandContext(ctx, proxyBin,
+		"-listen", fmt.Sprintf("127.0.0.1:%d", proxyPort), "-upstream", upstream,
+		"-out", proxyOut, "-protocol", fmt.Sprint(protocolVersion))
+	proxy.Stdout, proxy.Stderr = os.Stdout, os.Stderr
+	if err := proxy.Start(); err != nil {
+		return fmt.Errorf("start proxyrec: %w", err)
+	}
+	time.Sleep(time.Second)
+
+	// Bot through the proxy, also recording via the tnze adapter
+	adapterOut := filepath.Join(dir, "adapter.mcpr")
+	rec, err := recorder.NewFile(adapterOut, mcpr.Meta{Protocol: protocolVersion, Generator: "mc-replay-go/e2e"})
+	if err != nil {
+		return err
+	}
+	client := bot.NewClient()
+	client.Auth.Name = "e2e_bot"
+	basic.NewPlayer(client, basic.DefaultSettings, basic.EventsListener{})
+	client.Events.AddGeneric(bot.PacketHandler{Priority: 100, F: adapters.PacketFunc(rec, 0x00)})
+	if err := client.JoinServer(fmt.Sprintf("127.0.0.1:%d", proxyPort)); err != nil {
+		return fmt.Errorf("bot join: %w", err)
+	}
+	log.Printf("bot joined, recording for %s", duration)
+	go func() {
+		time.Sleep(duration)
+		_ = client.Close()
+	}()
+	if err := client.HandleGame(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("bot: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		return fmt.Errorf("adapter recording: %w", err)
+	}
+
+	_ = proxy.Process.Signal(syscall.SIGINT)
+	if err := proxy.Wait(); err != nil {
+		return fmt.Errorf("proxyrec: %w", err)
+	}
+
+	// The proxy sees the login phase; the adapter only sees play packets.
+	if err := check(proxyOut, protocol.Login); err != nil {
+		return fmt.Errorf("proxy replay: %w", err)
+	}
+	return check(adapterOut, protocol.Play)
+}
+
+// check validates a replay and asserts it contains every required packet.
+func check(path string, initial protocol.State) error {
+	if err := mcpr.ValidateFile(path); err != nil {
+		return err
+	}
+	table, _ := protocol.Lookup(protocolVersion)
+	seen := map[string]int{}
+	tracker := protocol.NewTracker(table, initial)
+	src, err := playback.FileSource(path)()
+	if err != nil {
+		return err
+	}
+	defer src.(io.Closer).Close()
+	for {
+		pk, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if tracker.Observe(pk.ID) == protocol.Play {
+			seen[table.Name(protocol.Clientbound, protocol.Play, pk.ID)]++
+		}
+	}
+	for _, name := range required {
+		if seen[name] == 0 {
+			return fmt.Errorf("%s: no %s packet recorded", filepath.Base(path), name)
+		}
+	}
+	log.Printf("%s: ok (%d packet types)", filepath.Base(path), len(seen))
+	return nil
+}
+
+// waitForServer polls with status pings until the server answers, which it
+// only does once the world has loaded.
+func waitForServer(ctx context.Context, addr string) error {
+	for {
+		if _, _, err := bot.PingAndList(addr); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server at %s did not start: %w", addr, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func freePort() int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/discord"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/summary"
+)
+
+// Posts finished replays to Discord with their HTML summary.
+//
+//  go run ./examples/discord -webhook https://discord.com/api/webhooks/... session.mcpr
+//
+// With -summary, only writes <replay>.html next to each replay.
+func main() {
+    var webhook, token, channel, username string
+    var maxSize int64
+    var summaryOnly bool
+    flag.StringVar(&webhook, "webhook", os.Getenv("DISCORD_WEBHOOK"), "Webhook URL (default $DISCORD_WEBHOOK)")
+    flag.StringVar(&token, "token", os.Getenv("DISCORD_TOKEN"), "Bot token, used with -channel (default $DISCORD_TOKEN)")
+    flag.StringVar(&channel, "channel", "", "Channel id for bot delivery")
+    flag.StringVar(&username, "username", "Replays", "Webhook display name")
+    flag.Int64Var(&maxSize, "max-size", discord.DefaultMaxFileSize, "Attach replays up to this many bytes")
+    flag.BoolVar(&summaryOnly, "summary", false, "Only write the HTML summaries")
+    flag.Parse()
+    if flag.NArg() == 0 {
+        fmt.Fprintf(os.Stderr, "Usage: %s [options] <replay.mcpr>...\n", os.Args[0])
+        flag.PrintDefaults()
+        os.Exit(1)
+    }
+
+    c := &discord.Client{WebhookURL: webhook, BotToken: token, ChannelID: channel, Username: username, MaxFileSize: maxSize}
+    failed := false
+    for _, path := range flag.Args() {
+        var err error
+        if summaryOnly {
+            err = writeSummary(path)
+        } else {
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+            err = c.Deliver(ctx, path)
+            cancel()
+        }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+            failed = true
+            continue
+        }
+        fmt.Printf("✅ %s\n", path)
+    }
+    if failed {
+        os.Exit(1)
+    }
+}
+
+func writeSummary(path string) error {
+    s, err := summary.Build(path)
+    if err != nil {
+        return err
+    }
+    f, err := os.Create(path + ".html")
+    if err != nil {
+        return err
+    }
+    if err := s.WriteHTML(f); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
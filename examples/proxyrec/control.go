@@ -0,0 +1,464 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "log"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/netframe"
+    mcproto "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// login is shared by the two directions of a proxied session. The
+// server->client parser reports when login succeeded and whether compression
+// was enabled by then, so the client->server watcher can decode what follows.
+type login struct {
+    once       sync.Once
+    done       chan struct{}
+    ok         bool
+    compressed bool
+
+    // onPluginRequest, if set, receives the channel of every login plugin
+    // request (CustomQuery) the server sends
+    onPluginRequest func(channel string)
+}
+
+func newLogin() *login {
+    return &login{done: make(chan struct{})}
+}
+
+// finish records a successful login.
+func (l *login) finish(compressed bool) {
+    l.once.Do(func() {
+        l.ok, l.compressed = true, compressed
+        close(l.done)
+    })
+}
+
+// pluginRequest handles the payload of a login plugin request:
+// message id (VarInt), channel (String), data.
+func (l *login) pluginRequest(payload []byte) {
+    br := bytes.NewReader(payload)
+    if _, err := readVarInt(br); err != nil || l.onPluginRequest == nil {
+        return
+    }
+    if ch, _, err := decodeString(payload[len(payload)-br.Len():]); err == nil {
+        l.onPluginRequest(ch)
+    }
+}
+
+// abort releases waiters if the server->client parser stops before login.
+func (l *login) abort() {
+    l.once.Do(func() { close(l.done) })
+}
+
+// recording is the replay of one proxied session, shared with the chat
+// command watcher and the RCON console.
+type recording struct {
+    mu     sync.Mutex
+    w      *mcpr.Writer
+    out    string
+    start  time.Time
+    stop   func() // ends recording; forwarding continues
+    closed bool
+
+    stopped atomic.Bool // stop was called
+    clips  [][2]uint32 // [start, end] ms windows written as separate replays after close
+
+    // A recording continues in further replays at server switches
+    // (-split-servers) and on "rotate" or "save". Only the parser changes
+    // these (under mu), so it reads them without locking.
+    first    string      // name of the first replay, numbered by segmentName
+    parts    int         // replays started so far
+    base     uint32      // session time in ms at which the current replay began
+    rotating atomic.Bool // a command asked to continue in a new replay
+
+    modLoader string // set once a Forge/FML handshake is seen
+}
+
+// setModLoader flags the recording as made with a modded client. The
+// handshake version (e.g. "FML3") replaces the generic "forge" seen on login
+// plugin channels, whichever arrives first.
+func (r *recording) setModLoader(name string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.closed || r.modLoader == name || (r.modLoader != "" && name == "forge") {
+        return
+    }
+    r.modLoader = name
+    r.w.SetModLoader(name)
+    log.Printf("%s: modded connection (%s)", r.out, name)
+}
+
+// onPluginRequest flags the recording as modded when the server negotiates
+// over a Forge login plugin channel.
+func (r *recording) onPluginRequest(channel string) {
+    if forgeChannel(channel) {
+        r.setModLoader("forge")
+    }
+}
+
+// mark adds a marker at the current recording time.
+func (r *recording) mark(name string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if !r.closed {
+        r.w.AddMarker(mcpr.Marker{Time: int(r.now()), Name: name})
+    }
+}
+
+// split finalizes the current replay and continues the recording in w,
+// written to out, from base, a session time in ms, on. It returns the name
+// of the finalized replay.
+func (r *recording) split(w *mcpr.Writer, out string, base uint32) (string, error) {
+    r.mu.Lock()
+    old := &recording{w: r.w, out: r.out, clips: r.clips}
+    if r.modLoader != "" {
+        w.SetModLoader(r.modLoader)
+    }
+    r.start = r.start.Add(time.Duration(base-r.base) * time.Millisecond)
+    r.w, r.out, r.base, r.clips = w, out, base, nil
+    r.parts++
+    r.mu.Unlock()
+    return old.out, old.close()
+}
+
+// continueIn finalizes the current replay and continues the recording at
+// session time ts in the next numbered replay, which begins with prelude at
+// time 0. why names the occasion for the log. If the new replay cannot be
+// created, the recording continues in the current one and continueIn
+// returns false.
+func (r *recording) continueIn(prelude []mcpr.Packet, ts uint32, cfg config, why string) bool {
+    out := segmentName(r.first, r.parts+1)
+    w, err := newReplay(out, cfg)
+    if err == nil {
+        for _, p := range prelude {
+            if err = w.WritePacket(0, p.ID, p.Payload); err != nil {
+                _ = w.Close()
+                break
+            }
+        }
+    }
+    if err != nil {
+        log.Printf("%s: %v; continuing in %s", why, err, r.out)
+        return false
+    }
+    log.Printf("%s: continuing in %s", why, out)
+    old, err := r.split(w, out, ts)
+    if err != nil {
+        log.Printf("close writer: %v", err)
+    } else {
+        log.Printf("finalized %s", old)
+        deliver(old, cfg)
+    }
+    return true
+}
+
+// now returns the current recording time in ms.
+func (r *recording) now() uint32 {
+    return uint32(time.Since(r.start).Milliseconds())
+}
+
+// close finalizes the replay, then writes the requested clips.
+func (r *recording) close() error {
+    r.mu.Lock()
+    r.closed = true
+    clips := r.clips
+    err := r.w.Close()
+    r.mu.Unlock()
+    if err != nil {
+        return err
+    }
+    ext := filepath.Ext(r.out)
+    for i, c := range clips {
+        name := fmt.Sprintf("%s-clip%d%s", strings.TrimSuffix(r.out, ext), i+1, ext)
+        p, err := transform.ParsePipeline(fmt.Sprintf("trim(%d,%d)", c[0], c[1]))
+        if err == nil {
+            _, err = transform.RewriteFile(r.out, name, p, transform.Options{})
+        }
+        if err != nil {
+            log.Printf("clip %s: %v", name, err)
+            continue
+        }
+        log.Printf("wrote clip %s", name)
+    }
+    return nil
+}
+
+// command executes a control command such as "mark Boss fight", "clip 5m" or
+// "stop" and returns a reply for the operator.
+func (r *recording) command(args []string) string {
+    if len(args) == 0 {
+        return "usage: mark [name] | clip <duration> | save [duration] | rotate | stop | status"
+    }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.closed {
+        return r.out + ": already finalized"
+    }
+    switch args[0] {
+    case "status":
+        return fmt.Sprintf("%s: recording for %s", r.out, time.Since(r.start).Round(time.Second))
+    case "mark":
+        name := strings.Join(args[1:], " ")
+        r.w.AddMarker(mcpr.Marker{Time: int(r.now()), Name: name})
+        return fmt.Sprintf("%s: marker %q at %s", r.out, name, time.Since(r.start).Round(time.Second))
+    case "clip":
+        if len(args) != 2 {
+            return "usage: clip <duration>, e.g. clip 5m"
+        }
+        d, err := time.ParseDuration(args[1])
+        if err != nil || d <= 0 {
+            return fmt.Sprintf("invalid duration %q", args[1])
+        }
+        end := r.now()
+        start := uint32(0)
+        if ms := uint32(d.Milliseconds()); ms < end {
+            start = end - ms
+        }
+        r.clips = append(r.clips, [2]uint32{start, end})
+        return fmt.Sprintf("%s: last %s will be saved as clip %d when the recording ends", r.out, d, len(r.clips))
+    case "stop":
+        r.stop()
+        return r.out + ": stopping"
+    case "rotate":
+        if len(args) != 1 {
+            return "usage: rotate"
+        }
+        r.rotating.Store(true)
+        return fmt.Sprintf("%s: finalizing, the recording continues in %s", r.out, segmentName(r.first, r.parts+1))
+    case "save":
+        // Finalize now what has been recorded, or the last d of it as a
+        // clip, by rotating: the finished replay and its clips are written
+        // while the session goes on
+        if len(args) > 2 {
+            return "usage: save [duration], e.g. save 5m"
+        }
+        what := r.out
+        if len(args) == 2 {
+            d, err := time.ParseDuration(args[1])
+            if err != nil || d <= 0 {
+                return fmt.Sprintf("invalid duration %q", args[1])
+            }
+            end := r.now()
+            start := uint32(0)
+            if ms := uint32(d.Milliseconds()); ms < end {
+                start = end - ms
+            }
+            r.clips = append(r.clips, [2]uint32{start, end})
+            ext := filepath.Ext(r.out)
+            what = fmt.Sprintf("the last %s as %s-clip%d%s", d, strings.TrimSuffix(r.out, ext), len(r.clips), ext)
+        }
+        r.rotating.Store(true)
+        return fmt.Sprintf("%s: saving %s now, the recording continues in %s", r.out, what, segmentName(r.first, r.parts+1))
+    }
+    return fmt.Sprintf("unknown command %q", args[0])
+}
+
+// runCommand executes a chat command from player and logs the reply.
+func (r *recording) runCommand(player string, args []string) {
+    log.Printf("control: %s: %s", player, r.command(args))
+}
+
+// registry tracks the recordings in progress for the RCON console.
+type registry struct {
+    mu   sync.Mutex
+    recs map[*recording]bool
+}
+
+var active = &registry{recs: map[*recording]bool{}}
+
+func (g *registry) add(r *recording) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    g.recs[r] = true
+}
+
+func (g *registry) remove(r *recording) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    delete(g.recs, r)
+}
+
+// recording reports whether path is being recorded.
+func (g *registry) recording(path string) bool {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    for r := range g.recs {
+        if r.out == path {
+            return true
+        }
+    }
+    return false
+}
+
+// stopAll stops every recording in progress.
+func (g *registry) stopAll() {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    for r := range g.recs {
+        r.stop()
+    }
+}
+
+// command runs an RCON command against every recording in progress.
+func (g *registry) command(cmd string) string {
+    g.mu.Lock()
+    recs := make([]*recording, 0, len(g.recs))
+    for r := range g.recs {
+        recs = append(recs, r)
+    }
+    g.mu.Unlock()
+    if len(recs) == 0 {
+        return "not recording"
+    }
+    replies := make([]string, 0, len(recs))
+    for _, r := range recs {
+        replies = append(replies, r.command(strings.Fields(cmd)))
+    }
+    return strings.Join(replies, "\n")
+}
+
+// clientWatch configures watchClient.
+type clientWatch struct {
+    onHandshake func(addr string) // server address from the handshake, if set
+
+    // Chat commands; disabled when table is nil
+    table  *mcproto.Table
+    allow  map[string]bool
+    prefix string
+    handle func(player string, args []string)
+}
+
+// watchClient reads client->server traffic from r. It reports the handshake's
+// server address, then calls handle with the arguments of every chat message
+// starting with prefix sent by an allowed player. Chat commands need the
+// protocol's packet table to find chat packets. Commands stay visible in chat:
+// dropping a signed chat message would break the client's chat chain.
+func watchClient(r io.Reader, lg *login, cw clientWatch) error {
+    // Read frames eagerly so forwarding never waits on the login handshake
+    frames := make(chan []byte, 256)
+    readErr := make(chan error, 1)
+    go func() {
+        defer close(frames)
+        br := bufio.NewReader(r)
+        for {
+            n, err := readVarInt(br)
+            if err != nil {
+                readErr <- err
+                return
+            }
+            if n <= 0 || n > 2<<20 {
+                readErr <- fmt.Errorf("invalid frame length %d", n)
+                return
+            }
+            frame := make([]byte, n)
+            if _, err := io.ReadFull(br, frame); err != nil {
+                readErr <- err
+                return
+            }
+            frames <- frame
+        }
+    }()
+    drain := func() error {
+        for range frames {
+        }
+        return <-readErr
+    }
+
+    // Handshake, then login start (Hello) with the player name, both sent
+    // before compression can be enabled
+    handshake, ok := <-frames
+    if !ok {
+        return <-readErr
+    }
+    // Handshake: protocol (VarInt), server address (String), port, next state
+    if id, payload, err := decodeFrame(handshake, false); err == nil && id == 0 && cw.onHandshake != nil {
+        br := bytes.NewReader(payload)
+        if _, err := readVarInt(br); err == nil {
+            if addr, _, err := decodeString(payload[len(payload)-br.Len():]); err == nil {
+                cw.onHandshake(addr)
+            }
+        }
+    }
+    if cw.table == nil {
+        return drain()
+    }
+    hello, ok := <-frames
+    if !ok {
+        return <-readErr
+    }
+    id, payload, err := decodeFrame(hello, false)
+    if err != nil || id != 0 {
+        return drain()
+    }
+    player, _, err := decodeString(payload)
+    if err != nil || !cw.allow[player] {
+        return drain()
+    }
+    <-lg.done
+    if !lg.ok {
+        return drain()
+    }
+    log.Printf("control: accepting %q commands from %s", cw.prefix, player)
+
+    state := mcproto.Login
+    for frame := range frames {
+        id, payload, err := decodeFrame(frame, lg.compressed)
+        if err != nil {
+            continue
+        }
+        switch name := cw.table.Name(mcproto.Serverbound, state, id); {
+        case state == mcproto.Login && name == "LoginAcknowledged":
+            state = mcproto.Configuration
+        case state == mcproto.Configuration && name == "FinishConfiguration":
+            state = mcproto.Play
+        case state == mcproto.Play && name == "ConfigurationAcknowledged":
+            state = mcproto.Configuration
+        case state == mcproto.Play && name == "Chat":
+            msg, _, err := decodeString(payload)
+            if err != nil || (msg != cw.prefix && !strings.HasPrefix(msg, cw.prefix+" ")) {
+                continue
+            }
+            cw.handle(player, strings.Fields(msg)[1:])
+        }
+    }
+    return <-readErr
+}
+
+// decodeFrame splits a frame into packet id and payload.
+func decodeFrame(frame []byte, compressed bool) (int32, []byte, error) {
+    return netframe.DecodePacket(frame, frameThreshold(compressed))
+}
+
+// frameThreshold returns the netframe threshold of frames sent with or
+// without compression, whose threshold is unknown.
+func frameThreshold(compressed bool) int {
+    if compressed {
+        return 0
+    }
+    return -1
+}
+
+// decodeString reads a protocol string and returns it with the remaining bytes.
+func decodeString(b []byte) (string, []byte, error) {
+    br := bytes.NewReader(b)
+    n, err := readVarInt(br)
+    if err != nil {
+        return "", nil, err
+    }
+    rest := b[len(b)-br.Len():]
+    if n < 0 || int(n) > len(rest) {
+        return "", nil, fmt.Errorf("string length %d out of range", n)
+    }
+    return string(rest[:n]), rest[n:], nil
+}
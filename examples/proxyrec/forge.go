@@ -0,0 +1,34 @@
+package main
+
+import "strings"
+
+// Forge clients mark their handshake by appending a NUL-separated marker to
+// the server address: "\x00FML\x00" (1.7–1.12), "\x00FML2\x00" (1.13–1.17),
+// "\x00FML3\x00" (1.18–1.20.1) and "\x00FORGE" (1.20.2+).
+var forgeMarkers = []struct{ marker, name string }{
+    {"\x00FML3\x00", "FML3"},
+    {"\x00FML2\x00", "FML2"},
+    {"\x00FML\x00", "FML"},
+    {"\x00FORGE", "FORGE"},
+}
+
+// forgeHandshake returns the Forge handshake version named by the server
+// address of a handshake, or "" for vanilla clients.
+func forgeHandshake(addr string) string {
+    for _, m := range forgeMarkers {
+        if strings.Contains(addr, m.marker) {
+            return m.name
+        }
+    }
+    return ""
+}
+
+// forgeChannel reports whether a login plugin channel belongs to the Forge
+// handshake, which servers use to negotiate the mod list before play.
+func forgeChannel(channel string) bool {
+    switch channel {
+    case "fml:loginwrapper", "fml:handshake", "forge:login", "forge:handshake":
+        return true
+    }
+    return false
+}
@@ -3,7 +3,6 @@ package main
 import (
     "bufio"
     "bytes"
-    "compress/zlib"
     "context"
     "errors"
     "flag"
@@ -12,12 +11,24 @@ import (
     "log"
     "net"
     "os"
-    "os/signal"
+    "path/filepath"
+    "strings"
     "syscall"
     "sync"
     "time"
 
     "github.com/reallyoldfogie/mc-replay-go/mcpr"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/debugserver"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/discord"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/diskguard"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/lifecycle"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/membudget"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/netframe"
+    mcproto "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/rcon"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/recorder"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/replayserver"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/schedule"
 )
 
 // Minimal TCP proxy that records server->client Minecraft packets into an MCPR file.
@@ -26,95 +37,782 @@ import (
 // - Only handles a single client connection and exits after it closes.
 // - Compression support is optional and limited: it can auto-detect SetCompression (login id=0x03) for many versions.
 // - Does not attempt protocol translation; it simply splits frames and records packet id + payload.
+//
+// With -mirror, the recording is also mirrored live to spectator clients (see replayserver.Relay).
+// With -schedule, the proxy keeps running and records only connections made
+// during the configured windows, one file per connection.
+// With -control-player, that player can type "!replay mark <name>",
+// "!replay save", "!replay rotate" or "!replay stop" in chat to add a marker,
+// finalize the replay so far and continue in a new one, or finalize the
+// recording; -rcon accepts the same commands from RCON consoles.
+// With -transfer-via, server transfers (1.20.5+) continue the same replay;
+// with -rejoin-wait, so does a client reconnecting after the server dropped it.
+// Behind Velocity or BungeeCord, switches between backend servers are marked
+// in the replay; -split-servers writes one replay per backend server instead.
+
+// packetWriter is implemented by *mcpr.Writer and *replayserver.Relay.
+type packetWriter interface {
+    WritePacket(ts uint32, packetID int32, payload []byte) error
+}
+
+// stateSetter is implemented by packet writers that need the connection
+// state of each packet parseAndRecord writes.
+type stateSetter interface {
+    setState(st mcproto.State)
+}
+
+// teeWriter writes every packet to the replay and, best-effort, to a mirror.
+// Only the parser writes through it, so it can read r.w without locking.
+type teeWriter struct {
+    r      *recording
+    cfg    config
+    mirror *replayserver.Relay
+    seg    *segmenter // set with -split-servers
+
+    // prelude holds the packets up to and including the first one in play
+    // (join game), with which replays continued by "rotate" or "save" begin
+    state   mcproto.State
+    prelude []mcpr.Packet
+    inPlay  bool
+}
+
+// setState tells the writer the connection state of the next packet.
+func (t *teeWriter) setState(st mcproto.State) {
+    t.state = st
+}
+
+func (t *teeWriter) WritePacket(ts uint32, packetID int32, payload []byte) error {
+    if t.mirror != nil {
+        _ = t.mirror.WritePacket(ts, packetID, payload)
+    }
+    if t.seg != nil {
+        t.seg.observe(packetID, payload)
+    }
+    if !t.inPlay {
+        t.prelude = append(t.prelude, mcpr.Packet{ID: packetID, Payload: append([]byte(nil), payload...)})
+        t.inPlay = t.state == mcproto.Play
+    } else if t.r.rotating.CompareAndSwap(true, false) {
+        // A rotation is done between play packets, so the new replay can
+        // pick up after its prelude. It starts without the world state sent
+        // before (chunks, entities); the client sees what arrives from now on.
+        t.r.continueIn(t.prelude, ts, t.cfg, "rotate")
+    }
+    return t.r.w.WritePacket(ts-t.r.base, packetID, payload)
+}
+
+// serverSwitch marks the switch or, with -split-servers, starts a new replay.
+func (t *teeWriter) serverSwitch(ts uint32) bool {
+    if t.seg == nil {
+        t.r.mark("Server switch")
+        return true
+    }
+    return t.seg.next(t.r, ts)
+}
+
+// config holds the proxy settings shared by all sessions.
+type config struct {
+    upstream         string
+    protocol         int
+    generator        string
+    assumeNoCompress bool
+    guessCompress    bool
+    forceThreshold   int
+    mirror           string
+    mirrorDelay      time.Duration
+    memory           *membudget.Budget // bounds buffered packets, e.g. the mirror's history
+    dimensions       bool
+    latency          bool
+    heartbeat        time.Duration
+    sampleRate       int // thin out recordings above this many packets/s
+    controlPlayers   []string
+    controlPrefix    string
+    rcon             string
+    rconPassword     string
+    discordWebhook   string
+    minFree          uint64 // do not start recordings below this much free space
+    transferVia      string        // follow transfers by redirecting clients to this address
+    transferWait     time.Duration // how long a recording waits for its transferred client
+    rejoinWait       time.Duration // how long a recording waits for a client whose server connection dropped
+    splitServers     bool          // one replay per backend server behind a network proxy
+    names            *recorder.NameTemplate // names each session's replay, if -out is a template
+    compression      mcpr.Compression       // of recording.tmcpr
+    writeBuffer      int                    // see mcpr.WithBufferSize
+}
+
+// diskFlags configure the disk-space guard.
+type diskFlags struct {
+    warn, clean, stop string
+    keep              int
+    tombstones        bool
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
 
 func main() {
-    var listen, upstream, out string
-    var protocol int
-    var generator string
-    var assumeNoCompress bool
-    var guessCompress bool
-    var forceThreshold int
+    var listen, out string
+    var cfg config
+    var schedules, controlPlayers listFlag
+    var disk diskFlags
+    var maxMemory, debugAddr, writeBuffer string
+    var level int
 
     flag.StringVar(&listen, "listen", ":25566", "Local listen address (proxy)")
-    flag.StringVar(&upstream, "upstream", "127.0.0.1:25565", "Upstream Minecraft server address")
-    flag.StringVar(&out, "out", "proxy.mcpr", "Output .mcpr path")
-    flag.IntVar(&protocol, "protocol", 754, "MC network protocol number (e.g. 754)")
-    flag.StringVar(&generator, "generator", "mc-replay-go/proxyrec", "Generator string for metadata")
-    flag.BoolVar(&assumeNoCompress, "no-compress", false, "Assume server never enables compression")
-    flag.BoolVar(&guessCompress, "guess-compress", true, "Detect login SetCompression and enable compression handling")
-    flag.IntVar(&forceThreshold, "compression-threshold", -1, "Force compression enabled with given threshold (>=0)")
+    flag.StringVar(&cfg.upstream, "upstream", "127.0.0.1:25565", "Upstream Minecraft server address")
+    flag.StringVar(&out, "out", "proxy.mcpr", "Output .mcpr path, or a name template for each session's replay (e.g. replays/{{.Player}}/{{.Seq}}.mcpr)")
+    flag.IntVar(&cfg.protocol, "protocol", 754, "MC network protocol number (e.g. 754)")
+    flag.StringVar(&cfg.generator, "generator", "mc-replay-go/proxyrec", "Generator string for metadata")
+    flag.BoolVar(&cfg.assumeNoCompress, "no-compress", false, "Assume server never enables compression")
+    flag.BoolVar(&cfg.guessCompress, "guess-compress", true, "Detect login SetCompression and enable compression handling")
+    flag.IntVar(&cfg.forceThreshold, "compression-threshold", -1, "Force compression enabled with given threshold (>=0)")
+    flag.IntVar(&level, "level", 0, "Deflate level of the recording, 1 (least CPU) to 9 (smallest); 0 for the default, -1 to store it uncompressed")
+    flag.StringVar(&writeBuffer, "write-buffer", "", "Write replays in blocks of this size (e.g. 1MiB), for network filesystems")
+    flag.StringVar(&cfg.mirror, "mirror", "", "Also mirror the recording live to spectator clients on this address")
+    flag.DurationVar(&cfg.mirrorDelay, "mirror-delay", 0, "Delay of the live mirror (e.g. 30s)")
+    flag.StringVar(&debugAddr, "debug-addr", "", "Serve pprof and expvar diagnostics on this address (e.g. localhost:6060)")
+    flag.StringVar(&maxMemory, "max-memory", "", "Cap memory of buffered packets (e.g. 512MiB); the mirror drops its oldest packets beyond it")
+    flag.BoolVar(&cfg.dimensions, "dimensions", false, "Track dimension changes into dimensions.json (needs a known protocol)")
+    flag.BoolVar(&cfg.latency, "latency", false, "Record per-packet arrival lag into latency.bin (needs a known protocol)")
+    flag.DurationVar(&cfg.heartbeat, "heartbeat", 0, "Insert a time update after this long without packets (e.g. 5s, needs a known protocol)")
+    flag.IntVar(&cfg.sampleRate, "sample-rate", 0, "Under sustained load above this many packets/s, drop particles, then decimate movement, then drop sounds (needs a known protocol)")
+    flag.Var(&schedules, "schedule", "Only record during this window (repeatable), e.g. \"0 20 * * FRI 3h\" or \"2026-10-20T20:00/3h\"")
+    flag.Var(&controlPlayers, "control-player", "Accept chat commands from this player (repeatable)")
+    flag.StringVar(&cfg.controlPrefix, "control-prefix", "!replay", "Chat prefix of control commands")
+    flag.StringVar(&cfg.rcon, "rcon", "", "Accept RCON console commands on this address (mark, clip, stop, status)")
+    flag.StringVar(&cfg.rconPassword, "rcon-password", "", "RCON password (required with -rcon)")
+    flag.StringVar(&cfg.discordWebhook, "discord-webhook", "", "Post finalized replays with a summary to this Discord webhook")
+    flag.StringVar(&disk.warn, "warn-free", "", "Warn when free disk space drops below this size (e.g. 5GiB)")
+    flag.StringVar(&disk.clean, "clean-free", "", "Delete the oldest finished recordings while free space is below this size")
+    flag.IntVar(&disk.keep, "keep", 0, "With -clean-free, always keep this many newest recordings")
+    flag.BoolVar(&disk.tombstones, "tombstones", false, "With -clean-free, leave a catalog tombstone for each deleted recording (purge with mcpr-catalog -purge)")
+    flag.StringVar(&disk.stop, "min-free", "", "Finalize recordings when free space drops below this size")
+    flag.StringVar(&cfg.transferVia, "transfer-via", "", "Follow server transfers (1.20.5+) in the same replay; host:port clients reach this proxy at")
+    flag.DurationVar(&cfg.transferWait, "transfer-wait", 30*time.Second, "How long to wait for a transferred client to reconnect")
+    flag.BoolVar(&cfg.splitServers, "split-servers", false, "Behind Velocity/BungeeCord, write one replay per backend server instead of marking switches")
+    flag.DurationVar(&cfg.rejoinWait, "rejoin-wait", 0, "Continue the replay if the client reconnects within this long after the server connection dropped (e.g. 2m)")
     flag.Parse()
+    cfg.controlPlayers = controlPlayers
+    cfg.memory = membudget.New(0)
+    if maxMemory != "" {
+        n, err := diskguard.ParseSize(maxMemory)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        cfg.memory = membudget.New(int64(n))
+    }
+    if writeBuffer != "" {
+        n, err := diskguard.ParseSize(writeBuffer)
+        if err != nil {
+            log.Fatalf("-write-buffer: %v", err)
+        }
+        cfg.writeBuffer = int(n)
+    }
+    switch {
+    case level == -1:
+        cfg.compression.Store = true
+    case level < 0 || level > 9:
+        log.Fatalf("-level: want 1-9, 0 or -1, got %d", level)
+    default:
+        cfg.compression.Level = level
+    }
+
+    if strings.Contains(out, "{{") {
+        var err error
+        if cfg.names, err = recorder.ParseNameTemplate(out); err != nil {
+            log.Fatalf("-out: %v", err)
+        }
+    }
+
+    if cfg.transferVia != "" {
+        if _, _, err := splitPort(cfg.transferVia); err != nil {
+            log.Fatalf("-transfer-via: %v", err)
+        }
+        if !supportsTransfers(cfg.protocol) {
+            log.Fatalf("-transfer-via: transfers are not supported for protocol %d", cfg.protocol)
+        }
+    }
+
+    if cfg.splitServers && !supportsSwitches(cfg.protocol) {
+        log.Fatalf("-split-servers: server switches cannot be detected for protocol %d", cfg.protocol)
+    }
+
+    var sched *schedule.Schedule
+    if len(schedules) > 0 {
+        var err error
+        if sched, err = schedule.Parse(schedules...); err != nil {
+            log.Fatalf("%v", err)
+        }
+        if cfg.mirror != "" {
+            log.Fatalf("-mirror cannot be combined with -schedule")
+        }
+    }
 
     ln, err := net.Listen("tcp", listen)
     if err != nil {
         log.Fatalf("listen: %v", err)
     }
-    log.Printf("listening on %s, proxying to %s", listen, upstream)
+    log.Printf("listening on %s, proxying to %s", listen, cfg.upstream)
 
-    conn, err := ln.Accept()
-    if err != nil {
+    // Graceful shutdown on SIGINT/SIGTERM: sessions end, recordings are
+    // finalized, then pending deliveries get time to finish
+    life = lifecycle.New(context.Background(), os.Interrupt, syscall.SIGTERM)
+    ctx := life.Context()
+    go func() { <-ctx.Done(); _ = ln.Close() }()
+
+    if debugAddr != "" {
+        life.Go(func(ctx context.Context) {
+            if err := debugserver.ListenAndServe(ctx, debugAddr); err != nil {
+                log.Printf("debug server: %v", err)
+            }
+        })
+        log.Printf("diagnostics on http://%s/debug/pprof/", debugAddr)
+    }
+
+    if cfg.rcon != "" {
+        srv := &rcon.Server{Password: cfg.rconPassword, Handler: active.command}
+        life.Go(func(ctx context.Context) {
+            if err := srv.ListenAndServe(ctx, cfg.rcon); err != nil {
+                log.Fatalf("rcon: %v", err)
+            }
+        })
+        log.Printf("rcon console on %s", cfg.rcon)
+    }
+
+    if disk.stop != "" {
+        if cfg.minFree, err = diskguard.ParseSize(disk.stop); err != nil {
+            log.Fatalf("%v", err)
+        }
+    }
+    if guard, err := newGuard(disk, out, cfg.names); err != nil {
+        log.Fatalf("%v", err)
+    } else if guard != nil {
+        life.Go(func(ctx context.Context) { _ = guard.Run(ctx) })
+    }
+
+    if sched != nil {
+        runScheduled(ctx, ln, sched, out, cfg)
+    } else if conn, err := ln.Accept(); err == nil {
+        if cfg.transferVia == "" && cfg.rejoinWait <= 0 {
+            _ = ln.Close()
+        } else {
+            go acceptReturning(ln, cfg)
+        }
+        life.Go(func(ctx context.Context) {
+            proxySession(ctx, ctx, conn, out, cfg, nil)
+            life.Stop()
+        })
+        <-ctx.Done()
+    } else if ctx.Err() == nil {
         log.Fatalf("accept: %v", err)
     }
+    if err := life.Shutdown(); err != nil {
+        log.Printf("shutdown: %v", err)
+    }
+}
+
+// life coordinates shutdown: sessions, finalizing recordings, deliveries.
+var life *lifecycle.Lifecycle
+
+// newGuard builds the disk-space guard for the directory of out, or returns
+// nil if no thresholds are set. With a name template, it covers the files
+// the template names.
+func newGuard(f diskFlags, out string, names *recorder.NameTemplate) (*diskguard.Guard, error) {
+    g := &diskguard.Guard{
+        Dir:    filepath.Dir(out),
+        OnStop: active.stopAll,
+    }
+    ext := filepath.Ext(out)
+    g.Retention = diskguard.Retention{
+        Pattern: strings.TrimSuffix(filepath.Base(out), ext) + "*" + ext,
+        Keep:       f.keep,
+        Protect:    active.recording,
+        Tombstones: f.tombstones,
+    }
+    if names != nil {
+        g.Dir, g.Retention.Pattern = names.Glob()
+        if err := os.MkdirAll(g.Dir, 0o755); err != nil {
+            return nil, err
+        }
+    }
+    for _, r := range []struct {
+        size   string
+        action diskguard.Action
+    }{{f.warn, diskguard.Warn}, {f.clean, diskguard.DeleteOldest}, {f.stop, diskguard.Stop}} {
+        if r.size == "" {
+            continue
+        }
+        n, err := diskguard.ParseSize(r.size)
+        if err != nil {
+            return nil, err
+        }
+        g.Rules = append(g.Rules, diskguard.Rule{Below: n, Action: r.action})
+    }
+    if len(g.Rules) == 0 {
+        return nil, nil
+    }
+    if _, err := g.Check(); err != nil {
+        return nil, err
+    }
+    return g, nil
+}
+
+// runScheduled keeps proxying connections until ctx is done. Connections that
+// begin inside a schedule window are recorded until they end or the window
+// closes, whichever is first; the connection itself stays up. Sessions that
+// began outside a window are only forwarded, since a replay must start with
+// the login phase.
+func runScheduled(ctx context.Context, ln net.Listener, sched *schedule.Schedule, out string, cfg config) {
+    if w, ok := sched.Active(time.Now()); ok {
+        log.Printf("recording window open: %s", w)
+    } else if w, ok := sched.Next(time.Now()); ok {
+        log.Printf("next recording window: %s", w)
+    } else {
+        log.Printf("no upcoming recording windows; forwarding only")
+    }
+
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        now := time.Now()
+        if h := handoffs.claim(conn); h != nil {
+            life.Go(func(ctx context.Context) {
+                proxySession(ctx, ctx, conn, "", cfg, h)
+            })
+            continue
+        }
+        life.Go(func(ctx context.Context) {
+            win, ok := sched.Active(now)
+            if !ok {
+                proxySession(ctx, nil, conn, "", cfg, nil)
+                return
+            }
+            recCtx, cancel := context.WithDeadline(ctx, win.End)
+            defer cancel()
+            name := out
+            if cfg.names == nil {
+                name = scheduledName(out, now)
+            }
+            proxySession(ctx, recCtx, conn, name, cfg, nil)
+        })
+    }
+}
+
+// scheduledName inserts the session start time into out:
+// proxy.mcpr -> proxy-20261020-200512.mcpr.
+func scheduledName(out string, t time.Time) string {
+    ext := filepath.Ext(out)
+    return strings.TrimSuffix(out, ext) + t.Format("-20060102-150405") + ext
+}
+
+// sessionPlayer peeks at the handshake and login start a client sends first
+// and returns the player name, or "" for status pings and clients that send
+// nothing in time. The bytes stay buffered in br for forwarding.
+func sessionPlayer(conn net.Conn, br *bufio.Reader) string {
+    _ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+    defer conn.SetReadDeadline(time.Time{})
+    off := 0
+    next := func() ([]byte, bool) {
+        var n, shift int
+        for i := 0; ; i++ {
+            b, err := br.Peek(off + i + 1)
+            if err != nil || i == 3 {
+                return nil, false
+            }
+            c := b[off+i]
+            n |= int(c&0x7F) << shift
+            shift += 7
+            if c&0x80 == 0 {
+                off += i + 1
+                break
+            }
+        }
+        if n <= 0 || n > 1<<16 {
+            return nil, false
+        }
+        b, err := br.Peek(off + n)
+        if err != nil {
+            return nil, false
+        }
+        off += n
+        return b[off-n : off], true
+    }
+    // Handshake: protocol (VarInt), server address (String), port, next state
+    frame, ok := next()
+    if !ok {
+        return ""
+    }
+    id, payload, err := decodeFrame(frame, false)
+    if err != nil || id != 0 {
+        return ""
+    }
+    pr := bytes.NewReader(payload)
+    if _, err := readVarInt(pr); err != nil {
+        return ""
+    }
+    _, rest, err := decodeString(payload[len(payload)-pr.Len():])
+    if err != nil || len(rest) < 3 || rest[2] != 2 && rest[2] != 3 { // next state login or transfer
+        return ""
+    }
+    // Login start (Hello): name (String), ...
+    if frame, ok = next(); !ok {
+        return ""
+    }
+    if id, payload, err = decodeFrame(frame, false); err != nil || id != 0 {
+        return ""
+    }
+    player, _, err := decodeString(payload)
+    if err != nil {
+        return ""
+    }
+    return player
+}
+
+// proxySession forwards conn to the upstream server until either side closes
+// or ctx is done. If out is set, server->client packets are recorded to out,
+// or to the name cfg.names gives the session, until the connection ends or
+// recCtx is done, and the replay is finalized.
+// If h is set, conn is a client coming back after a transfer or a dropped
+// server connection: it is forwarded to h's target and continues h's
+// recording.
+func proxySession(ctx, recCtx context.Context, conn net.Conn, out string, cfg config, h *handoff) {
     defer conn.Close()
-    _ = ln.Close()
 
+    upstream := cfg.upstream
+    var client io.Reader = conn
+    var handshake []byte // rewritten handshake of a transferred client
+    if h != nil {
+        upstream = h.target
+        <-h.ready // the previous connection is done feeding the recording
+        if h.transfer {
+            br := bufio.NewReader(conn)
+            var err error
+            if handshake, err = rewriteHandshake(br, h.target); err != nil {
+                log.Printf("transfer to %s: %v", h.target, err)
+                _ = h.tee.Close()
+                return
+            }
+            client = br
+        }
+    }
+    if out != "" && h == nil && cfg.names != nil {
+        br := bufio.NewReader(conn)
+        client = br
+        var err error
+        out, err = cfg.names.Next(recorder.NameData{
+            Player:   sessionPlayer(conn, br),
+            Server:   cfg.upstream,
+            Date:     time.Now(),
+            Protocol: cfg.protocol,
+        })
+        if err != nil {
+            log.Printf("not recording: %v", err)
+            out = ""
+        }
+    }
     upstreamConn, err := net.Dial("tcp", upstream)
     if err != nil {
-        log.Fatalf("dial upstream: %v", err)
+        log.Printf("dial upstream: %v", err)
+        if h != nil {
+            _ = h.tee.Close()
+        }
+        return
     }
     defer upstreamConn.Close()
 
-    w, err := mcpr.Create(out, mcpr.Meta{Protocol: protocol, Generator: generator, ServerName: upstream})
-    if err != nil {
-        log.Fatalf("create writer: %v", err)
+    // Create a pipe feeding the parser without slowing down forwarding.
+    // Closing its read side stops recording; forwarding ignores the error.
+    if out != "" && cfg.minFree > 0 {
+        if free, err := diskguard.FreeSpace(filepath.Dir(out)); err == nil && free < cfg.minFree {
+            log.Printf("only %s free, not recording %s", diskguard.FormatSize(free), out)
+            out = ""
+        }
+    }
+
+    var tee *io.PipeWriter
+    var rec *recording
+    var logins chan *login
+    lg := newLogin()
+    recDone := make(chan struct{})
+    switch {
+    case h != nil:
+        tee, rec, logins, recDone = h.tee, h.rec, h.logins, h.done
+        lg.onPluginRequest = rec.onPluginRequest
+        logins <- lg
+        if _, err := tee.Write(resumeMarker); err != nil {
+            lg.abort() // recording was stopped meanwhile
+        }
+        name := "Reconnected"
+        if h.transfer {
+            name = "Transfer to " + h.target
+        }
+        rec.mark(name)
+        log.Printf("continuing %s through %s", rec.out, upstream)
+    case out == "":
+        close(recDone)
+    default:
+        pr, pw := io.Pipe()
+        tee = pw
+        w, err := newReplay(out, cfg)
+        if err != nil {
+            log.Printf("create writer: %v", err)
+            return
+        }
+        log.Printf("recording to %s", out)
+        rec = &recording{w: w, out: out, first: out, parts: 1, start: time.Now()}
+        rec.stop = func() {
+            rec.stopped.Store(true)
+            _ = pr.Close()
+        }
+        active.add(rec)
+        lg.onPluginRequest = rec.onPluginRequest
+        go func() {
+            <-recCtx.Done()
+            rec.stop()
+        }()
+        // Should the session outlast the drain timeout, end the recording
+        // at shutdown so it is still finalized
+        remove := life.OnShutdown("finalize "+out, func(ctx context.Context) error {
+            rec.stop()
+            select {
+            case <-recDone:
+                return nil
+            case <-ctx.Done():
+                return ctx.Err()
+            }
+        })
+        logins = make(chan *login, 1)
+        go func() {
+            defer close(recDone)
+            defer remove()
+            record(ctx, pr, rec, lg, logins, out, cfg)
+        }()
+    }
+    // Watch client->server traffic for a modded handshake and, if enabled,
+    // the player's chat for control commands
+    var control *io.PipeWriter
+    if rec != nil {
+        cw := clientWatch{onHandshake: func(addr string) {
+            if l := forgeHandshake(addr); l != "" {
+                rec.setModLoader(l)
+            }
+        }}
+        if len(cfg.controlPlayers) > 0 {
+            if table, ok := mcproto.Lookup(cfg.protocol); !ok {
+                log.Printf("control: no packet table for protocol %d; chat commands disabled", cfg.protocol)
+            } else {
+                cw.table, cw.prefix, cw.handle = table, cfg.controlPrefix, rec.runCommand
+                cw.allow = map[string]bool{}
+                for _, p := range cfg.controlPlayers {
+                    cw.allow[p] = true
+                }
+            }
+        }
+        cr, pw := io.Pipe()
+        control = pw
+        go func() {
+            defer cr.Close()
+            if err := watchClient(cr, lg, cw); err != nil && !errors.Is(err, io.EOF) {
+                log.Printf("client watch: %v", err)
+            }
+        }()
     }
-    // Graceful shutdown on SIGINT/SIGTERM
-    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-    defer stop()
 
-    start := time.Now()
+    // Follow transfers: point the client back at this proxy and offer the
+    // recording to its next connection
+    var dst io.Writer = conn
+    var next *handoff
+    if rec != nil && cfg.transferVia != "" && supportsTransfers(cfg.protocol) {
+        dst = &transferRewriter{dst: conn, ss: newServerStream(cfg), via: cfg.transferVia, onTransfer: func(target string) {
+            next = &handoff{rec: rec, tee: tee, done: recDone, logins: logins, target: target, transfer: true}
+            handoffs.put(remoteIP(conn), next)
+        }}
+    }
 
     var wg sync.WaitGroup
-    // Client->Server (just proxy)
+    clientDone := make(chan struct{}) // the client closed its side first
+    // Client->Server (proxy + client watcher via tee)
     wg.Add(1)
     go func() {
         defer wg.Done()
+        defer close(clientDone)
         go func() { <-ctx.Done(); _ = conn.Close() }()
-        io.Copy(upstreamConn, conn)
-        _ = upstreamConn.(*net.TCPConn).CloseWrite()
+        if handshake != nil {
+            if _, err := upstreamConn.Write(handshake); err == nil && control != nil {
+                _, _ = control.Write(handshake)
+            }
+        }
+        if control == nil {
+            io.Copy(upstreamConn, client)
+        } else {
+            _ = forwardWithTee(client, upstreamConn, control)
+            _ = control.Close()
+        }
+        closeWrite(upstreamConn)
     }()
 
     // Server->Client (proxy + record via tee)
     wg.Add(1)
     go func() {
         defer wg.Done()
-        defer func() { _ = conn.(*net.TCPConn).CloseWrite() }()
+        defer closeWrite(conn)
         go func() { <-ctx.Done(); _ = upstreamConn.Close() }()
-        // Create a pipe feeding the parser without slowing down forwarding
-        pr, pw := io.Pipe()
-        var parseWG sync.WaitGroup
-        parseWG.Add(1)
-        go func() {
-            defer parseWG.Done()
-            if err := parseAndRecord(pr, w, start, assumeNoCompress, guessCompress, forceThreshold); err != nil && !errors.Is(err, io.EOF) {
-                log.Printf("parser: %v", err)
-            }
-        }()
-
+        var teeDst io.Writer
+        if tee != nil {
+            teeDst = tee
+        }
         // Forward raw bytes and tee into parser
-        if err := forwardWithTee(upstreamConn, conn, pw); err != nil && err != io.EOF {
+        if err := forwardWithTee(upstreamConn, dst, teeDst); err != nil && err != io.EOF {
             log.Printf("forward: %v", err)
         }
-        _ = pw.Close()
-        parseWG.Wait()
+        if next != nil && handoffs.await(remoteIP(conn), next, cfg.transferWait) {
+            return // the client's next connection continues the recording
+        }
+        if next == nil && rejoinable(ctx, rec, clientDone, cfg) {
+            // The server dropped the connection: disconnect the client and
+            // let its reconnect continue the recording
+            closeWrite(conn)
+            next = &handoff{rec: rec, tee: tee, done: recDone, logins: logins, target: cfg.upstream}
+            handoffs.put(remoteIP(conn), next)
+            if handoffs.await(remoteIP(conn), next, cfg.rejoinWait) {
+                return
+            }
+        }
+        if tee != nil {
+            _ = tee.Close()
+        }
     }()
 
     wg.Wait()
+    <-recDone
+}
+
+// rejoinable reports whether a recording whose server connection ended
+// should wait for the client to reconnect: -rejoin-wait is set, the client
+// did not leave first, and neither the proxy nor the recording was stopped.
+func rejoinable(ctx context.Context, rec *recording, clientDone <-chan struct{}, cfg config) bool {
+    if rec == nil || cfg.rejoinWait <= 0 || ctx.Err() != nil || rec.stopped.Load() {
+        return false
+    }
+    select {
+    case <-clientDone:
+        return false
+    default:
+        return true
+    }
+}
+
+// closeWrite tells the peer of c that nothing more will be sent, keeping
+// the other direction open. Connections that cannot half-close, unlike TCP
+// and TLS ones, are left alone until they are closed.
+func closeWrite(c net.Conn) {
+    if cw, ok := c.(interface{ CloseWrite() error }); ok {
+        _ = cw.CloseWrite()
+    }
+}
+
+// newReplay creates the replay writer for out.
+func newReplay(out string, cfg config) (*mcpr.Writer, error) {
+    sampling := mcpr.Sampling{Rate: cfg.sampleRate, OnChange: func(level mcpr.SamplingLevel, rate int) {
+        log.Printf("sampling %s: %d packets/s, recording %s", out, rate, level)
+    }}
+    opts := []mcpr.WriterOption{
+        mcpr.WithRecordingCompression(cfg.compression),
+        mcpr.WithBufferSize(cfg.writeBuffer),
+        optional("heartbeat", mcpr.WithHeartbeat(cfg.heartbeat, mcproto.Login)),
+        optional("sampling", mcpr.WithSampling(sampling, mcproto.Login)),
+    }
+    if cfg.dimensions {
+        opts = append(opts, optional("dimensions", mcpr.WithDimensions(mcproto.Login)))
+    }
+    if cfg.latency {
+        opts = append(opts, optional("latency", mcpr.WithLatency(mcproto.Login)))
+    }
+    return mcpr.Create(out, mcpr.Meta{Protocol: cfg.protocol, Generator: cfg.generator, ServerName: cfg.upstream}, opts...)
+}
+
+// optional logs why opt cannot apply, e.g. for a protocol without a packet
+// table, instead of failing the recording.
+func optional(what string, opt mcpr.WriterOption) mcpr.WriterOption {
+    return func(w *mcpr.Writer) error {
+        if err := opt(w); err != nil {
+            log.Printf("%s: %v", what, err)
+        }
+        return nil
+    }
+}
+
+// record parses packets from src into r until src ends, then finalizes the replay.
+// Connections continuing the recording after a transfer or reconnect send
+// their login on logins.
+func record(ctx context.Context, src io.Reader, r *recording, lg *login, logins <-chan *login, out string, cfg config) {
+    defer active.remove(r)
+    rec := &teeWriter{r: r, cfg: cfg}
+    if cfg.splitServers {
+        rec.seg = &segmenter{cfg: cfg}
+    }
+    stopMirror := func() {}
+    if cfg.mirror != "" {
+        relay := replayserver.NewRelay(cfg.protocol, cfg.mirrorDelay)
+        relay.MOTD = "Live: " + cfg.upstream
+        relay.Memory = cfg.memory.Account("mirror "+out, 0)
+        rec.mirror = relay
+        mirrorCtx, cancel := context.WithCancel(ctx)
+        stopMirror = cancel
+        go func() {
+            if err := relay.ListenAndServe(mirrorCtx, cfg.mirror); err != nil {
+                log.Printf("mirror: %v", err)
+            }
+        }()
+        log.Printf("mirroring live on %s (delay %s)", cfg.mirror, cfg.mirrorDelay)
+    }
+
+    err := parseAndRecord(src, rec, lg, r.start, newServerStream(cfg), logins)
+    switch {
+    case errors.Is(err, io.ErrClosedPipe):
+        log.Printf("recording stopped")
+    case err != nil && !errors.Is(err, io.EOF):
+        log.Printf("parser: %v", err)
+    }
+
+    if rec.mirror != nil {
+        // Spectators still receive the delayed tail of the session; stop
+        // serving once it is out, or when the proxy shuts down. The replay
+        // is finalized meanwhile, not after.
+        _ = rec.mirror.Close()
+        go func() {
+            select {
+            case <-time.After(cfg.mirrorDelay):
+            case <-ctx.Done():
+            }
+            stopMirror()
+        }()
+    }
 
-    if err := w.Close(); err != nil {
+    if err := r.close(); err != nil {
         log.Printf("close writer: %v", err)
-    } else {
-        log.Printf("finalized %s", out)
+        return
+    }
+    log.Printf("finalized %s", r.out)
+    deliver(r.out, cfg)
+}
+
+// deliver posts the finalized replay out where configured.
+func deliver(out string, cfg config) {
+    if cfg.discordWebhook != "" {
+        life.Deliver("discord "+out, func(ctx context.Context) error {
+            ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+            defer cancel()
+            c := &discord.Client{WebhookURL: cfg.discordWebhook}
+            if err := c.Deliver(ctx, out); err != nil {
+                return err
+            }
+            log.Printf("posted %s to Discord", out)
+            return nil
+        })
     }
 }
 
@@ -142,14 +840,21 @@ func forwardWithTee(src io.Reader, dst io.Writer, tee io.Writer) error {
 }
 
 // parseAndRecord reads framed packets from r and writes them to the replay writer.
-// It assumes MC VarInt length framing, optional zlib compression (threshold unknown, inferred),
-// and stops once framing becomes invalid (e.g., encryption starts) or EOF.
-func parseAndRecord(r io.Reader, w *mcpr.Writer, start time.Time, assumeNoCompress, guessCompress bool, forceThreshold int) error {
+// It assumes MC VarInt length framing, optional zlib compression (threshold unknown, inferred
+// from the login SetCompression packet), and stops once framing becomes invalid (e.g.,
+// encryption starts) or EOF. Cookie and transfer packets are not recorded.
+//
+// Server switches behind a network proxy are reported to w if it implements
+// serverSwitcher.
+//
+// After a resumeMarker, the packets are those of a connection continuing the
+// recording after a transfer or reconnect: its login comes from logins, its
+// login phase is left out, and for protocols with a configuration phase the
+// replay is switched back to configuration to receive it.
+func parseAndRecord(r io.Reader, w packetWriter, lg *login, start time.Time, ss *serverStream, logins <-chan *login) error {
     br := bufio.NewReader(r)
-    compressionEnabled := false
-    if forceThreshold >= 0 {
-        compressionEnabled = true
-    }
+    defer func() { lg.abort() }()
+    resumed := false
     const maxFrame = 8 << 20 // 8 MiB safety cap
     for {
         // Each packet frame: VarInt length, then 'length' bytes of data
@@ -157,6 +862,19 @@ func parseAndRecord(r io.Reader, w *mcpr.Writer, start time.Time, assumeNoCompre
         if err != nil {
             return err
         }
+        if frameLen == 0 && logins != nil {
+            lg.abort()
+            lg = <-logins
+            if ss.ids != nil && ss.state == mcproto.Play {
+                ts := uint32(time.Since(start).Milliseconds())
+                if err := w.WritePacket(ts, ss.ids.playStartConfig, nil); err != nil {
+                    return err
+                }
+            }
+            ss.reset()
+            resumed = true
+            continue
+        }
         if frameLen <= 0 || frameLen > maxFrame {
             return fmt.Errorf("invalid frame length %d", frameLen)
         }
@@ -165,50 +883,44 @@ func parseAndRecord(r io.Reader, w *mcpr.Writer, start time.Time, assumeNoCompre
             return err
         }
 
-        // Decode for recording
-        data := frame
-        if !assumeNoCompress && compressionEnabled {
-            // When compression is enabled, the first VarInt is uncompressed size
-            zr := bytes.NewReader(data)
-            uncompressedSize, err := readVarInt(zr)
-            if err == nil {
-                if uncompressedSize > 0 {
-                    // Decompress the rest of zr
-                    z, err := zlib.NewReader(zr)
-                    if err == nil {
-                        var buf bytes.Buffer
-                        if _, err := io.Copy(&buf, z); err == nil {
-                            data = buf.Bytes()
-                        }
-                        _ = z.Close()
-                    }
-                    // If decompressor failed, fall back to raw payload below
-                } else {
-                    // Data was not compressed, remainder is payload
-                    data, _ = io.ReadAll(zr)
-                }
-            }
-        }
-
-        // Now data should start with VarInt packetID followed by payload
-        pr := bytes.NewReader(data)
-        pid64, err := readVarInt(pr)
+        // Decode for recording. A frame that does not decode (e.g. once
+        // encryption starts) ends recording: framing is lost beyond it.
+        pid, payload, err := netframe.DecodePacket(frame, ss.threshold())
         if err != nil {
-            // framing invalid beyond this point; stop recording
             return err
         }
-        pid := int32(pid64)
-        payload, _ := io.ReadAll(pr)
 
-        // Heuristic: detect SetCompression during login if requested
-        if guessCompress && !compressionEnabled && !assumeNoCompress {
-            // If payload is exactly one VarInt and nothing else, assume SetCompression
-            if _, ok := singleVarInt(payload); ok {
-                compressionEnabled = true
+        // Login phase: SetCompression (0x03), plugin requests (0x04, used by
+        // Forge/FML handshakes) and login success (0x02), which ends it
+        st := ss.observe(pid, payload)
+        if st == mcproto.Login {
+            switch pid {
+            case 0x04:
+                if lg != nil {
+                    lg.pluginRequest(payload)
+                }
+            case 0x02:
+                if lg != nil {
+                    lg.finish(ss.framesCompressed())
+                }
+            }
+            if resumed {
+                continue
             }
         }
+        if ss.unrecorded(st, pid) {
+            continue
+        }
 
         ts := uint32(time.Since(start).Milliseconds())
+        if sw, ok := w.(stateSetter); ok {
+            sw.setState(st)
+        }
+        if sw, ok := w.(serverSwitcher); ok && ss.switching(st, pid) {
+            if !sw.serverSwitch(ts) {
+                continue
+            }
+        }
         if err := w.WritePacket(ts, pid, payload); err != nil {
             return err
         }
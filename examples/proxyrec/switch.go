@@ -0,0 +1,105 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr"
+    mcproto "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Behind a network proxy such as Velocity or BungeeCord, the player moves
+// between backend servers on one connection. Since 1.20.2 the network
+// reconfigures the client for the next server; before, it sends a second
+// join game packet, usually followed by respawns that reset the world. The
+// replay stays one file either way, with a "Server switch" marker at every
+// switch. With -split-servers, each backend server gets a replay of its own
+// instead.
+
+// joinGameIDs are the clientbound join game ("Login (play)") packet ids by
+// protocol, used to detect switches before 1.20.2.
+var joinGameIDs = map[int]int32{
+    754: 0x24, // 1.16.4-1.16.5
+    755: 0x26, // 1.17
+    756: 0x26, // 1.17.1
+    757: 0x26, // 1.18-1.18.1
+    758: 0x26, // 1.18.2
+    759: 0x23, // 1.19
+    760: 0x25, // 1.19.1-1.19.2
+    761: 0x24, // 1.19.3
+    762: 0x28, // 1.19.4
+    763: 0x28, // 1.20-1.20.1
+}
+
+// supportsSwitches reports whether the proxy detects server switches for
+// protocol.
+func supportsSwitches(protocol int) bool {
+    _, ok := joinGameIDs[protocol]
+    return ok || streamTables[protocol] != nil
+}
+
+// switching reports whether packet id, sent in state st, begins the session
+// of another backend server: a reconfiguration, or a join game packet after
+// the first.
+func (s *serverStream) switching(st mcproto.State, id int32) bool {
+    if st != mcproto.Play {
+        return false
+    }
+    if s.ids != nil {
+        return id == s.ids.playStartConfig
+    }
+    if join, ok := joinGameIDs[s.protocol]; !ok || id != join {
+        return false
+    }
+    first := !s.joined
+    s.joined = true
+    return !first
+}
+
+// serverSwitcher is implemented by packet writers that act on server
+// switches found by parseAndRecord. serverSwitch reports whether the packet
+// that began the switch is still to be written.
+type serverSwitcher interface {
+    serverSwitch(ts uint32) bool
+}
+
+// segmenter starts a new replay at every server switch for -split-servers.
+// Each replay begins with the login packets of the first, so ReplayMod
+// accepts it; for 1.20.2+ the configuration of the new server follows.
+type segmenter struct {
+    cfg      config
+    login    []mcpr.Packet // packets up to and including login success
+    loggedIn bool
+}
+
+// observe keeps the login packets of the first replay.
+func (s *segmenter) observe(id int32, payload []byte) {
+    if s.loggedIn {
+        return
+    }
+    s.login = append(s.login, mcpr.Packet{ID: id, Payload: append([]byte(nil), payload...)})
+    s.loggedIn = id == 0x02
+}
+
+// next finalizes the current replay of r and continues the recording in a
+// new one from ts on. It reports whether the packet that began the switch
+// belongs in the new replay: a reconfiguration does not, as the replay is
+// already in configuration after its login. If the new replay cannot be
+// created, the recording continues in the current one.
+func (s *segmenter) next(r *recording, ts uint32) bool {
+    if !r.continueIn(s.login, ts, s.cfg, "server switch") {
+        return true
+    }
+    return streamTables[s.cfg.protocol] == nil
+}
+
+// segmentName numbers the replays of a split recording:
+// proxy.mcpr, proxy-2.mcpr, proxy-3.mcpr, ...
+func segmentName(out string, n int) string {
+    if n <= 1 {
+        return out
+    }
+    ext := filepath.Ext(out)
+    return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(out, ext), n, ext)
+}
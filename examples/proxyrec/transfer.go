@@ -0,0 +1,438 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/netframe"
+    mcproto "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Since 1.20.5 (protocol 766) servers can store cookies on the client, ask
+// for them back, and transfer the client to another server, which it then
+// connects to with a handshake of intent 3. Cookie and transfer packets are
+// forwarded to the client but left out of the replay: played back, they would
+// act on the viewer's client. With -transfer-via the proxy also follows
+// transfers: it points the client back at itself, connects to the server the
+// client was sent to, and continues the same replay. With -rejoin-wait, a
+// client reconnecting after the server connection dropped continues the
+// replay the same way.
+
+// streamIDs are the clientbound packet ids the proxy needs to follow
+// configuration, cookies and transfers without a full packet table. -1 marks
+// packets a protocol does not have.
+type streamIDs struct {
+    loginCookieRequest  int32
+    configFinish        int32
+    configCookieRequest int32
+    configStoreCookie   int32
+    configTransfer      int32
+    playStartConfig     int32
+    playCookieRequest   int32
+    playStoreCookie     int32
+    playTransfer        int32
+}
+
+// streamTables covers the protocols with a configuration phase (1.20.2+)
+// that the proxy knows. Older protocols go from login straight to play.
+var streamTables = map[int]*streamIDs{
+    764: {-1, 0x02, -1, -1, -1, 0x65, -1, -1, -1}, // 1.20.2
+    765: {-1, 0x02, -1, -1, -1, 0x67, -1, -1, -1}, // 1.20.3-1.20.4
+    766: {0x05, 0x03, 0x00, 0x0A, 0x0B, 0x69, 0x16, 0x6B, 0x73}, // 1.20.5-1.20.6
+    767: {0x05, 0x03, 0x00, 0x0A, 0x0B, 0x69, 0x16, 0x6B, 0x73}, // 1.21-1.21.1
+}
+
+// supportsTransfers reports whether the proxy can follow transfers for protocol.
+func supportsTransfers(protocol int) bool {
+    ids := streamTables[protocol]
+    return ids != nil && ids.playTransfer >= 0
+}
+
+// serverStream follows the server->client packets of one connection:
+// whether frames are compressed and, for protocols with streamIDs, the
+// connection state. Without ids, everything after login counts as play.
+type serverStream struct {
+    ids        *streamIDs
+    protocol   int
+    state      mcproto.State
+    compressed bool
+    joined     bool // a join game packet was seen, see switching
+
+    noCompress    bool // -no-compress
+    guessCompress bool // -guess-compress
+    forced        bool // -compression-threshold
+}
+
+func newServerStream(cfg config) *serverStream {
+    s := &serverStream{
+        ids:           streamTables[cfg.protocol],
+        protocol:      cfg.protocol,
+        noCompress:    cfg.assumeNoCompress,
+        guessCompress: cfg.guessCompress,
+        forced:        cfg.forceThreshold >= 0,
+    }
+    s.reset()
+    return s
+}
+
+// reset starts over for a new connection.
+func (s *serverStream) reset() {
+    s.state = mcproto.Login
+    s.compressed = s.forced
+    s.joined = false
+}
+
+// framesCompressed reports whether frames carry the compression header.
+func (s *serverStream) framesCompressed() bool {
+    return s.compressed && !s.noCompress
+}
+
+// threshold returns the compression threshold for netframe: -1 while frames
+// are uncompressed, else 0, as the threshold itself is not tracked.
+func (s *serverStream) threshold() int {
+    return frameThreshold(s.framesCompressed())
+}
+
+// observe returns the state packet id was sent in and follows state changes.
+// Login SetCompression (0x03) is recognized heuristically by its payload of
+// exactly one VarInt; login success (0x02) ends the login phase.
+func (s *serverStream) observe(id int32, payload []byte) mcproto.State {
+    st := s.state
+    switch st {
+    case mcproto.Login:
+        switch id {
+        case 0x03:
+            if s.guessCompress && !s.compressed && !s.noCompress {
+                if _, ok := singleVarInt(payload); ok {
+                    s.compressed = true
+                }
+            }
+        case 0x02:
+            s.state = mcproto.Play
+            if s.ids != nil {
+                s.state = mcproto.Configuration
+            }
+        }
+    case mcproto.Configuration:
+        if id == s.ids.configFinish {
+            s.state = mcproto.Play
+        }
+    case mcproto.Play:
+        if s.ids != nil && id == s.ids.playStartConfig {
+            s.state = mcproto.Configuration
+        }
+    }
+    return st
+}
+
+// transfer reports whether packet id sent in state st is a Transfer.
+func (s *serverStream) transfer(st mcproto.State, id int32) bool {
+    if s.ids == nil {
+        return false
+    }
+    return st == mcproto.Configuration && id == s.ids.configTransfer ||
+        st == mcproto.Play && id == s.ids.playTransfer
+}
+
+// unrecorded reports whether packet id sent in state st is kept out of the
+// replay: cookie requests, stored cookies and transfers.
+func (s *serverStream) unrecorded(st mcproto.State, id int32) bool {
+    if s.ids == nil {
+        return false
+    }
+    switch st {
+    case mcproto.Login:
+        return id == s.ids.loginCookieRequest
+    case mcproto.Configuration:
+        return id == s.ids.configCookieRequest || id == s.ids.configStoreCookie || id == s.ids.configTransfer
+    case mcproto.Play:
+        return id == s.ids.playCookieRequest || id == s.ids.playStoreCookie || id == s.ids.playTransfer
+    }
+    return false
+}
+
+// resumeMarker is written into a recording's parser pipe before the packets
+// of a connection that continues it after a transfer. Real frames are never
+// empty.
+var resumeMarker = []byte{0}
+
+// handoff is a recording waiting for its client to come back, after a
+// transfer or after the server connection dropped.
+type handoff struct {
+    rec      *recording
+    tee      *io.PipeWriter // the recording's parser pipe
+    done     chan struct{}  // closed when the recording is finalized
+    logins   chan *login    // the next connection's login, read by the parser at the marker
+    target   string         // host:port to connect the returning client to
+    transfer bool           // the server sent the client to target
+
+    claimed chan struct{} // closed by claim
+    ready   chan struct{} // closed once the previous connection stopped writing to tee
+}
+
+// handoffTable holds the handoffs by client IP. Clients sharing an IP that
+// return at the same time may pick up each other's recording.
+type handoffTable struct {
+    mu      sync.Mutex
+    pending map[string]*handoff
+}
+
+var handoffs = &handoffTable{pending: map[string]*handoff{}}
+
+// put offers h to the next connection from ip, replacing an earlier offer.
+func (t *handoffTable) put(ip string, h *handoff) {
+    h.claimed = make(chan struct{})
+    h.ready = make(chan struct{})
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.pending[ip] = h
+}
+
+// claim returns the handoff waiting for conn's client, or nil.
+func (t *handoffTable) claim(conn net.Conn) *handoff {
+    ip := remoteIP(conn)
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    h := t.pending[ip]
+    if h != nil {
+        delete(t.pending, ip)
+        close(h.claimed)
+    }
+    return h
+}
+
+// await is called by the connection that put h once it is done with h.tee.
+// It waits up to wait for the client to come back and reports whether it
+// did; otherwise the offer is withdrawn and the caller still owns h.tee.
+func (t *handoffTable) await(ip string, h *handoff, wait time.Duration) bool {
+    close(h.ready)
+    timer := time.NewTimer(wait)
+    defer timer.Stop()
+    select {
+    case <-h.claimed:
+        return true
+    case <-timer.C:
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.pending[ip] != h {
+        return true // claimed just now
+    }
+    delete(t.pending, ip)
+    log.Printf("%s: client did not come back within %s", h.rec.out, wait)
+    return false
+}
+
+func remoteIP(conn net.Conn) string {
+    host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+    if err != nil {
+        return conn.RemoteAddr().String()
+    }
+    return host
+}
+
+// transferRewriter sits in the server->client direction. It passes frames
+// through unchanged, except that Transfer packets are redirected to via (this
+// proxy) and their original target is reported to onTransfer. If frames stop
+// making sense (e.g. encryption), it passes the rest of the stream through.
+type transferRewriter struct {
+    dst io.Writer
+    ss  *serverStream
+    via string // host:port clients reach this proxy at
+
+    // onTransfer receives the original target of every redirected transfer
+    onTransfer func(target string)
+
+    buf []byte
+    raw bool
+}
+
+func (t *transferRewriter) Write(p []byte) (int, error) {
+    if t.raw {
+        return t.dst.Write(p)
+    }
+    t.buf = append(t.buf, p...)
+    for {
+        br := bytes.NewReader(t.buf)
+        n, err := readVarInt(br)
+        if err != nil {
+            break // incomplete length
+        }
+        hdr := len(t.buf) - br.Len()
+        if n <= 0 || n > 8<<20 {
+            t.raw = true
+            break
+        }
+        if br.Len() < int(n) {
+            break
+        }
+        frame := t.buf[hdr : hdr+int(n)]
+        out := t.buf[:hdr+int(n)]
+        if repl, ok := t.inspect(frame); ok {
+            out = repl
+        }
+        if _, err := t.dst.Write(out); err != nil {
+            return 0, err
+        }
+        t.buf = t.buf[hdr+int(n):]
+    }
+    if t.raw && len(t.buf) > 0 {
+        _, err := t.dst.Write(t.buf)
+        t.buf = nil
+        if err != nil {
+            return 0, err
+        }
+    }
+    t.buf = append([]byte(nil), t.buf...)
+    return len(p), nil
+}
+
+// inspect follows the stream and returns a replacement for a Transfer frame.
+func (t *transferRewriter) inspect(frame []byte) ([]byte, bool) {
+    id, payload, err := decodeFrame(frame, t.ss.framesCompressed())
+    if err != nil {
+        t.raw = true
+        return nil, false
+    }
+    if !t.ss.transfer(t.ss.observe(id, payload), id) {
+        return nil, false
+    }
+    host, rest, err := decodeString(payload)
+    if err != nil {
+        return nil, false
+    }
+    port, err := readVarInt(bytes.NewReader(rest))
+    if err != nil {
+        return nil, false
+    }
+    target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+    viaHost, viaPort, err := splitPort(t.via)
+    if err != nil {
+        return nil, false
+    }
+    var pkt bytes.Buffer
+    _ = writeVarInt(&pkt, int(id))
+    writeString(&pkt, viaHost)
+    _ = writeVarInt(&pkt, viaPort)
+    repl, err := encodeFrame(pkt.Bytes(), frame, t.ss.framesCompressed())
+    if err != nil {
+        log.Printf("transfer to %s: %v; not following", target, err)
+        return nil, false
+    }
+    t.onTransfer(target)
+    log.Printf("server transfers client to %s; redirecting through %s", target, t.via)
+    return repl, true
+}
+
+// encodeFrame frames packet like orig was: compressed only if orig was, so
+// the client's compression threshold check passes.
+func encodeFrame(packet, orig []byte, compressed bool) ([]byte, error) {
+    threshold := -1
+    if compressed {
+        size, err := readVarInt(bytes.NewReader(orig))
+        if err != nil {
+            return nil, err
+        }
+        threshold = 0
+        if size == 0 {
+            threshold = len(packet) + 1 // stays uncompressed
+        }
+    }
+    body, err := netframe.Encode(packet, threshold)
+    if err != nil {
+        return nil, err
+    }
+    return netframe.Append(nil, body), nil
+}
+
+// rewriteHandshake reads the client's handshake from r and returns it framed
+// for target: server address and port replaced, any Forge marker after the
+// host kept. The handshake precedes compression.
+func rewriteHandshake(r *bufio.Reader, target string) ([]byte, error) {
+    n, err := readVarInt(r)
+    if err != nil {
+        return nil, err
+    }
+    if n <= 0 || n > 1<<16 {
+        return nil, fmt.Errorf("invalid handshake length %d", n)
+    }
+    frame := make([]byte, n)
+    if _, err := io.ReadFull(r, frame); err != nil {
+        return nil, err
+    }
+    id, payload, err := decodeFrame(frame, false)
+    if err != nil || id != 0 {
+        return nil, fmt.Errorf("not a handshake")
+    }
+    br := bytes.NewReader(payload)
+    proto, err := readVarInt(br)
+    if err != nil {
+        return nil, err
+    }
+    addr, rest, err := decodeString(payload[len(payload)-br.Len():])
+    if err != nil || len(rest) < 2 {
+        return nil, fmt.Errorf("invalid handshake")
+    }
+    host, port, err := splitPort(target)
+    if err != nil {
+        return nil, err
+    }
+    if i := strings.IndexByte(addr, 0); i >= 0 {
+        host += addr[i:]
+    }
+    var pkt bytes.Buffer
+    _ = writeVarInt(&pkt, 0)
+    _ = writeVarInt(&pkt, int(proto))
+    writeString(&pkt, host)
+    _ = binary.Write(&pkt, binary.BigEndian, uint16(port))
+    pkt.Write(rest[2:]) // next state
+    return encodeFrame(pkt.Bytes(), nil, false)
+}
+
+func splitPort(hostport string) (string, int, error) {
+    host, p, err := net.SplitHostPort(hostport)
+    if err != nil {
+        return "", 0, err
+    }
+    port, err := strconv.Atoi(p)
+    if err != nil || port <= 0 || port > 65535 {
+        return "", 0, fmt.Errorf("invalid port in %q", hostport)
+    }
+    return host, port, nil
+}
+
+func writeString(w *bytes.Buffer, s string) {
+    _ = writeVarInt(w, len(s))
+    w.WriteString(s)
+}
+
+// acceptReturning accepts the connections of clients coming back to a
+// recording in single-session mode, where the listener is otherwise unused.
+// Other connections are refused.
+func acceptReturning(ln net.Listener, cfg config) {
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        h := handoffs.claim(conn)
+        if h == nil {
+            log.Printf("refusing %s: only returning clients of the recorded session are accepted", conn.RemoteAddr())
+            _ = conn.Close()
+            continue
+        }
+        life.Go(func(ctx context.Context) {
+            proxySession(ctx, ctx, conn, "", cfg, h)
+        })
+    }
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/recorder"
+)
+
+// stats is the live state shown on the dashboard. The bot's packet handlers,
+// OnFinalize and uploads update it; HTTP handlers read it.
+type stats struct {
+    mu      sync.Mutex
+    out     string
+    started time.Time
+    last    time.Time // last packet
+    packets int64
+    bytes   int64
+    byID    map[int32]int64
+    markers []markerEvent
+    files   []*fileState
+}
+
+type markerEvent struct {
+    At   time.Time `json:"at"`
+    By   string    `json:"by,omitempty"`
+    Name string    `json:"name"`
+}
+
+// fileState is a finalized replay and its upload.
+type fileState struct {
+    Path      string    `json:"path"`
+    Size      int64     `json:"size"`
+    Finalized time.Time `json:"finalized"`
+    Upload    string    `json:"upload,omitempty"` // "pending", "done" or "failed"; empty without -upload
+    URL       string    `json:"url,omitempty"`
+    Error     string    `json:"error,omitempty"`
+}
+
+func newStats(out string) *stats {
+    return &stats{out: out, started: time.Now(), byID: map[int32]int64{}}
+}
+
+func (s *stats) packet(id int32, n int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.packets++
+    s.bytes += int64(n)
+    s.byID[id]++
+    s.last = time.Now()
+}
+
+func (s *stats) marked(by, name string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.markers = append(s.markers, markerEvent{At: time.Now(), By: by, Name: name})
+}
+
+// finalized records a finished replay and returns its entry for uploaded.
+func (s *stats) finalized(path string, uploading bool) *fileState {
+    f := &fileState{Path: path, Finalized: time.Now()}
+    if fi, err := os.Stat(path); err == nil {
+        f.Size = fi.Size()
+    }
+    if uploading {
+        f.Upload = "pending"
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.files = append(s.files, f)
+    return f
+}
+
+func (s *stats) uploaded(f *fileState, url string, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err != nil {
+        f.Upload, f.Error = "failed", err.Error()
+        return
+    }
+    f.Upload, f.URL = "done", url
+}
+
+// packetCount is the number of packets of one id.
+type packetCount struct {
+    ID    int32 `json:"id"`
+    Count int64 `json:"count"`
+}
+
+// snapshot is the JSON form of stats served at /stats.json.
+type snapshot struct {
+    Current      string                     `json:"current"` // replay being written
+    Uptime       float64                    `json:"uptimeSeconds"`
+    Packets      int64                      `json:"packets"`
+    Bytes        int64                      `json:"bytes"`
+    PacketRate   float64                    `json:"packetsPerSecond"`
+    LastPacket   float64                    `json:"lastPacketSecondsAgo"`
+    TopPackets   []packetCount              `json:"topPackets"`
+    Markers      []markerEvent              `json:"markers"`
+    Files        []fileState                `json:"files"`
+    WriteTimings map[string]perf.TimerStats `json:"timings"`
+}
+
+func (s *stats) snapshot() snapshot {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    up := time.Since(s.started)
+    snap := snapshot{
+        Current:      s.out,
+        Uptime:       up.Seconds(),
+        Packets:      s.packets,
+        Bytes:        s.bytes,
+        PacketRate:   float64(s.packets) / up.Seconds(),
+        Markers:      append([]markerEvent{}, s.markers...),
+        WriteTimings: perf.Snapshot(),
+    }
+    if !s.last.IsZero() {
+        snap.LastPacket = time.Since(s.last).Seconds()
+    }
+    // The recorder continues in part n+1 after n rotations
+    if n := len(s.files); n > 0 {
+        snap.Current = recorder.Parts(s.out)(n + 1)
+    }
+    for _, f := range s.files {
+        snap.Files = append(snap.Files, *f)
+    }
+    for id, n := range s.byID {
+        snap.TopPackets = append(snap.TopPackets, packetCount{id, n})
+    }
+    sort.Slice(snap.TopPackets, func(i, j int) bool {
+        a, b := snap.TopPackets[i], snap.TopPackets[j]
+        return a.Count > b.Count || a.Count == b.Count && a.ID < b.ID
+    })
+    if len(snap.TopPackets) > 10 {
+        snap.TopPackets = snap.TopPackets[:10]
+    }
+    return snap
+}
+
+// handler serves the dashboard page at / and its data at /stats.json.
+func (s *stats) handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/stats.json", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        _ = enc.Encode(s.snapshot())
+    })
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        _, _ = w.Write([]byte(dashboardHTML))
+    })
+    return mux
+}
+
+// dashboardHTML polls /stats.json and renders it, so the page needs no
+// templates and stays current without reloads.
+const dashboardHTML = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Replay recorder</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#222}
+table{border-collapse:collapse;margin-bottom:1.5em}
+td,th{border:1px solid #ccc;padding:.3em .6em;text-align:left}
+</style></head><body>
+<h1>Replay recorder</h1>
+<table id="overview"></table>
+<h2>Markers</h2><table id="markers"></table>
+<h2>Finalized replays</h2><table id="files"></table>
+<h2>Top packets</h2><table id="packets"></table>
+<script>
+function esc(s){return String(s).replace(/[&<>"]/g,c=>({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;'}[c]))}
+function rows(id,head,data){
+  document.getElementById(id).innerHTML='<tr>'+head.map(h=>'<th>'+h+'</th>').join('')+'</tr>'+
+    data.map(r=>'<tr>'+r.map(c=>'<td>'+esc(c)+'</td>').join('')+'</tr>').join('')
+}
+async function refresh(){
+  const s=await (await fetch('stats.json')).json()
+  rows('overview',['Recording','Uptime','Packets','Packets/s','Size','Last packet'],[[s.current,
+    Math.round(s.uptimeSeconds)+' s',s.packets,s.packetsPerSecond.toFixed(1),
+    (s.bytes/1048576).toFixed(1)+' MiB',s.lastPacketSecondsAgo.toFixed(1)+' s ago']])
+  rows('markers',['Time','By','Name'],(s.markers||[]).map(m=>[new Date(m.at).toLocaleTimeString(),m.by||'',m.name]))
+  rows('files',['Replay','Size','Finalized','Upload'],(s.files||[]).map(f=>[f.path,
+    (f.size/1048576).toFixed(1)+' MiB',new Date(f.finalized).toLocaleTimeString(),f.url||f.error||f.upload||'']))
+  rows('packets',['Id','Count'],(s.topPackets||[]).map(p=>['0x'+p.id.toString(16).padStart(2,'0'),p.count]))
+}
+refresh();setInterval(refresh,2000)
+</script></body></html>
+`
@@ -0,0 +1,234 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/Tnze/go-mc/bot"
+    "github.com/Tnze/go-mc/bot/basic"
+    "github.com/Tnze/go-mc/bot/msg"
+    "github.com/Tnze/go-mc/bot/playerlist"
+    "github.com/Tnze/go-mc/chat"
+    "github.com/Tnze/go-mc/data/packetid"
+    pk "github.com/Tnze/go-mc/net/packet"
+
+    "github.com/reallyoldfogie/mc-replay-go/adapters"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/lifecycle"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/recorder"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/upload"
+)
+
+// Recording bot: joins a server as a go-mc bot, records everything it sees
+// and serves a live dashboard. It ties the pieces of the library together
+// the way a production recorder would:
+//
+//   - adapters.PacketFunc feeds the bot's packets into a recorder.Recorder;
+//   - -rotate finalizes the replay every so often and continues in
+//     out-part2.mcpr, out-part3.mcpr, ... (recorder.Limits);
+//   - players type "!mark Boss fight" in chat to add a marker
+//     (Recorder.Mark), at the bot's position;
+//   - -upload sends every finalized part to a tus endpoint (package upload);
+//   - -dashboard serves live stats as HTML and JSON;
+//   - SIGINT/SIGTERM disconnect the bot, finalize the replay and wait for
+//     uploads (package lifecycle).
+//
+//  go run ./examples/recorderbot -server 127.0.0.1:25565 -out bot.mcpr \
+//    -rotate 1h -dashboard localhost:8080 -upload https://tus.example/files/
+//
+// The bot speaks go-mc's protocol version (1.20.2, protocol 764) and joins
+// offline-mode servers. Continuation parts start mid-session, without the
+// login and chunks a player joining would see; ReplayMod plays them, but the
+// world only fills in as chunks are resent.
+
+// The bot library speaks exactly one protocol version.
+const (
+    mcVersion       = "1.20.2"
+    protocolVersion = 764
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+    var server, name, out, dashAddr, endpoint, token, markPrefix string
+    var rotate time.Duration
+    var markers listFlag
+    flag.StringVar(&server, "server", "127.0.0.1:25565", "Minecraft server address")
+    flag.StringVar(&name, "name", "ReplayBot", "Bot player name (offline mode)")
+    flag.StringVar(&out, "out", "bot.mcpr", "Output .mcpr path")
+    flag.DurationVar(&rotate, "rotate", 0, "Continue in a new part after this much recording time (e.g. 1h)")
+    flag.StringVar(&dashAddr, "dashboard", "", "Serve the live dashboard on this address (e.g. localhost:8080)")
+    flag.StringVar(&endpoint, "upload", "", "Upload finalized replays to this tus endpoint")
+    flag.StringVar(&token, "upload-token", os.Getenv("UPLOAD_TOKEN"), "Bearer token for -upload (default $UPLOAD_TOKEN)")
+    flag.StringVar(&markPrefix, "mark-prefix", "!mark", "Chat prefix that adds a marker")
+    flag.Var(&markers, "marker-player", "Only accept markers from this player (repeatable; default everyone)")
+    flag.Parse()
+
+    if err := run(server, name, out, dashAddr, rotate, newUploader(endpoint, token), markPrefix, markers); err != nil {
+        log.Fatalf("%v", err)
+    }
+}
+
+func newUploader(endpoint, token string) *upload.Uploader {
+    if endpoint == "" {
+        return nil
+    }
+    u := &upload.Uploader{Endpoint: endpoint}
+    if token != "" {
+        u.Header = http.Header{"Authorization": {"Bearer " + token}}
+    }
+    return u
+}
+
+func run(server, name, out, dashAddr string, rotate time.Duration, up *upload.Uploader, markPrefix string, markPlayers []string) error {
+    life := lifecycle.New(context.Background(), os.Interrupt, syscall.SIGTERM)
+    stats := newStats(out)
+
+    // Listen and join before creating the replay, so a typo leaves no file
+    var ln net.Listener
+    if dashAddr != "" {
+        var err error
+        if ln, err = net.Listen("tcp", dashAddr); err != nil {
+            return fmt.Errorf("dashboard: %w", err)
+        }
+    }
+
+    // Handlers run in HandleGame, once rec is set below
+    var rec *recorder.Recorder
+    client := bot.NewClient()
+    client.Auth.Name = name
+    var pos *mcpr.MarkerPosition // last position the server put the bot at
+    var player *basic.Player
+    player = basic.NewPlayer(client, basic.DefaultSettings, basic.EventsListener{
+        GameStart: func() error {
+            log.Printf("joined %s as %s", server, name)
+            return nil
+        },
+        Disconnect: func(reason chat.Message) error {
+            log.Printf("⚠️ disconnected: %s", reason.ClearString())
+            return nil
+        },
+        Death: func() error {
+            rec.Mark("Bot died", pos)
+            return player.Respawn()
+        },
+        Teleported: func(x, y, z float64, yaw, pitch float32, flags byte, teleportID int32) error {
+            if flags == 0 { // absolute coordinates
+                pos = &mcpr.MarkerPosition{X: x, Y: y, Z: z, Yaw: yaw, Pitch: pitch}
+            }
+            return player.AcceptTeleportation(pk.VarInt(teleportID))
+        },
+    })
+    onChat := func(m chat.Message) error {
+        sender, text := chatParts(m)
+        label, ok := strings.CutPrefix(strings.TrimSpace(text), markPrefix)
+        if !ok || !allowed(sender, markPlayers) {
+            return nil
+        }
+        label = strings.TrimSpace(label)
+        rec.Mark(label, pos)
+        stats.marked(sender, label)
+        log.Printf("marker %q by %s", label, sender)
+        return nil
+    }
+    msg.New(client, player, playerlist.New(client), msg.EventsHandler{
+        PlayerChatMessage: func(m chat.Message, _ bool) error { return onChat(m) },
+        DisguisedChat:     onChat,
+    })
+    var record func(pk.Packet) error
+    client.Events.AddGeneric(bot.PacketHandler{Priority: 100, F: func(p pk.Packet) error {
+        stats.packet(p.ID, len(p.Data))
+        return record(p)
+    }})
+
+    if err := client.JoinServer(server); err != nil {
+        return fmt.Errorf("join %s: %w", server, err)
+    }
+
+    rec, err := recorder.NewFile(out, mcpr.Meta{
+        ServerName: server,
+        MCVersion:  mcVersion,
+        Protocol:   protocolVersion,
+        Generator:  "mc-replay-go/recorderbot",
+    })
+    if err != nil {
+        _ = client.Close()
+        return err
+    }
+    record = adapters.PacketFunc(rec, int32(packetid.BundleDelimiter))
+    if rotate > 0 {
+        rec.SetLimits(recorder.Limits{MaxDuration: rotate, Next: recorder.Parts(out)})
+    }
+    rec.OnFinalize(func(path string) {
+        f := stats.finalized(path, up != nil)
+        log.Printf("✅ finalized %s", path)
+        if up == nil {
+            return
+        }
+        life.Deliver("upload "+path, func(ctx context.Context) error {
+            url, err := up.Upload(ctx, path)
+            stats.uploaded(f, url, err)
+            if err == nil {
+                log.Printf("✅ uploaded %s to %s", path, url)
+            }
+            return err
+        })
+    })
+    // Closing the recorder in the finalize phase triggers the last OnFinalize
+    life.Record(rec, nil)
+
+    if ln != nil {
+        srv := &http.Server{Handler: stats.handler()}
+        life.Go(func(ctx context.Context) {
+            go func() { <-ctx.Done(); _ = srv.Close() }()
+            if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                log.Printf("dashboard: %v", err)
+            }
+        })
+        log.Printf("dashboard on http://%s/", ln.Addr())
+    }
+
+    life.Go(func(ctx context.Context) {
+        go func() { <-ctx.Done(); _ = client.Close() }()
+        if err := client.HandleGame(); err != nil && !errors.Is(err, net.ErrClosed) {
+            log.Printf("bot: %v", err)
+        }
+        // The connection ended on its own: finalize and exit
+        life.Stop()
+    })
+    return life.Wait()
+}
+
+// chatParts returns the sender and text of a chat message decorated by a
+// chat type ("<%s> %s" and the like), or only its text if it is not one.
+func chatParts(m chat.Message) (sender, text string) {
+    if m.Translate != "" && len(m.With) >= 2 {
+        return m.With[0].ClearString(), m.With[len(m.With)-1].ClearString()
+    }
+    return "", m.ClearString()
+}
+
+// allowed reports whether sender may add markers.
+func allowed(sender string, players []string) bool {
+    if len(players) == 0 {
+        return true
+    }
+    for _, p := range players {
+        if strings.EqualFold(p, sender) {
+            return true
+        }
+    }
+    return false
+}
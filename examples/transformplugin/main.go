@@ -0,0 +1,33 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// A transform plugin dropping packets by id, for use as an external stage:
+//
+//  go build -o drop-ids ./examples/transformplugin
+//  go run ./cmd/mcpr-transform -plugin drop-ids=./drop-ids \
+//      --pipeline "drop-ids(0x5A,0x5B)" in.mcpr out.mcpr
+//
+// Only play-state packets are dropped. What the plugin prints reaches the
+// host's stderr.
+func main() {
+    transform.ServePlugin(func(env transform.Env, args transform.Args) (transform.Stage, error) {
+        drop := map[int32]bool{}
+        for _, a := range args.Positional {
+            id, err := strconv.ParseInt(a, 0, 32)
+            if err != nil {
+                return nil, fmt.Errorf("invalid packet id %q", a)
+            }
+            drop[int32(id)] = true
+        }
+        return transform.StageFunc(func(p *transform.Packet) bool {
+            return p.State != protocol.Play || !drop[p.ID]
+        }), nil
+    })
+}
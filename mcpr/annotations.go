@@ -0,0 +1,77 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+)
+
+// AnnotationsEntryName is the archive entry holding annotations, notes tied
+// to a point in the recording for inspection and report tools. ReplayMod
+// ignores it.
+const AnnotationsEntryName = "annotations.json"
+
+// Annotation is a note about the recording at a point in time, such as
+// {"lag", "spike 850ms"} or {"anticheat", "reach 4.2 blocks"}.
+type Annotation struct {
+    Time  uint32 `json:"time"`  // ms from the start of the recording
+    Frame int64  `json:"frame"` // index of the latest frame written before the note, -1 if none
+    Key   string `json:"key"`
+    Value string `json:"value,omitempty"`
+}
+
+// Annotate adds a note at ts, written to annotations.json on Close. The note
+// refers to the latest frame written so far, typically the packet that
+// prompted it. It has no effect if the caller supplies annotations.json
+// itself via CreateEntry or CopyEntry.
+func (w *Writer) Annotate(ts uint32, key, value string) {
+    defer w.lock().unlock()
+    w.drain()
+    w.annotations = append(w.annotations, Annotation{Time: ts, Frame: w.packets - 1, Key: key, Value: value})
+}
+
+func (w *Writer) writeAnnotations() error {
+    if len(w.annotations) == 0 || w.entries[AnnotationsEntryName] {
+        return nil
+    }
+    aw, err := w.createEntry(AnnotationsEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", AnnotationsEntryName, err)
+    }
+    return json.NewEncoder(aw).Encode(w.annotations)
+}
+
+// ReadAnnotations returns the annotations of the replay at path in the order
+// they were added, or nil if it has none.
+func ReadAnnotations(path string) ([]Annotation, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return readAnnotations(zr.File)
+}
+
+// Annotations returns the annotations stored in the replay, see
+// ReadAnnotations.
+func (r *Reader) Annotations() ([]Annotation, error) {
+    return readAnnotations(r.files)
+}
+
+func readAnnotations(files []*zip.File) ([]Annotation, error) {
+    for _, f := range files {
+        if f.Name == AnnotationsEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer rc.Close()
+            var as []Annotation
+            if err := json.NewDecoder(rc).Decode(&as); err != nil {
+                return nil, fmt.Errorf("parse %s: %w", AnnotationsEntryName, err)
+            }
+            return as, nil
+        }
+    }
+    return nil, nil
+}
@@ -0,0 +1,63 @@
+package mcpr
+
+import (
+    "io"
+    "strings"
+
+    "github.com/google/uuid"
+)
+
+// AssetPrefix is the directory of ReplayMod's asset repository, which holds
+// files the editor uses, such as images placed in the scene.
+const AssetPrefix = "asset/"
+
+// AssetRef identifies an asset. ReplayMod stores it in the entry
+// "asset/<uuid>_<name>.<extension>" and refers to it by UUID elsewhere.
+type AssetRef struct {
+    UUID          uuid.UUID `json:"uuid"`
+    Name          string    `json:"name"`
+    FileExtension string    `json:"fileExtension"` // without the dot, e.g. "png"
+}
+
+// EntryName returns the name of the archive entry holding the asset.
+func (a AssetRef) EntryName() string {
+    return AssetPrefix + a.UUID.String() + "_" + a.Name + "." + a.FileExtension
+}
+
+// ParseAssetEntry returns the asset stored in the archive entry name, and
+// false if name is not an asset entry.
+func ParseAssetEntry(name string) (AssetRef, bool) {
+    rest, ok := strings.CutPrefix(name, AssetPrefix)
+    if !ok {
+        return AssetRef{}, false
+    }
+    id, rest, ok := strings.Cut(rest, "_")
+    if !ok {
+        return AssetRef{}, false
+    }
+    u, err := uuid.Parse(id)
+    if err != nil {
+        return AssetRef{}, false
+    }
+    dot := strings.LastIndexByte(rest, '.')
+    if dot < 0 || strings.Contains(rest, "/") {
+        return AssetRef{}, false
+    }
+    return AssetRef{UUID: u, Name: rest[:dot], FileExtension: rest[dot+1:]}, true
+}
+
+// Assets returns the assets of the replay in archive order.
+func (r *Reader) Assets() []AssetRef {
+    var out []AssetRef
+    for _, f := range r.files {
+        if a, ok := ParseAssetEntry(f.Name); ok {
+            out = append(out, a)
+        }
+    }
+    return out
+}
+
+// CreateAsset adds the asset a to the replay, see CreateEntry.
+func (w *Writer) CreateAsset(a AssetRef) (io.Writer, error) {
+    return w.CreateEntry(a.EntryName())
+}
@@ -0,0 +1,143 @@
+package mcpr
+
+import (
+    "fmt"
+    "sync"
+)
+
+// asyncQueue hands the packets of a Writer in async mode to the goroutine
+// writing them, see SetAsync.
+type asyncQueue struct {
+    frames chan asyncFrame
+    done   chan struct{} // closed when the goroutine has returned
+    free   sync.Pool     // *[]byte payload buffers
+
+    mu  sync.Mutex
+    err error // of the first packet that failed
+}
+
+// asyncFrame is a queued packet, or a barrier if barrier is set.
+type asyncFrame struct {
+    ts      uint32
+    id      int32
+    payload *[]byte
+    barrier chan struct{} // closed once the packets before it are written
+}
+
+// asyncMaxReuse is the largest payload buffer kept for reuse; larger ones,
+// such as chunk batches, are left to the garbage collector.
+const asyncMaxReuse = 64 << 10
+
+// SetAsync makes WritePacket, WritePacketFrom and WritePacketBuffers queue
+// packets for a goroutine that writes them, so that compressing and writing
+// the archive does not hold up the goroutine handling the connection. The
+// payload is copied into a reused buffer and the call returns; only when
+// queue packets are waiting already does it block until one is written.
+// queue <= 0 writes packets synchronously again, after those queued.
+//
+// A packet that fails to be written stops the recording: its error is
+// returned by the next write and every one after it, and by Close, which
+// still finishes the archive with the packets written before. The methods
+// reading or changing the recording's state, such as Flush, Snapshot,
+// Dimensions, Annotate, AddTags and CreateEntry, first wait for the queue to
+// drain. Sampling's OnChange runs on the writing goroutine. As in
+// synchronous mode, the Writer is not safe for concurrent use unless made
+// WithLocking.
+//
+// Deprecated: Use WithAsync.
+func (w *Writer) SetAsync(queue int) error {
+    defer w.lock().unlock()
+    if w.closed {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if err := w.stopAsync(); err != nil {
+        return err
+    }
+    if queue <= 0 {
+        return nil
+    }
+    a := &asyncQueue{frames: make(chan asyncFrame, queue), done: make(chan struct{})}
+    w.async = a
+    go w.runAsync(a)
+    return nil
+}
+
+// runAsync writes the packets queued to a until it is closed.
+func (w *Writer) runAsync(a *asyncQueue) {
+    defer close(a.done)
+    for f := range a.frames {
+        if f.barrier != nil {
+            close(f.barrier)
+            continue
+        }
+        if a.failed() == nil {
+            if err := w.write(f.ts, f.id, *f.payload); err != nil {
+                a.fail(err)
+            }
+        }
+        if cap(*f.payload) <= asyncMaxReuse {
+            a.free.Put(f.payload)
+        }
+    }
+}
+
+// stopAsync writes the packets queued and ends async mode, returning the
+// error that stopped it, which also becomes the Writer's.
+func (w *Writer) stopAsync() error {
+    a := w.async
+    if a == nil {
+        return nil
+    }
+    close(a.frames)
+    <-a.done
+    w.async = nil
+    if err := a.failed(); err != nil {
+        if w.broken == nil {
+            w.broken = err
+        }
+        return err
+    }
+    return nil
+}
+
+// drain waits until the packets queued in async mode are written, after
+// which the writing goroutine touches no state until the next packet is
+// queued.
+func (w *Writer) drain() {
+    if w.async == nil {
+        return
+    }
+    b := make(chan struct{})
+    w.async.frames <- asyncFrame{barrier: b}
+    <-b
+}
+
+// buffer returns a payload buffer of n bytes.
+func (a *asyncQueue) buffer(n int) *[]byte {
+    b, _ := a.free.Get().(*[]byte)
+    if b == nil {
+        b = new([]byte)
+    }
+    if cap(*b) < n {
+        *b = make([]byte, n)
+    }
+    *b = (*b)[:n]
+    return b
+}
+
+// queue queues a packet whose payload is in b, from buffer.
+func (a *asyncQueue) queue(ts uint32, id int32, b *[]byte) {
+    a.frames <- asyncFrame{ts: ts, id: id, payload: b}
+}
+
+func (a *asyncQueue) fail(err error) {
+    a.mu.Lock()
+    a.err = err
+    a.mu.Unlock()
+}
+
+func (a *asyncQueue) failed() error {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.err
+}
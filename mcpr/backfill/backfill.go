@@ -0,0 +1,226 @@
+// Package backfill fills in the metadata of replays whose metaData.json was
+// left sparse by old recorders: duration, players, selfId and mcversion (and
+// the protocol, when the packets identify it) are derived from the packets,
+// so old archives can be browsed and cataloged like new ones. A missing date
+// is estimated from the file's modification time, taken as the end of the
+// recording.
+//
+// Derivation is best effort and assumes a vanilla server. The recording
+// player comes from the login success packet and its entity id from the join
+// game packet in every release the protocol detector knows; other players
+// come from the tab list and need a packet table (currently 1.20.2).
+package backfill
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// Derived is the metadata found in a replay's packets.
+type Derived struct {
+	Protocol  int      // from metaData.json, or guessed if the packets fit only one; 0 if unknown
+	MCVersion string   // release of Protocol, "" if unknown
+	Duration  int      // ms, time of the last packet
+	Date      int64    // unix ms, file modification time less Duration
+	SelfID    int      // entity id of the recording player, -1 if not found
+	Players   []string // UUIDs of the recording player and the tab list, in order of appearance
+}
+
+// Derive scans the packets of the replay at path.
+func Derive(path string) (Derived, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return Derived{}, err
+	}
+	defer ar.Close()
+
+	d := Derived{Protocol: ar.Meta.Protocol, SelfID: -1}
+	seen := map[string]bool{}
+	addPlayer := func(uuid string) {
+		if uuid != "" && !seen[uuid] {
+			seen[uuid] = true
+			d.Players = append(d.Players, uuid)
+		}
+	}
+	det := protocol.NewDetector()
+	joined := false
+	var table *protocol.Table
+	var tracker *protocol.Tracker // follows the states after the join game packet
+	err = ar.Each(func(f tmcpr.Frame) error {
+		d.Duration = max(d.Duration, int(f.Time))
+		if !joined {
+			if f.ID == 0x02 {
+				if uuid, ok := loginSuccess(f.Payload); ok {
+					addPlayer(uuid)
+				}
+			}
+			if !det.Observe(f.ID, f.Payload) {
+				return nil
+			}
+			// The first play packet is the join game packet: entity:i32 ...
+			joined = true
+			r := wire.NewDecoder(f.Payload)
+			if eid := r.Int(); r.Err == nil && eid >= 0 {
+				d.SelfID = int(eid)
+			}
+			if d.Protocol == 0 {
+				if g := det.Guess(); g.Certain() {
+					d.Protocol = g.Protocol
+				}
+			}
+			if t, ok := protocol.Lookup(d.Protocol); ok && t.HasPlayers() {
+				table, tracker = t, protocol.NewTracker(t, protocol.Play)
+			}
+			return nil
+		}
+		if tracker != nil && tracker.Observe(f.ID) == protocol.Play {
+			if uuids, ok := table.Players(f.ID, f.Payload); ok {
+				for _, u := range uuids {
+					addPlayer(u)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Derived{}, fmt.Errorf("%s: %w", path, err)
+	}
+	d.MCVersion = release(d.Protocol)
+	if fi, err := os.Stat(path); err == nil {
+		d.Date = fi.ModTime().UnixMilli() - int64(d.Duration)
+	}
+	return d, nil
+}
+
+// loginSuccess returns the UUID in a login success payload: uuid:16 name:string ...
+func loginSuccess(p []byte) (string, bool) {
+	d := wire.NewDecoder(p)
+	uuid := d.UUID()
+	name := d.String()
+	return uuid, d.Err == nil && len(name) > 0 && len(name) <= 16
+}
+
+// release returns the Minecraft release of a protocol. Where releases share
+// a protocol, e.g. "1.20-1.20.1", it is the last one, which servers stayed on.
+func release(proto int) string {
+	r := protocol.Releases[proto]
+	if i := strings.LastIndexByte(r, '-'); i >= 0 {
+		r = r[i+1:]
+	}
+	return r
+}
+
+// Patch returns the patch filling the fields of m that d knows and m lacks,
+// or that differ from d if overwrite is set, and the names of those fields
+// as in metaData.json. Duration is not part of the patch: rewriting a
+// replay recomputes it.
+func Patch(m mcpr.Meta, d Derived, overwrite bool) (mcpr.MetaPatch, []string) {
+	var p mcpr.MetaPatch
+	var fields []string
+	if d.Duration > 0 && (m.Duration == 0 || overwrite && m.Duration != d.Duration) {
+		fields = append(fields, "duration")
+	}
+	// Never overwritten: a recorded date beats an estimate
+	if d.Date > 0 && m.Date == 0 {
+		p.Date = &d.Date
+		fields = append(fields, "date")
+	}
+	if d.Protocol != 0 && m.Protocol == 0 {
+		p.Protocol = &d.Protocol
+		fields = append(fields, "protocol")
+	}
+	if d.MCVersion != "" && (m.MCVersion == "" || overwrite && m.MCVersion != d.MCVersion) {
+		p.MCVersion = &d.MCVersion
+		fields = append(fields, "mcversion")
+	}
+	// selfId 0 is what writers that never set it leave behind
+	if d.SelfID >= 0 && (m.SelfID == 0 || overwrite && m.SelfID != d.SelfID) {
+		p.SelfID = &d.SelfID
+		fields = append(fields, "selfId")
+	}
+	if len(d.Players) > 0 {
+		players := d.Players
+		if !overwrite {
+			players = union(m.Players, d.Players)
+		}
+		if len(players) != len(m.Players) || overwrite && !equal(players, m.Players) {
+			p.Players = players
+			fields = append(fields, "players")
+		}
+	}
+	return p, fields
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, s := range b {
+		if !contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Options configure File.
+type Options struct {
+	Overwrite bool // replace fields that disagree with the packets, not only missing ones
+	DryRun    bool // report what would be filled without rewriting
+}
+
+// Result describes a backfilled replay.
+type Result struct {
+	Derived Derived
+	Filled  []string // fields filled in, see Patch; empty if nothing was missing
+}
+
+// File backfills the metadata of the replay at path, rewriting it in place
+// (see transform.RewriteFile) unless nothing is missing or opts.DryRun is set.
+func File(path string, opts Options) (Result, error) {
+	d, err := Derive(path)
+	if err != nil {
+		return Result{}, err
+	}
+	m, err := mcpr.ReadMeta(path)
+	if err != nil {
+		return Result{}, err
+	}
+	patch, fields := Patch(m, d, opts.Overwrite)
+	res := Result{Derived: d, Filled: fields}
+	if len(fields) == 0 || opts.DryRun {
+		return res, nil
+	}
+	_, err = transform.RewriteFile(path, path, &transform.Pipeline{}, transform.Options{
+		Meta:      &patch,
+		Operation: "backfill " + strings.Join(fields, ", "),
+	})
+	return res, err
+}
@@ -0,0 +1,80 @@
+package mcpr
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+)
+
+// output is the destination of an archive the Writer owns, written through a
+// buffer once SetBufferSize sets one.
+type output struct {
+    w   io.Writer
+    buf *bufio.Writer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+    if o.buf != nil {
+        return o.buf.Write(p)
+    }
+    return o.w.Write(p)
+}
+
+// flush writes out the buffered bytes, if any.
+func (o *output) flush() error {
+    if o.buf == nil {
+        return nil
+    }
+    return o.buf.Flush()
+}
+
+// SetBufferSize writes the archive to its destination in blocks of n bytes,
+// instead of the 4 KiB the zip package buffers; n <= 0 removes the buffer.
+// On network filesystems and other destinations where each write is costly,
+// a buffer of 1 MiB or more turns thousands of small writes per second into
+// a few large ones. Close flushes the buffer, Flush does so at any time.
+//
+// Bytes still buffered are lost if the process dies, in addition to the
+// central directory every unfinished archive lacks. The buffer belongs to
+// the archive's destination, so writers made by NewWriterInZip, whose archive
+// the caller owns, cannot have one; buffer that archive's destination
+// instead.
+//
+// Deprecated: Use WithBufferSize.
+func (w *Writer) SetBufferSize(n int) error {
+    defer w.lock().unlock()
+    w.drain()
+    if w.closed {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if w.out == nil {
+        return fmt.Errorf("mcpr: SetBufferSize needs a writer made by NewWriter or Create")
+    }
+    if err := w.out.flush(); err != nil {
+        return err
+    }
+    w.out.buf = nil
+    if n > 0 {
+        w.out.buf = bufio.NewWriterSize(w.out.w, n)
+    }
+    return nil
+}
+
+// Flush writes everything written to the archive so far through to its
+// destination, except what the compressor of recording.tmcpr still holds
+// back, so that the file on disk is as complete as it can be without
+// closing the writer. It does not sync the file; call Sync on it for that.
+func (w *Writer) Flush() error {
+    defer w.lock().unlock()
+    w.drain()
+    if w.closed {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if err := w.zw.Flush(); err != nil {
+        return err
+    }
+    if w.out == nil {
+        return nil
+    }
+    return w.out.flush()
+}
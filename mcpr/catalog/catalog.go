@@ -0,0 +1,245 @@
+// Package catalog indexes a library of replays into a single JSON file, so
+// tools can list and filter replays by metadata, tags and markers without
+// opening every archive.
+//
+// The catalog is rebuilt incrementally: Update only re-reads replays whose
+// size or modification time changed since they were indexed.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// DefaultFile is the catalog file name used by the CLIs.
+const DefaultFile = "catalog.json"
+
+// Entry is one indexed replay.
+type Entry struct {
+	Path    string    `json:"path"` // absolute
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Meta    mcpr.Meta `json:"meta"`
+	Tags    []string  `json:"tags,omitempty"`
+	Markers []string  `json:"markers,omitempty"` // marker names
+
+	// Set for replays that were deleted, see WriteTombstone.
+	Deleted      *time.Time `json:"deleted,omitempty"`
+	DeleteReason string     `json:"deleteReason,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"` // of the deleted file
+}
+
+// Time returns the recording's start time, or the file's modification time if
+// the metadata has no date.
+func (e *Entry) Time() time.Time {
+	if e.Meta.Date != 0 {
+		return time.UnixMilli(e.Meta.Date)
+	}
+	return e.ModTime
+}
+
+// Catalog is a set of indexed replays, sorted by path.
+type Catalog struct {
+	Updated time.Time `json:"updated"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Load reads the catalog at path. A missing file yields an empty catalog.
+func Load(path string) (*Catalog, error) {
+	c := &Catalog{Entries: []Entry{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the catalog to path, via a temporary file renamed into place.
+func (c *Catalog) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get returns the entry for path.
+func (c *Catalog) Get(path string) (*Entry, bool) {
+	i := sort.Search(len(c.Entries), func(i int) bool { return c.Entries[i].Path >= path })
+	if i < len(c.Entries) && c.Entries[i].Path == path {
+		return &c.Entries[i], true
+	}
+	return nil, false
+}
+
+// Put adds or replaces the entry for e.Path.
+func (c *Catalog) Put(e Entry) {
+	if old, ok := c.Get(e.Path); ok {
+		*old = e
+		return
+	}
+	c.Entries = append(c.Entries, e)
+	sort.Slice(c.Entries, func(i, j int) bool { return c.Entries[i].Path < c.Entries[j].Path })
+}
+
+// Refresh re-reads the replay at path into the catalog.
+func (c *Catalog) Refresh(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	e, err := Read(path)
+	if err != nil {
+		return err
+	}
+	e.Size, e.ModTime = fi.Size(), fi.ModTime()
+	c.Put(*e)
+	c.Updated = time.Now().UTC()
+	return nil
+}
+
+// Stats summarizes an Update.
+type Stats struct {
+	Added, Updated, Removed, Unchanged int
+	Tombstones                         int              // entries of deleted replays, see WriteTombstone
+	Failed                             map[string]error // replays that could not be read
+}
+
+// Update indexes the .mcpr files under root: new and changed replays are
+// read, unchanged ones kept, and entries under root whose file is gone are
+// removed, or replaced by the replay's tombstone if it has one. Entries
+// outside root are left alone. Unreadable replays and tombstones are
+// reported in Stats.Failed and skipped.
+func (c *Catalog) Update(root string) (Stats, error) {
+	st := Stats{Failed: map[string]error{}}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return st, err
+	}
+	old := map[string]Entry{}
+	var keep, tombs []Entry
+	for _, e := range c.Entries {
+		if within(root, e.Path) {
+			old[e.Path] = e
+		} else {
+			keep = append(keep, e)
+		}
+	}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isTombstone(path) {
+			e, err := ReadTombstone(path)
+			if err != nil {
+				st.Failed[path] = err
+			} else {
+				tombs = append(tombs, *e)
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".mcpr") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		prev, known := old[path]
+		delete(old, path)
+		if known && prev.Size == fi.Size() && prev.ModTime.Equal(fi.ModTime()) {
+			keep = append(keep, prev)
+			st.Unchanged++
+			return nil
+		}
+		e, err := Read(path)
+		if err != nil {
+			st.Failed[path] = err
+			return nil
+		}
+		e.Size, e.ModTime = fi.Size(), fi.ModTime()
+		keep = append(keep, *e)
+		if known {
+			st.Updated++
+		} else {
+			st.Added++
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	live := map[string]bool{}
+	for _, e := range keep {
+		live[e.Path] = true
+	}
+	for _, e := range tombs {
+		if live[e.Path] {
+			continue // restored
+		}
+		delete(old, e.Path)
+		keep = append(keep, e)
+		st.Tombstones++
+	}
+	st.Removed = len(old)
+	sort.Slice(keep, func(i, j int) bool { return keep[i].Path < keep[j].Path })
+	if keep == nil {
+		keep = []Entry{}
+	}
+	c.Entries = keep
+	c.Updated = time.Now().UTC()
+	return st, nil
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Read indexes the replay at path.
+func Read(path string) (*Entry, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := mcpr.ReadMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Path: path, Meta: meta}
+	ext, err := mcpr.ReadExtMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	e.Tags = ext.Tags
+	ms, err := mcpr.ReadMarkers(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		if m.Name != "" {
+			e.Markers = append(e.Markers, m.Name)
+		}
+	}
+	return e, nil
+}
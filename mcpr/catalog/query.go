@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// Query selects catalog entries. Zero fields match everything, except that
+// deleted replays (see WriteTombstone) are only included with
+// IncludeDeleted; an entry must match all set fields.
+type Query struct {
+	Player   string    // UUID, with or without dashes
+	Server   string    // case-insensitive substring of the server or custom server name
+	After    time.Time // recorded at or after
+	Before   time.Time // recorded before
+	Tags     []string  // all present
+	Marker   string    // case-insensitive substring of a marker name
+	Protocol int
+
+	IncludeDeleted bool // also match the tombstones of deleted replays
+}
+
+// Match reports whether e satisfies q.
+func (q Query) Match(e *Entry) bool {
+	if e.Deleted != nil && !q.IncludeDeleted {
+		return false
+	}
+	if q.Player != "" && !hasPlayer(e.Meta.Players, q.Player) {
+		return false
+	}
+	if q.Server != "" {
+		s := strings.ToLower(q.Server)
+		if !strings.Contains(strings.ToLower(e.Meta.ServerName), s) &&
+			!strings.Contains(strings.ToLower(e.Meta.CustomServerName), s) {
+			return false
+		}
+	}
+	t := e.Time()
+	if !q.After.IsZero() && t.Before(q.After) || !q.Before.IsZero() && !t.Before(q.Before) {
+		return false
+	}
+	for _, tag := range mcpr.NormalizeTags(q.Tags) {
+		if !contains(e.Tags, tag) {
+			return false
+		}
+	}
+	if q.Marker != "" && !hasMarker(e.Markers, q.Marker) {
+		return false
+	}
+	return q.Protocol == 0 || e.Meta.Protocol == q.Protocol
+}
+
+// Search returns the entries matching q, oldest first.
+func (c *Catalog) Search(q Query) []Entry {
+	out := []Entry{}
+	for i := range c.Entries {
+		if q.Match(&c.Entries[i]) {
+			out = append(out, c.Entries[i])
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time().Before(out[j].Time()) })
+	return out
+}
+
+func hasPlayer(players []string, uuid string) bool {
+	want := strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+	for _, p := range players {
+		if strings.ToLower(strings.ReplaceAll(p, "-", "")) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMarker(names []string, sub string) bool {
+	sub = strings.ToLower(sub)
+	for _, n := range names {
+		if strings.Contains(strings.ToLower(n), sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TombstoneExt is appended to the path of a deleted replay to name its
+// tombstone, e.g. session.mcpr.tombstone.
+const TombstoneExt = ".tombstone"
+
+// WriteTombstone records the replay at path before it is deleted: its entry
+// (metadata, tags and marker names) with Deleted, DeleteReason and the
+// SHA-256 of the file, so the replay stays in searches and an accidental
+// deletion can be matched against backups. The tombstone is a small JSON
+// file next to the replay that Update indexes in its place; PurgeTombstones
+// removes it for good. Deleting the replay is up to the caller.
+func WriteTombstone(path, reason string) (*Entry, error) {
+	e, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("hash %s: %w", path, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	e.Size, e.ModTime = n, fi.ModTime()
+	e.Deleted, e.DeleteReason, e.SHA256 = &now, reason, hex.EncodeToString(h.Sum(nil))
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	dst := path + TombstoneExt
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return nil, err
+	}
+	return e, os.Rename(tmp, dst)
+}
+
+// ReadTombstone reads the tombstone file at path. The entry's Path is that
+// of the deleted replay next to it, even if the library was moved since.
+func ReadTombstone(path string) (*Entry, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if e.Deleted == nil {
+		return nil, fmt.Errorf("parse %s: not a tombstone", path)
+	}
+	e.Path = strings.TrimSuffix(path, TombstoneExt)
+	return &e, nil
+}
+
+// isTombstone reports whether path names the tombstone of a replay.
+func isTombstone(path string) bool {
+	return strings.HasSuffix(path, TombstoneExt) &&
+		strings.EqualFold(filepath.Ext(strings.TrimSuffix(path, TombstoneExt)), ".mcpr")
+}
+
+// PurgeTombstones removes the tombstones under root of replays deleted
+// before the given time (all of them if it is zero), and their entries, so
+// the replays are gone for good. It returns the paths of the replays purged.
+func (c *Catalog) PurgeTombstones(root string, before time.Time) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isTombstone(path) {
+			return nil
+		}
+		e, err := ReadTombstone(path)
+		if err != nil {
+			return err
+		}
+		if !before.IsZero() && !e.Deleted.Before(before) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		purged = append(purged, strings.TrimSuffix(path, TombstoneExt))
+		return nil
+	})
+	for _, p := range purged {
+		if e, ok := c.Get(p); ok && e.Deleted != nil {
+			c.remove(p)
+		}
+	}
+	if len(purged) > 0 {
+		c.Updated = time.Now().UTC()
+	}
+	return purged, err
+}
+
+// remove drops the entry for path.
+func (c *Catalog) remove(path string) {
+	for i := range c.Entries {
+		if c.Entries[i].Path == path {
+			c.Entries = append(c.Entries[:i], c.Entries[i+1:]...)
+			return
+		}
+	}
+}
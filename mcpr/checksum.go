@@ -0,0 +1,206 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "errors"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// ErrNoChecksum is returned by Reader.VerifyChecksum for replays without a
+// recording.tmcpr.crc32 entry.
+var ErrNoChecksum = errors.New("mcpr: no recording.tmcpr.crc32")
+
+// ChecksumError is returned by Reader.VerifyChecksum when recording.tmcpr
+// does not match the CRC-32 stored next to it.
+type ChecksumError struct {
+    Want uint32 // stored in recording.tmcpr.crc32
+    Got  uint32 // computed from recording.tmcpr
+}
+
+func (e *ChecksumError) Error() string {
+    return fmt.Sprintf("mcpr: recording.tmcpr checksum mismatch: stored %d, computed %d", e.Want, e.Got)
+}
+
+// VerifyChecksum streams recording.tmcpr through CRC-32 and compares it with
+// the recording.tmcpr.crc32 entry the writer stores. It returns a
+// *ChecksumError on mismatch and ErrNoChecksum if the replay has no
+// checksum. Call it right after opening to refuse corrupted replays before
+// reading packets; it decompresses the whole recording once, independently of
+// Next.
+func (r *Reader) VerifyChecksum() error {
+    if r.sum == nil {
+        return ErrNoChecksum
+    }
+    return verifyChecksum(r.rec, r.sum)
+}
+
+func verifyChecksum(rec, sum *zip.File) error {
+    want, err := readChecksum(sum)
+    if err != nil {
+        return err
+    }
+    rc, err := rec.Open()
+    if err != nil {
+        return fmt.Errorf("open recording.tmcpr: %w", err)
+    }
+    defer rc.Close()
+    h := crc32.NewIEEE()
+    if _, err := io.Copy(h, rc); err != nil {
+        return fmt.Errorf("read recording.tmcpr: %w", err)
+    }
+    if got := h.Sum32(); got != want {
+        return &ChecksumError{Want: want, Got: got}
+    }
+    return nil
+}
+
+// readChecksum parses recording.tmcpr.crc32, a decimal number.
+func readChecksum(f *zip.File) (uint32, error) {
+    rc, err := f.Open()
+    if err != nil {
+        return 0, fmt.Errorf("open recording.tmcpr.crc32: %w", err)
+    }
+    defer rc.Close()
+    b, err := io.ReadAll(io.LimitReader(rc, 32))
+    if err != nil {
+        return 0, fmt.Errorf("read recording.tmcpr.crc32: %w", err)
+    }
+    v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+    if err != nil {
+        return 0, fmt.Errorf("parse recording.tmcpr.crc32: %w", err)
+    }
+    return uint32(v), nil
+}
+
+// FixChecksum rewrites the recording.tmcpr.crc32 entry of the replay at path
+// to match its recording, for replays whose recording was edited on purpose
+// by a tool that did not update the checksum. It first reads the recording
+// frame by frame and refuses to touch replays where that fails, since a
+// checksum mismatch with a broken stream means corruption, not an edit.
+// Archives failing CheckArchive are refused too, so unsafe or duplicate
+// entries are never re-signed as valid.
+//
+// It returns the mismatch it corrected, or nil if the checksum already
+// matched and the file was left alone. The other entries are copied without
+// recompression; the archive is written to a temporary file and renamed into
+// place, and a sidecar next to the replay (see WriteSidecar) is updated.
+func FixChecksum(path string) (*ChecksumError, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    var rec, sum *zip.File
+    for _, f := range zr.File {
+        switch f.Name {
+        case "recording.tmcpr":
+            rec = f
+        case "recording.tmcpr.crc32":
+            sum = f
+        }
+    }
+    if rec == nil {
+        return nil, errors.New("mcpr: missing recording.tmcpr")
+    }
+    if sum == nil {
+        return nil, ErrNoChecksum
+    }
+    want, err := readChecksum(sum)
+    if err != nil {
+        return nil, err
+    }
+    got, err := framedChecksum(rec)
+    if err != nil {
+        return nil, fmt.Errorf("mcpr: recording.tmcpr looks corrupt, not fixing its checksum: %w", err)
+    }
+    if got == want {
+        return nil, nil
+    }
+
+    tmp := path + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return nil, err
+    }
+    zw := zip.NewWriter(out)
+    copyAll := func() error {
+        for _, f := range zr.File {
+            if f == sum {
+                w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+                if err != nil {
+                    return err
+                }
+                if _, err := fmt.Fprintf(w, "%d", got); err != nil {
+                    return err
+                }
+                continue
+            }
+            hdr := f.FileHeader
+            w, err := zw.CreateRaw(&hdr)
+            if err != nil {
+                return err
+            }
+            r, err := f.OpenRaw()
+            if err != nil {
+                return err
+            }
+            if _, err := io.Copy(w, r); err != nil {
+                return fmt.Errorf("copy %s: %w", f.Name, err)
+            }
+        }
+        if err := zw.Close(); err != nil {
+            return err
+        }
+        return out.Close()
+    }
+    if err := copyAll(); err != nil {
+        _ = out.Close()
+        _ = os.Remove(tmp)
+        return nil, err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        return nil, err
+    }
+    if sc, err := ReadSidecar(path); err == nil {
+        sc.RecordingCRC32 = got
+        if err := WriteSidecar(path, sc); err != nil {
+            return nil, err
+        }
+    }
+    return &ChecksumError{Want: want, Got: got}, nil
+}
+
+// framedChecksum computes the CRC-32 of rec while checking that it is a
+// sequence of complete frames.
+func framedChecksum(rec *zip.File) (uint32, error) {
+    rc, err := rec.Open()
+    if err != nil {
+        return 0, err
+    }
+    defer rc.Close()
+    h := crc32.NewIEEE()
+    fr := tmcpr.NewReader(io.TeeReader(rc, h))
+    for {
+        _, _, err := fr.NextHeader()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return 0, err
+        }
+        if err := fr.Skip(); err != nil {
+            return 0, err
+        }
+    }
+    if _, err := io.Copy(h, rc); err != nil {
+        return 0, err
+    }
+    return h.Sum32(), nil
+}
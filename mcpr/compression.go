@@ -0,0 +1,92 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "compress/flate"
+    "fmt"
+    "io"
+)
+
+// Compression selects how the Writer compresses archive entries, see
+// WithRecordingCompression and WithEntryCompression. The zero value is the
+// default: Deflate at flate.DefaultCompression.
+type Compression struct {
+    Level int  // Deflate level from 1 (fastest) to 9 (smallest); 0 is the default level
+    Store bool // store entries uncompressed (method Store), which costs no CPU
+}
+
+func (c Compression) check() error {
+    if c.Level < 0 || c.Level > flate.BestCompression {
+        return fmt.Errorf("mcpr: invalid deflate level %d, want 1-9 or 0 for the default", c.Level)
+    }
+    if c.Store && c.Level != 0 {
+        return fmt.Errorf("mcpr: deflate level %d for stored entries", c.Level)
+    }
+    return nil
+}
+
+// level returns the flate level of c.
+func (c Compression) level() int {
+    if c.Level == 0 {
+        return flate.DefaultCompression
+    }
+    return c.Level
+}
+
+// WithRecordingCompression sets the compression of recording.tmcpr, which
+// takes nearly all of the Writer's CPU time. Recording at high packet rates
+// on small machines is often bound by the default level: level 1 costs a
+// fraction of it for somewhat larger files, and Store none at all. Files
+// stay readable by ReplayMod either way.
+func WithRecordingCompression(c Compression) WriterOption {
+    return func(w *Writer) error {
+        if err := c.check(); err != nil {
+            return err
+        }
+        w.recComp = c
+        return nil
+    }
+}
+
+// WithEntryCompression sets the compression of the other entries the Writer
+// creates: metadata, markers and the like, and those from CreateEntry, such
+// as assets. CopyEntry keeps the compression of the copied entry.
+func WithEntryCompression(c Compression) WriterOption {
+    return func(w *Writer) error {
+        if err := c.check(); err != nil {
+            return err
+        }
+        w.entryComp = c
+        return nil
+    }
+}
+
+// registerCompressor makes Deflate entries of w.zw use the level set before
+// their creation, if a level other than the default is configured. For
+// NewWriterInZip this replaces the Deflate compressor of the caller's
+// archive, whose own entries then get the default level.
+func (w *Writer) registerCompressor() {
+    if w.recComp.Level == 0 && w.entryComp.Level == 0 {
+        return
+    }
+    w.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+        return flate.NewWriter(out, w.level)
+    })
+    w.level = flate.DefaultCompression
+}
+
+// create adds the entry name, below the prefix, compressed as c says.
+func (w *Writer) create(name string, c Compression) (io.Writer, error) {
+    if c.Store {
+        return w.zw.CreateHeader(&zip.FileHeader{Name: w.prefix + name, Method: zip.Store})
+    }
+    w.level = c.level()
+    defer func() { w.level = flate.DefaultCompression }()
+    return w.zw.Create(w.prefix + name)
+}
+
+// createEntry adds the entry name, below the prefix, compressed as set by
+// WithEntryCompression.
+func (w *Writer) createEntry(name string) (io.Writer, error) {
+    return w.create(name, w.entryComp)
+}
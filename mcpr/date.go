@@ -0,0 +1,75 @@
+package mcpr
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Styles for FormatDate.
+const (
+    DateISO   = "iso"   // ISO 8601 / RFC 3339, e.g. 2024-05-01T18:30:00+02:00
+    DateHuman = "human" // e.g. Wed, 01 May 2024 18:30:00 CEST
+    DateEpoch = "epoch" // unix milliseconds, as stored in metaData.json
+)
+
+// dateLayouts are the layouts ParseDate tries, in order.
+var dateLayouts = []string{
+    time.RFC3339Nano,
+    "2006-01-02T15:04:05",
+    "2006-01-02T15:04",
+    "2006-01-02 15:04:05Z07:00",
+    "2006-01-02 15:04:05 -0700",
+    "2006-01-02 15:04:05",
+    "2006-01-02 15:04",
+    "2006-01-02",
+    time.RFC1123Z,
+    time.RFC1123,
+    time.UnixDate,
+}
+
+// ParseDate parses a recording date as users write it when editing replays:
+// an ISO 8601 date or time such as 2024-05-01, 2024-05-01 18:30 or
+// 2024-05-01T18:30:00+02:00, an RFC 1123 or date(1) timestamp, unix
+// milliseconds as in metaData.json (1714581000000), unix seconds prefixed
+// with '@' (@1714581000), or "now". Times without a zone are in loc.
+func ParseDate(s string, loc *time.Location) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    switch {
+    case s == "now":
+        return time.Now().In(loc), nil
+    case strings.HasPrefix(s, "@"):
+        if sec, err := strconv.ParseInt(s[1:], 10, 64); err == nil {
+            return time.Unix(sec, 0).In(loc), nil
+        }
+    default:
+        if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+            return time.UnixMilli(ms).In(loc), nil
+        }
+    }
+    for _, l := range dateLayouts {
+        if t, err := time.ParseInLocation(l, s, loc); err == nil {
+            return t, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf("mcpr: invalid date %q, want e.g. 2024-05-01T18:30:00+02:00, 2024-05-01 18:30, unix ms or @unix seconds", s)
+}
+
+// FormatDate formats a Meta.Date, unix milliseconds, in the given style and
+// time zone. Dates of 0 (unknown) format as "".
+func FormatDate(ms int64, style string, loc *time.Location) (string, error) {
+    if ms == 0 {
+        return "", nil
+    }
+    t := time.UnixMilli(ms).In(loc)
+    switch style {
+    case DateISO:
+        return t.Format(time.RFC3339), nil
+    case DateHuman:
+        return t.Format(time.RFC1123), nil
+    case DateEpoch:
+        return strconv.FormatInt(ms, 10), nil
+    }
+    return "", fmt.Errorf("mcpr: unknown date style %q, want %s, %s or %s", style, DateISO, DateHuman, DateEpoch)
+}
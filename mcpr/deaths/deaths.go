@@ -0,0 +1,291 @@
+// Package deaths extracts a death feed from a replay: who died, when, how and
+// — as far as the recording shows — who killed them.
+//
+// Deaths come from the death messages the server sends (to the dying player
+// and, unless disabled, to everyone in chat), which name the killer for most
+// causes. When a message does not, the last damage the victim took from a
+// player within AssistWindow is used instead, if the recording saw it.
+package deaths
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// AssistWindow is how long (ms) damage from a player counts towards a death
+// whose message names no killer.
+const AssistWindow = 10000
+
+// Death is one death.
+type Death struct {
+	Time    uint32 `json:"time"` // ms
+	Victim  string `json:"victim"`
+	Killer  string `json:"killer,omitempty"` // player name or mob type
+	Weapon  string `json:"weapon,omitempty"` // e.g. "[Diamond Sword]"
+	Cause   string `json:"cause"`            // message key, e.g. "death.attack.player"
+	Message string `json:"message"`          // flattened death message
+
+	// Attribution tells how Killer was found: "message" or "damage".
+	Attribution string `json:"attribution,omitempty"`
+	// Self is set for deaths of the recording player.
+	Self bool `json:"self,omitempty"`
+}
+
+// Description is a one-line summary, e.g. "Steve was killed by Alex".
+func (d Death) Description() string {
+	switch {
+	case d.Killer != "" && d.Weapon != "":
+		return fmt.Sprintf("%s was killed by %s using %s", d.Victim, d.Killer, d.Weapon)
+	case d.Killer != "":
+		return fmt.Sprintf("%s was killed by %s", d.Victim, d.Killer)
+	}
+	return fmt.Sprintf("%s died (%s)", d.Victim, strings.TrimPrefix(d.Cause, "death."))
+}
+
+// PlayerStats are the kills and deaths of one player.
+type PlayerStats struct {
+	Name   string `json:"name"`
+	Kills  int    `json:"kills"`
+	Deaths int    `json:"deaths"`
+}
+
+// Stats tallies kills and deaths per player, most kills first (then fewest
+// deaths, then name). Mobs are counted as killers like players.
+func Stats(deaths []Death) []PlayerStats {
+	byName := map[string]*PlayerStats{}
+	get := func(name string) *PlayerStats {
+		if byName[name] == nil {
+			byName[name] = &PlayerStats{Name: name}
+		}
+		return byName[name]
+	}
+	for _, d := range deaths {
+		get(d.Victim).Deaths++
+		if d.Killer != "" && d.Killer != d.Victim {
+			get(d.Killer).Kills++
+		}
+	}
+	out := make([]PlayerStats, 0, len(byName))
+	for _, s := range byName {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Kills != b.Kills {
+			return a.Kills > b.Kills
+		}
+		if a.Deaths != b.Deaths {
+			return a.Deaths < b.Deaths
+		}
+		return a.Name < b.Name
+	})
+	return out
+}
+
+// Markers returns one replay marker per death, named by its description.
+func Markers(deaths []Death) []mcpr.Marker {
+	out := make([]mcpr.Marker, 0, len(deaths))
+	for _, d := range deaths {
+		out = append(out, mcpr.Marker{Time: int(d.Time), Name: d.Description()})
+	}
+	return out
+}
+
+// WriteJSON writes deaths as indented JSON.
+func WriteJSON(w io.Writer, deaths []Death) error {
+	if deaths == nil {
+		deaths = []Death{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(deaths)
+}
+
+// ErrUnsupported is returned for protocols without decoders.
+var ErrUnsupported = errors.New("deaths: protocol not supported")
+
+// Analyzer collects deaths from the clientbound packets of a recording.
+type Analyzer struct {
+	table   *protocol.Table
+	tracker *protocol.Tracker
+	dec     decoder
+	deaths  []Death
+
+	self     string           // recording player's name
+	selfID   int32            // recording player's entity id
+	names    map[string]string // player UUID → name
+	entities map[int32]string  // entity id → UUID
+	lastHit  map[int32]hit     // victim entity id → last damage by an entity
+}
+
+type hit struct {
+	by int32
+	ts uint32
+}
+
+// NewAnalyzer returns an analyzer for a recording of the given protocol that
+// starts in state s (protocol.Login for ReplayMod recordings).
+func NewAnalyzer(proto int, s protocol.State) (*Analyzer, error) {
+	table, ok := protocol.Lookup(proto)
+	dec, ok2 := decoders[proto]
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, proto)
+	}
+	return &Analyzer{
+		table:    table,
+		tracker:  protocol.NewTracker(table, s),
+		dec:      dec,
+		selfID:   -1,
+		names:    map[string]string{},
+		entities: map[int32]string{},
+		lastHit:  map[int32]hit{},
+	}, nil
+}
+
+// Observe feeds one packet.
+func (a *Analyzer) Observe(ts uint32, id int32, payload []byte) error {
+	state := a.tracker.Observe(id)
+	name := a.table.Name(protocol.Clientbound, state, id)
+	if state == protocol.Login {
+		if name == "GameProfile" {
+			d := wire.NewDecoder(payload)
+			uuid := d.UUID()
+			a.self = d.String()
+			a.names[uuid] = a.self
+		}
+		return nil
+	}
+	if state != protocol.Play {
+		return nil
+	}
+	d := wire.NewDecoder(payload)
+	switch name {
+	case "Login":
+		a.selfID = d.Int()
+	case "AddEntity":
+		eid := d.VarInt()
+		a.entities[eid] = d.UUID()
+	case "RemoveEntities":
+		for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+			eid := d.VarInt()
+			delete(a.entities, eid)
+			delete(a.lastHit, eid)
+		}
+	case "PlayerInfoUpdate":
+		a.dec.playerInfo(d, a.names)
+	case "DamageEvent":
+		victim, by := a.dec.damage(d)
+		if by >= 0 {
+			a.lastHit[victim] = hit{by: by, ts: ts}
+		}
+	case "PlayerCombatKill":
+		eid := d.VarInt()
+		msg := d.String()
+		if d.Err == nil && eid == a.selfID {
+			a.death(ts, msg, true)
+		}
+	case "SystemChat":
+		msg := d.String()
+		if d.Err == nil && !d.Bool() {
+			a.death(ts, msg, false)
+		}
+	default:
+		return nil
+	}
+	if d.Err != nil {
+		return fmt.Errorf("%s at %d ms: %w", name, ts, d.Err)
+	}
+	return nil
+}
+
+// death records msg if it is a death message.
+func (a *Analyzer) death(ts uint32, msg string, self bool) {
+	key, args, ok := wire.Translation(msg)
+	if !ok || !strings.HasPrefix(key, "death.") || len(args) == 0 {
+		return
+	}
+	dt := Death{Time: ts, Victim: args[0], Cause: key, Message: wire.PlainText(msg), Self: self || args[0] == a.self}
+	// The dying player gets the message twice: as the death screen text and,
+	// when death messages are shown, in chat
+	if n := len(a.deaths); n > 0 {
+		prev := a.deaths[n-1]
+		if prev.Message == dt.Message && ts-prev.Time <= 1000 {
+			return
+		}
+	}
+	// The second argument names the attacker for every cause that has one;
+	// ".item" variants add the weapon. badRespawnPoint's is a link.
+	if len(args) > 1 && !strings.HasPrefix(key, "death.attack.badRespawnPoint") {
+		dt.Killer = entityName(args[1])
+		dt.Attribution = "message"
+		if strings.HasSuffix(key, ".item") && len(args) > 2 {
+			dt.Weapon = args[2]
+		}
+	} else if killer := a.lastAttacker(dt.Victim, ts); killer != "" {
+		dt.Killer = killer
+		dt.Attribution = "damage"
+	}
+	a.deaths = append(a.deaths, dt)
+}
+
+// lastAttacker returns the player who last damaged victim within AssistWindow.
+func (a *Analyzer) lastAttacker(victim string, ts uint32) string {
+	eid := a.selfID
+	if victim != a.self {
+		eid = -1
+		for id, uuid := range a.entities {
+			if a.names[uuid] == victim {
+				eid = id
+				break
+			}
+		}
+	}
+	h, ok := a.lastHit[eid]
+	if !ok || ts-h.ts > AssistWindow {
+		return ""
+	}
+	return a.names[a.entities[h.by]]
+}
+
+// entityName shortens untranslated mob names ("entity.minecraft.zombie").
+func entityName(s string) string {
+	if strings.HasPrefix(s, "entity.minecraft.") && !strings.Contains(s, " ") {
+		return strings.TrimPrefix(s, "entity.minecraft.")
+	}
+	return s
+}
+
+// Deaths returns the deaths observed so far.
+func (a *Analyzer) Deaths() []Death {
+	return a.deaths
+}
+
+// Extract returns the deaths in the replay at path.
+func Extract(path string) ([]Death, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	a, err := NewAnalyzer(ar.Meta.Protocol, protocol.Login)
+	if err != nil {
+		return nil, err
+	}
+	err = ar.Each(func(f tmcpr.Frame) error {
+		return a.Observe(f.Time, f.ID, f.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.Deaths(), nil
+}
@@ -0,0 +1,63 @@
+package deaths
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+
+// decoder decodes the packets whose layout differs between versions.
+type decoder struct {
+	// playerInfo adds the names in a PlayerInfoUpdate to names (by UUID).
+	playerInfo func(d *wire.Decoder, names map[string]string)
+	// damage returns the entity hurt by a DamageEvent and the entity that
+	// caused it (-1 for none).
+	damage func(d *wire.Decoder) (victim, by int32)
+}
+
+// decoders by protocol.
+var decoders = map[int]decoder{
+	764: {playerInfo: playerInfo764, damage: damage764},
+}
+
+// PlayerInfoUpdate: actions:byte count:varint, then per player uuid and, for
+// each action bit in order: 0x01 name:string properties:varint×(name:string
+// value:string signed:bool [signature:string]); 0x02 chat session:bool
+// [session:uuid expiry:long key:bytes signature:bytes]; 0x04 game mode:varint;
+// 0x08 listed:bool; 0x10 latency:varint; 0x20 display name:bool [chat]
+func playerInfo764(d *wire.Decoder, names map[string]string) {
+	actions := d.Byte()
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		uuid := d.UUID()
+		if actions&0x01 != 0 {
+			names[uuid] = d.String()
+			for p := d.VarInt(); p > 0 && d.Err == nil; p-- {
+				_ = d.String()
+				_ = d.String()
+				if d.Bool() {
+					_ = d.String()
+				}
+			}
+		}
+		if actions&0x02 != 0 && d.Bool() {
+			d.Skip(16 + 8)
+			d.ByteArray()
+			d.ByteArray()
+		}
+		if actions&0x04 != 0 {
+			d.VarInt()
+		}
+		if actions&0x08 != 0 {
+			d.Bool()
+		}
+		if actions&0x10 != 0 {
+			d.VarInt()
+		}
+		if actions&0x20 != 0 && d.Bool() {
+			_ = d.String()
+		}
+	}
+}
+
+// DamageEvent: entity:varint type:varint cause:varint(id+1) direct:varint(id+1) ...
+func damage764(d *wire.Decoder) (victim, by int32) {
+	victim = d.VarInt()
+	d.VarInt()
+	return victim, d.VarInt() - 1
+}
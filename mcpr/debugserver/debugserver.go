@@ -0,0 +1,54 @@
+// Package debugserver serves diagnostics for long-running recording
+// services: pprof profiles under /debug/pprof/, expvar variables (including
+// the perf timers as "mcpr") under /debug/vars.
+//
+// It is opt-in: the endpoint exposes internals and can be used to slow the
+// process down, so bind it to localhost or a private network only.
+package debugserver
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+)
+
+var publish sync.Once
+
+// Handler returns the diagnostics handler.
+func Handler() http.Handler {
+	publish.Do(func() {
+		expvar.Publish("mcpr", expvar.Func(func() any { return perf.Snapshot() }))
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// ListenAndServe serves Handler on addr until ctx is cancelled.
+func ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mcpr
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+
+// ProtocolGuess is kept in metaDataExt.json when Meta.Protocol was guessed
+// from the packets, see Writer.DetectProtocol.
+type ProtocolGuess struct {
+    Certain    bool     `json:"certain"`              // the packets fit only Meta.Protocol
+    Candidates []int    `json:"candidates,omitempty"` // every protocol they fit
+    Evidence   []string `json:"evidence,omitempty"`
+}
+
+// DetectProtocol makes the writer guess Meta.Protocol from the packets
+// written, for imports of raw dumps that come without metadata; see
+// protocol.Detector for how. It has no effect if Meta.Protocol is set. On
+// Close the most likely protocol becomes Meta.Protocol and the guess is
+// recorded in metaDataExt.json, flagged uncertain when the packets fit
+// several protocols. Call it before writing packets.
+//
+// Deprecated: Use WithProtocolDetection.
+func (w *Writer) DetectProtocol() {
+    defer w.lock().unlock()
+    if w.meta.Protocol == 0 {
+        w.detect = protocol.NewDetector()
+    }
+}
+
+// ProtocolGuess returns the guess for the packets written so far; ok is false
+// unless DetectProtocol is in effect.
+func (w *Writer) ProtocolGuess() (g protocol.Guess, ok bool) {
+    defer w.lock().unlock()
+    w.drain()
+    if w.detect == nil {
+        return g, false
+    }
+    return w.detect.Guess(), true
+}
+
+// SetProtocolGuess records g in metaDataExt.json, for tools that rewrite a
+// replay whose protocol was guessed.
+func (w *Writer) SetProtocolGuess(g *ProtocolGuess) {
+    defer w.lock().unlock()
+    w.drain()
+    w.ext.ProtocolGuess = g
+}
+
+// applyGuess sets Meta.Protocol from the guess and records it.
+func (w *Writer) applyGuess() {
+    if w.detect == nil {
+        return
+    }
+    g := w.detect.Guess()
+    w.meta.Protocol = g.Protocol
+    w.ext.ProtocolGuess = &ProtocolGuess{Certain: g.Certain(), Candidates: g.Candidates, Evidence: g.Evidence}
+}
@@ -0,0 +1,142 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// DimensionsEntryName is the archive entry listing the dimension segments of a
+// recording, written when dimension tracking is enabled (see TrackDimensions).
+const DimensionsEntryName = "dimensions.json"
+
+// DimensionSegment is one continuous stay in a dimension, from the Login or
+// Respawn packet that entered it until the next dimension change. Respawning
+// in the same dimension (e.g. after death) does not start a new segment.
+type DimensionSegment struct {
+    Dimension string `json:"dimension"` // e.g. "minecraft:the_nether"
+    Visit     int    `json:"visit"`     // 1 for the first stay in Dimension, 2 for the second, ...
+    Start     uint32 `json:"start"`     // ms
+    End       uint32 `json:"end"`       // ms, the start of the next segment or the end of the recording
+}
+
+// dimensionTracker splits a packet stream into DimensionSegments.
+type dimensionTracker struct {
+    table    *protocol.Table
+    state    *protocol.Tracker
+    segments []DimensionSegment
+    visits   map[string]int
+}
+
+// observe feeds one packet and reports whether it entered a new dimension.
+func (d *dimensionTracker) observe(ts uint32, id int32, payload []byte) bool {
+    if d.state.Observe(id) != protocol.Play {
+        return false
+    }
+    dim, ok := d.table.Dimension(id, payload)
+    if !ok {
+        return false
+    }
+    n := len(d.segments)
+    if n > 0 && d.segments[n-1].Dimension == dim {
+        return false
+    }
+    if n > 0 {
+        d.segments[n-1].End = ts
+    }
+    d.visits[dim]++
+    d.segments = append(d.segments, DimensionSegment{Dimension: dim, Visit: d.visits[dim], Start: ts})
+    return true
+}
+
+// TrackDimensions makes the writer follow Login and Respawn packets and write
+// the resulting segments to "dimensions.json" on Close. When an index is
+// enabled (SetIndexInterval), every dimension change also gets an index entry
+// so seeking tools can jump straight to it.
+//
+// initial is the connection state of the first packet: protocol.Login for
+// full captures such as the proxy's, protocol.Play for streams recorded after
+// login. Call it before writing packets. It fails if the writer's protocol has
+// no packet table with dimension support.
+//
+// Deprecated: Use WithDimensions.
+func (w *Writer) TrackDimensions(initial protocol.State) error {
+    defer w.lock().unlock()
+    t, ok := protocol.Lookup(w.meta.Protocol)
+    if !ok || !t.HasDimensions() {
+        return fmt.Errorf("mcpr: no dimension support for protocol %d", w.meta.Protocol)
+    }
+    w.dims = &dimensionTracker{table: t, state: protocol.NewTracker(t, initial), visits: map[string]int{}}
+    return nil
+}
+
+// Dimensions returns the dimension segments recorded so far, or nil if
+// tracking is disabled. The last segment ends at the latest packet time.
+func (w *Writer) Dimensions() []DimensionSegment {
+    defer w.lock().unlock()
+    w.drain()
+    return w.dimensions()
+}
+
+func (w *Writer) dimensions() []DimensionSegment {
+    if w.dims == nil || len(w.dims.segments) == 0 {
+        return nil
+    }
+    // Segments end at the replay's end; one set by SetDuration may cut off
+    // those starting later
+    end := w.end()
+    segs := make([]DimensionSegment, 0, len(w.dims.segments))
+    for _, sg := range w.dims.segments {
+        if sg.Start > end && len(segs) > 0 {
+            break
+        }
+        segs = append(segs, sg)
+    }
+    last := &segs[len(segs)-1]
+    last.End = end
+    if last.Start > end {
+        last.Start = end
+    }
+    return segs
+}
+
+// ReadDimensions returns the dimension segments stored in the replay at path,
+// or nil if it has none.
+func ReadDimensions(path string) ([]DimensionSegment, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return findDimensions(zr.File)
+}
+
+// Dimensions returns the dimension segments stored in the replay, see
+// ReadDimensions.
+func (r *Reader) Dimensions() ([]DimensionSegment, error) {
+    return findDimensions(r.files)
+}
+
+func findDimensions(files []*zip.File) ([]DimensionSegment, error) {
+    for _, f := range files {
+        if f.Name == DimensionsEntryName {
+            return readDimensions(f)
+        }
+    }
+    return nil, nil
+}
+
+func readDimensions(f *zip.File) ([]DimensionSegment, error) {
+    rc, err := f.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    var segs []DimensionSegment
+    if err := json.NewDecoder(rc).Decode(&segs); err != nil {
+        return nil, fmt.Errorf("parse %s: %w", DimensionsEntryName, err)
+    }
+    return segs, nil
+}
@@ -0,0 +1,197 @@
+// Package discord delivers finished replays to a Discord channel, through a
+// webhook or a bot token, together with an HTML summary (see package summary).
+// Replays larger than the upload limit are announced with a link instead.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/summary"
+)
+
+// DefaultMaxFileSize is Discord's upload limit for servers without boosts.
+const DefaultMaxFileSize = 10 << 20
+
+const apiBase = "https://discord.com/api/v10"
+
+// Client posts messages to one channel. Set either WebhookURL, or BotToken
+// and ChannelID.
+type Client struct {
+	WebhookURL string
+	BotToken   string
+	ChannelID  string
+
+	Username    string // webhook display name override
+	MaxFileSize int64  // attachments larger than this are linked instead; 0 means DefaultMaxFileSize
+
+	// Link, if set, returns a download URL (e.g. a signed object-store link)
+	// for replays too large to attach.
+	Link func(ctx context.Context, path string) (string, error)
+
+	HTTPClient *http.Client // defaults to a client with a 5 minute timeout
+}
+
+func (c *Client) endpoint() (string, error) {
+	switch {
+	case c.WebhookURL != "":
+		return c.WebhookURL, nil
+	case c.BotToken != "" && c.ChannelID != "":
+		return apiBase + "/channels/" + c.ChannelID + "/messages", nil
+	}
+	return "", errors.New("discord: need a webhook URL or a bot token and channel id")
+}
+
+// Deliver posts the replay at path with its HTML summary. If the replay is
+// larger than MaxFileSize it is linked via Link, or only the summary is posted
+// with a note if Link is nil.
+func (c *Client) Deliver(ctx context.Context, path string) error {
+	s, err := summary.Build(path)
+	if err != nil {
+		return err
+	}
+	var html bytes.Buffer
+	if err := s.WriteHTML(&html); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	files := []attachment{{name: base + ".html", open: func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(html.Bytes())), nil
+	}}}
+
+	content := s.Text()
+	limit := c.MaxFileSize
+	if limit == 0 {
+		limit = DefaultMaxFileSize
+	}
+	switch {
+	case s.Size <= limit:
+		files = append(files, attachment{name: filepath.Base(path), open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}})
+	case c.Link != nil:
+		url, err := c.Link(ctx, path)
+		if err != nil {
+			return fmt.Errorf("discord: link: %w", err)
+		}
+		content += "\n" + url
+	default:
+		content += "\n(replay too large to attach)"
+	}
+	return c.post(ctx, content, files...)
+}
+
+type attachment struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// post sends a message with optional file attachments. Rate-limited requests
+// are retried after the delay Discord asks for.
+func (c *Client) post(ctx context.Context, content string, files ...attachment) error {
+	url, err := c.endpoint()
+	if err != nil {
+		return err
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 5 * time.Minute}
+	}
+	for attempt := 0; ; attempt++ {
+		body, ctype, err := c.encode(content, files)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", ctype)
+		if c.WebhookURL == "" {
+			req.Header.Set("Authorization", "Bot "+c.BotToken)
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return fmt.Errorf("discord: %w", err)
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			wait := retryAfter(resp.Header.Get("Retry-After"), msg)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("discord: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		return nil
+	}
+}
+
+// encode builds the multipart body. The body is streamed from the files
+// through a pipe so large replays are not held in memory.
+func (c *Client) encode(content string, files []attachment) (io.Reader, string, error) {
+	payload, err := json.Marshal(struct {
+		Content  string `json:"content"`
+		Username string `json:"username,omitempty"`
+	}{content, c.Username})
+	if err != nil {
+		return nil, "", err
+	}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			if err := mw.WriteField("payload_json", string(payload)); err != nil {
+				return err
+			}
+			for i, f := range files {
+				part, err := mw.CreateFormFile(fmt.Sprintf("files[%d]", i), f.name)
+				if err != nil {
+					return err
+				}
+				rc, err := f.open()
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(part, rc)
+				rc.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+	return pr, mw.FormDataContentType(), nil
+}
+
+// retryAfter reads the delay from a 429 response, defaulting to one second.
+func retryAfter(header string, body []byte) time.Duration {
+	if s, err := strconv.ParseFloat(header, 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	var rl struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &rl) == nil && rl.RetryAfter > 0 {
+		return time.Duration(rl.RetryAfter * float64(time.Second))
+	}
+	return time.Second
+}
@@ -0,0 +1,262 @@
+// Package diskguard watches free space on the volume holding recordings and
+// acts before a full disk corrupts the replay being written: it can warn,
+// ask the recorder to rotate or stop, and delete the oldest finished replays
+// according to a retention policy.
+package diskguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+)
+
+// Action is what a Rule does when free space drops below its threshold.
+type Action int
+
+const (
+	Warn         Action = iota // log a warning (and call OnWarn)
+	Rotate                     // call OnRotate, e.g. to finalize and start a new file
+	Stop                       // call OnStop to finalize recording
+	DeleteOldest               // delete old replays per Retention until above the threshold
+)
+
+func (a Action) String() string {
+	switch a {
+	case Warn:
+		return "warn"
+	case Rotate:
+		return "rotate"
+	case Stop:
+		return "stop"
+	case DeleteOldest:
+		return "delete-oldest"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Rule triggers Action when free space falls below Below bytes. Warn, Rotate
+// and Stop fire once per crossing and re-arm when space recovers;
+// DeleteOldest runs on every check while space is low.
+type Rule struct {
+	Below  uint64
+	Action Action
+}
+
+// Retention selects replays DeleteOldest may remove.
+type Retention struct {
+	Pattern string // glob relative to Guard.Dir; default "*.mcpr"
+	Keep    int    // always keep this many newest matches
+
+	// Protect, if set, exempts files from deletion (e.g. the active recording).
+	Protect func(path string) bool
+
+	// Tombstones leaves a catalog tombstone in place of each deleted replay
+	// (see catalog.WriteTombstone), so it stays searchable until purged. A
+	// replay whose tombstone cannot be written is deleted anyway.
+	Tombstones bool
+}
+
+// Guard checks free space on Dir every Interval and applies Rules.
+type Guard struct {
+	Dir       string
+	Interval  time.Duration // default 10s
+	Rules     []Rule
+	Retention Retention
+
+	OnWarn   func(free uint64)
+	OnRotate func()
+	OnStop   func()
+
+	Logf func(format string, args ...any) // defaults to log.Printf
+
+	fired map[int]bool
+}
+
+func (g *Guard) logf(format string, args ...any) {
+	if g.Logf != nil {
+		g.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Run checks until ctx is done. Errors from individual checks are logged.
+func (g *Guard) Run(ctx context.Context) error {
+	iv := g.Interval
+	if iv <= 0 {
+		iv = 10 * time.Second
+	}
+	t := time.NewTicker(iv)
+	defer t.Stop()
+	for {
+		if _, err := g.Check(); err != nil {
+			g.logf("diskguard: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Check measures free space once, applies the rules and returns the free
+// space after any deletions.
+func (g *Guard) Check() (uint64, error) {
+	if g.fired == nil {
+		g.fired = map[int]bool{}
+	}
+	free, err := FreeSpace(g.Dir)
+	if err != nil {
+		return 0, err
+	}
+	for i, r := range g.Rules {
+		if free >= r.Below {
+			g.fired[i] = false
+			continue
+		}
+		if r.Action == DeleteOldest {
+			if free, err = g.deleteOldest(r.Below); err != nil {
+				return free, err
+			}
+			if free < r.Below && !g.fired[i] {
+				g.fired[i] = true
+				g.logf("diskguard: %s free on %s, nothing more to delete", FormatSize(free), g.Dir)
+			}
+			continue
+		}
+		if g.fired[i] {
+			continue
+		}
+		g.fired[i] = true
+		g.logf("diskguard: %s free on %s, below %s: %s", FormatSize(free), g.Dir, FormatSize(r.Below), r.Action)
+		switch r.Action {
+		case Warn:
+			if g.OnWarn != nil {
+				g.OnWarn(free)
+			}
+		case Rotate:
+			if g.OnRotate != nil {
+				g.OnRotate()
+			}
+		case Stop:
+			if g.OnStop != nil {
+				g.OnStop()
+			}
+		}
+	}
+	return free, nil
+}
+
+// deleteOldest removes the oldest unprotected replays until free space
+// reaches target or nothing more may be deleted.
+func (g *Guard) deleteOldest(target uint64) (uint64, error) {
+	pattern := g.Retention.Pattern
+	if pattern == "" {
+		pattern = "*.mcpr"
+	}
+	matches, err := filepath.Glob(filepath.Join(g.Dir, pattern))
+	if err != nil {
+		return 0, err
+	}
+	type file struct {
+		path string
+		mod  time.Time
+	}
+	var files []file
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, file{m, fi.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	if keep := g.Retention.Keep; keep > 0 {
+		if keep >= len(files) {
+			files = nil
+		} else {
+			files = files[:len(files)-keep]
+		}
+	}
+
+	free, err := FreeSpace(g.Dir)
+	for _, f := range files {
+		if err != nil || free >= target {
+			break
+		}
+		if g.Retention.Protect != nil && g.Retention.Protect(f.path) {
+			continue
+		}
+		if g.Retention.Tombstones {
+			if _, terr := catalog.WriteTombstone(f.path, "deleted by diskguard to free space"); terr != nil {
+				g.logf("diskguard: tombstone for %s: %v", f.path, terr)
+			}
+		}
+		if rerr := os.Remove(f.path); rerr != nil {
+			g.logf("diskguard: delete %s: %v", f.path, rerr)
+			_ = os.Remove(f.path + catalog.TombstoneExt)
+			continue
+		}
+		// Companion files written next to replays
+		for _, ext := range []string{".json", ".html", ".upload"} {
+			_ = os.Remove(f.path + ext)
+		}
+		g.logf("diskguard: deleted %s to free space", f.path)
+		free, err = FreeSpace(g.Dir)
+	}
+	return free, err
+}
+
+// ParseSize parses a byte size such as "500MiB", "2GB", "1.5G" or "1048576".
+// Binary (KiB, MiB, GiB, TiB) and decimal (KB, MB, GB, TB) units are accepted;
+// a bare K, M, G or T is binary.
+func ParseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.ToUpper(strings.TrimSpace(s[i:]))
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	mult := map[string]float64{
+		"": 1, "B": 1,
+		"K": 1 << 10, "KIB": 1 << 10, "KB": 1e3,
+		"M": 1 << 20, "MIB": 1 << 20, "MB": 1e6,
+		"G": 1 << 30, "GIB": 1 << 30, "GB": 1e9,
+		"T": 1 << 40, "TIB": 1 << 40, "TB": 1e12,
+	}[unit]
+	if mult == 0 {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return uint64(v * mult), nil
+}
+
+// FormatSize formats n bytes with a binary unit.
+func FormatSize(n uint64) string {
+	const units = "KMGT"
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, u := float64(n)/(1<<10), 0
+	for v >= 1<<10 && u < len(units)-1 {
+		v /= 1 << 10
+		u++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[u])
+}
+
+// errUnsupported is returned by FreeSpace on platforms without a statfs equivalent.
+var errUnsupported = errors.New("diskguard: free space not available on this platform")
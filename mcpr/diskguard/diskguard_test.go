@@ -0,0 +1,138 @@
+package diskguard
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/catalog"
+)
+
+// writeReplays writes empty replays named after names into dir, each one
+// minute newer than the one before, with an upload state file next to each.
+func writeReplays(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	start := time.Now().Add(-time.Hour)
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		w, err := mcpr.Create(path, mcpr.Meta{Protocol: 765})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+".upload", []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mod := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// names returns the base names of the files in dir matching pattern.
+func names(t *testing.T, dir, pattern string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []string{}
+	for _, m := range matches {
+		out = append(out, filepath.Base(m))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestDeleteOldest(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		keep       int
+		protect    string
+		tombstones bool
+		want       []string // replays left
+	}{
+		{"all", 0, "", false, []string{}},
+		{"keep", 2, "", false, []string{"d.mcpr", "e.mcpr"}},
+		{"keep all", 5, "", false, []string{"a.mcpr", "b.mcpr", "c.mcpr", "d.mcpr", "e.mcpr"}},
+		{"protect", 1, "b.mcpr", false, []string{"b.mcpr", "e.mcpr"}},
+		{"tombstones", 1, "b.mcpr", true, []string{"b.mcpr", "e.mcpr"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeReplays(t, dir, "a.mcpr", "b.mcpr", "c.mcpr", "d.mcpr", "e.mcpr")
+			if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var protected []string
+			g := &Guard{
+				Dir: dir,
+				Retention: Retention{
+					Keep:       c.keep,
+					Tombstones: c.tombstones,
+					Protect: func(path string) bool {
+						protected = append(protected, filepath.Base(path))
+						return filepath.Base(path) == c.protect
+					},
+				},
+				Logf: t.Logf,
+			}
+
+			// No disk has this much space, so everything allowed goes
+			if _, err := g.deleteOldest(math.MaxUint64); err != nil {
+				t.Fatal(err)
+			}
+			if got := names(t, dir, "*.mcpr"); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("left %v, want %v", got, c.want)
+			}
+			for _, name := range protected {
+				if (c.keep >= 1 && name == "e.mcpr") || (c.keep >= 2 && name == "d.mcpr") {
+					t.Errorf("asked to protect %s, which Keep keeps", name)
+				}
+			}
+			left := map[string]bool{}
+			for _, name := range c.want {
+				left[name] = true
+			}
+			for _, name := range []string{"a.mcpr", "b.mcpr", "c.mcpr", "d.mcpr", "e.mcpr"} {
+				path := filepath.Join(dir, name)
+				_, err := os.Stat(path + ".upload")
+				if left[name] != (err == nil) {
+					t.Errorf("%s.upload left = %v with the replay left = %v", name, err == nil, left[name])
+				}
+				ts, err := catalog.ReadTombstone(path + catalog.TombstoneExt)
+				switch {
+				case c.tombstones && !left[name] && err != nil:
+					t.Errorf("tombstone of %s: %v", name, err)
+				case c.tombstones && !left[name] && ts.DeleteReason == "":
+					t.Errorf("tombstone of %s has no reason", name)
+				case (!c.tombstones || left[name]) && err == nil:
+					t.Errorf("tombstone of %s, which was not deleted with tombstones", name)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+				t.Errorf("non-matching file: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteOldestTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeReplays(t, dir, "a.mcpr", "b.mcpr")
+	g := &Guard{Dir: dir, Logf: t.Logf}
+	if _, err := g.deleteOldest(0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(t, dir, "*.mcpr"), []string{"a.mcpr", "b.mcpr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("left %v with enough free space, want %v", got, want)
+	}
+}
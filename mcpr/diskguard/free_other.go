@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package diskguard
+
+// FreeSpace is not supported on this platform.
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package diskguard
+
+import "syscall"
+
+// FreeSpace returns the bytes available to unprivileged users on the volume
+// holding dir.
+func FreeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -1,4 +1,5 @@
-// Package mcpr provides a streaming writer for ReplayMod (.mcpr) files.
+// Package mcpr provides a streaming writer and reader for ReplayMod (.mcpr)
+// files.
 //
 // The writer emits a ZIP file containing at least two entries:
 //  - recording.tmcpr: stream of [timeBE:int32][lenBE:int32][varint packetId][packet bytes]
@@ -7,5 +8,22 @@
 // Packets can be written incrementally as they are received; the writer does
 // not buffer all packets in memory. The duration in metadata is computed
 // from the maximum timestamp observed. Metadata is written only on Close().
+//
+// A Reader, from OpenReader, iterates the packets of an existing replay in the
+// same streaming fashion and can jump to a time with SeekToTime; a
+// TMCPRReader reads a bare recording.tmcpr stream.
+//
+// A Writer is configured with WriterOptions passed to its constructor; the
+// setters that duplicate them are deprecated.
+//
+// From v1 on, this package, recorder, transform, replayserver and the
+// adapters package follow semantic versioning: exported identifiers are not
+// removed or changed incompatibly before v2. Ones with a better replacement
+// are marked Deprecated and keep working. Excepted are the experimental
+// parts, which may change in minor releases: packed frames
+// (WithPackThreshold, transform.Flatten), remote replays (RemoteFile,
+// OpenRemote, OpenURL) and transform's plugins (StartPlugin, ServePlugin and
+// their protocol). Other packages may still change in minor releases;
+// packages under internal/ are not importable.
 package mcpr
 
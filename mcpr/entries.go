@@ -0,0 +1,104 @@
+package mcpr
+
+import (
+    "fmt"
+    "io"
+    "io/fs"
+    "strings"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// EntryKind is the category of an archive entry, see Reader.Entries.
+type EntryKind int
+
+const (
+    EntryUnknown   EntryKind = iota // not written by ReplayMod or this module
+    EntryRecording                  // recording.tmcpr and data derived from it
+    EntryMetadata                   // metaData.json and other descriptions of the replay
+    EntryMarkers                    // markers.json
+    EntryAsset                      // thumbnail, resource packs and other files the replay uses
+)
+
+func (k EntryKind) String() string {
+    switch k {
+    case EntryRecording:
+        return "recording"
+    case EntryMetadata:
+        return "metadata"
+    case EntryMarkers:
+        return "markers"
+    case EntryAsset:
+        return "asset"
+    }
+    return "unknown"
+}
+
+// Entry describes an archive entry of a replay.
+type Entry struct {
+    Name           string
+    Size           int64 // uncompressed, as declared by the archive
+    CompressedSize int64
+    Kind           EntryKind
+}
+
+// entryKinds categorizes the entries with fixed names. ReplayMod's editor
+// stores camera paths in timelines.json (paths.json in older versions) and
+// hidden entities in visibility.json.
+var entryKinds = map[string]EntryKind{
+    "recording.tmcpr":       EntryRecording,
+    "recording.tmcpr.crc32": EntryRecording,
+    tmcpr.IndexEntryName:    EntryRecording,
+    LatencyEntryName:        EntryRecording,
+    "metaData.json":         EntryMetadata,
+    "mods.json":             EntryMetadata,
+    "paths.json":            EntryMetadata,
+    TimelinesEntryName:      EntryMetadata,
+    "visibility.json":       EntryMetadata,
+    ExtMetaEntryName:        EntryMetadata,
+    ProcessingEntryName:     EntryMetadata,
+    DimensionsEntryName:     EntryMetadata,
+    AnnotationsEntryName:    EntryMetadata,
+    MarkersEntryName:        EntryMarkers,
+    ThumbEntryName:          EntryAsset,
+}
+
+// entryKind returns the category of the entry name. Resource packs live
+// under resourcepack/, other assets of ReplayMod's asset repository under
+// asset/.
+func entryKind(name string) EntryKind {
+    if k, ok := entryKinds[name]; ok {
+        return k
+    }
+    if strings.HasPrefix(name, "resourcepack/") || strings.HasPrefix(name, "asset/") {
+        return EntryAsset
+    }
+    return EntryUnknown
+}
+
+// Entries returns all entries of the replay's archive in directory order,
+// e.g. for tools copying or auditing the extra files next to the recording.
+func (r *Reader) Entries() []Entry {
+    out := make([]Entry, 0, len(r.files))
+    for _, f := range r.files {
+        out = append(out, Entry{
+            Name:           f.Name,
+            Size:           int64(f.UncompressedSize64),
+            CompressedSize: int64(f.CompressedSize64),
+            Kind:           entryKind(f.Name),
+        })
+    }
+    return out
+}
+
+// OpenEntry opens the archive entry name for reading. The error wraps
+// fs.ErrNotExist if the replay has no such entry. Entries can be read while
+// packets are read with Next.
+func (r *Reader) OpenEntry(name string) (io.ReadCloser, error) {
+    for _, f := range r.files {
+        if f.Name == name {
+            return f.Open()
+        }
+    }
+    return nil, fmt.Errorf("open %s: %w", name, fs.ErrNotExist)
+}
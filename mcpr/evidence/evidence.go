@@ -0,0 +1,386 @@
+// Package evidence packages a replay for handing it to third parties, such as
+// a moderation team passing a recording to a platform or to law enforcement:
+// one ZIP holding the replay unchanged, its validation report and processing
+// log, checksums of everything and a manifest tying them together, optionally
+// signed with an Ed25519 key so the recipient can check the bundle was not
+// altered since.
+//
+// A bundle contains:
+//
+//	manifest.json      Manifest: what is in the bundle and where it came from
+//	manifest.sig       Ed25519 signature of manifest.json, if signed
+//	manifest.pub       the public key that made it (PEM), if signed
+//	replay/NAME.mcpr   the replay, byte for byte
+//	validation.json    Validation of the replay when the bundle was made
+//	processing.json    its processing log (see mcpr.ProcessingStep)
+//	checksums.sha256   SHA-256 of every file, in sha256sum format
+//
+// The manifest lists every other file with its size and SHA-256, so checking
+// the signature of manifest.json and the hashes it lists covers the whole
+// bundle; Verify does both.
+package evidence
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// Entry names in a bundle.
+const (
+	ManifestName   = "manifest.json"
+	SignatureName  = "manifest.sig"
+	PublicKeyName  = "manifest.pub"
+	ValidationName = "validation.json"
+	ProcessingName = "processing.json"
+	ChecksumsName  = "checksums.sha256"
+	replayDir      = "replay/"
+)
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Version int       `json:"version"` // format version, 1
+	Created time.Time `json:"created"`
+	Tool    string    `json:"tool"` // mc-replay-go version, see mcpr.Version
+	Case    string    `json:"case,omitempty"`
+	By      string    `json:"by,omitempty"`
+	Note    string    `json:"note,omitempty"`
+
+	Replay string    `json:"replay"` // bundle path of the replay
+	Meta   mcpr.Meta `json:"meta"`
+	Valid  bool      `json:"valid"` // whether the replay validated, see validation.json
+	Files  []File    `json:"files"` // every file but the manifest and its signature
+
+	// Signer is the key that signed the manifest, set by Verify; nil for
+	// unsigned bundles.
+	Signer ed25519.PublicKey `json:"-"`
+}
+
+// File is a file of a bundle.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Validation is the state of the replay when the bundle was made.
+type Validation struct {
+	Valid    bool     `json:"valid"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Checksum string   `json:"checksum"` // of recording.tmcpr: "ok", "missing" or the mismatch
+}
+
+// Options describe a bundle.
+type Options struct {
+	Case string // case or ticket reference
+	By   string // who made the bundle
+	Note string
+
+	// Key, if set, signs the manifest.
+	Key ed25519.PrivateKey
+}
+
+// Create packages the replay at src into a bundle at dst. The replay goes
+// into the bundle even if it fails validation; the report says so. dst is
+// written to a temporary file and renamed into place.
+func Create(dst, src string, opts Options) (*Manifest, error) {
+	replay, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Version: 1,
+		Created: time.Now().UTC(),
+		Tool:    mcpr.Version(),
+		Case:    opts.Case,
+		By:      opts.By,
+		Note:    opts.Note,
+		Replay:  replayDir + filepath.Base(src),
+	}
+	v := validate(src)
+	m.Valid = v.Valid
+	if v.Valid {
+		if m.Meta, err = mcpr.ReadMeta(src); err != nil {
+			return nil, err
+		}
+	}
+	steps, _ := mcpr.ReadProcessingLog(src)
+	if steps == nil {
+		steps = []mcpr.ProcessingStep{}
+	}
+
+	files := map[string][]byte{m.Replay: replay}
+	if files[ValidationName], err = json.MarshalIndent(v, "", "  "); err != nil {
+		return nil, err
+	}
+	if files[ProcessingName], err = json.MarshalIndent(steps, "", "  "); err != nil {
+		return nil, err
+	}
+	var sums bytes.Buffer
+	for _, name := range sortedNames(files) {
+		f := hashFile(name, files[name])
+		m.Files = append(m.Files, f)
+		fmt.Fprintf(&sums, "%s  %s\n", f.SHA256, name)
+	}
+	files[ChecksumsName] = sums.Bytes()
+	m.Files = append(m.Files, hashFile(ChecksumsName, files[ChecksumsName]))
+
+	if files[ManifestName], err = json.MarshalIndent(m, "", "  "); err != nil {
+		return nil, err
+	}
+	if opts.Key != nil {
+		files[SignatureName] = ed25519.Sign(opts.Key, files[ManifestName])
+		pub, err := x509.MarshalPKIXPublicKey(opts.Key.Public())
+		if err != nil {
+			return nil, err
+		}
+		files[PublicKeyName] = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	}
+	return m, writeBundle(dst, files)
+}
+
+// validate checks the replay at path as mcpr-validate -crc would.
+func validate(path string) Validation {
+	v := Validation{Checksum: "missing"}
+	res, err := mcpr.ValidatePath(path)
+	if res != nil {
+		v.Warnings = res.Warnings
+	}
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	v.Valid = true
+	r, err := mcpr.OpenReader(path)
+	if err != nil {
+		v.Checksum = err.Error()
+		return v
+	}
+	defer r.Close()
+	switch err := r.VerifyChecksum(); {
+	case err == nil:
+		v.Checksum = "ok"
+	case !errors.Is(err, mcpr.ErrNoChecksum):
+		v.Checksum = err.Error()
+	}
+	return v
+}
+
+// writeBundle writes files to a ZIP at dst, the manifest first. Files are
+// stored uncompressed, so the replay's bytes appear in the bundle as is.
+func writeBundle(dst string, files map[string][]byte) error {
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	write := func() error {
+		names := sortedNames(files)
+		sort.SliceStable(names, func(i, j int) bool { return names[i] == ManifestName && names[j] != ManifestName })
+		for _, name := range names {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(files[name]); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+	if err := write(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Verify checks the bundle at path: every file the manifest lists must be
+// present with its hash, and nothing else but the signature and key. If the
+// bundle is signed, the signature must be valid for pub, or, if pub is nil,
+// for the key in the bundle, which only proves the bundle is intact and not
+// who made it: compare KeyFingerprint with the sender's. Unsigned bundles
+// fail if pub is set.
+func Verify(path string, pub ed25519.PublicKey) (*Manifest, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	if err := mcpr.CheckArchive(zr.File, mcpr.DefaultArchiveLimits); err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		b, err := readEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = b
+	}
+	raw, ok := files[ManifestName]
+	if !ok {
+		return nil, fmt.Errorf("evidence: no %s", ManifestName)
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("evidence: parse %s: %w", ManifestName, err)
+	}
+
+	sig, signed := files[SignatureName]
+	switch {
+	case signed && pub == nil:
+		if pub, err = parsePublicKey(files[PublicKeyName]); err != nil {
+			return nil, fmt.Errorf("evidence: %s: %w", PublicKeyName, err)
+		}
+		fallthrough
+	case signed:
+		if !ed25519.Verify(pub, raw, sig) {
+			return nil, errors.New("evidence: invalid signature")
+		}
+		m.Signer = pub
+	case pub != nil:
+		return nil, errors.New("evidence: bundle is not signed")
+	}
+
+	listed := map[string]bool{ManifestName: true, SignatureName: true, PublicKeyName: true}
+	for _, f := range m.Files {
+		listed[f.Name] = true
+		b, ok := files[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("evidence: %s is missing", f.Name)
+		}
+		if got := hashFile(f.Name, b); got != f {
+			return nil, fmt.Errorf("evidence: %s was modified (sha256 %s, manifest says %s)", f.Name, got.SHA256, f.SHA256)
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("evidence: %s is not in the manifest", name)
+		}
+	}
+	return &m, nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func hashFile(name string, b []byte) File {
+	sum := sha256.Sum256(b)
+	return File{Name: name, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeyFingerprint returns the hex SHA-256 of a public key, for comparing keys
+// out of band.
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadPrivateKey reads an Ed25519 private key in PKCS #8 PEM form, as written
+// by GenerateKey or "openssl genpkey -algorithm ed25519".
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// LoadPublicKey reads an Ed25519 public key in PEM form, such as a bundle's
+// manifest.pub or the .pub file written by GenerateKey.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parsePublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pub, nil
+}
+
+func parsePublicKey(b []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key")
+	}
+	return pub, nil
+}
+
+// GenerateKey writes a new Ed25519 key pair to path (private, mode 0600) and
+// path + ".pub".
+func GenerateKey(path string) (ed25519.PublicKey, error) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return pub, os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644)
+}
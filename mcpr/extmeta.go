@@ -0,0 +1,103 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// ExtMetaEntryName is the archive entry holding metadata that has no place in
+// ReplayMod's metaData.json schema. ReplayMod ignores it.
+const ExtMetaEntryName = "metaDataExt.json"
+
+// ExtMeta is the content of metaDataExt.json.
+type ExtMeta struct {
+    // Tags are free-form labels such as "pvp" or "tournament", see NormalizeTags.
+    Tags []string `json:"tags,omitempty"`
+
+    // ProtocolGuess is set when Meta.Protocol was guessed from the packets.
+    ProtocolGuess *ProtocolGuess `json:"protocolGuess,omitempty"`
+
+    // Packed is set when recording.tmcpr holds packed frames, which ReplayMod
+    // cannot read (see Writer.SetPackThreshold).
+    Packed bool `json:"packed,omitempty"`
+
+    // Sampled lists the stretches recorded with adaptive sampling, which
+    // left packets out (see Writer.SetSampling).
+    Sampled []SampledPeriod `json:"sampled,omitempty"`
+}
+
+// NormalizeTags returns tags trimmed, lower-cased, without empty or duplicate
+// entries, and sorted.
+func NormalizeTags(tags []string) []string {
+    seen := map[string]bool{}
+    out := []string{}
+    for _, t := range tags {
+        t = strings.ToLower(strings.TrimSpace(t))
+        if t != "" && !seen[t] {
+            seen[t] = true
+            out = append(out, t)
+        }
+    }
+    sort.Strings(out)
+    return out
+}
+
+// AddTags adds tags written to metaDataExt.json on Close. It has no effect if
+// the caller supplies metaDataExt.json itself via CreateEntry or CopyEntry.
+func (w *Writer) AddTags(tags ...string) {
+    defer w.lock().unlock()
+    w.drain()
+    w.addTags(tags)
+}
+
+func (w *Writer) addTags(tags []string) {
+    w.ext.Tags = NormalizeTags(append(w.ext.Tags, tags...))
+}
+
+func (w *Writer) writeExtMeta() error {
+    if len(w.ext.Tags) == 0 && w.ext.ProtocolGuess == nil && !w.ext.Packed && len(w.ext.Sampled) == 0 || w.entries[ExtMetaEntryName] {
+        return nil
+    }
+    ew, err := w.createEntry(ExtMetaEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", ExtMetaEntryName, err)
+    }
+    return json.NewEncoder(ew).Encode(w.ext)
+}
+
+// ReadExtMeta returns the extension metadata of the replay at path; it is
+// empty if the replay has none.
+func ReadExtMeta(path string) (ExtMeta, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return ExtMeta{}, err
+    }
+    defer zr.Close()
+    return readExtMeta(zr.File)
+}
+
+// ExtMeta returns the extension metadata of the replay, see ReadExtMeta.
+func (r *Reader) ExtMeta() (ExtMeta, error) {
+    return readExtMeta(r.files)
+}
+
+func readExtMeta(files []*zip.File) (ExtMeta, error) {
+    var ext ExtMeta
+    for _, f := range files {
+        if f.Name == ExtMetaEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return ext, err
+            }
+            defer rc.Close()
+            if err := json.NewDecoder(rc).Decode(&ext); err != nil {
+                return ext, fmt.Errorf("parse %s: %w", ExtMetaEntryName, err)
+            }
+            return ext, nil
+        }
+    }
+    return ext, nil
+}
@@ -0,0 +1,96 @@
+package mcpr
+
+import (
+    "encoding/binary"
+    "fmt"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// heartbeat fills quiet periods of a recording with SetTime packets, see
+// Writer.SetHeartbeat.
+type heartbeat struct {
+    interval uint32 // ms
+    state    *protocol.Tracker
+    setTime  int32
+
+    known    bool   // a SetTime was seen since entering play
+    at       uint32 // time of the latest SetTime, recorded or injected
+    age, day int64  // its world age and time of day
+    last     uint32 // time of the latest packet
+}
+
+// SetHeartbeat makes the writer insert a SetTime packet whenever no packet
+// was written for interval, so ReplayMod's timeline shows no misleading dead
+// stretches and seeking through them stays responsive. The injected packets
+// continue the world time of the last SetTime the server sent (none are
+// injected before the first one); a stopped daylight cycle stays stopped.
+//
+// Packets are injected when the next packet arrives, with timestamps inside
+// the gap. initial is the connection state of the first packet, as for
+// TrackDimensions. Call it before writing packets; 0 disables heartbeats. It
+// fails if the writer's protocol has no packet table.
+//
+// Deprecated: Use WithHeartbeat.
+func (w *Writer) SetHeartbeat(interval time.Duration, initial protocol.State) error {
+    defer w.lock().unlock()
+    if interval <= 0 {
+        w.hb = nil
+        return nil
+    }
+    t, ok := protocol.Lookup(w.meta.Protocol)
+    if !ok {
+        return fmt.Errorf("mcpr: no packet table for protocol %d", w.meta.Protocol)
+    }
+    id, ok := t.ID(protocol.Clientbound, protocol.Play, "SetTime")
+    if !ok {
+        return fmt.Errorf("mcpr: no SetTime packet in protocol %d", w.meta.Protocol)
+    }
+    ms := uint32(interval / time.Millisecond)
+    if ms == 0 {
+        ms = 1
+    }
+    w.hb = &heartbeat{interval: ms, state: protocol.NewTracker(t, initial), setTime: id}
+    return nil
+}
+
+// fill returns the SetTime payloads and times to write before a packet at ts.
+func (h *heartbeat) fill(ts uint32) (times []uint32, payloads [][]byte) {
+    if !h.known {
+        return nil, nil
+    }
+    for t := h.last + h.interval; t < ts; t += h.interval {
+        ticks := int64(t-h.at) / 50
+        h.age += ticks
+        if h.day >= 0 {
+            h.day += ticks
+        }
+        h.at += uint32(ticks * 50)
+        var p [16]byte
+        binary.BigEndian.PutUint64(p[0:8], uint64(h.age))
+        binary.BigEndian.PutUint64(p[8:16], uint64(h.day))
+        times = append(times, t)
+        payloads = append(payloads, p[:])
+        h.last = t
+    }
+    return times, payloads
+}
+
+// observe feeds a packet written at ts.
+func (h *heartbeat) observe(ts uint32, id int32, payload []byte) {
+    if ts > h.last {
+        h.last = ts
+    }
+    if h.state.Observe(id) != protocol.Play {
+        h.known = false
+        return
+    }
+    // SetTime (1.20.2): worldAge:long timeOfDay:long
+    if id == h.setTime && len(payload) >= 16 {
+        h.known = true
+        h.at = ts
+        h.age = int64(binary.BigEndian.Uint64(payload[0:8]))
+        h.day = int64(binary.BigEndian.Uint64(payload[8:16]))
+    }
+}
@@ -0,0 +1,71 @@
+package mcpr
+
+import (
+    "errors"
+    "fmt"
+    "log"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// ErrPacketIDRange is returned by WritePacket in strict mode for packet ids
+// that no clientbound state of Meta.Protocol defines, see SetStrict.
+var ErrPacketIDRange = errors.New("mcpr: packet id out of range for protocol")
+
+// idRange checks written packet ids against the packet table of the replay's
+// protocol. Ids beyond every clientbound state almost always mean Meta.Protocol
+// names a different version than the one recorded.
+type idRange struct {
+    max    int32 // largest valid id; no check if negative
+    warned map[int32]bool
+}
+
+func newIDRange(proto int) idRange {
+    r := idRange{max: -1}
+    t, ok := protocol.Lookup(proto)
+    if !ok {
+        return r
+    }
+    for _, s := range []protocol.State{protocol.Login, protocol.Configuration, protocol.Play} {
+        if n := int32(t.Count(protocol.Clientbound, s)) - 1; n > r.max {
+            r.max = n
+        }
+    }
+    return r
+}
+
+// SetStrict makes WritePacket reject packet ids outside the clientbound range
+// of Meta.Protocol with ErrPacketIDRange instead of logging a warning. Both
+// need a packet table for the protocol (currently 764); for other protocols
+// ids are not checked. A strict writer from Create also fails Close on
+// validation warnings (see ErrWarning) instead of logging them. Writers start
+// out strict in strict mode, see SetStrictMode.
+//
+// Deprecated: Use WithStrict.
+func (w *Writer) SetStrict(strict bool) {
+    defer w.lock().unlock()
+    w.drain()
+    w.strict = strict
+}
+
+// checkID reports a packet id outside the protocol's range: an error in
+// strict mode, otherwise a warning logged once per id.
+func (w *Writer) checkID(ts uint32, id int32) error {
+    r := &w.ids
+    if r.max < 0 || id >= 0 && id <= r.max {
+        return nil
+    }
+    if w.strict {
+        return fmt.Errorf("%w %d: id 0x%02X at %d ms (valid 0x00-0x%02X)", ErrPacketIDRange, w.meta.Protocol, id, ts, r.max)
+    }
+    if r.warned[id] {
+        return nil
+    }
+    if r.warned == nil {
+        r.warned = map[int32]bool{}
+    }
+    r.warned[id] = true
+    log.Printf("[mcpr] WARNING: packet id 0x%02X at %d ms is not a clientbound id of protocol %d (valid 0x00-0x%02X); is Meta.Protocol the version recorded?",
+        id, ts, w.meta.Protocol, r.max)
+    return nil
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// Caveat describes information lost when converting a replay to another format.
+type Caveat string
+
+// exportFunc writes frames read from fr, a replay described by meta, to data
+// (and times, when the format uses a timestamp file).
+type exportFunc func(fr *tmcpr.Reader, meta mcpr.Meta, data, times io.Writer) (int, error)
+
+var exporters = map[string]exportFunc{
+	"lenlog":   exportLenLog(false),
+	"lenlog32": exportLenLog(true),
+	"hexlines": exportHexLines,
+	"pcap":     exportPcap,
+}
+
+// ExportFormats returns the names of the formats replays can be exported to.
+func ExportFormats() []string {
+	names := make([]string, 0, len(exporters))
+	for n := range exporters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportFile converts the replay at path into format, writing the capture to
+// dataPath and, for lenlog formats, timestamps to timesPath. It returns the
+// number of packets written and the caveats of the conversion: everything in
+// the replay the target format cannot represent.
+func ExportFile(format, path, dataPath, timesPath string) (int, []Caveat, error) {
+	exp, ok := exporters[format]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown format %q", format)
+	}
+	needTimes := strings.HasPrefix(format, "lenlog")
+	if needTimes && timesPath == "" {
+		return 0, nil, fmt.Errorf("format %s needs a timestamp file", format)
+	}
+
+	zr, err := archive.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+
+	var caveats []Caveat
+	meta := zr.Meta
+	caveats = append(caveats, Caveat(fmt.Sprintf(
+		"metadata is not stored (protocol %d, server %q, %d players); pass -protocol when importing back",
+		meta.Protocol, meta.ServerName, len(meta.Players))))
+	if format == "pcap" {
+		caveats = append(caveats,
+			"pcap holds only the server->client half of a synthetic connection (10.0.0.1:25565 -> 10.0.0.2:50000); the client's packets are not in the replay",
+			"pcap packets are written unencrypted, compressed from the replay's login SetCompression on")
+	}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "recording.tmcpr", "metaData.json", "recording.tmcpr.crc32", tmcpr.IndexEntryName:
+		default:
+			caveats = append(caveats, Caveat(fmt.Sprintf("entry %s is not exported", f.Name)))
+		}
+	}
+
+	fr, rec, err := zr.Frames()
+	if err != nil {
+		return 0, caveats, err
+	}
+	defer rec.Close()
+
+	data, err := os.Create(dataPath)
+	if err != nil {
+		return 0, caveats, err
+	}
+	defer data.Close()
+	dw := bufio.NewWriter(data)
+	var tw *bufio.Writer
+	if needTimes {
+		tf, err := os.Create(timesPath)
+		if err != nil {
+			return 0, caveats, err
+		}
+		defer tf.Close()
+		tw = bufio.NewWriter(tf)
+	}
+
+	var times io.Writer
+	if tw != nil {
+		times = tw
+	}
+	n, err := exp(fr, meta, dw, times)
+	if err != nil {
+		return n, caveats, err
+	}
+	if err := dw.Flush(); err != nil {
+		return n, caveats, err
+	}
+	if tw != nil {
+		if err := tw.Flush(); err != nil {
+			return n, caveats, err
+		}
+	}
+	return n, caveats, nil
+}
+
+func exportLenLog(int32Len bool) exportFunc {
+	return func(fr *tmcpr.Reader, _ mcpr.Meta, data, times io.Writer) (int, error) {
+		n := 0
+		for {
+			f, err := fr.Next()
+			if errors.Is(err, io.EOF) {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			id := encodeVarInt(f.ID)
+			size := len(id) + len(f.Payload)
+			if int32Len {
+				var b [4]byte
+				binary.BigEndian.PutUint32(b[:], uint32(size))
+				_, err = data.Write(b[:])
+			} else {
+				_, err = data.Write(encodeVarInt(int32(size)))
+			}
+			if err != nil {
+				return n, err
+			}
+			if _, err := data.Write(id); err != nil {
+				return n, err
+			}
+			if _, err := data.Write(f.Payload); err != nil {
+				return n, err
+			}
+			if _, err := fmt.Fprintf(times, "%d\n", f.Time); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+func exportHexLines(fr *tmcpr.Reader, _ mcpr.Meta, data, _ io.Writer) (int, error) {
+	n := 0
+	if _, err := fmt.Fprintln(data, "# ms id payload (exported by mc-replay-go)"); err != nil {
+		return n, err
+	}
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if _, err := fmt.Fprintf(data, "%d 0x%02X %s\n", f.Time, f.ID, hex.EncodeToString(f.Payload)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func encodeVarInt(v int32) []byte {
+	var buf [5]byte
+	n := binary.PutUvarint(buf[:], uint64(uint32(v)))
+	return buf[:n]
+}
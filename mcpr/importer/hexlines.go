@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// ImportHexLines imports a text dump with one packet per line:
+//
+//	<ms> [direction] <id> <hex payload>
+//
+// ms is a millisecond timestamp (rebased so the first packet is at t=0), id is
+// decimal or 0x-prefixed hex, and the payload may be empty. The optional
+// direction column (S->C, C->S, CB, SB, clientbound, serverbound) is used to
+// skip serverbound packets. Blank lines and lines starting with '#' are ignored.
+func ImportHexLines(in Input, w *mcpr.Writer) (int, error) {
+	sc := bufio.NewScanner(in.Data)
+	sc.Buffer(make([]byte, 64<<10), 64<<20)
+	var times timeSource
+	n, lineNo := 0, 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && isDirection(fields[1]) {
+			if serverbound(fields[1]) {
+				continue
+			}
+			fields = append(fields[:1], fields[2:]...)
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return n, fmt.Errorf("line %d: want \"<ms> <id> <hex>\"", lineNo)
+		}
+		ms, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return n, fmt.Errorf("line %d: timestamp: %w", lineNo, err)
+		}
+		id, err := strconv.ParseInt(fields[1], 0, 32)
+		if err != nil {
+			return n, fmt.Errorf("line %d: packet id: %w", lineNo, err)
+		}
+		var payload []byte
+		if len(fields) == 3 {
+			if payload, err = hex.DecodeString(fields[2]); err != nil {
+				return n, fmt.Errorf("line %d: payload: %w", lineNo, err)
+			}
+		}
+		ts, err := times.rebase(ms)
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := w.WritePacket(ts, int32(id), payload); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, sc.Err()
+}
+
+func isDirection(s string) bool {
+	switch strings.ToLower(s) {
+	case "s->c", "c->s", "cb", "sb", "clientbound", "serverbound":
+		return true
+	}
+	return false
+}
+
+func serverbound(s string) bool {
+	switch strings.ToLower(s) {
+	case "c->s", "sb", "serverbound":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+// Package importer converts packet captures produced by other tools into
+// .mcpr replays, and exports replays back into those formats. Conversions
+// stream their input, so captures larger than memory can be converted.
+//
+// Supported formats (import and export):
+//   - "lenlog": length-prefixed wire frames ([len][varint id][payload]) with
+//     timestamps in a separate text file, one per frame; "lenlog32" uses a
+//     big-endian int32 length instead of a VarInt
+//   - "hexlines": text dumps with one packet per line: "<ms> <id> <hex payload>"
+//   - "pcap": a libpcap capture (tcpdump, Wireshark) of the connection; the
+//     server->client bytes are reassembled from TCP and decoded as for
+//     "wire", see ImportPcap. Exported replays are written as a synthetic
+//     connection over Ethernet.
+//
+// Import only:
+//   - "wire": the server->client bytes of a connection as captured on the
+//     network, compressed and, given the shared secret, encrypted; see
+//     ImportWire
+package importer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// Input is the data an importer reads.
+type Input struct {
+	Data   io.Reader
+	Times  io.Reader // timestamp sidecar, for formats that need one
+	Secret []byte    // shared secret of an encrypted connection, for "wire" and "pcap"
+	Port   int       // server port of the connection, for "pcap" (0 = DefaultPort)
+}
+
+// Func imports packets from in into w and returns the number of packets written.
+type Func func(in Input, w *mcpr.Writer) (int, error)
+
+var formats = map[string]Func{
+	"lenlog":   ImportLenLog,
+	"lenlog32": ImportLenLog32,
+	"hexlines": ImportHexLines,
+	"wire":     ImportWire,
+	"pcap":     ImportPcap,
+}
+
+// Formats returns the names of the supported input formats, sorted.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for n := range formats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the importer for a format name.
+func Lookup(format string) (Func, bool) {
+	f, ok := formats[format]
+	return f, ok
+}
+
+// ConvertFile imports the capture at dataPath (and optional timesPath) into a
+// new replay at out. If meta.Protocol is 0 it is guessed from the packets, see
+// mcpr.Writer.DetectProtocol.
+func ConvertFile(format, dataPath, timesPath, out string, meta mcpr.Meta) (int, error) {
+	return ConvertSecret(format, dataPath, timesPath, nil, out, meta)
+}
+
+// ConvertSecret is ConvertFile for encrypted captures, which need the shared
+// secret of the connection.
+func ConvertSecret(format, dataPath, timesPath string, secret []byte, out string, meta mcpr.Meta) (int, error) {
+	return Convert(format, dataPath, timesPath, Input{Secret: secret}, out, meta)
+}
+
+// Convert is ConvertFile with the options of in (Secret, Port); its Data and
+// Times are opened from dataPath and timesPath.
+func Convert(format, dataPath, timesPath string, in Input, out string, meta mcpr.Meta) (int, error) {
+	imp, ok := Lookup(format)
+	if !ok {
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer data.Close()
+	in.Data, in.Times = data, nil
+	if timesPath != "" {
+		tf, err := os.Open(timesPath)
+		if err != nil {
+			return 0, err
+		}
+		defer tf.Close()
+		in.Times = tf
+	}
+
+	w, err := mcpr.Create(out, meta, mcpr.WithProtocolDetection())
+	if err != nil {
+		return 0, err
+	}
+	n, err := imp(in, w)
+	if err != nil {
+		_ = w.Close()
+		return n, err
+	}
+	return n, w.Close()
+}
@@ -0,0 +1,121 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// ImportLenLog imports uncompressed wire frames prefixed with a VarInt length,
+// as written by simple socket loggers. Timestamps are read from in.Times, one
+// decimal millisecond value per line and frame; they are rebased so the first
+// packet is at t=0. Without a timestamp file all packets are placed at t=0.
+func ImportLenLog(in Input, w *mcpr.Writer) (int, error) {
+	return importLenLog(false)(in, w)
+}
+
+// ImportLenLog32 is like ImportLenLog for logs using a big-endian int32 length.
+func ImportLenLog32(in Input, w *mcpr.Writer) (int, error) {
+	return importLenLog(true)(in, w)
+}
+
+func importLenLog(int32Len bool) Func {
+	return func(in Input, w *mcpr.Writer) (int, error) {
+		br := bufio.NewReader(in.Data)
+		var times *timeSource
+		if in.Times != nil {
+			times = newTimeSource(in.Times)
+		}
+		n := 0
+		for {
+			var size int64
+			if int32Len {
+				var b [4]byte
+				if _, err := io.ReadFull(br, b[:]); err != nil {
+					if errors.Is(err, io.EOF) {
+						return n, nil
+					}
+					return n, fmt.Errorf("frame %d: %w", n, err)
+				}
+				size = int64(binary.BigEndian.Uint32(b[:]))
+			} else {
+				v, err := tmcpr.ReadVarInt(br)
+				if errors.Is(err, io.EOF) {
+					return n, nil
+				}
+				if err != nil {
+					return n, fmt.Errorf("frame %d: %w", n, err)
+				}
+				size = int64(v)
+			}
+			if size <= 0 || size > tmcpr.MaxFrameSize {
+				return n, fmt.Errorf("frame %d: invalid length %d", n, size)
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(br, body); err != nil {
+				return n, fmt.Errorf("frame %d: %w", n, err)
+			}
+			id, k, err := tmcpr.DecodeVarInt(body)
+			if err != nil {
+				return n, fmt.Errorf("frame %d: packet id: %w", n, err)
+			}
+			var ts uint32
+			if times != nil {
+				if ts, err = times.next(); err != nil {
+					return n, fmt.Errorf("frame %d: timestamp: %w", n, err)
+				}
+			}
+			if err := w.WritePacket(ts, id, body[k:]); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+// timeSource reads one timestamp per line and rebases them to the first.
+type timeSource struct {
+	sc    *bufio.Scanner
+	first int64
+	seen  bool
+}
+
+func newTimeSource(r io.Reader) *timeSource {
+	return &timeSource{sc: bufio.NewScanner(r)}
+}
+
+func (t *timeSource) next() (uint32, error) {
+	for t.sc.Scan() {
+		line := strings.TrimSpace(t.sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return t.rebase(v)
+	}
+	if err := t.sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("timestamp file has fewer entries than frames")
+}
+
+func (t *timeSource) rebase(v int64) (uint32, error) {
+	if !t.seen {
+		t.first, t.seen = v, true
+	}
+	d := v - t.first
+	if d < 0 {
+		return 0, fmt.Errorf("timestamp %d before first timestamp %d", v, t.first)
+	}
+	return uint32(d), nil
+}
@@ -0,0 +1,498 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/netframe"
+)
+
+// The "pcap" format is the classic libpcap capture file written by tcpdump,
+// Wireshark and most other network tools. Importing picks the first TCP
+// connection sent from the server port (Input.Port), reassembles its
+// server->client bytes and decodes them as ImportWire does, with each
+// packet timestamped when the segment completing it was captured.
+// Exporting writes the replay as such a connection over Ethernet, with
+// synthetic addresses, so the packets can be inspected with those tools.
+
+// DefaultPort is the server port ImportPcap follows when Input.Port is 0.
+const DefaultPort = 25565
+
+// pcap file constants.
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapMaxRecord  = 256 << 20
+
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkRawAlt   = 12 // LINKTYPE_RAW on some BSDs
+	linkSLL      = 113
+	linkSLL2     = 276
+)
+
+// pcapMaxPending bounds the out-of-order data buffered while waiting for a
+// missing segment.
+const pcapMaxPending = 64 << 20
+
+// ImportPcap imports the server->client half of a Minecraft connection from
+// a pcap capture, see the "pcap" format. in.Secret decrypts captures of
+// online-mode servers as for ImportWire; in.Times is not used.
+func ImportPcap(in Input, w *mcpr.Writer) (int, error) {
+	port := in.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	s, err := newPcapStream(in.Data, uint16(port))
+	if err != nil {
+		return 0, err
+	}
+	times := &timeSource{}
+	return importWire(s, in.Secret, func() (uint32, error) { return times.rebase(s.now) }, w)
+}
+
+// pcapStream reads the reassembled server->client bytes of one TCP
+// connection from a pcap file. Each Read returns data from at most one
+// segment, so now is the capture time of the segment the last byte read
+// came from.
+type pcapStream struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	nano  bool
+	link  uint32
+	port  uint16
+
+	flow    string // source and destination of the connection followed
+	synced  bool   // next is known
+	next    uint32 // sequence number of the next byte expected
+	pending map[uint32][]byte
+	pendLen int
+	fin     bool
+	finSeq  uint32
+
+	buf []byte // data of the current segment not read yet
+	now int64  // capture time of the current segment, in ms
+	eof bool
+}
+
+func newPcapStream(r io.Reader, port uint16) (*pcapStream, error) {
+	s := &pcapStream{r: bufio.NewReader(r), port: port, pending: map[uint32][]byte{}}
+	var hdr [24]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("pcap header: %w", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(hdr[0:]) == pcapMagicMicro:
+		s.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:]) == pcapMagicMicro:
+		s.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[0:]) == pcapMagicNano:
+		s.order, s.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[0:]) == pcapMagicNano:
+		s.order, s.nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap file (pcapng is not supported; convert it with editcap -F pcap)")
+	}
+	s.link = s.order.Uint32(hdr[20:]) & 0x0fffffff
+	switch s.link {
+	case linkNull, linkEthernet, linkRaw, linkRawAlt, linkSLL, linkSLL2:
+	default:
+		return nil, fmt.Errorf("pcap link type %d is not supported", s.link)
+	}
+	return s, nil
+}
+
+func (s *pcapStream) Read(p []byte) (int, error) {
+	if err := s.fill(); err != nil {
+		return 0, err
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *pcapStream) ReadByte() (byte, error) {
+	if err := s.fill(); err != nil {
+		return 0, err
+	}
+	b := s.buf[0]
+	s.buf = s.buf[1:]
+	return b, nil
+}
+
+// fill reads records until data of the connection is available.
+func (s *pcapStream) fill() error {
+	for len(s.buf) == 0 {
+		if s.eof {
+			return io.EOF
+		}
+		if err := s.record(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record reads one capture record and takes its data if it belongs to the
+// connection.
+func (s *pcapStream) record() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+			if s.flow == "" {
+				return fmt.Errorf("pcap: no TCP connection from port %d in the capture", s.port)
+			}
+			if s.pendLen > 0 {
+				return fmt.Errorf("pcap: %d bytes of the connection follow a segment missing from the capture", s.pendLen)
+			}
+			return nil
+		}
+		return fmt.Errorf("pcap record: %w", err)
+	}
+	sec, frac := int64(s.order.Uint32(hdr[0:])), int64(s.order.Uint32(hdr[4:]))
+	incl, orig := s.order.Uint32(hdr[8:]), s.order.Uint32(hdr[12:])
+	if incl > pcapMaxRecord {
+		return fmt.Errorf("pcap record of %d bytes", incl)
+	}
+	data := make([]byte, incl)
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		return fmt.Errorf("pcap record: %w", err)
+	}
+	ms := sec*1000 + frac/1000
+	if s.nano {
+		ms = sec*1000 + frac/1000000
+	}
+
+	ip, ok := s.network(data)
+	if !ok {
+		return nil
+	}
+	seg, ok := parseTCP(ip)
+	if !ok || seg.src != s.port {
+		return nil
+	}
+	if s.flow == "" {
+		s.flow = seg.flow
+	} else if seg.flow != s.flow {
+		return nil
+	}
+	if incl < orig {
+		return fmt.Errorf("pcap: segment cut to %d of %d bytes by the capture's snapshot length", incl, orig)
+	}
+	s.now = ms
+	s.segment(seg)
+	return nil
+}
+
+// network returns the IP packet in a link-layer frame.
+func (s *pcapStream) network(frame []byte) ([]byte, bool) {
+	switch s.link {
+	case linkNull:
+		if len(frame) < 4 {
+			return nil, false
+		}
+		return frame[4:], true
+	case linkRaw, linkRawAlt:
+		return frame, true
+	case linkSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+		return frame[16:], true
+	case linkSLL2:
+		if len(frame) < 20 {
+			return nil, false
+		}
+		return frame[20:], true
+	}
+	// Ethernet, possibly with VLAN tags
+	if len(frame) < 14 {
+		return nil, false
+	}
+	typ, rest := binary.BigEndian.Uint16(frame[12:]), frame[14:]
+	for typ == 0x8100 || typ == 0x88a8 {
+		if len(rest) < 4 {
+			return nil, false
+		}
+		typ, rest = binary.BigEndian.Uint16(rest[2:]), rest[4:]
+	}
+	if typ != 0x0800 && typ != 0x86dd {
+		return nil, false
+	}
+	return rest, true
+}
+
+// tcpSegment is the part of a TCP segment the stream needs.
+type tcpSegment struct {
+	flow     string
+	src      uint16
+	seq      uint32
+	syn, fin bool
+	rst      bool
+	data     []byte
+}
+
+// parseTCP decodes the TCP segment in an IPv4 or IPv6 packet. Fragments and
+// IPv6 extension headers are not followed.
+func parseTCP(ip []byte) (tcpSegment, bool) {
+	var seg tcpSegment
+	var src, dst, tcp []byte
+	if len(ip) < 1 {
+		return seg, false
+	}
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return seg, false
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		frag := binary.BigEndian.Uint16(ip[6:]) & 0x3fff // MF and offset
+		if ip[9] != 6 || frag != 0 || ihl < 20 || total < ihl || total > len(ip) {
+			return seg, false
+		}
+		src, dst, tcp = ip[12:16], ip[16:20], ip[ihl:total] // total drops Ethernet padding
+	case 6:
+		if len(ip) < 40 {
+			return seg, false
+		}
+		plen := int(binary.BigEndian.Uint16(ip[4:]))
+		if ip[6] != 6 || 40+plen > len(ip) {
+			return seg, false
+		}
+		src, dst, tcp = ip[8:24], ip[24:40], ip[40:40+plen]
+	default:
+		return seg, false
+	}
+	if len(tcp) < 20 {
+		return seg, false
+	}
+	off := int(tcp[12]>>4) * 4
+	if off < 20 || off > len(tcp) {
+		return seg, false
+	}
+	seg.src = binary.BigEndian.Uint16(tcp[0:])
+	seg.flow = fmt.Sprintf("%x:%d>%x:%d", src, seg.src, dst, binary.BigEndian.Uint16(tcp[2:]))
+	seg.seq = binary.BigEndian.Uint32(tcp[4:])
+	flags := tcp[13]
+	seg.fin, seg.syn, seg.rst = flags&0x01 != 0, flags&0x02 != 0, flags&0x04 != 0
+	seg.data = tcp[off:]
+	return seg, true
+}
+
+// segment adds a segment of the connection, reassembling out-of-order and
+// retransmitted data.
+func (s *pcapStream) segment(seg tcpSegment) {
+	if seg.rst {
+		s.eof = true
+		return
+	}
+	seq := seg.seq
+	if seg.syn {
+		s.next, s.synced = seq+1, true
+		seq++
+	} else if !s.synced {
+		s.next, s.synced = seq, true
+	}
+	if seg.fin {
+		s.fin, s.finSeq = true, seq+uint32(len(seg.data))
+	}
+	if len(seg.data) > 0 {
+		if d := int32(seq - s.next); d > 0 {
+			if _, dup := s.pending[seq]; !dup && s.pendLen+len(seg.data) <= pcapMaxPending {
+				s.pending[seq] = seg.data
+				s.pendLen += len(seg.data)
+			}
+		} else {
+			s.take(seq, seg.data)
+			s.drain()
+		}
+	}
+	if s.fin && s.next == s.finSeq {
+		s.eof = true
+	}
+}
+
+// take appends the part of data at seq not delivered yet.
+func (s *pcapStream) take(seq uint32, data []byte) {
+	skip := int(s.next - seq)
+	if skip >= len(data) {
+		return
+	}
+	s.buf = append(s.buf, data[skip:]...)
+	s.next += uint32(len(data) - skip)
+}
+
+// drain delivers pending segments that became contiguous.
+func (s *pcapStream) drain() {
+	for {
+		found := false
+		for seq, data := range s.pending {
+			if int32(seq-s.next) <= 0 {
+				delete(s.pending, seq)
+				s.pendLen -= len(data)
+				s.take(seq, data)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// Addresses of the connection exportPcap writes.
+var (
+	pcapServerMAC = []byte{0x02, 0, 0, 0, 0, 0x01}
+	pcapClientMAC = []byte{0x02, 0, 0, 0, 0, 0x02}
+	pcapServerIP  = []byte{10, 0, 0, 1}
+	pcapClientIP  = []byte{10, 0, 0, 2}
+)
+
+const (
+	pcapClientPort = 50000
+	pcapMaxSegment = 65535 - 20 - 20 // IPv4 total length minus IP and TCP headers
+)
+
+// exportPcap writes the frames as a TCP connection from pcapServerIP:25565,
+// opened with a SYN-ACK and closed with a FIN, timestamped from meta.Date.
+// Frames after a login SetCompression are compressed as the server would
+// have.
+func exportPcap(fr *tmcpr.Reader, meta mcpr.Meta, data, _ io.Writer) (int, error) {
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 262144)
+	binary.LittleEndian.PutUint32(hdr[20:], linkEthernet)
+	if _, err := data.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	pw := &pcapWriter{w: data, seq: 1000}
+	if err := pw.segment(meta.Date, 0x12, nil); err != nil { // SYN, ACK
+		return 0, err
+	}
+	pw.seq++
+	login, threshold := true, -1
+	n := 0
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			return n, pw.segment(meta.Date+int64(pw.last), 0x11, nil) // FIN, ACK
+		}
+		if err != nil {
+			return n, err
+		}
+		packet := append(tmcpr.AppendVarInt(nil, f.ID), f.Payload...)
+		body, err := netframe.Encode(packet, threshold)
+		if err != nil {
+			return n, fmt.Errorf("packet %d: %w", n, err)
+		}
+		frame := netframe.Append(nil, body)
+		ms := meta.Date + int64(f.Time)
+		for len(frame) > 0 {
+			k := min(len(frame), pcapMaxSegment)
+			if err := pw.segment(ms, 0x18, frame[:k]); err != nil { // PSH, ACK
+				return n, err
+			}
+			pw.seq += uint32(k)
+			frame = frame[k:]
+		}
+		pw.last = f.Time
+		if login {
+			switch f.ID {
+			case loginSetCompression:
+				if t, _, err := tmcpr.DecodeVarInt(f.Payload); err == nil {
+					threshold = max(int(t), -1)
+				}
+			case loginSuccess:
+				login = false
+			}
+		}
+		n++
+	}
+}
+
+// pcapWriter writes the server's segments of the exported connection.
+type pcapWriter struct {
+	w    io.Writer
+	seq  uint32
+	id   uint16
+	last uint32 // time of the latest packet
+	buf  []byte
+}
+
+// segment writes one TCP segment with flags and payload, captured at ms.
+func (p *pcapWriter) segment(ms int64, flags byte, payload []byte) error {
+	size := 14 + 20 + 20 + len(payload)
+	b := append(p.buf[:0], make([]byte, 16+size)...)
+	binary.LittleEndian.PutUint32(b[0:], uint32(ms/1000))
+	binary.LittleEndian.PutUint32(b[4:], uint32(ms%1000*1000))
+	binary.LittleEndian.PutUint32(b[8:], uint32(size))
+	binary.LittleEndian.PutUint32(b[12:], uint32(size))
+
+	eth := b[16:]
+	copy(eth[0:], pcapClientMAC)
+	copy(eth[6:], pcapServerMAC)
+	binary.BigEndian.PutUint16(eth[12:], 0x0800)
+
+	ip := eth[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+20+len(payload)))
+	binary.BigEndian.PutUint16(ip[4:], p.id)
+	p.id++
+	binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+	ip[8], ip[9] = 64, 6
+	copy(ip[12:], pcapServerIP)
+	copy(ip[16:], pcapClientIP)
+	binary.BigEndian.PutUint16(ip[10:], checksum(0, ip[:20]))
+
+	tcp := ip[20:]
+	binary.BigEndian.PutUint16(tcp[0:], DefaultPort)
+	binary.BigEndian.PutUint16(tcp[2:], pcapClientPort)
+	binary.BigEndian.PutUint32(tcp[4:], p.seq)
+	binary.BigEndian.PutUint32(tcp[8:], 1)
+	tcp[12], tcp[13] = 5<<4, flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+	// Checksum over the IPv4 pseudo header and the segment
+	var pseudo [12]byte
+	copy(pseudo[0:], pcapServerIP)
+	copy(pseudo[4:], pcapClientIP)
+	pseudo[9] = 6
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+	binary.BigEndian.PutUint16(tcp[16:], checksum(sum16(0, pseudo[:]), tcp))
+
+	p.buf = b
+	_, err := p.w.Write(b)
+	return err
+}
+
+// sum16 adds b to the one's complement sum s.
+func sum16(s uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		s += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		s += uint32(b[0]) << 8
+	}
+	return s
+}
+
+// checksum returns the Internet checksum of b, continuing the sum s.
+func checksum(s uint32, b []byte) uint16 {
+	s = sum16(s, b)
+	for s > 0xffff {
+		s = s>>16 + s&0xffff
+	}
+	return ^uint16(s)
+}
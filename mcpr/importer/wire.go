@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/netframe"
+)
+
+// Login packet ids (clientbound) the wire importer follows.
+const (
+	loginEncryptionRequest = 0x01
+	loginSuccess           = 0x02
+	loginSetCompression    = 0x03
+)
+
+// ImportWire imports the server->client half of a TCP connection exactly as
+// it was captured on the network, from the first login packet on: VarInt
+// length framing, compression once the server enables it and, for online
+// mode servers, encryption from the frame after the encryption request on.
+// Encrypted captures need in.Secret, the connection's shared secret exported
+// by a cooperating client. The encryption request itself is left out of the
+// replay. Timestamps are read from in.Times as for ImportLenLog.
+func ImportWire(in Input, w *mcpr.Writer) (int, error) {
+	next := func() (uint32, error) { return 0, nil }
+	if in.Times != nil {
+		next = newTimeSource(in.Times).next
+	}
+	return importWire(in.Data, in.Secret, next, w)
+}
+
+// importWire imports the wire frames read from data, timestamping each with
+// frameTime, called once the frame has been read.
+func importWire(data io.Reader, secret []byte, frameTime func() (uint32, error), w *mcpr.Writer) (int, error) {
+	raw := bufio.NewReader(data)
+	var br io.ByteReader = raw
+	var r io.Reader = raw
+	login, threshold := true, -1
+	n, frames := 0, 0
+	for ; ; frames++ {
+		size, err := tmcpr.ReadVarInt(br)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("frame %d: %w", frames, err)
+		}
+		if size <= 0 || size > tmcpr.MaxFrameSize {
+			return n, fmt.Errorf("frame %d: invalid length %d (encrypted, or wrong secret?)", frames, size)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return n, fmt.Errorf("frame %d: %w", frames, err)
+		}
+		id, payload, err := netframe.DecodePacket(body, threshold)
+		if err != nil {
+			return n, fmt.Errorf("frame %d: %w", frames, err)
+		}
+		ts, err := frameTime()
+		if err != nil {
+			return n, fmt.Errorf("frame %d: timestamp: %w", frames, err)
+		}
+
+		if login {
+			switch id {
+			case loginEncryptionRequest:
+				if secret == nil {
+					return n, errors.New("capture is encrypted; the connection's shared secret is needed")
+				}
+				// Everything after this frame is encrypted. raw may hold
+				// bytes read ahead, so decrypt from it rather than in.Data.
+				dec, err := newCFB8Decrypter(secret)
+				if err != nil {
+					return n, err
+				}
+				sr := bufio.NewReader(cipher.StreamReader{S: dec, R: raw})
+				br, r = sr, sr
+				continue
+			case loginSetCompression:
+				t, _, err := tmcpr.DecodeVarInt(payload)
+				if err != nil {
+					return n, fmt.Errorf("frame %d: set compression: %w", frames, err)
+				}
+				threshold = max(int(t), -1)
+			case loginSuccess:
+				login = false
+			}
+		}
+		if err := w.WritePacket(ts, id, payload); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// cfb8 decrypts AES/CFB8, the cipher of Minecraft connections, which use the
+// shared secret as both key and IV. The standard library only has CFB128.
+type cfb8 struct {
+	block cipher.Block
+	reg   []byte // shift register: the last block-size ciphertext bytes
+	out   []byte
+}
+
+func newCFB8Decrypter(secret []byte) (cipher.Stream, error) {
+	if len(secret) != 16 {
+		return nil, fmt.Errorf("shared secret must be 16 bytes, have %d", len(secret))
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("shared secret: %w", err)
+	}
+	return &cfb8{block: block, reg: append([]byte(nil), secret...), out: make([]byte, block.BlockSize())}, nil
+}
+
+func (c *cfb8) XORKeyStream(dst, src []byte) {
+	for i, b := range src {
+		c.block.Encrypt(c.out, c.reg)
+		copy(c.reg, c.reg[1:])
+		c.reg[len(c.reg)-1] = b
+		dst[i] = b ^ c.out[0]
+	}
+}
@@ -0,0 +1,97 @@
+// Package archive opens .mcpr files for the packages that read replays.
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// Archive is an opened replay file.
+type Archive struct {
+	*zip.ReadCloser
+	Meta mcpr.Meta
+}
+
+// Open opens the replay at path and parses its metadata.
+func Open(path string) (*Archive, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	if err := mcpr.CheckArchive(zr.File, mcpr.DefaultArchiveLimits); err != nil {
+		_ = zr.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	a := &Archive{ReadCloser: zr}
+	rc, err := zr.Open("metaData.json")
+	if err != nil {
+		_ = zr.Close()
+		return nil, fmt.Errorf("open metaData.json: %w", err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&a.Meta); err != nil {
+		_ = zr.Close()
+		return nil, fmt.Errorf("parse metaData.json: %w", err)
+	}
+	return a, nil
+}
+
+// Frames opens recording.tmcpr. The returned closer must be closed after use.
+func (a *Archive) Frames() (*tmcpr.Reader, io.Closer, error) {
+	rc, err := a.ReadCloser.Open("recording.tmcpr")
+	if err != nil {
+		return nil, nil, fmt.Errorf("open recording.tmcpr: %w", err)
+	}
+	return tmcpr.NewReader(rc), rc, nil
+}
+
+// Index returns the frame index if the archive has one.
+func (a *Archive) Index() (*tmcpr.Index, error) {
+	rc, err := a.ReadCloser.Open(tmcpr.IndexEntryName)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return tmcpr.ReadIndex(rc)
+}
+
+// FramesAt opens recording.tmcpr positioned at stream offset off, which must be
+// a frame boundary. Skipped bytes are decompressed but not parsed.
+func (a *Archive) FramesAt(off int64) (*tmcpr.Reader, io.Closer, error) {
+	rc, err := a.ReadCloser.Open("recording.tmcpr")
+	if err != nil {
+		return nil, nil, fmt.Errorf("open recording.tmcpr: %w", err)
+	}
+	if _, err := io.CopyN(io.Discard, rc, off); err != nil {
+		_ = rc.Close()
+		return nil, nil, fmt.Errorf("skip to offset %d: %w", off, err)
+	}
+	return tmcpr.NewReaderAt(rc, off), rc, nil
+}
+
+// Each calls fn for every frame of the recording, stopping at the first error.
+func (a *Archive) Each(fn func(f tmcpr.Frame) error) error {
+	fr, rc, err := a.Frames()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
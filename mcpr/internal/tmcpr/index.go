@@ -0,0 +1,100 @@
+package tmcpr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// IndexEntryName is the archive entry holding the frame index.
+const IndexEntryName = "recording.tmcpr.index"
+
+var indexMagic = [8]byte{'M', 'C', 'P', 'R', 'I', 'D', 'X', 1}
+
+// IndexEntry points at the first frame at or after a time boundary.
+type IndexEntry struct {
+	Time   uint32 // timestamp of the frame
+	Offset int64  // byte offset of the frame in recording.tmcpr
+}
+
+// Index maps times to frame offsets in recording.tmcpr.
+// Layout: magic[8] interval:u32 count:u32 then count × (time:u32 offset:u64), big-endian.
+type Index struct {
+	Interval uint32 // ms between entries
+	Entries  []IndexEntry
+}
+
+// Add records a frame at offset if it starts a new interval.
+func (ix *Index) Add(ts uint32, offset int64) {
+	if n := len(ix.Entries); n > 0 && ts < ix.Entries[n-1].Time+ix.Interval {
+		return
+	}
+	ix.Entries = append(ix.Entries, IndexEntry{Time: ts, Offset: offset})
+}
+
+// Mark records a frame at offset regardless of the interval, e.g. at a
+// dimension change that seeking tools should be able to land on.
+func (ix *Index) Mark(ts uint32, offset int64) {
+	if n := len(ix.Entries); n > 0 && ix.Entries[n-1].Offset == offset {
+		return
+	}
+	ix.Entries = append(ix.Entries, IndexEntry{Time: ts, Offset: offset})
+}
+
+// Lookup returns the last entry at or before ms, and false if there is none.
+func (ix *Index) Lookup(ms uint32) (IndexEntry, bool) {
+	lo, hi := 0, len(ix.Entries)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if ix.Entries[mid].Time <= ms {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return IndexEntry{}, false
+	}
+	return ix.Entries[lo-1], true
+}
+
+// WriteTo writes the index in its binary form.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 0, 16+12*len(ix.Entries))
+	buf = append(buf, indexMagic[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, ix.Interval)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(ix.Entries)))
+	for _, e := range ix.Entries {
+		buf = binary.BigEndian.AppendUint32(buf, e.Time)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(e.Offset))
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadIndex parses an index written by Index.WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("index header: %w", err)
+	}
+	if [8]byte(hdr[:8]) != indexMagic {
+		return nil, errors.New("index: bad magic")
+	}
+	ix := &Index{Interval: binary.BigEndian.Uint32(hdr[8:12])}
+	count := binary.BigEndian.Uint32(hdr[12:16])
+	body, err := io.ReadAll(io.LimitReader(r, int64(count)*12+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != int(count)*12 {
+		return nil, fmt.Errorf("index: want %d entries, have %d bytes", count, len(body))
+	}
+	ix.Entries = make([]IndexEntry, count)
+	for i := range ix.Entries {
+		e := body[i*12:]
+		ix.Entries[i] = IndexEntry{Time: binary.BigEndian.Uint32(e), Offset: int64(binary.BigEndian.Uint64(e[4:]))}
+	}
+	return ix, nil
+}
@@ -0,0 +1,170 @@
+package tmcpr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ResyncWindow bounds, in ms, how much later than the last good frame a frame
+// found while resynchronizing may be.
+const ResyncWindow = 60 * 60 * 1000
+
+// Skipped is a byte range of the stream that a lenient Reader dropped.
+type Skipped struct {
+	Offset int64
+	Length int64
+	Err    error // what was wrong at Offset
+}
+
+// SetLenient makes the Reader skip corrupt data instead of failing: after an
+// invalid length, a bad packet id or a frame cut off by the end of the
+// stream, it scans byte by byte for the next plausible frame (a valid header
+// whose time is at most ResyncWindow after the last good frame, followed by
+// another valid header when that is buffered) and calls report with each
+// range dropped, then continues from there. A stream that fails to decompress ends there, the buffered
+// rest being reported. Frames are read ahead whole, so Skip saves no memory
+// in this mode. nil makes the Reader strict again.
+func (r *Reader) SetLenient(report func(Skipped)) {
+	r.report = report
+}
+
+// frameHead is a frame header found by peekFrame.
+type frameHead struct {
+	ts     uint32
+	n      int   // length after the header
+	id     int32 // packet id, that of the frame held by a packed frame
+	k      int   // length of the id VarInt
+	packed bool
+}
+
+func (r *Reader) nextLenient() (uint32, int32, error) {
+	var skip *Skipped
+	drop := func(n int, err error) {
+		if skip == nil {
+			skip = &Skipped{Offset: r.off, Err: err}
+		}
+		skip.Length += int64(n)
+		r.off += int64(n)
+	}
+	flush := func() {
+		if skip != nil {
+			r.report(*skip)
+			skip = nil
+		}
+	}
+	for {
+		h, end, err := r.peekFrame(skip != nil)
+		if end {
+			if n := r.br.Buffered(); n > 0 || skip != nil || !errors.Is(err, io.EOF) {
+				_, _ = r.br.Discard(n)
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				drop(n, err)
+			}
+			flush()
+			return 0, 0, io.EOF
+		}
+		if err != nil {
+			_, _ = r.br.Discard(1)
+			drop(1, err)
+			continue
+		}
+
+		frame := make([]byte, 8+h.n)
+		got, err := io.ReadFull(r.br, frame)
+		if err != nil {
+			// Cut off by the end of the stream: look for frames in what was
+			// read, behind its first byte
+			r.br = bufio.NewReaderSize(io.MultiReader(bytes.NewReader(frame[1:got]), r.br), r.br.Size())
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			drop(1, err)
+			continue
+		}
+		body := frame[8+h.k:]
+		if h.packed {
+			// Packed frames are unpacked now, so that corrupt ones are skipped
+			_, unpacked, err := Unpack(body)
+			if err != nil {
+				drop(len(frame), err)
+				continue
+			}
+			body = unpacked
+		}
+		flush()
+		r.last = int64(h.ts)
+		r.body = body
+		r.rest = len(body)
+		r.size = int64(len(frame))
+		r.packed = false
+		return h.ts, h.id, nil
+	}
+}
+
+// peekFrame checks the frame at the current position without consuming it.
+// end reports that the stream ends, or fails with err, before a whole frame
+// header; otherwise err says why the frame is not plausible. While
+// resynchronizing, frames must also have a time close to the last one, a
+// packet id below 256, which every protocol version so far stays within, and
+// be followed by a plausible header.
+func (r *Reader) peekFrame(resync bool) (h frameHead, end bool, err error) {
+	b, err := r.br.Peek(8)
+	if len(b) < 8 {
+		return h, true, err
+	}
+	h.ts = binary.BigEndian.Uint32(b[0:4])
+	n := binary.BigEndian.Uint32(b[4:8])
+	if n == 0 || n > MaxFrameSize {
+		return h, false, fmt.Errorf("tmcpr: invalid frame length %d at t=%d", n, h.ts)
+	}
+	h.n = int(n)
+	if b, err = r.br.Peek(8 + min(5, h.n)); err != nil {
+		return h, false, io.ErrUnexpectedEOF
+	}
+	if h.id, h.k, err = DecodeVarInt(b[8:]); err != nil {
+		return h, false, fmt.Errorf("tmcpr: packet id at t=%d: %w", h.ts, err)
+	}
+	if h.packed = h.id == PackedID; h.packed {
+		if b, err = r.br.Peek(8 + h.k + min(5, h.n-h.k)); err != nil {
+			return h, false, io.ErrUnexpectedEOF
+		}
+		if h.id, _, err = DecodeVarInt(b[8+h.k:]); err != nil || h.id < 0 {
+			return h, false, fmt.Errorf("tmcpr: packed frame at t=%d: invalid packet id", h.ts)
+		}
+	} else if h.id < 0 {
+		return h, false, fmt.Errorf("tmcpr: negative packet id %d at t=%d", h.id, h.ts)
+	}
+	if resync {
+		if h.id >= 0x100 {
+			return h, false, fmt.Errorf("tmcpr: implausible packet id %#x at t=%d", h.id, h.ts)
+		}
+		if r.last >= 0 && (int64(h.ts) < r.last || int64(h.ts)-r.last > ResyncWindow) {
+			return h, false, fmt.Errorf("tmcpr: implausible time t=%d after t=%d", h.ts, r.last)
+		}
+	}
+	// The next header, when buffered, must be plausible too
+	if resync && 8+h.n+8 <= r.br.Size() {
+		b, _ = r.br.Peek(8 + h.n + 8)
+		if len(b) < 8+h.n {
+			return h, false, io.ErrUnexpectedEOF
+		}
+		if len(b) == 8+h.n+8 && !plausibleNext(h.ts, b[8+h.n:]) {
+			return h, false, fmt.Errorf("tmcpr: frame at t=%d is not followed by a valid frame", h.ts)
+		}
+	}
+	return h, false, nil
+}
+
+// plausibleNext reports whether b, the header of the frame after one at time
+// ts, could start a frame.
+func plausibleNext(ts uint32, b []byte) bool {
+	next := binary.BigEndian.Uint32(b[0:4])
+	n := binary.BigEndian.Uint32(b[4:8])
+	return n > 0 && n <= MaxFrameSize && next >= ts && next-ts <= ResyncWindow
+}
@@ -0,0 +1,70 @@
+package tmcpr
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PackedID is the packet id of a packed frame, an extension of this module
+// for archival copies: its payload is [varint packet id][varint size]
+// [DEFLATE data] of the frame it replaces. Real packet ids are never
+// negative. Reader unpacks such frames transparently; ReplayMod cannot read
+// them, so packed recordings must be rewritten without packing first.
+const PackedID int32 = -1
+
+// Pack returns the payload of a packed frame holding packet id with payload.
+func Pack(id int32, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(AppendVarInt(nil, id))
+	buf.Write(AppendVarInt(nil, int32(len(payload))))
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unpack returns the packet id and payload held by the payload of a packed
+// frame.
+func Unpack(b []byte) (int32, []byte, error) {
+	id, k, err := DecodeVarInt(b)
+	if err != nil {
+		return 0, nil, fmt.Errorf("tmcpr: packed frame id: %w", err)
+	}
+	n, m, err := DecodeVarInt(b[k:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("tmcpr: packed frame size: %w", err)
+	}
+	if id < 0 || n < 0 || n > MaxFrameSize {
+		return 0, nil, fmt.Errorf("tmcpr: invalid packed frame (id %d, size %d)", id, n)
+	}
+	payload := make([]byte, n)
+	zr := flate.NewReader(bytes.NewReader(b[k+m:]))
+	if _, err := io.ReadFull(zr, payload); err != nil {
+		return 0, nil, fmt.Errorf("tmcpr: packed frame data: %w", err)
+	}
+	// The data must end where the size says
+	if _, err := zr.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		return 0, nil, errors.New("tmcpr: packed frame data longer than its size")
+	}
+	return id, payload, nil
+}
+
+// AppendVarInt appends v to b as a Minecraft VarInt.
+func AppendVarInt(b []byte, v int32) []byte {
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
@@ -0,0 +1,275 @@
+// Package tmcpr decodes the recording.tmcpr frame stream:
+// [timeBE:int32][lenBE:int32][varint packetId][packet bytes].
+package tmcpr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxFrameSize bounds the length field of a single frame. Larger values are
+// treated as corruption rather than allocated.
+const MaxFrameSize = 32 << 20
+
+// Frame is a single decoded packet frame.
+type Frame struct {
+	Time    uint32
+	ID      int32
+	Payload []byte
+}
+
+// Reader reads frames from a recording.tmcpr stream.
+type Reader struct {
+	br     *bufio.Reader
+	off    int64
+	rest   int            // payload bytes of the frame started by NextHeader, -1 if none
+	size   int64          // its size including the header
+	packed bool           // it is a packed frame, see PackedID
+	body   []byte         // its payload if read ahead, see SetLenient
+	stream *payloadStream // the payload handed out by PayloadReader, if any
+
+	report func(Skipped) // see SetLenient
+	last   int64         // time of the last frame returned in lenient mode, or -1
+}
+
+// NewReader returns a Reader reading frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReaderSize(r, 64<<10), rest: -1, last: -1}
+}
+
+// NewReaderAt returns a Reader for r, which is positioned at stream offset off
+// (e.g. after skipping to an index entry). Offsets reported by the Reader are
+// relative to the start of the stream.
+func NewReaderAt(r io.Reader, off int64) *Reader {
+	fr := NewReader(r)
+	fr.off = off
+	return fr
+}
+
+// Offset returns the stream offset of the next frame; between NextHeader and
+// Payload or Skip, that of the frame started.
+func (r *Reader) Offset() int64 {
+	return r.off
+}
+
+// Next returns the next frame. It returns io.EOF at a clean end of stream and
+// io.ErrUnexpectedEOF if the stream ends inside a frame. Packed frames (see
+// PackedID) are returned unpacked.
+func (r *Reader) Next() (Frame, error) {
+	ts, id, err := r.NextHeader()
+	if err != nil {
+		return Frame{}, err
+	}
+	payload, err := r.Payload()
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Time: ts, ID: id, Payload: payload}, nil
+}
+
+// NextHeader reads the time and packet id of the next frame, which must then
+// be finished with Payload or Skip. Together they let callers drop frames
+// without allocating their payloads. Errors are those of Next.
+func (r *Reader) NextHeader() (uint32, int32, error) {
+	if r.rest >= 0 {
+		return 0, 0, errors.New("tmcpr: NextHeader before Payload or Skip")
+	}
+	if err := r.closeStream(); err != nil {
+		return 0, 0, err
+	}
+	if r.report != nil {
+		return r.nextLenient()
+	}
+	var hdr [8]byte
+	if _, err := io.ReadFull(r.br, hdr[:]); err != nil {
+		return 0, 0, err
+	}
+	ts := binary.BigEndian.Uint32(hdr[0:4])
+	n := binary.BigEndian.Uint32(hdr[4:8])
+	if n == 0 || n > MaxFrameSize {
+		return 0, 0, fmt.Errorf("tmcpr: invalid frame length %d at t=%d", n, ts)
+	}
+	peek := 5
+	if n < 5 {
+		peek = int(n)
+	}
+	b, err := r.br.Peek(peek)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, err
+	}
+	id, k, err := DecodeVarInt(b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("tmcpr: packet id at t=%d: %w", ts, err)
+	}
+	_, _ = r.br.Discard(k)
+	r.rest = int(n) - k
+	r.size = int64(len(hdr)) + int64(n)
+	r.packed = id == PackedID
+	if r.packed {
+		// The packed frame starts with the id of the frame it holds
+		if b, err = r.br.Peek(min(5, r.rest)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, err
+		}
+		if id, _, err = DecodeVarInt(b); err != nil || id < 0 {
+			return 0, 0, fmt.Errorf("tmcpr: packed frame at t=%d: invalid packet id", ts)
+		}
+	}
+	return ts, id, nil
+}
+
+// Payload reads the payload of the frame started by NextHeader.
+func (r *Reader) Payload() ([]byte, error) {
+	if r.rest < 0 {
+		return nil, errors.New("tmcpr: Payload without NextHeader")
+	}
+	if r.body != nil {
+		body := r.body
+		r.off += r.size
+		r.rest, r.body = -1, nil
+		return body, nil
+	}
+	body := make([]byte, r.rest)
+	if _, err := io.ReadFull(r.br, body); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r.off += r.size
+	r.rest = -1
+	if r.packed {
+		_, unpacked, err := Unpack(body)
+		return unpacked, err
+	}
+	return body, nil
+}
+
+// PayloadReader returns the payload of the frame started by NextHeader as a
+// stream read straight from the recording, so that callers needing only its
+// start do not allocate it whole. The stream is valid until the next call on
+// r, which discards what was left unread. Payloads read ahead (see
+// SetLenient) or packed are returned from memory.
+func (r *Reader) PayloadReader() (io.Reader, error) {
+	if r.rest < 0 {
+		return nil, errors.New("tmcpr: PayloadReader without NextHeader")
+	}
+	if r.body != nil || r.packed {
+		b, err := r.Payload()
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+	r.stream = &payloadStream{br: r.br, n: r.rest}
+	r.off += r.size
+	r.rest = -1
+	return r.stream, nil
+}
+
+// payloadStream is a payload returned by PayloadReader.
+type payloadStream struct {
+	br *bufio.Reader // nil once the Reader moved on
+	n  int           // bytes left
+}
+
+func (s *payloadStream) Read(p []byte) (int, error) {
+	if s.br == nil {
+		return 0, errors.New("tmcpr: payload read after the Reader moved on")
+	}
+	if s.n <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > s.n {
+		p = p[:s.n]
+	}
+	n, err := s.br.Read(p)
+	s.n -= n
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// closeStream discards the unread rest of the payload handed out by
+// PayloadReader and invalidates it.
+func (r *Reader) closeStream() error {
+	s := r.stream
+	if s == nil {
+		return nil
+	}
+	r.stream, s.br = nil, nil
+	if n, err := r.br.Discard(s.n); n < s.n {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// Skip discards the payload of the frame started by NextHeader.
+func (r *Reader) Skip() error {
+	if r.rest < 0 {
+		return errors.New("tmcpr: Skip without NextHeader")
+	}
+	if r.body != nil {
+		r.off += r.size
+		r.rest, r.body = -1, nil
+		return nil
+	}
+	n, err := r.br.Discard(r.rest)
+	if n < r.rest {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.off += r.size
+	r.rest = -1
+	return nil
+}
+
+// DecodeVarInt decodes a Minecraft VarInt from the start of b and returns the
+// value and the number of bytes consumed.
+func DecodeVarInt(b []byte) (int32, int, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		if i >= len(b) {
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+		v |= uint32(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return int32(v), i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("varint too long")
+}
+
+// ReadVarInt reads a Minecraft VarInt from r.
+func ReadVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if i > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("varint too long")
+}
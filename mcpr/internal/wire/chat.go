@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PlainText flattens a JSON chat component (as sent before 1.20.3) to its
+// text. Translated components, whose text lives in the client's language
+// files, become their key followed by their arguments in brackets
+// ("death.attack.player [Steve, Alex]"); invalid JSON is returned unchanged.
+func PlainText(component string) string {
+	var v any
+	if err := json.Unmarshal([]byte(component), &v); err != nil {
+		return component
+	}
+	var sb strings.Builder
+	plain(&sb, v)
+	return sb.String()
+}
+
+func plain(sb *strings.Builder, v any) {
+	switch v := v.(type) {
+	case string:
+		sb.WriteString(v)
+	case []any:
+		for _, c := range v {
+			plain(sb, c)
+		}
+	case map[string]any:
+		if t, ok := v["text"].(string); ok {
+			sb.WriteString(t)
+		} else if key, ok := v["translate"].(string); ok && key == "chat.square_brackets" {
+			// Item names in death and chat messages: "[Diamond Sword]"
+			args, _ := v["with"].([]any)
+			sb.WriteByte('[')
+			plain(sb, args)
+			sb.WriteByte(']')
+		} else if key, ok := v["translate"].(string); ok {
+			sb.WriteString(key)
+			if args, _ := v["with"].([]any); len(args) > 0 {
+				sb.WriteString(" [")
+				for i, a := range args {
+					if i > 0 {
+						sb.WriteString(", ")
+					}
+					plain(sb, a)
+				}
+				sb.WriteByte(']')
+			}
+		}
+		if extra, ok := v["extra"].([]any); ok {
+			plain(sb, extra)
+		}
+	}
+}
+
+// Translation returns the key and flattened arguments of a translated chat
+// component; ok is false for other components.
+func Translation(component string) (key string, args []string, ok bool) {
+	var v struct {
+		Translate string `json:"translate"`
+		With      []any  `json:"with"`
+	}
+	if err := json.Unmarshal([]byte(component), &v); err != nil || v.Translate == "" {
+		return "", nil, false
+	}
+	for _, a := range v.With {
+		var sb strings.Builder
+		plain(&sb, a)
+		args = append(args, sb.String())
+	}
+	return v.Translate, args, true
+}
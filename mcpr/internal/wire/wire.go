@@ -0,0 +1,155 @@
+// Package wire decodes the primitive types of Minecraft packet payloads for
+// the packages that analyze recorded packets.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/nbt"
+)
+
+// ErrShort is reported when a payload ends inside a field.
+var ErrShort = errors.New("protocol: short packet")
+
+// Decoder reads fields from a payload, recording the first error; after it,
+// reads return zero values. Check Err once all fields are read.
+type Decoder struct {
+	B   []byte
+	Err error
+}
+
+// NewDecoder returns a decoder over payload p.
+func NewDecoder(p []byte) *Decoder {
+	return &Decoder{B: p}
+}
+
+// Skip skips n bytes.
+func (d *Decoder) Skip(n int) {
+	d.take(n)
+}
+
+func (d *Decoder) take(n int) []byte {
+	if d.Err != nil {
+		return nil
+	}
+	if n < 0 || len(d.B) < n {
+		d.Err = ErrShort
+		return nil
+	}
+	b := d.B[:n]
+	d.B = d.B[n:]
+	return b
+}
+
+func (d *Decoder) Byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *Decoder) Bool() bool {
+	return d.Byte() != 0
+}
+
+func (d *Decoder) Short() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *Decoder) Int() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *Decoder) Long() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *Decoder) Float() float32 {
+	return math.Float32frombits(uint32(d.Int()))
+}
+
+func (d *Decoder) Double() float64 {
+	return math.Float64frombits(uint64(d.Long()))
+}
+
+func (d *Decoder) VarInt() int32 {
+	if d.Err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.B)
+	if n <= 0 || n > 5 {
+		d.Err = ErrShort
+		return 0
+	}
+	d.B = d.B[n:]
+	return int32(uint32(v))
+}
+
+func (d *Decoder) VarLong() int64 {
+	if d.Err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.B)
+	if n <= 0 || n > 10 {
+		d.Err = ErrShort
+		return 0
+	}
+	d.B = d.B[n:]
+	return int64(v)
+}
+
+func (d *Decoder) String() string {
+	return string(d.take(int(d.VarInt())))
+}
+
+// Raw returns the next n bytes.
+func (d *Decoder) Raw(n int) []byte {
+	return d.take(n)
+}
+
+// ByteArray returns a VarInt-prefixed byte array.
+func (d *Decoder) ByteArray() []byte {
+	return d.take(int(d.VarInt()))
+}
+
+// UUID returns a UUID in its canonical hyphenated form.
+func (d *Decoder) UUID() string {
+	b := d.take(16)
+	if b == nil {
+		return ""
+	}
+	const hex = "0123456789abcdef"
+	out := make([]byte, 0, 36)
+	for i, c := range b {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			out = append(out, '-')
+		}
+		out = append(out, hex[c>>4], hex[c&15])
+	}
+	return string(out)
+}
+
+// NBT returns the raw bytes of an embedded NBT tag (a single TagEnd byte
+// when absent). network selects the nameless root of protocol 764+.
+func (d *Decoder) NBT(network bool) []byte {
+	if d.Err != nil {
+		return nil
+	}
+	n, err := nbt.Len(d.B, network)
+	if err != nil {
+		d.Err = err
+		return nil
+	}
+	return d.take(n)
+}
@@ -0,0 +1,312 @@
+// Package inventory extracts a timeline of the recording player's inventory
+// from a replay: every slot change and every held (hotbar) slot change, for
+// speedrun verification or investigating kit abuse.
+//
+// Only what the server sends is recorded. Hotbar selection made by the client
+// is serverbound and therefore missing; Held only reflects the slot the server
+// selects (on join, respawn or by command). Items are identified by their
+// numeric registry id, which is fixed per game version.
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/nbt"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Player inventory (window 0) slots.
+const (
+	SlotCraftingResult = 0
+	SlotHead           = 5
+	SlotChest          = 6
+	SlotLegs           = 7
+	SlotFeet           = 8
+	SlotMainStart      = 9  // 27 main inventory slots, 9-35
+	SlotHotbarStart    = 36 // 9 hotbar slots, 36-44
+	SlotOffhand        = 45
+	NumSlots           = 46
+
+	// SlotCursor is the item carried by the mouse cursor.
+	SlotCursor = -1
+)
+
+// Item is a stack of items.
+type Item struct {
+	ID    int32          `json:"id"` // item registry id
+	Count int            `json:"count"`
+	Tag   map[string]any `json:"tag,omitempty"` // item NBT (enchantments, custom name, ...)
+
+	raw []byte // NBT bytes, for comparison
+}
+
+// Equal reports whether a and b hold the same stack; nil is an empty slot.
+func (a *Item) Equal(b *Item) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID && a.Count == b.Count && bytes.Equal(a.raw, b.raw)
+}
+
+// Change is one change to a slot.
+type Change struct {
+	Time     uint32 `json:"time"` // ms
+	Slot     int    `json:"slot"` // see the Slot constants
+	Item     *Item  `json:"item"` // nil when emptied
+	Previous *Item  `json:"previous"`
+}
+
+// HeldChange is a change of the selected hotbar slot.
+type HeldChange struct {
+	Time   uint32 `json:"time"`
+	Hotbar int    `json:"hotbar"` // 0-8
+}
+
+// Timeline is the inventory history of a replay.
+type Timeline struct {
+	Protocol int          `json:"protocol"`
+	Changes  []Change     `json:"changes"`
+	Held     []HeldChange `json:"held"`
+}
+
+// State is the inventory at one point in time.
+type State struct {
+	Slots  [NumSlots]*Item
+	Cursor *Item
+	Hotbar int // selected hotbar slot, 0-8
+}
+
+// HeldItem returns the item in the selected hotbar slot.
+func (s *State) HeldItem() *Item {
+	return s.Slots[SlotHotbarStart+s.Hotbar]
+}
+
+// At reconstructs the inventory at time t (ms).
+func (tl *Timeline) At(t uint32) State {
+	var s State
+	for _, c := range tl.Changes {
+		if c.Time > t {
+			break
+		}
+		s.set(c.Slot, c.Item)
+	}
+	for _, h := range tl.Held {
+		if h.Time > t {
+			break
+		}
+		s.Hotbar = h.Hotbar
+	}
+	return s
+}
+
+func (s *State) get(slot int) *Item {
+	if slot == SlotCursor {
+		return s.Cursor
+	}
+	return s.Slots[slot]
+}
+
+func (s *State) set(slot int, it *Item) {
+	if slot == SlotCursor {
+		s.Cursor = it
+		return
+	}
+	s.Slots[slot] = it
+}
+
+// WriteJSON writes the timeline as indented JSON.
+func (tl *Timeline) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tl)
+}
+
+// SlotName describes a slot, e.g. "hotbar 3" or "offhand".
+func SlotName(slot int) string {
+	switch {
+	case slot == SlotCursor:
+		return "cursor"
+	case slot == SlotCraftingResult:
+		return "crafting result"
+	case slot < SlotHead:
+		return fmt.Sprintf("crafting %d", slot)
+	case slot == SlotHead:
+		return "head"
+	case slot == SlotChest:
+		return "chest"
+	case slot == SlotLegs:
+		return "legs"
+	case slot == SlotFeet:
+		return "feet"
+	case slot < SlotHotbarStart:
+		return fmt.Sprintf("main %d", slot-SlotMainStart+1)
+	case slot < SlotOffhand:
+		return fmt.Sprintf("hotbar %d", slot-SlotHotbarStart+1)
+	case slot == SlotOffhand:
+		return "offhand"
+	}
+	return fmt.Sprintf("slot %d", slot)
+}
+
+// ErrUnsupported is returned for protocols without slot decoders.
+var ErrUnsupported = errors.New("inventory: protocol not supported")
+
+// layouts decode the slot data of a protocol version, keyed by protocol.
+var layouts = map[int]layout{
+	764: {networkNBT: true},
+}
+
+// layout describes how a protocol encodes item stacks.
+type layout struct {
+	networkNBT bool // nameless root tag (1.20.2+)
+}
+
+// Analyzer builds a Timeline from the clientbound packets of a recording.
+type Analyzer struct {
+	table   *protocol.Table
+	tracker *protocol.Tracker
+	layout  layout
+	state   State
+	tl      Timeline
+
+	setContent, setSlot, setCarried int32
+}
+
+// NewAnalyzer returns an analyzer for a recording of the given protocol that
+// starts in state s (protocol.Login for ReplayMod recordings).
+func NewAnalyzer(proto int, s protocol.State) (*Analyzer, error) {
+	table, ok := protocol.Lookup(proto)
+	lay, ok2 := layouts[proto]
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, proto)
+	}
+	a := &Analyzer{table: table, tracker: protocol.NewTracker(table, s), layout: lay}
+	a.tl = Timeline{Protocol: proto, Changes: []Change{}, Held: []HeldChange{}}
+	a.setContent = a.id("ContainerSetContent")
+	a.setSlot = a.id("ContainerSetSlot")
+	a.setCarried = a.id("SetCarriedItem")
+	return a, nil
+}
+
+func (a *Analyzer) id(name string) int32 {
+	if id, ok := a.table.ID(protocol.Clientbound, protocol.Play, name); ok {
+		return id
+	}
+	return -1
+}
+
+// Observe feeds one packet. Malformed inventory packets are reported but
+// leave the analyzer usable.
+func (a *Analyzer) Observe(ts uint32, id int32, payload []byte) error {
+	if a.tracker.Observe(id) != protocol.Play {
+		return nil
+	}
+	d := wire.NewDecoder(payload)
+	switch id {
+	case a.setContent:
+		window := d.Byte()
+		d.VarInt() // state id
+		n := int(d.VarInt())
+		if window != 0 {
+			// Other containers; their trailing player inventory slots are
+			// resent for window 0 when the container closes
+			return d.Err
+		}
+		items := make([]*Item, 0, NumSlots)
+		for i := 0; i < n && d.Err == nil; i++ {
+			items = append(items, a.item(d))
+		}
+		cursor := a.item(d)
+		if d.Err != nil {
+			return fmt.Errorf("ContainerSetContent at %d ms: %w", ts, d.Err)
+		}
+		for i, it := range items {
+			if i < NumSlots {
+				a.change(ts, i, it)
+			}
+		}
+		a.change(ts, SlotCursor, cursor)
+	case a.setSlot:
+		window := int8(d.Byte())
+		d.VarInt() // state id
+		slot := int(d.Short())
+		it := a.item(d)
+		if d.Err != nil {
+			return fmt.Errorf("ContainerSetSlot at %d ms: %w", ts, d.Err)
+		}
+		switch {
+		case window == -1 && slot == -1:
+			a.change(ts, SlotCursor, it)
+		case (window == 0 || window == -2) && slot >= 0 && slot < NumSlots:
+			a.change(ts, slot, it)
+		}
+	case a.setCarried:
+		hb := int(d.Byte())
+		if d.Err != nil || hb > 8 {
+			return fmt.Errorf("SetCarriedItem at %d ms: invalid slot", ts)
+		}
+		if hb != a.state.Hotbar || len(a.tl.Held) == 0 {
+			a.state.Hotbar = hb
+			a.tl.Held = append(a.tl.Held, HeldChange{Time: ts, Hotbar: hb})
+		}
+	}
+	return nil
+}
+
+// item decodes a slot: present:bool [id:varint count:byte nbt].
+func (a *Analyzer) item(d *wire.Decoder) *Item {
+	if !d.Bool() {
+		return nil
+	}
+	it := &Item{ID: d.VarInt(), Count: int(int8(d.Byte()))}
+	it.raw = d.NBT(a.layout.networkNBT)
+	if d.Err != nil || len(it.raw) <= 1 {
+		it.raw = nil
+		return it
+	}
+	if _, v, err := nbt.Decode(bytes.NewReader(it.raw), a.layout.networkNBT); err == nil {
+		it.Tag, _ = v.(map[string]any)
+	}
+	return it
+}
+
+func (a *Analyzer) change(ts uint32, slot int, it *Item) {
+	prev := a.state.get(slot)
+	if prev.Equal(it) {
+		return
+	}
+	a.state.set(slot, it)
+	a.tl.Changes = append(a.tl.Changes, Change{Time: ts, Slot: slot, Item: it, Previous: prev})
+}
+
+// Timeline returns the changes observed so far.
+func (a *Analyzer) Timeline() *Timeline {
+	return &a.tl
+}
+
+// Extract builds the inventory timeline of the replay at path.
+func Extract(path string) (*Timeline, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	a, err := NewAnalyzer(ar.Meta.Protocol, protocol.Login)
+	if err != nil {
+		return nil, err
+	}
+	err = ar.Each(func(f tmcpr.Frame) error {
+		return a.Observe(f.Time, f.ID, f.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.Timeline(), nil
+}
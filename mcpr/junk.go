@@ -0,0 +1,121 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "strings"
+)
+
+// EntryProblem is an archive entry that does not belong in a replay, as
+// added by archivers and file managers (OS metadata files, directory
+// entries), by tools appending to the ZIP (duplicate names) or crafted to
+// escape an extraction directory (see SafeEntryName). ReplayMod's importer
+// may reject or misread replays containing them.
+type EntryProblem struct {
+    Name   string
+    Index  int    // position in the central directory
+    Reason string // "unsafe name", "directory", "os metadata" or "duplicate"
+}
+
+func (p EntryProblem) String() string {
+    return fmt.Sprintf("%s (%s)", p.Name, p.Reason)
+}
+
+// osMetadataFiles are file names created by operating systems, not tools.
+var osMetadataFiles = map[string]bool{
+    ".DS_Store":   true,
+    "Thumbs.db":   true,
+    "ehthumbs.db": true,
+    "desktop.ini": true,
+}
+
+// CheckEntries returns the entries of a replay archive that should not be
+// there. Of duplicate names, every entry after the first is reported.
+func CheckEntries(files []*zip.File) []EntryProblem {
+    var out []EntryProblem
+    seen := map[string]bool{}
+    for i, f := range files {
+        base := path.Base(f.Name)
+        reason := ""
+        switch {
+        case !SafeEntryName(f.Name):
+            reason = "unsafe name"
+        case seen[f.Name]:
+            reason = "duplicate"
+        case strings.HasSuffix(f.Name, "/") || f.FileInfo().IsDir():
+            reason = "directory"
+        case osMetadataFiles[base] || strings.HasPrefix(base, "._") ||
+            f.Name == "__MACOSX" || strings.HasPrefix(f.Name, "__MACOSX/"):
+            reason = "os metadata"
+        }
+        seen[f.Name] = true
+        if reason != "" {
+            out = append(out, EntryProblem{Name: f.Name, Index: i, Reason: reason})
+        }
+    }
+    return out
+}
+
+// CleanFile copies the replay at src to dst without the entries reported by
+// CheckEntries, keeping the first of duplicate names. Entries are copied
+// without recompression, so the recording is unchanged byte for byte. dst may
+// equal src; the copy is written to a temporary file and renamed into place.
+// Archives failing the other checks of CheckArchive (overlapping entries,
+// DefaultArchiveLimits) are not copied.
+func CleanFile(src, dst string) ([]EntryProblem, error) {
+    zr, err := zip.OpenReader(src)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    if err := checkLayout(zr.File, DefaultArchiveLimits); err != nil {
+        return nil, err
+    }
+    problems := CheckEntries(zr.File)
+    skip := map[int]bool{}
+    for _, p := range problems {
+        skip[p.Index] = true
+    }
+
+    tmp := dst + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return nil, err
+    }
+    zw := zip.NewWriter(out)
+    copyAll := func() error {
+        for i, f := range zr.File {
+            if skip[i] {
+                continue
+            }
+            hdr := f.FileHeader
+            w, err := zw.CreateRaw(&hdr)
+            if err != nil {
+                return err
+            }
+            r, err := f.OpenRaw()
+            if err != nil {
+                return err
+            }
+            if _, err := io.Copy(w, r); err != nil {
+                return fmt.Errorf("copy %s: %w", f.Name, err)
+            }
+        }
+        if err := zw.Close(); err != nil {
+            return err
+        }
+        return out.Close()
+    }
+    if err := copyAll(); err != nil {
+        _ = out.Close()
+        _ = os.Remove(tmp)
+        return nil, err
+    }
+    if err := os.Rename(tmp, dst); err != nil {
+        return nil, err
+    }
+    return problems, nil
+}
@@ -0,0 +1,178 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// LatencyEntryName is the archive entry holding the arrival lag of every
+// frame, see Writer.TrackLatency. ReplayMod ignores it.
+const LatencyEntryName = "latency.bin"
+
+// LatencyUnknown is the lag of frames without an estimate: those before the
+// first SetTime of a play session and those inserted by the writer.
+const LatencyUnknown = math.MaxInt16
+
+// latency.bin layout: magic[8] count:u32 then count × lag:i16, big-endian,
+// one lag per frame of recording.tmcpr in order.
+var latencyMagic = [8]byte{'M', 'C', 'P', 'R', 'L', 'A', 'T', 1}
+
+// latencyTracker estimates the server's tick clock from SetTime packets,
+// see Writer.TrackLatency.
+type latencyTracker struct {
+    state   *protocol.Tracker
+    setTime int32
+
+    known bool   // a SetTime was seen since entering play
+    base  int64  // lowest receive time minus server time seen, ms
+    at    uint32 // receive time of the latest SetTime
+    lag   int64  // its lag behind base
+    lags  []int16
+}
+
+// TrackLatency makes the writer estimate, for every frame, how late it
+// arrived behind the server tick it was most likely sent in, and write the
+// estimates to "latency.bin" on Close for network-quality analysis.
+//
+// The server's clock comes from the world age in SetTime packets, which the
+// server sends every second: a SetTime's lag is its receive time minus its
+// world age in ms, relative to the lowest such value seen, so the fastest
+// delivery counts as 0. Other frames are assumed to be sent on the 50 ms tick
+// grid of the latest SetTime, so their lag adds their distance from it;
+// spread around the SetTime lags shows jitter, rising lags show network or
+// server lag. Lags are in ms and reset when a session leaves play, e.g. on a
+// server switch.
+//
+// initial is the connection state of the first packet, as for
+// TrackDimensions. Call it before writing packets; it fails if the writer's
+// protocol has no packet table. The estimates take 2 bytes of memory per
+// frame until Close.
+//
+// Deprecated: Use WithLatency.
+func (w *Writer) TrackLatency(initial protocol.State) error {
+    defer w.lock().unlock()
+    t, ok := protocol.Lookup(w.meta.Protocol)
+    if !ok {
+        return fmt.Errorf("mcpr: no packet table for protocol %d", w.meta.Protocol)
+    }
+    id, ok := t.ID(protocol.Clientbound, protocol.Play, "SetTime")
+    if !ok {
+        return fmt.Errorf("mcpr: no SetTime packet in protocol %d", w.meta.Protocol)
+    }
+    w.lat = &latencyTracker{state: protocol.NewTracker(t, initial), setTime: id}
+    return nil
+}
+
+// observe records the lag of a frame received at ts.
+func (l *latencyTracker) observe(ts uint32, id int32, payload []byte) {
+    if l.state.Observe(id) != protocol.Play {
+        l.known = false
+        l.lags = append(l.lags, LatencyUnknown)
+        return
+    }
+    // SetTime (1.20.2): worldAge:long timeOfDay:long
+    if id == l.setTime && len(payload) >= 16 {
+        off := int64(ts) - int64(binary.BigEndian.Uint64(payload[0:8]))*50
+        if !l.known || off < l.base {
+            l.base = off
+        }
+        l.known = true
+        l.at = ts
+        l.lag = off - l.base
+    }
+    if !l.known {
+        l.lags = append(l.lags, LatencyUnknown)
+        return
+    }
+    d := int64(ts) - int64(l.at)
+    lag := l.lag + d - (d+25)/50*50
+    if lag >= LatencyUnknown {
+        lag = LatencyUnknown - 1
+    } else if lag < math.MinInt16 {
+        lag = math.MinInt16
+    }
+    l.lags = append(l.lags, int16(lag))
+}
+
+// inserted records a frame the writer inserted itself.
+func (l *latencyTracker) inserted() {
+    l.lags = append(l.lags, LatencyUnknown)
+}
+
+func (w *Writer) writeLatency() error {
+    if w.lat == nil || w.entries[LatencyEntryName] {
+        return nil
+    }
+    lw, err := w.createEntry(LatencyEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", LatencyEntryName, err)
+    }
+    buf := make([]byte, 0, 12+2*len(w.lat.lags))
+    buf = append(buf, latencyMagic[:]...)
+    buf = binary.BigEndian.AppendUint32(buf, uint32(len(w.lat.lags)))
+    for _, lag := range w.lat.lags {
+        buf = binary.BigEndian.AppendUint16(buf, uint16(lag))
+    }
+    _, err = lw.Write(buf)
+    return err
+}
+
+// ReadLatency returns the per-frame lags stored in the replay at path, one
+// per frame in recording order, or nil if it has none. Frames without an
+// estimate are LatencyUnknown.
+func ReadLatency(path string) ([]int16, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return findLatency(zr.File)
+}
+
+// Latency returns the per-frame lags stored in the replay, see ReadLatency.
+func (r *Reader) Latency() ([]int16, error) {
+    return findLatency(r.files)
+}
+
+func findLatency(files []*zip.File) ([]int16, error) {
+    for _, f := range files {
+        if f.Name == LatencyEntryName {
+            return readLatency(f)
+        }
+    }
+    return nil, nil
+}
+
+func readLatency(f *zip.File) ([]int16, error) {
+    rc, err := f.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    var hdr [12]byte
+    if _, err := io.ReadFull(rc, hdr[:]); err != nil {
+        return nil, fmt.Errorf("%s header: %w", LatencyEntryName, err)
+    }
+    if [8]byte(hdr[:8]) != latencyMagic {
+        return nil, errors.New(LatencyEntryName + ": bad magic")
+    }
+    count := binary.BigEndian.Uint32(hdr[8:12])
+    body, err := io.ReadAll(io.LimitReader(rc, int64(count)*2+1))
+    if err != nil {
+        return nil, err
+    }
+    if len(body) != int(count)*2 {
+        return nil, fmt.Errorf("%s: want %d frames, have %d bytes", LatencyEntryName, count, len(body))
+    }
+    lags := make([]int16, count)
+    for i := range lags {
+        lags[i] = int16(binary.BigEndian.Uint16(body[i*2:]))
+    }
+    return lags, nil
+}
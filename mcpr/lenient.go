@@ -0,0 +1,61 @@
+package mcpr
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+
+// SkippedRange is a part of recording.tmcpr that a lenient reader dropped.
+type SkippedRange struct {
+    Offset int64 // stream offset in recording.tmcpr
+    Length int64
+    Err    error // what was wrong at Offset
+}
+
+// SetLenient makes the Reader salvage what it can from a damaged recording,
+// such as one left behind by a crashed recorder, instead of failing at the
+// first corrupt frame. After an invalid frame length, a bad packet id or a
+// frame cut off by the end of the recording, it resynchronizes at the next
+// plausible frame boundary: a valid header whose time is at most an hour after
+// the last good packet, followed by another valid header. Skipped lists the
+// byte ranges dropped. A recording that fails to decompress ends where it
+// fails. Call it before reading packets.
+func (r *Reader) SetLenient(lenient bool) {
+    r.lenient = lenient
+    if r.fr != nil {
+        if lenient {
+            r.fr.SetLenient(r.skip)
+        } else {
+            r.fr.SetLenient(nil)
+        }
+    }
+}
+
+// Skipped returns the byte ranges of recording.tmcpr a lenient Reader has
+// dropped so far, in the order met. Ranges read again after SeekToTime are
+// listed once.
+func (r *Reader) Skipped() []SkippedRange {
+    return r.skipped
+}
+
+func (r *Reader) skip(s tmcpr.Skipped) {
+    for _, old := range r.skipped {
+        if old.Offset == s.Offset {
+            return
+        }
+    }
+    r.skipped = append(r.skipped, SkippedRange(s))
+}
+
+// SetLenient makes the TMCPRReader skip corrupt frames, see Reader.SetLenient.
+func (r *TMCPRReader) SetLenient(lenient bool) {
+    if !lenient {
+        r.fr.SetLenient(nil)
+        return
+    }
+    r.fr.SetLenient(func(s tmcpr.Skipped) {
+        r.skipped = append(r.skipped, SkippedRange(s))
+    })
+}
+
+// Skipped returns the byte ranges a lenient TMCPRReader has dropped so far.
+func (r *TMCPRReader) Skipped() []SkippedRange {
+    return r.skipped
+}
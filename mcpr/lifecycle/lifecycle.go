@@ -0,0 +1,288 @@
+// Package lifecycle runs the shutdown of a long-running recording process as
+// one ordered sequence with timeouts, so a SIGTERM from a service manager
+// finalizes every replay and finishes uploads instead of leaving truncated
+// files behind.
+//
+// Shutdown proceeds in four phases:
+//
+//  1. Stop: the context returned by Context is cancelled, on a signal or a
+//     call to Stop. Listeners and sessions watching it wind down.
+//  2. Drain: tasks started with Go are waited for, up to Timeouts.Drain.
+//  3. Finalize: hooks registered with OnShutdown run, newest first, with a
+//     context bounded by Timeouts.Finalize; recorders are closed here, which
+//     validates their replays.
+//  4. Deliver: deliveries started with Deliver (uploads, webhooks), including
+//     those started by the phases above, are waited for up to
+//     Timeouts.Deliver, then their context is cancelled.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/recorder"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/upload"
+)
+
+// Timeouts bound the phases of Shutdown. Zero fields use DefaultTimeouts.
+type Timeouts struct {
+	Drain    time.Duration // for tasks started with Go
+	Finalize time.Duration // for all OnShutdown hooks together
+	Deliver  time.Duration // for outstanding deliveries
+}
+
+// DefaultTimeouts suit a proxy or bot recorder run by a service manager;
+// give the process at least their sum before killing it.
+var DefaultTimeouts = Timeouts{
+	Drain:    30 * time.Second,
+	Finalize: 30 * time.Second,
+	Deliver:  10 * time.Minute,
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Lifecycle coordinates the shutdown of one process. Create it with New.
+type Lifecycle struct {
+	Timeouts Timeouts
+	Logf     func(format string, args ...any) // defaults to log.Printf
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopSignals context.CancelFunc
+
+	// Deliveries outlive the main context until the deliver phase ends
+	dctx    context.Context
+	dcancel context.CancelFunc
+
+	mu         sync.Mutex
+	hooks      map[int]hook
+	nextHook   int
+	delivering bool // false once the deliver phase has begun
+	shutdown   bool
+	tasks      sync.WaitGroup
+	deliveries sync.WaitGroup
+}
+
+// New returns a lifecycle whose context is cancelled when parent is done,
+// Stop is called or one of signals arrives (typically os.Interrupt and
+// syscall.SIGTERM). A second signal during Shutdown is not caught and
+// terminates the process as usual.
+func New(parent context.Context, signals ...os.Signal) *Lifecycle {
+	l := &Lifecycle{Timeouts: DefaultTimeouts, hooks: map[int]hook{}, delivering: true}
+	l.ctx, l.cancel = context.WithCancel(parent)
+	l.stopSignals = func() {}
+	if len(signals) > 0 {
+		var sctx context.Context
+		sctx, l.stopSignals = signal.NotifyContext(l.ctx, signals...)
+		go func() {
+			<-sctx.Done()
+			l.cancel()
+		}()
+	}
+	l.dctx, l.dcancel = context.WithCancel(context.Background())
+	return l
+}
+
+func (l *Lifecycle) logf(format string, args ...any) {
+	if l.Logf != nil {
+		l.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (l *Lifecycle) timeouts() Timeouts {
+	t := l.Timeouts
+	if t.Drain <= 0 {
+		t.Drain = DefaultTimeouts.Drain
+	}
+	if t.Finalize <= 0 {
+		t.Finalize = DefaultTimeouts.Finalize
+	}
+	if t.Deliver <= 0 {
+		t.Deliver = DefaultTimeouts.Deliver
+	}
+	return t
+}
+
+// Context is cancelled when shutdown begins.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Stop begins shutdown as if a signal had arrived. Call Shutdown to run it.
+func (l *Lifecycle) Stop() {
+	l.cancel()
+}
+
+// Go runs fn in a goroutine that Shutdown waits for in the drain phase. fn
+// should return soon after ctx, the lifecycle's context, is done. Tasks
+// started once Shutdown has begun are not run.
+func (l *Lifecycle) Go(fn func(ctx context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		l.logf("[lifecycle] shutting down, task not started")
+		return
+	}
+	l.tasks.Add(1)
+	go func() {
+		defer l.tasks.Done()
+		fn(l.ctx)
+	}()
+}
+
+// OnShutdown registers fn to run in the finalize phase. Call remove once the
+// resource was released on its own, e.g. a recording finished before
+// shutdown. fn must honour ctx, which expires with Timeouts.Finalize.
+func (l *Lifecycle) OnShutdown(name string, fn func(ctx context.Context) error) (remove func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := l.nextHook
+	l.nextHook++
+	l.hooks[id] = hook{name, fn}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.hooks, id)
+	}
+}
+
+// Deliver runs fn in a goroutine that Shutdown waits for in the deliver
+// phase. Unlike tasks, deliveries keep their context while the process stops
+// and are only cancelled when Timeouts.Deliver expires. Deliveries started
+// in the deliver phase, e.g. by a hook still running past Timeouts.Finalize,
+// are not run. Errors are logged.
+func (l *Lifecycle) Deliver(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.delivering {
+		l.logf("[lifecycle] %s: shutting down, not started", name)
+		return
+	}
+	l.deliveries.Add(1)
+	go func() {
+		defer l.deliveries.Done()
+		if err := fn(l.dctx); err != nil {
+			l.logf("[lifecycle] %s: %v", name, err)
+		}
+	}()
+}
+
+// Record registers rec to be closed in the finalize phase and, if u is not
+// nil, uploads every file rec finalizes (including continuation parts, see
+// recorder.Limits) as a delivery.
+func (l *Lifecycle) Record(rec *recorder.Recorder, u *upload.Uploader) {
+	if u != nil {
+		rec.OnFinalize(func(path string) {
+			l.Deliver("upload "+path, func(ctx context.Context) error {
+				url, err := u.Upload(ctx, path)
+				if err == nil {
+					l.logf("[lifecycle] uploaded %s to %s", path, url)
+				}
+				return err
+			})
+		})
+	}
+	l.OnShutdown("close recording "+rec.ID(), func(ctx context.Context) error {
+		// Close cannot be interrupted; stop waiting for it when ctx expires
+		done := make(chan error, 1)
+		go func() { done <- rec.Close() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return fmt.Errorf("not finalized: %w", ctx.Err())
+		}
+	})
+}
+
+// Wait blocks until shutdown begins and then runs Shutdown.
+func (l *Lifecycle) Wait() error {
+	<-l.ctx.Done()
+	return l.Shutdown()
+}
+
+// Shutdown stops the process in the order described in the package
+// documentation and returns the errors of finalize hooks and timeouts.
+// Later calls return nil immediately.
+func (l *Lifecycle) Shutdown() error {
+	l.mu.Lock()
+	if l.shutdown {
+		l.mu.Unlock()
+		return nil
+	}
+	l.shutdown = true
+	l.mu.Unlock()
+
+	t := l.timeouts()
+	var errs []error
+
+	// Stop
+	l.cancel()
+	l.stopSignals()
+
+	// Drain
+	if !wait(&l.tasks, t.Drain) {
+		errs = append(errs, fmt.Errorf("lifecycle: tasks still running after %s", t.Drain))
+	}
+
+	// Finalize
+	ctx, cancel := context.WithTimeout(context.Background(), t.Finalize)
+	for _, h := range l.takeHooks() {
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+		}
+	}
+	cancel()
+
+	// Deliver; no delivery may start while they are waited for
+	l.mu.Lock()
+	l.delivering = false
+	l.mu.Unlock()
+	if !wait(&l.deliveries, t.Deliver) {
+		errs = append(errs, fmt.Errorf("lifecycle: deliveries cancelled after %s", t.Deliver))
+	}
+	l.dcancel()
+	return errors.Join(errs...)
+}
+
+// takeHooks removes and returns the registered hooks, newest first.
+func (l *Lifecycle) takeHooks() []hook {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]hook, 0, len(l.hooks))
+	for id := l.nextHook - 1; id >= 0; id-- {
+		if h, ok := l.hooks[id]; ok {
+			out = append(out, h)
+		}
+	}
+	l.hooks = map[int]hook{}
+	return out
+}
+
+// wait waits for wg up to d and reports whether it finished.
+func wait(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
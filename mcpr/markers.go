@@ -0,0 +1,100 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+)
+
+// MarkersEntryName is the archive entry ReplayMod stores replay markers in.
+const MarkersEntryName = "markers.json"
+
+// Marker is a named point in the replay timeline, as shown in ReplayMod's
+// marker bar. Position is optional; ReplayMod sets it to the camera position
+// when a marker is added in the editor.
+type Marker struct {
+    Time     int             // milliseconds from the start of the recording
+    Name     string          // may be empty
+    Position *MarkerPosition // nil when unknown
+}
+
+// MarkerPosition is a camera position and rotation.
+type MarkerPosition struct {
+    X     float64 `json:"x"`
+    Y     float64 `json:"y"`
+    Z     float64 `json:"z"`
+    Yaw   float32 `json:"yaw"`
+    Pitch float32 `json:"pitch"`
+    Roll  float32 `json:"roll"`
+}
+
+// markerJSON is ReplayMod's on-disk form:
+// {"realTimestamp":1234,"value":{"name":"...","position":{...}}}
+type markerJSON struct {
+    RealTimestamp int `json:"realTimestamp"`
+    Value         struct {
+        Name     string          `json:"name,omitempty"`
+        Position *MarkerPosition `json:"position,omitempty"`
+    } `json:"value"`
+}
+
+// MarshalJSON encodes m in ReplayMod's markers.json form.
+func (m Marker) MarshalJSON() ([]byte, error) {
+    var j markerJSON
+    j.RealTimestamp = m.Time
+    j.Value.Name = m.Name
+    j.Value.Position = m.Position
+    return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a marker in ReplayMod's markers.json form.
+func (m *Marker) UnmarshalJSON(b []byte) error {
+    var j markerJSON
+    if err := json.Unmarshal(b, &j); err != nil {
+        return err
+    }
+    *m = Marker{Time: j.RealTimestamp, Name: j.Value.Name, Position: j.Value.Position}
+    return nil
+}
+
+// AddMarker adds a marker written to markers.json on Close. It has no effect
+// if the caller supplies markers.json itself via CreateEntry or CopyEntry.
+func (w *Writer) AddMarker(m Marker) {
+    defer w.lock().unlock()
+    w.markers = append(w.markers, m)
+}
+
+// ReadMarkers returns the markers stored in the replay at path, or nil if it
+// has none.
+func ReadMarkers(path string) ([]Marker, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return readMarkers(zr.File)
+}
+
+// Markers returns the markers stored in the replay's markers.json, or nil if
+// it has none, so tools need not parse ReplayMod's schema themselves.
+func (r *Reader) Markers() ([]Marker, error) {
+    return readMarkers(r.files)
+}
+
+func readMarkers(files []*zip.File) ([]Marker, error) {
+    for _, f := range files {
+        if f.Name == MarkersEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer rc.Close()
+            var ms []Marker
+            if err := json.NewDecoder(rc).Decode(&ms); err != nil {
+                return nil, fmt.Errorf("parse %s: %w", MarkersEntryName, err)
+            }
+            return ms, nil
+        }
+    }
+    return nil, nil
+}
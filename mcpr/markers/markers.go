@@ -0,0 +1,221 @@
+// Package markers converts replay markers (markers.json) to and from formats
+// editors work with: CSV for spreadsheets and YouTube-style chapter lists
+// ("00:01:23 Chapter name").
+package markers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// csvHeader is written by WriteCSV and skipped by ReadCSV.
+var csvHeader = []string{"time", "name", "x", "y", "z", "yaw", "pitch", "roll"}
+
+// ReadCSV parses markers from CSV rows of time,name[,x,y,z[,yaw,pitch,roll]].
+// time accepts anything ParseTime does. A leading header row is skipped.
+func ReadCSV(r io.Reader) ([]mcpr.Marker, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var out []mcpr.Marker
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) == 0 || (len(rec) == 1 && rec[0] == "") {
+			continue
+		}
+		if line == 1 && strings.EqualFold(rec[0], "time") {
+			continue
+		}
+		ms, err := ParseTime(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		m := mcpr.Marker{Time: ms}
+		if len(rec) > 1 {
+			m.Name = rec[1]
+		}
+		if len(rec) > 2 && rec[2] != "" {
+			if m.Position, err = parsePosition(rec[2:]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		out = append(out, m)
+	}
+	sortMarkers(out)
+	return out, nil
+}
+
+func parsePosition(f []string) (*mcpr.MarkerPosition, error) {
+	if len(f) != 3 && len(f) != 6 {
+		return nil, fmt.Errorf("want x,y,z or x,y,z,yaw,pitch,roll, got %d fields", len(f))
+	}
+	var v [6]float64
+	for i, s := range f {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", s)
+		}
+		v[i] = n
+	}
+	return &mcpr.MarkerPosition{X: v[0], Y: v[1], Z: v[2], Yaw: float32(v[3]), Pitch: float32(v[4]), Roll: float32(v[5])}, nil
+}
+
+// WriteCSV writes markers with a header row, times as H:MM:SS.mmm.
+func WriteCSV(w io.Writer, ms []mcpr.Marker) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, m := range ms {
+		rec := []string{FormatTime(m.Time, true), m.Name}
+		if p := m.Position; p != nil {
+			for _, v := range []float64{p.X, p.Y, p.Z, float64(p.Yaw), float64(p.Pitch), float64(p.Roll)} {
+				rec = append(rec, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadChapters parses a chapter list with one "TIME NAME" entry per line, as
+// used in YouTube descriptions. Separators such as "-" between time and name
+// are dropped; lines that do not start with a time are ignored, so a whole
+// video description can be pasted in.
+func ReadChapters(r io.Reader) ([]mcpr.Marker, error) {
+	var out []mcpr.Marker
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		ts, name, _ := strings.Cut(line, " ")
+		ms, err := ParseTime(ts)
+		if err != nil || !strings.Contains(ts, ":") {
+			continue
+		}
+		name = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(name), "-–—|:"))
+		out = append(out, mcpr.Marker{Time: ms, Name: name})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sortMarkers(out)
+	return out, nil
+}
+
+// WriteChapters writes markers as a YouTube chapter list. YouTube requires
+// the first chapter to start at 0:00, so one named "Start" is added if no
+// marker is at 0. Unnamed markers are called "Marker N".
+func WriteChapters(w io.Writer, ms []mcpr.Marker) error {
+	bw := bufio.NewWriter(w)
+	long := len(ms) > 0 && ms[len(ms)-1].Time >= int(time.Hour/time.Millisecond)
+	if len(ms) == 0 || ms[0].Time >= 1000 {
+		fmt.Fprintf(bw, "%s Start\n", FormatChapterTime(0, long))
+	}
+	for i, m := range ms {
+		name := m.Name
+		if name == "" {
+			name = fmt.Sprintf("Marker %d", i+1)
+		}
+		fmt.Fprintf(bw, "%s %s\n", FormatChapterTime(m.Time, long), name)
+	}
+	return bw.Flush()
+}
+
+// Shift moves markers by delta ms, e.g. a negative render start offset to map
+// replay time to video time. Markers that end up before 0 are dropped.
+func Shift(ms []mcpr.Marker, delta int) []mcpr.Marker {
+	var out []mcpr.Marker
+	for _, m := range ms {
+		m.Time += delta
+		if m.Time >= 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// ParseTime parses a marker time: plain milliseconds ("83500"), a clock time
+// ("1:23", "01:01:23", "1:23.5") or a Go duration ("83.5s", "1m23s").
+func ParseTime(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return n, nil
+	}
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		var total float64
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil || v < 0 || (i < len(parts)-1 && strings.Contains(p, ".")) {
+				return 0, fmt.Errorf("invalid time %q", s)
+			}
+			total = total*60 + v
+		}
+		return int(total*1000 + 0.5), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return int(d.Milliseconds()), nil
+}
+
+// FormatTime formats ms as H:MM:SS, with a .mmm suffix if millis is set.
+func FormatTime(ms int, millis bool) string {
+	s := fmt.Sprintf("%d:%02d:%02d", ms/3600000, ms/60000%60, ms/1000%60)
+	if millis {
+		s += fmt.Sprintf(".%03d", ms%1000)
+	}
+	return s
+}
+
+// FormatChapterTime formats ms the way YouTube shows chapter times: M:SS, or
+// H:MM:SS when long is set.
+func FormatChapterTime(ms int, long bool) string {
+	if long {
+		return FormatTime(ms, false)
+	}
+	return fmt.Sprintf("%d:%02d", ms/60000, ms/1000%60)
+}
+
+// Merge combines two marker lists in time order, dropping markers from b that
+// duplicate one in a (same time and name), so re-importing a file is harmless.
+func Merge(a, b []mcpr.Marker) []mcpr.Marker {
+	out := append([]mcpr.Marker(nil), a...)
+	seen := map[mcpr.Marker]bool{}
+	for _, m := range a {
+		seen[mcpr.Marker{Time: m.Time, Name: m.Name}] = true
+	}
+	for _, m := range b {
+		if !seen[mcpr.Marker{Time: m.Time, Name: m.Name}] {
+			out = append(out, m)
+		}
+	}
+	sortMarkers(out)
+	return out
+}
+
+func sortMarkers(ms []mcpr.Marker) {
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].Time < ms[j].Time })
+}
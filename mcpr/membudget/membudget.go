@@ -0,0 +1,155 @@
+// Package membudget accounts for the memory held by buffering features, so a
+// recorder embedded in a game proxy stays within a predictable footprint.
+// Today the only such feature is the live relay's catch-up history (see
+// replayserver.Relay.Memory); a Writer's async queue, clip windows and
+// sampling are bounded by their own settings and not accounted here.
+//
+// A Budget caps the total; each feature draws from it through an Account,
+// which may have a cap of its own. Features reserve memory before buffering
+// and, when a reservation fails, evict their own oldest data until it
+// succeeds. Accounts never evict each other, so features need not know about
+// each other's locks.
+package membudget
+
+import (
+	"sort"
+	"sync"
+)
+
+// Budget is a shared memory cap. The zero value is unlimited.
+type Budget struct {
+	mu       sync.Mutex
+	limit    int64
+	used     int64
+	peak     int64
+	accounts []*Account
+}
+
+// New returns a budget of limit bytes; 0 means unlimited (accounting only).
+func New(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Account is one feature's share of a budget. Its methods are safe for
+// concurrent use. A nil *Account is unlimited and accounts nothing, so
+// features can hold one unconditionally.
+type Account struct {
+	b     *Budget
+	name  string
+	limit int64
+	used  int64 // guarded by b.mu
+}
+
+// Account registers a consumer named name, e.g. "relay proxy.mcpr", capped at
+// limit bytes (0 means only the budget's limit applies).
+func (b *Budget) Account(name string, limit int64) *Account {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	a := &Account{b: b, name: name, limit: limit}
+	b.accounts = append(b.accounts, a)
+	return a
+}
+
+// TryReserve reserves n bytes if neither the account's nor the budget's limit
+// would be exceeded, and reports whether it did.
+func (a *Account) TryReserve(n int64) bool {
+	if a == nil {
+		return true
+	}
+	b := a.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a.limit > 0 && a.used+n > a.limit || b.limit > 0 && b.used+n > b.limit {
+		return false
+	}
+	a.add(n)
+	return true
+}
+
+// Reserve reserves n bytes regardless of the limits, for data a feature
+// cannot do without (e.g. a single packet larger than the budget). Such
+// overdraft shows in Used and makes later TryReserve calls fail until enough
+// is released.
+func (a *Account) Reserve(n int64) {
+	if a == nil {
+		return
+	}
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	a.add(n)
+}
+
+func (a *Account) add(n int64) {
+	a.used += n
+	a.b.used += n
+	if a.b.used > a.b.peak {
+		a.b.peak = a.b.used
+	}
+}
+
+// Release returns n bytes reserved earlier.
+func (a *Account) Release(n int64) {
+	if a == nil {
+		return
+	}
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	a.used -= n
+	a.b.used -= n
+}
+
+// Close releases everything the account holds and removes it from the
+// budget's statistics.
+func (a *Account) Close() {
+	if a == nil {
+		return
+	}
+	b := a.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= a.used
+	a.used = 0
+	for i, o := range b.accounts {
+		if o == a {
+			b.accounts = append(b.accounts[:i], b.accounts[i+1:]...)
+			break
+		}
+	}
+}
+
+// Used returns the bytes the account holds.
+func (a *Account) Used() int64 {
+	if a == nil {
+		return 0
+	}
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	return a.used
+}
+
+// Stats is a point-in-time view of a budget.
+type Stats struct {
+	Limit    int64
+	Used     int64
+	Peak     int64
+	Accounts []AccountStats // largest first
+}
+
+// AccountStats is one account's usage.
+type AccountStats struct {
+	Name  string
+	Limit int64
+	Used  int64
+}
+
+// Stats returns the budget's current usage.
+func (b *Budget) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := Stats{Limit: b.limit, Used: b.used, Peak: b.peak}
+	for _, a := range b.accounts {
+		st.Accounts = append(st.Accounts, AccountStats{Name: a.name, Limit: a.limit, Used: a.used})
+	}
+	sort.SliceStable(st.Accounts, func(i, j int) bool { return st.Accounts[i].Used > st.Accounts[j].Used })
+	return st
+}
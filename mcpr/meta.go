@@ -1,5 +1,12 @@
 package mcpr
 
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
 // CurrentFileFormatVersion is the latest ReplayMod MCPR format supported by this package.
 const CurrentFileFormatVersion = 14
 
@@ -18,5 +25,162 @@ type Meta struct {
     Generator         string   `json:"generator,omitempty"`
     SelfID            int      `json:"selfId,omitempty"`
     Players           []string `json:"players,omitempty"`
+
+    // ID uniquely identifies the recording. It is not part of ReplayMod's schema
+    // (ReplayMod ignores it) and is generated by NewWriter when empty.
+    ID string `json:"id,omitempty"`
+
+    // ModLoader names the mod loader handshake seen on a modded connection
+    // (e.g. "FML2" for Forge). Not part of ReplayMod's schema; empty for vanilla.
+    ModLoader string `json:"modLoader,omitempty"`
+}
+
+
+// MetaPatch holds metadata only known when a recording ends, applied by
+// Writer.CloseWithMeta just before metaData.json is written. Nil fields are
+// left unchanged.
+type MetaPatch struct {
+    ServerName       *string
+    CustomServerName *string
+    MCVersion        *string
+    Protocol         *int
+    Date             *int64
+    SelfID           *int
+    ModLoader        *string
+    Players          []string // when non-nil, replaces the player list
+
+    // Tags are added to the recording's tags (see Writer.AddTags). They are
+    // not part of Meta, so Apply ignores them.
+    Tags []string
+}
+
+// Apply sets the patched fields of m.
+func (p MetaPatch) Apply(m *Meta) {
+    if p.ServerName != nil {
+        m.ServerName = *p.ServerName
+    }
+    if p.CustomServerName != nil {
+        m.CustomServerName = *p.CustomServerName
+    }
+    if p.MCVersion != nil {
+        m.MCVersion = *p.MCVersion
+    }
+    if p.Protocol != nil {
+        m.Protocol = *p.Protocol
+    }
+    if p.Date != nil {
+        m.Date = *p.Date
+    }
+    if p.SelfID != nil {
+        m.SelfID = *p.SelfID
+    }
+    if p.ModLoader != nil {
+        m.ModLoader = *p.ModLoader
+    }
+    if p.Players != nil {
+        m.Players = appendUnique([]string{}, p.Players...)
+    }
 }
 
+// MergeMeta combines the metadata of recordings played back to back, as
+// when concatenating replays, or normalizes a single one:
+//   - Players is the union of all player lists, without duplicates, in order
+//     of first appearance.
+//   - Date is the earliest non-zero date.
+//   - Duration is the sum of the durations; writers recompute it from the
+//     packets anyway.
+//   - Generator lists each distinct generator once, separated by " + ".
+//   - Singleplayer is set only if every recording was singleplayer.
+//   - ID is cleared, so writers assign the result a new one.
+//
+// The remaining fields are taken from the first recording that has them.
+// MergeMeta does not check that the protocols match.
+func MergeMeta(ms ...Meta) Meta {
+    if len(ms) == 0 {
+        return Meta{}
+    }
+    out := ms[0]
+    out.ID = ""
+    out.Duration = 0
+    out.Date = 0
+    out.Players = nil
+    var generators []string
+    for i, m := range ms {
+        out.Duration += m.Duration
+        if m.Date != 0 && (out.Date == 0 || m.Date < out.Date) {
+            out.Date = m.Date
+        }
+        out.Players = appendUnique(out.Players, m.Players...)
+        if m.Generator != "" {
+            generators = appendUnique(generators, m.Generator)
+        }
+        out.Singleplayer = out.Singleplayer && m.Singleplayer
+        if i == 0 {
+            continue
+        }
+        fill(&out.ServerName, m.ServerName)
+        fill(&out.CustomServerName, m.CustomServerName)
+        fill(&out.MCVersion, m.MCVersion)
+        fill(&out.FileFormat, m.FileFormat)
+        fill(&out.ModLoader, m.ModLoader)
+        fill(&out.FileFormatVersion, m.FileFormatVersion)
+        fill(&out.Protocol, m.Protocol)
+        fill(&out.SelfID, m.SelfID)
+    }
+    out.Generator = strings.Join(generators, " + ")
+    return out
+}
+
+// appendUnique appends the values of add not already in list or added before.
+func appendUnique(list []string, add ...string) []string {
+    seen := make(map[string]bool, len(list)+len(add))
+    for _, v := range list {
+        seen[v] = true
+    }
+    for _, v := range add {
+        if !seen[v] {
+            seen[v] = true
+            list = append(list, v)
+        }
+    }
+    return list
+}
+
+// fill sets *dst to v if *dst is the zero value.
+func fill[T comparable](dst *T, v T) {
+    var zero T
+    if *dst == zero {
+        *dst = v
+    }
+}
+
+// ReadMeta returns the metadata of the replay at path. It reads only the ZIP
+// central directory and metaData.json, not the recording, so it is fast
+// enough to index large replay libraries.
+func ReadMeta(path string) (Meta, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return Meta{}, fmt.Errorf("open %s: %w", path, err)
+    }
+    defer zr.Close()
+    for _, f := range zr.File {
+        if f.Name == "metaData.json" {
+            return decodeMeta(f)
+        }
+    }
+    return Meta{}, fmt.Errorf("open %s: missing metaData.json", path)
+}
+
+// decodeMeta parses a metaData.json entry.
+func decodeMeta(f *zip.File) (Meta, error) {
+    var m Meta
+    rc, err := f.Open()
+    if err != nil {
+        return m, fmt.Errorf("open metaData.json: %w", err)
+    }
+    defer rc.Close()
+    if err := json.NewDecoder(rc).Decode(&m); err != nil {
+        return m, fmt.Errorf("parse metaData.json: %w", err)
+    }
+    return m, nil
+}
@@ -0,0 +1,95 @@
+package mcpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []Meta
+		want Meta
+	}{
+		{
+			name: "none",
+			want: Meta{},
+		},
+		{
+			name: "single normalized",
+			in:   []Meta{{ID: "a", Duration: 500, Date: 7, Generator: "g", Players: []string{"p1", "p2", "p1"}}},
+			want: Meta{Duration: 500, Date: 7, Generator: "g", Players: []string{"p1", "p2"}},
+		},
+		{
+			name: "players union in order of first appearance",
+			in: []Meta{
+				{Players: []string{"p1", "p2"}},
+				{Players: []string{"p3", "p1"}},
+				{Players: []string{"p2", "p4", "p4"}},
+			},
+			want: Meta{Players: []string{"p1", "p2", "p3", "p4"}},
+		},
+		{
+			name: "no players",
+			in:   []Meta{{}, {Players: []string{}}},
+			want: Meta{},
+		},
+		{
+			name: "earliest non-zero date",
+			in:   []Meta{{Date: 0}, {Date: 300}, {Date: 200}, {Date: 0}},
+			want: Meta{Date: 200},
+		},
+		{
+			name: "durations summed",
+			in:   []Meta{{Duration: 1000}, {Duration: 0}, {Duration: 2500}},
+			want: Meta{Duration: 3500},
+		},
+		{
+			name: "generators combined once, empty skipped",
+			in:   []Meta{{Generator: "a"}, {}, {Generator: "b"}, {Generator: "a"}},
+			want: Meta{Generator: "a + b"},
+		},
+		{
+			name: "singleplayer only if all are",
+			in:   []Meta{{Singleplayer: true}, {Singleplayer: false}},
+			want: Meta{},
+		},
+		{
+			name: "singleplayer kept",
+			in:   []Meta{{Singleplayer: true}, {Singleplayer: true}},
+			want: Meta{Singleplayer: true},
+		},
+		{
+			name: "missing fields filled from later recordings",
+			in: []Meta{
+				{ServerName: "", Protocol: 0, MCVersion: "1.20.4"},
+				{ServerName: "s1", Protocol: 765, MCVersion: "1.20.2", ModLoader: "FML3"},
+				{ServerName: "s2", SelfID: 42},
+			},
+			want: Meta{ServerName: "s1", Protocol: 765, MCVersion: "1.20.4", ModLoader: "FML3", SelfID: 42},
+		},
+		{
+			name: "ids cleared",
+			in:   []Meta{{ID: "a"}, {ID: "b"}},
+			want: Meta{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeMeta(tt.in...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeMeta() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeMetaDoesNotAlias(t *testing.T) {
+	players := []string{"p1", "p2"}
+	in := Meta{Players: players}
+	out := MergeMeta(in)
+	out.Players[0] = "changed"
+	if players[0] != "p1" {
+		t.Errorf("MergeMeta shares the input's player list")
+	}
+}
@@ -0,0 +1,61 @@
+package mcpr
+
+import (
+    "fmt"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// packetNamer names the packets of a recording, following its connection
+// state.
+type packetNamer struct {
+    table *protocol.Table
+    state *protocol.Tracker // nil until the first packet after a rewind
+}
+
+// name feeds the packet id read next and returns its name, or "" if the
+// table does not know it. The first packet of a recording decides where it
+// starts: recordings of a full login begin with GameProfile, the others are
+// taken to start in play.
+func (n *packetNamer) name(id int32) string {
+    if n.state == nil {
+        s := protocol.Play
+        if n.table.Name(protocol.Clientbound, protocol.Login, id) == "GameProfile" {
+            s = protocol.Login
+        }
+        n.state = protocol.NewTracker(n.table, s)
+    }
+    return n.table.Name(protocol.Clientbound, n.state.Observe(id), id)
+}
+
+// reset follows a reopen at stream offset off. Index entries past the start
+// are assumed to lie in play, where recordings spend nearly all their time.
+func (n *packetNamer) reset(off int64) {
+    if off == 0 {
+        n.state = nil
+    } else {
+        n.state = protocol.NewTracker(n.table, protocol.Play)
+    }
+}
+
+// SetPacketNames makes Next fill in Packet.Name from the built-in packet
+// table of the replay's protocol (Meta.Protocol), e.g. "LevelChunkWithLight" or
+// "PlayerInfoUpdate", for debugging and inspection tools. The Reader follows
+// the connection state through login and configuration, so that ids are
+// named in the right state. Names are looked up for every frame, which costs
+// a little time per packet; false turns them off again.
+//
+// Call it before reading packets. It fails if there is no table for the
+// protocol.
+func (r *Reader) SetPacketNames(on bool) error {
+    if !on {
+        r.names = nil
+        return nil
+    }
+    t, ok := protocol.Lookup(r.Meta.Protocol)
+    if !ok {
+        return fmt.Errorf("mcpr: no packet table for protocol %d", r.Meta.Protocol)
+    }
+    r.names = &packetNamer{table: t}
+    return nil
+}
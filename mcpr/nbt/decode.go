@@ -0,0 +1,577 @@
+package nbt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Token is one tag returned by Decoder.Next.
+type Token struct {
+	Tag   Tag    // TagEnd closes the innermost compound or list
+	Name  string // name within the enclosing compound; "" for list elements and the network root
+	Depth int    // nesting depth; the root is 0
+
+	Int    int64   // Byte, Short, Int and Long values
+	Float  float64 // Float and Double values
+	String string  // String values
+
+	Len  int // element count of lists and arrays
+	Elem Tag // element type of lists
+}
+
+// Decoder reads NBT tag by tag.
+type Decoder struct {
+	// Network selects the nameless root of protocol 764+ payloads.
+	Network bool
+
+	r     io.Reader
+	br    io.ByteReader
+	off   int64
+	buf   [8]byte
+	stack []frame
+
+	started bool
+	done    bool
+	pending Token // array whose elements have not been read yet
+	open    bool  // last token opened a compound or list
+}
+
+type frame struct {
+	tag       Tag // TagCompound or TagList
+	elem      Tag
+	remaining int
+}
+
+// NewDecoder returns a decoder reading from r. Readers that are not
+// io.ByteReaders are buffered and may be read past the end of the NBT; use a
+// *bytes.Reader (or Len) to continue parsing a payload after it.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		r, br = b, b
+	}
+	return &Decoder{r: r, br: br}
+}
+
+// Offset returns the number of bytes consumed so far.
+func (d *Decoder) Offset() int64 {
+	return d.off
+}
+
+// Next returns the next tag. Compounds and lists are followed by their
+// elements and a closing TagEnd token; array elements are skipped unless
+// read with Bytes, Ints or Longs. It returns io.EOF after the root closes.
+func (d *Decoder) Next() (Token, error) {
+	if err := d.skipPending(); err != nil {
+		return Token{}, err
+	}
+	d.open = false
+	if d.done {
+		return Token{}, io.EOF
+	}
+	if !d.started {
+		d.started = true
+		tag, err := d.readTag()
+		if err != nil {
+			return Token{}, err
+		}
+		if tag == TagEnd {
+			// Empty payload, e.g. an item without tag data
+			d.done = true
+			return Token{Tag: TagEnd}, nil
+		}
+		var name string
+		if !d.Network {
+			if name, err = d.readString(); err != nil {
+				return Token{}, err
+			}
+		}
+		return d.readValue(tag, name)
+	}
+
+	top := &d.stack[len(d.stack)-1]
+	if top.tag == TagList {
+		if top.remaining == 0 {
+			return d.close(), nil
+		}
+		top.remaining--
+		return d.readValue(top.elem, "")
+	}
+	tag, err := d.readTag()
+	if err != nil {
+		return Token{}, err
+	}
+	if tag == TagEnd {
+		return d.close(), nil
+	}
+	name, err := d.readString()
+	if err != nil {
+		return Token{}, err
+	}
+	return d.readValue(tag, name)
+}
+
+// close pops the innermost compound or list.
+func (d *Decoder) close() Token {
+	d.stack = d.stack[:len(d.stack)-1]
+	if len(d.stack) == 0 {
+		d.done = true
+	}
+	return Token{Tag: TagEnd, Depth: len(d.stack)}
+}
+
+func (d *Decoder) readValue(tag Tag, name string) (Token, error) {
+	t := Token{Tag: tag, Name: name, Depth: len(d.stack)}
+	var err error
+	switch tag {
+	case TagByte:
+		var b byte
+		b, err = d.readByte()
+		t.Int = int64(int8(b))
+	case TagShort:
+		var v uint64
+		v, err = d.readN(2)
+		t.Int = int64(int16(v))
+	case TagInt:
+		var v uint64
+		v, err = d.readN(4)
+		t.Int = int64(int32(v))
+	case TagLong:
+		var v uint64
+		v, err = d.readN(8)
+		t.Int = int64(v)
+	case TagFloat:
+		var v uint64
+		v, err = d.readN(4)
+		t.Float = float64(math.Float32frombits(uint32(v)))
+	case TagDouble:
+		var v uint64
+		v, err = d.readN(8)
+		t.Float = math.Float64frombits(v)
+	case TagString:
+		t.String, err = d.readString()
+	case TagByteArray, TagIntArray, TagLongArray:
+		if t.Len, err = d.readLen(); err == nil {
+			d.pending = t
+		}
+	case TagList:
+		var elem Tag
+		if elem, err = d.readTag(); err != nil {
+			break
+		}
+		if t.Len, err = d.readLen(); err != nil {
+			break
+		}
+		t.Elem = elem
+		err = d.push(frame{tag: TagList, elem: elem, remaining: t.Len})
+	case TagCompound:
+		err = d.push(frame{tag: TagCompound})
+	default:
+		err = fmt.Errorf("nbt: invalid tag type %d at offset %d", byte(tag), d.off)
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	return t, nil
+}
+
+func (d *Decoder) push(f frame) error {
+	if len(d.stack) >= maxDepth {
+		return fmt.Errorf("nbt: nesting deeper than %d", maxDepth)
+	}
+	d.stack = append(d.stack, f)
+	d.open = true
+	return nil
+}
+
+// Skip skips the rest of the compound or list opened by the last token,
+// including its closing TagEnd. It does nothing after other tokens.
+func (d *Decoder) Skip() error {
+	if !d.open {
+		return d.skipPending()
+	}
+	d.open = false
+	top := d.stack[len(d.stack)-1]
+	if top.tag == TagList {
+		for i := 0; i < top.remaining; i++ {
+			if err := d.skipPayload(top.elem, len(d.stack)); err != nil {
+				return err
+			}
+		}
+	} else if err := d.skipCompound(len(d.stack)); err != nil {
+		return err
+	}
+	d.close()
+	return nil
+}
+
+// Bytes returns the elements of the ByteArray returned by the last token.
+func (d *Decoder) Bytes() ([]byte, error) {
+	if d.pending.Tag != TagByteArray {
+		return nil, fmt.Errorf("nbt: last token is not a ByteArray")
+	}
+	n := d.pending.Len
+	d.pending = Token{}
+	b := make([]byte, n)
+	if err := d.readFull(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Ints returns the elements of the IntArray returned by the last token.
+func (d *Decoder) Ints() ([]int32, error) {
+	if d.pending.Tag != TagIntArray {
+		return nil, fmt.Errorf("nbt: last token is not an IntArray")
+	}
+	n := d.pending.Len
+	d.pending = Token{}
+	out := make([]int32, n)
+	for i := range out {
+		v, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = int32(v)
+	}
+	return out, nil
+}
+
+// Longs returns the elements of the LongArray returned by the last token.
+func (d *Decoder) Longs() ([]int64, error) {
+	if d.pending.Tag != TagLongArray {
+		return nil, fmt.Errorf("nbt: last token is not a LongArray")
+	}
+	n := d.pending.Len
+	d.pending = Token{}
+	out := make([]int64, n)
+	for i := range out {
+		v, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = int64(v)
+	}
+	return out, nil
+}
+
+// Value materializes the tag returned by the last token t: int8, int16,
+// int32, int64, float32, float64, string, []byte, []int32, []int64, []any
+// for lists and map[string]any for compounds.
+func (d *Decoder) Value(t Token) (any, error) {
+	switch t.Tag {
+	case TagByte:
+		return int8(t.Int), nil
+	case TagShort:
+		return int16(t.Int), nil
+	case TagInt:
+		return int32(t.Int), nil
+	case TagLong:
+		return t.Int, nil
+	case TagFloat:
+		return float32(t.Float), nil
+	case TagDouble:
+		return t.Float, nil
+	case TagString:
+		return t.String, nil
+	case TagByteArray:
+		return d.Bytes()
+	case TagIntArray:
+		return d.Ints()
+	case TagLongArray:
+		return d.Longs()
+	case TagList:
+		list := make([]any, 0, t.Len)
+		for {
+			c, err := d.Next()
+			if err != nil {
+				return nil, err
+			}
+			if c.Tag == TagEnd {
+				return list, nil
+			}
+			v, err := d.Value(c)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case TagCompound:
+		m := map[string]any{}
+		for {
+			c, err := d.Next()
+			if err != nil {
+				return nil, err
+			}
+			if c.Tag == TagEnd {
+				return m, nil
+			}
+			v, err := d.Value(c)
+			if err != nil {
+				return nil, err
+			}
+			m[c.Name] = v
+		}
+	}
+	return nil, nil
+}
+
+// Find descends through the named compounds of path, starting inside the
+// compound opened by the last token (or at the root), and returns the token
+// of the last element. Tags on the way are skipped without being decoded.
+// It returns ErrNotFound if a name is missing; the decoder is then positioned
+// after the compound in which the lookup failed.
+func (d *Decoder) Find(path ...string) (Token, error) {
+	if !d.started {
+		t, err := d.Next()
+		if err != nil {
+			return Token{}, err
+		}
+		if t.Tag != TagCompound {
+			return Token{}, ErrNotFound
+		}
+	}
+	for i, name := range path {
+		if len(d.stack) == 0 || d.stack[len(d.stack)-1].tag != TagCompound {
+			return Token{}, ErrNotFound
+		}
+		for {
+			t, err := d.Next()
+			if err != nil {
+				return Token{}, err
+			}
+			if t.Tag == TagEnd {
+				return Token{}, ErrNotFound
+			}
+			if t.Name != name {
+				if err := d.Skip(); err != nil {
+					return Token{}, err
+				}
+				continue
+			}
+			if i == len(path)-1 {
+				return t, nil
+			}
+			if t.Tag != TagCompound {
+				return Token{}, ErrNotFound
+			}
+			break
+		}
+	}
+	return Token{}, ErrNotFound
+}
+
+// Len returns the size in bytes of the NBT value at the start of data, e.g.
+// to continue parsing a packet payload after an embedded tag.
+func Len(data []byte, network bool) (int, error) {
+	d := NewDecoder(bytes.NewReader(data))
+	d.Network = network
+	t, err := d.Next()
+	if err != nil {
+		return 0, err
+	}
+	if t.Tag != TagEnd {
+		if err := d.Skip(); err != nil {
+			return 0, err
+		}
+	}
+	return int(d.off), nil
+}
+
+// Decode materializes a whole NBT value from r (see Decoder.Value) and
+// returns it with the root's name.
+func Decode(r io.Reader, network bool) (string, any, error) {
+	d := NewDecoder(r)
+	d.Network = network
+	t, err := d.Next()
+	if err != nil {
+		return "", nil, err
+	}
+	if t.Tag == TagEnd {
+		return "", nil, nil
+	}
+	v, err := d.Value(t)
+	return t.Name, v, err
+}
+
+func (d *Decoder) skipPending() error {
+	if d.pending.Tag == TagEnd {
+		return nil
+	}
+	n := int64(d.pending.Len) * elemSize(d.pending.Tag)
+	d.pending = Token{}
+	return d.discard(n)
+}
+
+func (d *Decoder) skipCompound(depth int) error {
+	for {
+		tag, err := d.readTag()
+		if err != nil {
+			return err
+		}
+		if tag == TagEnd {
+			return nil
+		}
+		n, err := d.readN(2)
+		if err != nil {
+			return err
+		}
+		if err := d.discard(int64(n)); err != nil {
+			return err
+		}
+		if err := d.skipPayload(tag, depth); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Decoder) skipPayload(tag Tag, depth int) error {
+	if depth >= maxDepth {
+		return fmt.Errorf("nbt: nesting deeper than %d", maxDepth)
+	}
+	switch tag {
+	case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble:
+		return d.discard(elemSize(tag))
+	case TagString:
+		n, err := d.readN(2)
+		if err != nil {
+			return err
+		}
+		return d.discard(int64(n))
+	case TagByteArray, TagIntArray, TagLongArray:
+		n, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		return d.discard(int64(n) * elemSize(tag))
+	case TagList:
+		elem, err := d.readTag()
+		if err != nil {
+			return err
+		}
+		n, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		if size := elemSize(elem); size > 0 {
+			return d.discard(int64(n) * size)
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skipPayload(elem, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case TagCompound:
+		return d.skipCompound(depth + 1)
+	}
+	return fmt.Errorf("nbt: invalid tag type %d at offset %d", byte(tag), d.off)
+}
+
+// elemSize returns the fixed size of a scalar or array element, or 0.
+func elemSize(tag Tag) int64 {
+	switch tag {
+	case TagByte, TagByteArray:
+		return 1
+	case TagShort:
+		return 2
+	case TagInt, TagFloat, TagIntArray:
+		return 4
+	case TagLong, TagDouble, TagLongArray:
+		return 8
+	}
+	return 0
+}
+
+func (d *Decoder) readTag() (Tag, error) {
+	b, err := d.readByte()
+	return Tag(b), err
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	b, err := d.br.ReadByte()
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	d.off++
+	return b, nil
+}
+
+// readN reads an n-byte big-endian unsigned integer.
+func (d *Decoder) readN(n int) (uint64, error) {
+	if err := d.readFull(d.buf[:n]); err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range d.buf[:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func (d *Decoder) readLen() (int, error) {
+	v, err := d.readN(4)
+	if err != nil {
+		return 0, err
+	}
+	n := int32(v)
+	if n < 0 || n > maxLen {
+		return 0, fmt.Errorf("nbt: invalid length %d at offset %d", n, d.off-4)
+	}
+	return int(n), nil
+}
+
+func (d *Decoder) readString() (string, error) {
+	n, err := d.readN(2)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if err := d.readFull(b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *Decoder) readFull(b []byte) error {
+	n, err := io.ReadFull(d.r, b)
+	d.off += int64(n)
+	return unexpected(err)
+}
+
+func (d *Decoder) discard(n int64) error {
+	if s, ok := d.r.(io.Seeker); ok {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if cur+n > end {
+			d.off += end - cur
+			return io.ErrUnexpectedEOF
+		}
+		if _, err := s.Seek(cur+n, io.SeekStart); err != nil {
+			return err
+		}
+		d.off += n
+		return nil
+	}
+	m, err := io.CopyN(io.Discard, d.r, n)
+	d.off += m
+	return unexpected(err)
+}
+
+// unexpected turns a clean EOF inside a tag into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
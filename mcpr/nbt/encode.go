@@ -0,0 +1,343 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Encoder writes NBT incrementally. The first call writes the root tag and
+// must be BeginCompound (or BeginList); names are ignored inside lists.
+// Errors are sticky: after the first one, calls do nothing and Err reports it.
+//
+//	e := nbt.NewEncoder(w)
+//	e.BeginCompound("")
+//	e.String("id", "minecraft:diamond_sword")
+//	e.Byte("Count", 1)
+//	e.EndCompound()
+//	err := e.Err()
+type Encoder struct {
+	// Network writes the nameless root of protocol 764+ payloads.
+	Network bool
+
+	w     io.Writer
+	err   error
+	buf   [8]byte
+	stack []frame
+	root  bool // root tag written
+}
+
+// NewEncoder returns an encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Err returns the first error encountered, or an error if compounds or lists
+// are still open. Call it once the root has been closed.
+func (e *Encoder) Err() error {
+	if e.err == nil && e.root && len(e.stack) > 0 {
+		return fmt.Errorf("nbt: %d unclosed compounds or lists", len(e.stack))
+	}
+	return e.err
+}
+
+// Empty writes the single TagEnd used for absent tag data, e.g. items
+// without NBT.
+func (e *Encoder) Empty() {
+	if e.err == nil && e.root {
+		e.err = fmt.Errorf("nbt: Empty after root tag")
+		return
+	}
+	e.root = true
+	e.writeByte(byte(TagEnd))
+}
+
+// BeginCompound opens a compound; close it with EndCompound.
+func (e *Encoder) BeginCompound(name string) {
+	e.header(TagCompound, name)
+	e.open(frame{tag: TagCompound})
+}
+
+// EndCompound closes the innermost compound.
+func (e *Encoder) EndCompound() {
+	if e.err != nil {
+		return
+	}
+	if len(e.stack) == 0 || e.stack[len(e.stack)-1].tag != TagCompound {
+		e.err = fmt.Errorf("nbt: EndCompound without open compound")
+		return
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	e.writeByte(byte(TagEnd))
+}
+
+// BeginList opens a list of n elements of type elem; write exactly n
+// elements, then call EndList.
+func (e *Encoder) BeginList(name string, elem Tag, n int) {
+	e.header(TagList, name)
+	e.writeByte(byte(elem))
+	e.writeInt(4, uint64(n))
+	e.open(frame{tag: TagList, elem: elem, remaining: n})
+}
+
+// EndList closes the innermost list.
+func (e *Encoder) EndList() {
+	if e.err != nil {
+		return
+	}
+	if len(e.stack) == 0 || e.stack[len(e.stack)-1].tag != TagList {
+		e.err = fmt.Errorf("nbt: EndList without open list")
+		return
+	}
+	if r := e.stack[len(e.stack)-1].remaining; r != 0 {
+		e.err = fmt.Errorf("nbt: list closed with %d elements missing", r)
+		return
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// Byte writes a Byte tag.
+func (e *Encoder) Byte(name string, v int8) {
+	e.header(TagByte, name)
+	e.writeByte(byte(v))
+}
+
+// Short writes a Short tag.
+func (e *Encoder) Short(name string, v int16) {
+	e.header(TagShort, name)
+	e.writeInt(2, uint64(v))
+}
+
+// Int writes an Int tag.
+func (e *Encoder) Int(name string, v int32) {
+	e.header(TagInt, name)
+	e.writeInt(4, uint64(v))
+}
+
+// Long writes a Long tag.
+func (e *Encoder) Long(name string, v int64) {
+	e.header(TagLong, name)
+	e.writeInt(8, uint64(v))
+}
+
+// Float writes a Float tag.
+func (e *Encoder) Float(name string, v float32) {
+	e.header(TagFloat, name)
+	e.writeInt(4, uint64(math.Float32bits(v)))
+}
+
+// Double writes a Double tag.
+func (e *Encoder) Double(name string, v float64) {
+	e.header(TagDouble, name)
+	e.writeInt(8, math.Float64bits(v))
+}
+
+// String writes a String tag.
+func (e *Encoder) String(name, v string) {
+	e.header(TagString, name)
+	e.writeString(v)
+}
+
+// ByteArray writes a ByteArray tag.
+func (e *Encoder) ByteArray(name string, v []byte) {
+	e.header(TagByteArray, name)
+	e.writeInt(4, uint64(len(v)))
+	e.write(v)
+}
+
+// IntArray writes an IntArray tag.
+func (e *Encoder) IntArray(name string, v []int32) {
+	e.header(TagIntArray, name)
+	e.writeInt(4, uint64(len(v)))
+	for _, x := range v {
+		e.writeInt(4, uint64(x))
+	}
+}
+
+// LongArray writes a LongArray tag.
+func (e *Encoder) LongArray(name string, v []int64) {
+	e.header(TagLongArray, name)
+	e.writeInt(4, uint64(len(v)))
+	for _, x := range v {
+		e.writeInt(8, uint64(x))
+	}
+}
+
+// Value writes a materialized value of the types Decoder.Value returns.
+// Compound keys are written in sorted order; an empty list has element type
+// TagEnd.
+func (e *Encoder) Value(name string, v any) {
+	if e.err != nil {
+		return
+	}
+	switch v := v.(type) {
+	case int8:
+		e.Byte(name, v)
+	case int16:
+		e.Short(name, v)
+	case int32:
+		e.Int(name, v)
+	case int64:
+		e.Long(name, v)
+	case float32:
+		e.Float(name, v)
+	case float64:
+		e.Double(name, v)
+	case string:
+		e.String(name, v)
+	case []byte:
+		e.ByteArray(name, v)
+	case []int32:
+		e.IntArray(name, v)
+	case []int64:
+		e.LongArray(name, v)
+	case []any:
+		elem := TagEnd
+		if len(v) > 0 {
+			if elem = tagOf(v[0]); elem == TagEnd {
+				e.err = fmt.Errorf("nbt: unsupported list element %T", v[0])
+				return
+			}
+		}
+		e.BeginList(name, elem, len(v))
+		for _, x := range v {
+			if tagOf(x) != elem {
+				e.err = fmt.Errorf("nbt: list %q mixes %s and %T", name, elem, x)
+				return
+			}
+			e.Value("", x)
+		}
+		e.EndList()
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.BeginCompound(name)
+		for _, k := range keys {
+			e.Value(k, v[k])
+		}
+		e.EndCompound()
+	default:
+		e.err = fmt.Errorf("nbt: unsupported value %T", v)
+	}
+}
+
+// Encode writes v (see Encoder.Value) as a complete NBT value.
+func Encode(w io.Writer, name string, v any, network bool) error {
+	e := NewEncoder(w)
+	e.Network = network
+	e.Value(name, v)
+	return e.Err()
+}
+
+func tagOf(v any) Tag {
+	switch v.(type) {
+	case int8:
+		return TagByte
+	case int16:
+		return TagShort
+	case int32:
+		return TagInt
+	case int64:
+		return TagLong
+	case float32:
+		return TagFloat
+	case float64:
+		return TagDouble
+	case string:
+		return TagString
+	case []byte:
+		return TagByteArray
+	case []int32:
+		return TagIntArray
+	case []int64:
+		return TagLongArray
+	case []any:
+		return TagList
+	case map[string]any:
+		return TagCompound
+	}
+	return TagEnd
+}
+
+// header writes the type and name of a tag in the current context.
+func (e *Encoder) header(tag Tag, name string) {
+	if e.err != nil {
+		return
+	}
+	if !e.root {
+		if tag != TagCompound && tag != TagList {
+			e.err = fmt.Errorf("nbt: root must be a compound or list, not %s", tag)
+			return
+		}
+		e.root = true
+		e.writeByte(byte(tag))
+		if !e.Network {
+			e.writeString(name)
+		}
+		return
+	}
+	if len(e.stack) == 0 {
+		e.err = fmt.Errorf("nbt: %s after root tag closed", tag)
+		return
+	}
+	top := &e.stack[len(e.stack)-1]
+	if top.tag == TagList {
+		if tag != top.elem {
+			e.err = fmt.Errorf("nbt: %s in list of %s", tag, top.elem)
+			return
+		}
+		if top.remaining == 0 {
+			e.err = fmt.Errorf("nbt: too many list elements")
+			return
+		}
+		top.remaining--
+		return
+	}
+	e.writeByte(byte(tag))
+	e.writeString(name)
+}
+
+func (e *Encoder) open(f frame) {
+	if e.err != nil {
+		return
+	}
+	if len(e.stack) >= maxDepth {
+		e.err = fmt.Errorf("nbt: nesting deeper than %d", maxDepth)
+		return
+	}
+	e.stack = append(e.stack, f)
+}
+
+func (e *Encoder) writeString(s string) {
+	if len(s) > math.MaxUint16 {
+		if e.err == nil {
+			e.err = fmt.Errorf("nbt: string of %d bytes too long", len(s))
+		}
+		return
+	}
+	e.writeInt(2, uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *Encoder) writeByte(b byte) {
+	e.buf[0] = b
+	e.write(e.buf[:1])
+}
+
+// writeInt writes the low n bytes of v big-endian.
+func (e *Encoder) writeInt(n int, v uint64) {
+	binary.BigEndian.PutUint64(e.buf[:], v)
+	e.write(e.buf[8-n:])
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(b)
+}
@@ -0,0 +1,56 @@
+// Package nbt reads and writes Minecraft's Named Binary Tag format as found in
+// recorded packet payloads (item slots, block entities, registry data).
+//
+// Decoder is a pull parser: it returns one Token per tag and only reads
+// arrays and subtrees the caller asks for, so a payload can be scanned for a
+// few fields without materializing it. Encoder writes NBT incrementally.
+//
+// Since protocol 764 (1.20.2) the network form omits the root tag's name; set
+// Network on the Decoder or Encoder for it. Strings are treated as UTF-8;
+// Java's modified UTF-8 only differs for NUL and characters outside the BMP.
+package nbt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tag is an NBT tag type.
+type Tag byte
+
+const (
+	TagEnd Tag = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+var tagNames = [...]string{
+	"End", "Byte", "Short", "Int", "Long", "Float", "Double",
+	"ByteArray", "String", "List", "Compound", "IntArray", "LongArray",
+}
+
+func (t Tag) String() string {
+	if int(t) < len(tagNames) {
+		return tagNames[t]
+	}
+	return fmt.Sprintf("Tag(%d)", byte(t))
+}
+
+// ErrNotFound is returned by Decoder.Find when the path does not exist.
+var ErrNotFound = errors.New("nbt: tag not found")
+
+// maxLen bounds array, list and string lengths read from untrusted payloads.
+const maxLen = 1 << 24
+
+// maxDepth bounds nesting, as Minecraft does.
+const maxDepth = 512
@@ -0,0 +1,132 @@
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// item is an item stack with every tag type.
+var item = map[string]any{
+	"id":    "minecraft:written_book",
+	"Count": int8(1),
+	"tag": map[string]any{
+		"generation": int16(2),
+		"pages":      []any{`"one"`, `"two"`},
+		"Damage":     int32(-7),
+		"seed":       int64(-1 << 40),
+		"yaw":        float32(1.5),
+		"x":          float64(-1234.25),
+		"raw":        []byte{0, 1, 0xff},
+		"UUID":       []int32{1, -2, 3, -4},
+		"states":     []int64{1 << 62, -1},
+		"empty":      []any{},
+		"Enchantments": []any{
+			map[string]any{"id": "minecraft:unbreaking", "lvl": int16(3)},
+			map[string]any{"id": "minecraft:mending", "lvl": int16(1)},
+		},
+	},
+}
+
+func encode(t *testing.T, name string, v any, network bool) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := Encode(&b, name, v, network); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		root     string
+		network  bool
+		wantName string
+	}{
+		{"file", "Item", false, "Item"},
+		{"network", "Item", true, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			data := encode(t, c.root, item, c.network)
+			name, v, err := Decode(bytes.NewReader(data), c.network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != c.wantName {
+				t.Errorf("name = %q, want %q", name, c.wantName)
+			}
+			if !reflect.DeepEqual(v, item) {
+				t.Errorf("decoded %#v, want %#v", v, item)
+			}
+			if again := encode(t, name, v, c.network); c.network && !bytes.Equal(again, data) {
+				t.Errorf("re-encoded %x, want %x", again, data)
+			}
+
+			// Len finds the end of the tag within a payload
+			n, err := Len(append(data, 0xde, 0xad), c.network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(data) {
+				t.Errorf("Len = %d, want %d", n, len(data))
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	d := NewDecoder(bytes.NewReader(encode(t, "", item, true)))
+	d.Network = true
+	tok, err := d.Find("tag", "Damage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Tag != TagInt || tok.Int != -7 {
+		t.Errorf("Find = %+v, want Int -7", tok)
+	}
+	d = NewDecoder(bytes.NewReader(encode(t, "", item, true)))
+	d.Network = true
+	if _, err := d.Find("tag", "display", "Name"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find of a missing tag = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	data := encode(t, "", item, true)
+	// Every truncation of a valid tag fails, rather than returning part of it
+	for i := 1; i < len(data); i++ {
+		if _, _, err := Decode(bytes.NewReader(data[:i]), true); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("Decode of %d of %d bytes = %v, want %v", i, len(data), err, io.ErrUnexpectedEOF)
+		}
+		if _, err := Len(data[:i], true); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("Len of %d of %d bytes = %v, want %v", i, len(data), err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	// A list of lists of lists ...
+	deep := append([]byte{byte(TagList)}, bytes.Repeat([]byte{byte(TagList), 0, 0, 0, 1}, maxDepth+1)...)
+	for _, c := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"tag type", []byte{byte(TagCompound), 13, 0, 1, 'a'}, "invalid tag type 13"},
+		{"root tag type", []byte{0x20}, "invalid tag type 32"},
+		{"negative length", []byte{byte(TagCompound), byte(TagIntArray), 0, 1, 'a', 0xff, 0xff, 0xff, 0xfe}, "invalid length -2"},
+		{"huge length", []byte{byte(TagList), byte(TagLong), 0x7f, 0xff, 0xff, 0xff}, "invalid length"},
+		{"nesting", deep, "nesting deeper than"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, err := Decode(bytes.NewReader(c.data), true); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("Decode = %v, want %q", err, c.want)
+			}
+			if _, err := Len(c.data, true); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("Len = %v, want %q", err, c.want)
+			}
+		})
+	}
+}
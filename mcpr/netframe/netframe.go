@@ -0,0 +1,133 @@
+// Package netframe decodes and encodes the frames of Minecraft connections:
+// a VarInt length followed by the packet, which, once the server enabled
+// compression, is preceded by its uncompressed length and zlib-compressed
+// if it reached the threshold. Proxies, importers and converters of raw
+// captures share it, so that the size checks guarding against malformed
+// and malicious frames are the same everywhere.
+//
+// The protocol compresses with zlib only; there is no other algorithm to
+// negotiate.
+package netframe
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// MaxDataLength is the largest uncompressed packet a compressed frame may
+// declare, as in the vanilla client (2^23 bytes).
+const MaxDataLength = 8 << 20
+
+var (
+	// ErrTooLarge is returned for frames declaring a packet larger than
+	// MaxDataLength.
+	ErrTooLarge = errors.New("netframe: packet too large")
+
+	// ErrThreshold is returned for packets compressed although smaller than
+	// the threshold, or sent uncompressed although reaching it, which the
+	// vanilla client rejects.
+	ErrThreshold = errors.New("netframe: packet size does not match the compression threshold")
+)
+
+// Decode returns the packet (VarInt id and payload) carried by body, a frame
+// without its length prefix. threshold is the connection's compression
+// threshold: negative while compression is off, when body is the packet
+// itself, and 0 if compression is on with an unknown threshold, which skips
+// the threshold checks.
+//
+// A compressed packet must inflate to exactly the length it declares, at
+// most MaxDataLength, so a small frame cannot expand into an arbitrary
+// amount of memory. Uncompressed packets are returned as a slice of body.
+func Decode(body []byte, threshold int) ([]byte, error) {
+	if threshold < 0 {
+		return body, nil
+	}
+	size, k, err := tmcpr.DecodeVarInt(body)
+	if err != nil {
+		return nil, fmt.Errorf("netframe: data length: %w", err)
+	}
+	data := body[k:]
+	switch {
+	case size == 0:
+		if threshold > 0 && len(data) >= threshold {
+			return nil, fmt.Errorf("%w: uncompressed packet of %d bytes, threshold %d", ErrThreshold, len(data), threshold)
+		}
+		return data, nil
+	case size < 0 || size > MaxDataLength:
+		return nil, fmt.Errorf("%w: declares %d bytes", ErrTooLarge, size)
+	case int(size) < threshold:
+		return nil, fmt.Errorf("%w: compressed packet of %d bytes, threshold %d", ErrThreshold, size, threshold)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("netframe: decompress: %w", err)
+	}
+	defer zr.Close()
+	out := make([]byte, size)
+	if _, err := io.ReadFull(zr, out); err != nil {
+		return nil, fmt.Errorf("netframe: decompress %d declared bytes: %w", size, err)
+	}
+	// The data must end where the length says; reading to the end also
+	// checks the zlib checksum
+	if n, err := zr.Read(make([]byte, 1)); n > 0 {
+		return nil, fmt.Errorf("netframe: packet inflates beyond the declared %d bytes", size)
+	} else if err != io.EOF {
+		return nil, fmt.Errorf("netframe: decompress: %w", err)
+	}
+	return out, nil
+}
+
+// Split splits a packet into its id and payload, a slice of packet.
+func Split(packet []byte) (id int32, payload []byte, err error) {
+	id, k, err := tmcpr.DecodeVarInt(packet)
+	if err != nil {
+		return 0, nil, fmt.Errorf("netframe: packet id: %w", err)
+	}
+	return id, packet[k:], nil
+}
+
+// DecodePacket is Decode followed by Split.
+func DecodePacket(body []byte, threshold int) (id int32, payload []byte, err error) {
+	packet, err := Decode(body, threshold)
+	if err != nil {
+		return 0, nil, err
+	}
+	return Split(packet)
+}
+
+// Encode returns the frame body for packet (VarInt id and payload), without
+// the length prefix, on a connection with compression threshold threshold:
+// negative for none, otherwise compressed if the packet reaches it.
+func Encode(packet []byte, threshold int) ([]byte, error) {
+	if threshold < 0 {
+		return packet, nil
+	}
+	if len(packet) < threshold || len(packet) == 0 {
+		// A data length of 0 marks an uncompressed packet, so an empty one
+		// cannot be sent compressed
+		return append([]byte{0}, packet...), nil
+	}
+	if len(packet) > MaxDataLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, len(packet))
+	}
+	var b bytes.Buffer
+	b.Write(tmcpr.AppendVarInt(nil, int32(len(packet))))
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(packet); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Append appends body to dst as a frame: its VarInt length, then body.
+func Append(dst, body []byte) []byte {
+	return append(tmcpr.AppendVarInt(dst, int32(len(body))), body...)
+}
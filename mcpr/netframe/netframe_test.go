@@ -0,0 +1,148 @@
+package netframe
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// compressed returns a compressed frame body declaring size bytes and
+// holding data.
+func compressed(t *testing.T, size int, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	b.Write(tmcpr.AppendVarInt(nil, int32(size)))
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// uncompressed returns an uncompressed frame body of a compressed connection.
+func uncompressed(data []byte) []byte {
+	return append([]byte{0}, data...)
+}
+
+func TestDecodeThreshold(t *testing.T) {
+	const threshold = 256
+	small := bytes.Repeat([]byte{1}, threshold-1)
+	exact := bytes.Repeat([]byte{2}, threshold)
+	tests := []struct {
+		name      string
+		body      []byte
+		threshold int
+		want      []byte
+		err       error
+	}{
+		{"compression off", exact, -1, exact, nil},
+		{"uncompressed below threshold", uncompressed(small), threshold, small, nil},
+		{"uncompressed at threshold", uncompressed(exact), threshold, nil, ErrThreshold},
+		{"compressed at threshold", compressed(t, threshold, exact), threshold, exact, nil},
+		{"compressed below threshold", compressed(t, threshold-1, small), threshold, nil, ErrThreshold},
+		{"unknown threshold, uncompressed", uncompressed(exact), 0, exact, nil},
+		{"unknown threshold, compressed", compressed(t, threshold-1, small), 0, small, nil},
+		{"empty uncompressed packet", uncompressed(nil), threshold, []byte{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.body, tt.threshold)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Decode() = %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestDecodeDeclaredSize(t *testing.T) {
+	data := bytes.Repeat([]byte("abc"), 200)
+	if _, err := Decode(compressed(t, len(data)+1, data), 0); err == nil {
+		t.Error("Decode of a packet shorter than declared succeeded")
+	}
+	if _, err := Decode(compressed(t, len(data)-1, data), 0); err == nil {
+		t.Error("Decode of a packet longer than declared succeeded")
+	}
+	if _, err := Decode(compressed(t, len(data), data), 0); err != nil {
+		t.Errorf("Decode of a packet of the declared size: %v", err)
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	body := compressed(t, MaxDataLength+1, []byte{0})
+	if _, err := Decode(body, 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode() error = %v, want ErrTooLarge", err)
+	}
+	if _, err := Decode(compressed(t, -1, []byte{0}), 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode() of a negative size: error = %v, want ErrTooLarge", err)
+	}
+	if _, err := Encode(make([]byte, MaxDataLength+1), 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Encode() error = %v, want ErrTooLarge", err)
+	}
+}
+
+// A small frame inflating to far more than it declares must fail without
+// inflating all of it.
+func TestDecodeBomb(t *testing.T) {
+	body := compressed(t, 1024, make([]byte, 64<<20))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := Decode(body, 0)
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("Decode of a zlib bomb succeeded")
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Decode of a bomb declaring 1 KiB allocated %d bytes", n)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 255, 256, 257, 4096} {
+		packet := bytes.Repeat([]byte{byte(n)}, n)
+		for _, threshold := range []int{-1, 0, 256} {
+			body, err := Encode(packet, threshold)
+			if err != nil {
+				t.Fatalf("Encode(%d bytes, %d): %v", n, threshold, err)
+			}
+			got, err := Decode(body, threshold)
+			if err != nil {
+				t.Fatalf("Decode(Encode(%d bytes, %d)): %v", n, threshold, err)
+			}
+			if !bytes.Equal(got, packet) {
+				t.Errorf("round trip of %d bytes at threshold %d changed the packet", n, threshold)
+			}
+		}
+	}
+}
+
+func TestDecodePacket(t *testing.T) {
+	packet := append(tmcpr.AppendVarInt(nil, 0x2A), "payload"...)
+	frame := Append(nil, uncompressed(packet))
+	n, k, err := tmcpr.DecodeVarInt(frame)
+	if err != nil || int(n) != len(frame)-k {
+		t.Fatalf("Append wrote length %d (%v), want %d", n, err, len(frame)-k)
+	}
+	id, payload, err := DecodePacket(frame[k:], 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0x2A || string(payload) != "payload" {
+		t.Errorf("DecodePacket() = %#x %q, want 0x2a \"payload\"", id, payload)
+	}
+}
@@ -0,0 +1,46 @@
+package mcpr
+
+import "io"
+
+// Timing holds a replay's times as recorded and as rebased by
+// Reader.NormalizeTimes.
+type Timing struct {
+    Offset      uint32 // recorded time of the first packet, subtracted from every packet
+    RawDuration uint32 // Meta.Duration as recorded
+    Duration    uint32 // RawDuration - Offset, the normalized Meta.Duration
+}
+
+// NormalizeTimes makes the Reader rebase packet times so the first packet is
+// at t=0, for replays from recorders that start their clock well before the
+// first packet. Packet.Time, Meta.Duration and SeekToTime then use normalized
+// times; Packet.RawTime keeps the recorded ones, and the returned Timing has
+// both durations. Packets with times before the first one, which some
+// recorders write, are put at 0.
+//
+// Call it before reading packets. Calling it again returns the same Timing.
+func (r *Reader) NormalizeTimes() (Timing, error) {
+    if r.norm != nil {
+        return *r.norm, nil
+    }
+    t := Timing{RawDuration: uint32(r.Meta.Duration)}
+    if err := r.open(0); err != nil {
+        return t, err
+    }
+    ts, _, err := r.fr.NextHeader()
+    if err != nil && err != io.EOF {
+        return t, r.fail(err)
+    }
+    if err == nil {
+        t.Offset = ts
+    }
+    if err := r.open(0); err != nil {
+        return t, err
+    }
+    if t.RawDuration > t.Offset {
+        t.Duration = t.RawDuration - t.Offset
+    }
+    r.base = t.Offset
+    r.Meta.Duration = int(t.Duration)
+    r.norm = &t
+    return t, nil
+}
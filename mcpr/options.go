@@ -0,0 +1,144 @@
+package mcpr
+
+import (
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// WriterOption configures a Writer while NewWriter, NewWriterInZip or Create
+// builds it, before any packet is written:
+//
+//  w, err := mcpr.Create("out.mcpr", meta,
+//      mcpr.WithIndexInterval(10000),
+//      mcpr.WithDimensions(protocol.Login))
+//
+// Options are applied in order; the first one failing fails the
+// constructor. They are how a Writer is configured: the setters they
+// replace, such as SetAsync and TrackDimensions, are deprecated, and new
+// capabilities get an option rather than a setter or constructor argument.
+type WriterOption func(*Writer) error
+
+// applyOptions applies opts to a new writer, which is abandoned if one fails.
+func (w *Writer) applyOptions(opts []WriterOption) error {
+    for _, opt := range opts {
+        if err := opt(w); err != nil {
+            w.abandon()
+            return err
+        }
+    }
+    return nil
+}
+
+// WithIndexInterval writes a seek index, see Writer.SetIndexInterval.
+func WithIndexInterval(ms uint32) WriterOption {
+    return func(w *Writer) error {
+        w.SetIndexInterval(ms)
+        return nil
+    }
+}
+
+// WithSidecar sets whether a sidecar file is written on Close, see
+// Writer.SetSidecar.
+func WithSidecar(enabled bool) WriterOption {
+    return func(w *Writer) error {
+        w.SetSidecar(enabled)
+        return nil
+    }
+}
+
+// WithStrict sets whether the writer is strict, see Writer.SetStrict.
+func WithStrict(strict bool) WriterOption {
+    return func(w *Writer) error {
+        w.SetStrict(strict)
+        return nil
+    }
+}
+
+// WithPackThreshold enables packed frames, see Writer.SetPackThreshold.
+// Packed frames are experimental and outside the v1 promise.
+func WithPackThreshold(n int) WriterOption {
+    return func(w *Writer) error {
+        w.SetPackThreshold(n)
+        return nil
+    }
+}
+
+// WithProtocolDetection guesses a missing Meta.Protocol, see
+// Writer.DetectProtocol.
+func WithProtocolDetection() WriterOption {
+    return func(w *Writer) error {
+        w.DetectProtocol()
+        return nil
+    }
+}
+
+// WithDimensions tracks dimension changes, see Writer.TrackDimensions.
+func WithDimensions(initial protocol.State) WriterOption {
+    return func(w *Writer) error {
+        return w.TrackDimensions(initial)
+    }
+}
+
+// WithLatency records latency samples, see Writer.TrackLatency.
+func WithLatency(initial protocol.State) WriterOption {
+    return func(w *Writer) error {
+        return w.TrackLatency(initial)
+    }
+}
+
+// WithHeartbeat fills gaps in the recording, see Writer.SetHeartbeat.
+func WithHeartbeat(interval time.Duration, initial protocol.State) WriterOption {
+    return func(w *Writer) error {
+        return w.SetHeartbeat(interval, initial)
+    }
+}
+
+// WithSampling thins out the recording under overload, see
+// Writer.SetSampling.
+func WithSampling(s Sampling, initial protocol.State) WriterOption {
+    return func(w *Writer) error {
+        return w.SetSampling(s, initial)
+    }
+}
+
+// WithSnapshots keeps a copy of the recording for Snapshot, see
+// Writer.EnableSnapshots.
+func WithSnapshots(dir string) WriterOption {
+    return func(w *Writer) error {
+        return w.EnableSnapshots(dir)
+    }
+}
+
+// WithBufferSize writes the archive in larger blocks, see
+// Writer.SetBufferSize.
+func WithBufferSize(n int) WriterOption {
+    return func(w *Writer) error {
+        return w.SetBufferSize(n)
+    }
+}
+
+// WithAsync writes packets on a separate goroutine, see Writer.SetAsync.
+func WithAsync(queue int) WriterOption {
+    return func(w *Writer) error {
+        return w.SetAsync(queue)
+    }
+}
+
+// WithLocking makes the Writer safe for concurrent use: every exported
+// method holds a mutex of the Writer while it runs, so recorders, proxies
+// and adapters sharing a writer between goroutines need no mutex of their
+// own. Packets written from several goroutines are written in the order they
+// get the mutex, which need not be the order of their timestamps. Callbacks
+// the writer runs, such as Sampling's OnChange, must not call it.
+// WritePacketFrom holds the mutex while reading the payload.
+//
+// Without it, methods take no lock and cost nothing extra. Unlike the other
+// options it has no setter, as a writer must lock from the start, before it
+// is shared.
+func WithLocking() WriterOption {
+    return func(w *Writer) error {
+        w.locking = true
+        return nil
+    }
+}
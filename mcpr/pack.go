@@ -0,0 +1,36 @@
+package mcpr
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+
+// SetPackThreshold enables packed frames, an extension of this module meant
+// for archival copies: payloads of at least n bytes, such as multi-megabyte
+// chunk batches, are stored DEFLATE-compressed in their own frame when that
+// makes them smaller. Every reader of this module unpacks them transparently
+// and metaDataExt.json records that the replay is packed, but ReplayMod
+// cannot read such frames: flatten packed replays (transform.Flatten,
+// mcpr-transform -flatten) before opening them there.
+//
+// recording.tmcpr is itself compressed in the ZIP, so packing mostly pays
+// off for large payloads that compress better on their own; measure on your
+// own recordings. 0 disables packing, the default.
+//
+// Deprecated: Use WithPackThreshold.
+func (w *Writer) SetPackThreshold(n int) {
+    defer w.lock().unlock()
+    w.drain()
+    w.pack = n
+}
+
+// packFrame returns the id and payload of the frame written for a packet:
+// the packet itself, or a packed frame holding it.
+func (w *Writer) packFrame(packetID int32, payload []byte) (int32, []byte) {
+    if w.pack <= 0 || len(payload) < w.pack || packetID < 0 {
+        return packetID, payload
+    }
+    packed, err := tmcpr.Pack(packetID, payload)
+    if err != nil || len(packed) >= len(payload) {
+        return packetID, payload
+    }
+    w.ext.Packed = true
+    return tmcpr.PackedID, packed
+}
@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package mcpr
+
+import "iter"
+
+// PacketHeader is the frame header of a packet yielded by Reader.Packets.
+type PacketHeader struct {
+    Time    uint32 // milliseconds since the start of the recording
+    RawTime uint32 // Time as recorded, see Reader.NormalizeTimes
+    ID      int32
+    Name    string // see Reader.SetPacketNames
+}
+
+// Packets returns an iterator over the remaining packets:
+//
+//	for hdr, data := range r.Packets() {
+//	    ...
+//	}
+//	if err := r.Err(); err != nil {
+//	    ...
+//	}
+//
+// Iteration stops at the end of the recording or at the first error, which
+// Err reports afterwards. data is owned by the caller.
+func (r *Reader) Packets() iter.Seq2[PacketHeader, []byte] {
+    return func(yield func(PacketHeader, []byte) bool) {
+        for {
+            p, err := r.Next()
+            if err != nil {
+                return
+            }
+            if !yield(PacketHeader{Time: p.Time, RawTime: p.RawTime, ID: p.ID, Name: p.Name}, p.Payload) {
+                return
+            }
+        }
+    }
+}
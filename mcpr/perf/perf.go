@@ -0,0 +1,83 @@
+// Package perf keeps lightweight timing counters for the hot paths of
+// mc-replay-go (writing packets, finalizing and validating replays,
+// rewrites, uploads), so slow recording services can be diagnosed in place.
+// Counters cost two clock reads and a few atomic adds per call.
+//
+// Services expose them, together with pprof, through package debugserver.
+package perf
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timer accumulates the calls to one operation and the time they took.
+type Timer struct {
+	name  string
+	calls atomic.Int64
+	total atomic.Int64 // ns
+	max   atomic.Int64 // ns
+}
+
+var (
+	mu     sync.Mutex
+	timers []*Timer
+)
+
+// NewTimer returns a timer registered under name, e.g. "mcpr.WritePacket".
+// Create timers once, in package variables.
+func NewTimer(name string) *Timer {
+	t := &Timer{name: name}
+	mu.Lock()
+	timers = append(timers, t)
+	mu.Unlock()
+	return t
+}
+
+// Since records a call that started at start:
+//
+//	defer timer.Since(time.Now())
+func (t *Timer) Since(start time.Time) {
+	d := int64(time.Since(start))
+	t.calls.Add(1)
+	t.total.Add(d)
+	for {
+		m := t.max.Load()
+		if d <= m || t.max.CompareAndSwap(m, d) {
+			return
+		}
+	}
+}
+
+// TimerStats are the totals of a Timer.
+type TimerStats struct {
+	Calls int64         `json:"calls"`
+	Total time.Duration `json:"totalNs"`
+	Mean  time.Duration `json:"meanNs"`
+	Max   time.Duration `json:"maxNs"`
+}
+
+// Stats returns the timer's totals so far.
+func (t *Timer) Stats() TimerStats {
+	st := TimerStats{
+		Calls: t.calls.Load(),
+		Total: time.Duration(t.total.Load()),
+		Max:   time.Duration(t.max.Load()),
+	}
+	if st.Calls > 0 {
+		st.Mean = st.Total / time.Duration(st.Calls)
+	}
+	return st
+}
+
+// Snapshot returns the totals of all timers by name.
+func Snapshot() map[string]TimerStats {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]TimerStats, len(timers))
+	for _, t := range timers {
+		out[t.name] = t.Stats()
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package playback
+
+import (
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// TimeSeeker is implemented by sources that can reposition themselves so the
+// next packet is the first one at or after ms. Player.Jump uses it.
+type TimeSeeker interface {
+	SeekTime(ms uint32) error
+}
+
+// FileSource returns an opener for New that reads the replay at path. The
+// sources it returns implement TimeSeeker and use the replay's frame index
+// (recording.tmcpr.index), when present, to jump without parsing every frame.
+func FileSource(path string) func() (Source, error) {
+	return func() (Source, error) {
+		a, err := archive.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		fs := &fileSource{a: a}
+		if ix, err := a.Index(); err == nil {
+			fs.ix = ix
+		}
+		if err := fs.reopen(0); err != nil {
+			_ = a.Close()
+			return nil, err
+		}
+		return fs, nil
+	}
+}
+
+type fileSource struct {
+	a   *archive.Archive
+	ix  *tmcpr.Index
+	fr  *tmcpr.Reader
+	rc  io.Closer
+	buf *tmcpr.Frame // frame read ahead by SeekTime
+}
+
+func (s *fileSource) reopen(off int64) error {
+	if s.rc != nil {
+		_ = s.rc.Close()
+	}
+	fr, rc, err := s.a.FramesAt(off)
+	if err != nil {
+		return err
+	}
+	s.fr, s.rc, s.buf = fr, rc, nil
+	return nil
+}
+
+func (s *fileSource) Next() (Packet, error) {
+	if s.buf != nil {
+		f := *s.buf
+		s.buf = nil
+		return Packet{Time: f.Time, ID: f.ID, Payload: f.Payload}, nil
+	}
+	f, err := s.fr.Next()
+	return Packet{Time: f.Time, ID: f.ID, Payload: f.Payload}, err
+}
+
+func (s *fileSource) SeekTime(ms uint32) error {
+	var off int64
+	if s.ix != nil {
+		if e, ok := s.ix.Lookup(ms); ok {
+			off = e.Offset
+		}
+	}
+	if err := s.reopen(off); err != nil {
+		return err
+	}
+	for {
+		f, err := s.fr.Next()
+		if err != nil {
+			return err
+		}
+		if f.Time >= ms {
+			s.buf = &f
+			return nil
+		}
+	}
+}
+
+func (s *fileSource) Close() error {
+	if s.rc != nil {
+		_ = s.rc.Close()
+	}
+	return s.a.Close()
+}
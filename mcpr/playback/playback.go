@@ -0,0 +1,303 @@
+// Package playback emits recorded packets on a timer that honors their
+// original timestamps, with speed control, seeking, and pausing. It drives the
+// replay server and is useful for tests and custom viewers.
+//
+//	p := playback.New(open)
+//	go p.Run(ctx, func(pk playback.Packet) error { return handle(pk) })
+//	p.SetSpeed(2)
+//	p.Seek(60_000)
+package playback
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Packet is a recorded packet.
+type Packet struct {
+	Time    uint32 // milliseconds since the start of the recording
+	ID      int32
+	Payload []byte
+}
+
+// Source yields packets in timestamp order. Next returns io.EOF at the end.
+type Source interface {
+	Next() (Packet, error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func() (Packet, error)
+
+// Next calls f.
+func (f SourceFunc) Next() (Packet, error) { return f() }
+
+// Player paces packets from a Source. Its methods are safe to call from other
+// goroutines while Run is active.
+type Player struct {
+	// OnIdle, if set, is called before the player waits for the next packet
+	// to become due. Use it to flush buffered output.
+	OnIdle func() error
+	// OnRewind, if set, is called when a backward seek restarts the source;
+	// consumers holding state derived from earlier packets should reset it.
+	OnRewind func()
+
+	open func() (Source, error)
+
+	mu       sync.Mutex
+	speed    float64
+	paused   bool
+	pos      float64   // playback position in ms at wall
+	wall     time.Time // wall time pos was taken
+	seek     *uint32   // pending seek target
+	jump     *uint32   // pending jump target
+	changed  chan struct{}
+	position uint32 // timestamp of the last emitted packet
+}
+
+// New returns a player reading from sources returned by open. open is called
+// once when Run starts and again for every backward seek.
+func New(open func() (Source, error)) *Player {
+	return &Player{open: open, speed: 1, wall: time.Now(), changed: make(chan struct{})}
+}
+
+// clock returns the current playback position in ms. Callers hold p.mu.
+func (p *Player) clock() float64 {
+	if p.paused {
+		return p.pos
+	}
+	return p.pos + float64(time.Since(p.wall))/float64(time.Millisecond)*p.speed
+}
+
+// rebase freezes the clock at its current value before a change. Callers hold p.mu.
+func (p *Player) rebase() {
+	p.pos = p.clock()
+	p.wall = time.Now()
+}
+
+func (p *Player) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// SetSpeed changes the playback speed; 2.0 plays twice as fast.
+// Non-positive values are ignored.
+func (p *Player) SetSpeed(speed float64) {
+	if speed <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rebase()
+	p.speed = speed
+	p.notify()
+}
+
+// Pause stops the playback clock. Packets stop being emitted until Resume.
+func (p *Player) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rebase()
+	p.paused = true
+	p.notify()
+}
+
+// Resume restarts the playback clock after Pause.
+func (p *Player) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rebase()
+	p.paused = false
+	p.notify()
+}
+
+// Seek moves playback to ms. Packets between the current position and ms are
+// emitted immediately (so consumers see the world state at ms); seeking
+// backwards restarts the source from the beginning.
+func (p *Player) Seek(ms uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seek = &ms
+	p.notify()
+}
+
+// Jump moves playback to ms without emitting the packets in between. Use it
+// when the consumer does not need the state those packets carry (e.g. packet
+// inspectors). Sources implementing TimeSeeker, such as FileSource, can jump
+// without reading the skipped packets.
+func (p *Player) Jump(ms uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jump = &ms
+	p.notify()
+}
+
+// Position returns the timestamp of the last emitted packet.
+func (p *Player) Position() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position
+}
+
+// Run emits packets until the source is exhausted, emit returns an error, or
+// ctx is cancelled. It returns nil at the end of the source.
+func (p *Player) Run(ctx context.Context, emit func(Packet) error) error {
+	src, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer func() { closeSource(src) }()
+	p.mu.Lock()
+	p.pos, p.wall = 0, time.Now()
+	p.mu.Unlock()
+
+	var pending *Packet
+	fastForward := -1.0 // emit packets up to this time without waiting
+	for {
+		p.mu.Lock()
+		if p.seek != nil {
+			target := float64(*p.seek)
+			p.seek = nil
+			rewind := pending != nil && float64(pending.Time) > target || target < float64(p.position)
+			p.pos, p.wall = target, time.Now()
+			p.mu.Unlock()
+			if rewind {
+				closeSource(src)
+				if src, err = p.open(); err != nil {
+					return err
+				}
+				pending = nil
+				p.mu.Lock()
+				p.position = 0
+				p.mu.Unlock()
+				if p.OnRewind != nil {
+					p.OnRewind()
+				}
+			}
+			fastForward = target
+			continue
+		}
+		if p.jump != nil {
+			target := *p.jump
+			p.jump = nil
+			p.pos, p.wall = float64(target), time.Now()
+			p.position = target
+			p.mu.Unlock()
+			pending = nil
+			if src, err = p.jumpSource(src, target); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			fastForward = -1
+			continue
+		}
+		p.mu.Unlock()
+
+		if pending == nil {
+			pk, err := src.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			pending = &pk
+		}
+
+		if float64(pending.Time) > fastForward {
+			p.mu.Lock()
+			ahead := float64(pending.Time) - p.clock()
+			paused, speed, changed := p.paused, p.speed, p.changed
+			p.mu.Unlock()
+			if paused || ahead > 0 {
+				if p.OnIdle != nil {
+					if err := p.OnIdle(); err != nil {
+						return err
+					}
+				}
+				if err := wait(ctx, ahead, speed, paused, changed); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if err := emit(*pending); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.position = pending.Time
+		p.mu.Unlock()
+		pending = nil
+	}
+}
+
+// jumpSource positions src so its next packet is the first at or after ms.
+func (p *Player) jumpSource(src Source, ms uint32) (Source, error) {
+	if ts, ok := src.(TimeSeeker); ok {
+		return src, ts.SeekTime(ms)
+	}
+	// Without seek support: restart and discard packets before ms
+	closeSource(src)
+	src, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pk, err := src.Next()
+		if err != nil {
+			return src, err
+		}
+		if pk.Time >= ms {
+			return &pushback{Source: src, pending: &pk}, nil
+		}
+	}
+}
+
+// pushback returns a packet read ahead before reading from Source.
+type pushback struct {
+	Source
+	pending *Packet
+}
+
+func (b *pushback) Next() (Packet, error) {
+	if b.pending != nil {
+		pk := *b.pending
+		b.pending = nil
+		return pk, nil
+	}
+	return b.Source.Next()
+}
+
+func (b *pushback) Close() error {
+	closeSource(b.Source)
+	return nil
+}
+
+func closeSource(src Source) {
+	if c, ok := src.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// wait blocks until a packet ahead ms in the future is due, playback settings
+// change, or ctx is cancelled. While paused it only returns on changes.
+func wait(ctx context.Context, ahead, speed float64, paused bool, changed <-chan struct{}) error {
+	var timer <-chan time.Time
+	if !paused {
+		t := time.NewTimer(time.Duration(ahead / speed * float64(time.Millisecond)))
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+	case <-timer:
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "runtime/debug"
+    "time"
+)
+
+// ProcessingEntryName is the archive entry logging the tools that rewrote a
+// replay after it was recorded, oldest first.
+const ProcessingEntryName = "processing.json"
+
+// modulePath identifies this module in build info, see Version.
+const modulePath = "github.com/reallyoldfogie/mc-replay-go"
+
+// ProcessingStep is one rewrite of a replay. Together with the source's id
+// and checksum it lets a reviewer trace a replay back to the original
+// recording.
+type ProcessingStep struct {
+    Time        time.Time `json:"time"`
+    Tool        string    `json:"tool"`                  // program that rewrote the replay, e.g. "mcpr-transform"
+    Version     string    `json:"version"`               // mc-replay-go version, see Version
+    Operation   string    `json:"operation"`             // e.g. "trim(0,5m)|scrub-chat"
+    Source      string    `json:"source,omitempty"`      // metadata id of the replay rewritten
+    SourceCRC32 string    `json:"sourceCrc32,omitempty"` // its recording.tmcpr.crc32
+}
+
+// AddProcessingStep appends a step to the processing log written to
+// processing.json on Close. Earlier steps are carried over by adding them
+// first. A zero Time is set to the current time and an empty Version to
+// Version(). It has no effect if the caller supplies processing.json itself.
+func (w *Writer) AddProcessingStep(s ProcessingStep) {
+    defer w.lock().unlock()
+    if s.Time.IsZero() {
+        s.Time = time.Now().UTC()
+    }
+    if s.Version == "" {
+        s.Version = Version()
+    }
+    w.processing = append(w.processing, s)
+}
+
+func (w *Writer) writeProcessing() error {
+    if len(w.processing) == 0 || w.entries[ProcessingEntryName] {
+        return nil
+    }
+    pw, err := w.createEntry(ProcessingEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", ProcessingEntryName, err)
+    }
+    enc := json.NewEncoder(pw)
+    enc.SetIndent("", "  ")
+    return enc.Encode(w.processing)
+}
+
+// ReadProcessingLog returns the processing log of the replay at path, or nil
+// if it was never rewritten.
+func ReadProcessingLog(path string) ([]ProcessingStep, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return readProcessingLog(zr.File)
+}
+
+// ProcessingLog returns the processing log of the replay, see
+// ReadProcessingLog.
+func (r *Reader) ProcessingLog() ([]ProcessingStep, error) {
+    return readProcessingLog(r.files)
+}
+
+func readProcessingLog(files []*zip.File) ([]ProcessingStep, error) {
+    for _, f := range files {
+        if f.Name == ProcessingEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer rc.Close()
+            var steps []ProcessingStep
+            if err := json.NewDecoder(rc).Decode(&steps); err != nil {
+                return nil, fmt.Errorf("parse %s: %w", ProcessingEntryName, err)
+            }
+            return steps, nil
+        }
+    }
+    return nil, nil
+}
+
+// Version returns the version of this module in the running binary, e.g.
+// "v1.4.0", a pseudo-version when built from a checkout, or "unknown".
+func Version() string {
+    bi, ok := debug.ReadBuildInfo()
+    if !ok {
+        return "unknown"
+    }
+    mod := &bi.Main
+    for _, d := range bi.Deps {
+        if d.Path == modulePath {
+            mod = d
+        }
+    }
+    if mod.Path != modulePath {
+        return "unknown"
+    }
+    if mod.Version != "" && mod.Version != "(devel)" {
+        return mod.Version
+    }
+    for _, s := range bi.Settings {
+        if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+            return "devel-" + s.Value[:12]
+        }
+    }
+    return "devel"
+}
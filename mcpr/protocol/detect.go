@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+)
+
+// Releases names the Minecraft releases of the protocols a Detector knows,
+// 1.16.5 to 1.21.1.
+var Releases = map[int]string{
+	754: "1.16.5",
+	755: "1.17",
+	756: "1.17.1",
+	757: "1.18-1.18.1",
+	758: "1.18.2",
+	759: "1.19",
+	760: "1.19.1-1.19.2",
+	761: "1.19.3",
+	762: "1.19.4",
+	763: "1.20-1.20.1",
+	764: "1.20.2",
+	765: "1.20.3-1.20.4",
+	766: "1.20.5-1.20.6",
+	767: "1.21-1.21.1",
+}
+
+// joinGameIDs are the candidate protocols for each clientbound play Login
+// (join game) id, the first play packet vanilla servers send.
+var joinGameIDs = map[int32][]int{
+	0x23: {759},
+	0x24: {754, 761},
+	0x25: {760},
+	0x26: {755, 756, 757, 758},
+	0x28: {762, 763},
+	0x29: {764, 765},
+	0x2B: {766, 767},
+}
+
+// Guess is a protocol version inferred from a packet stream, see Detector.
+type Guess struct {
+	Protocol   int      // most likely protocol, 0 if nothing matched
+	Candidates []int    // protocols consistent with the stream, ascending
+	Evidence   []string // the packets the guess rests on
+}
+
+// Certain reports whether the stream fits exactly one protocol.
+func (g Guess) Certain() bool {
+	return len(g.Candidates) == 1
+}
+
+func (g Guess) String() string {
+	if g.Protocol == 0 {
+		return "unknown protocol"
+	}
+	s := fmt.Sprintf("protocol %d (%s)", g.Protocol, Releases[g.Protocol])
+	if !g.Certain() {
+		s += fmt.Sprintf(", uncertain: could be any of %v", g.Candidates)
+	}
+	return s
+}
+
+// Detector guesses the protocol of a clientbound packet stream that carries
+// no metadata, such as an imported raw dump, from packet ids and shapes:
+// whether login success is followed by a configuration phase (1.20.2+), the
+// ids of FinishConfiguration and UpdateEnabledFeatures, the registries sent,
+// and the id of the join game packet, which differs between most releases.
+// Releases that share every id, e.g. 1.17 and 1.17.1, stay ambiguous.
+//
+// Streams may start at login or, for captures taken after login, at the join
+// game packet. Detection is best effort: it assumes a vanilla server, whose
+// first play packet is the join game packet.
+type Detector struct {
+	phase      State // Login, Configuration or Play; Play once done
+	loggedIn   bool  // login success was seen
+	configured bool  // configuration packets were seen
+	finished   bool  // FinishConfiguration was seen
+	registries bool  // 1.20.5+ registry packets were seen
+	v121       bool  // a registry new in 1.21 was seen
+	cands      []int // nil until something narrowed the candidates
+	evidence   []string
+}
+
+// NewDetector returns a detector for a stream starting at login or play.
+func NewDetector() *Detector {
+	return &Detector{phase: Login}
+}
+
+// Observe feeds the next clientbound packet to the detector and reports
+// whether it is done: after the join game packet nothing narrows the guess
+// further, so the caller can stop feeding packets.
+func (d *Detector) Observe(id int32, payload []byte) bool {
+	switch d.phase {
+	case Login:
+		if id == 0x02 && loginSuccess(payload) {
+			d.loggedIn = true
+			d.phase = Configuration
+			return false
+		}
+		if id <= 0x04 {
+			return false // other login packets look alike in every release
+		}
+		d.joinGame(id, payload)
+	case Configuration:
+		// Configuration ids stay below 0x10, join game ids above 0x20.
+		if !d.finished && id <= 0x10 {
+			d.configure(id, payload)
+			return false
+		}
+		d.joinGame(id, payload)
+	}
+	return d.phase == Play
+}
+
+// Guess returns the guess for the packets observed so far.
+func (d *Detector) Guess() Guess {
+	g := Guess{Candidates: d.cands, Evidence: d.evidence}
+	if len(g.Candidates) > 0 {
+		// Within a set of releases that look alike, the last was the one
+		// servers stayed on.
+		g.Protocol = g.Candidates[len(g.Candidates)-1]
+	}
+	return g
+}
+
+// narrow keeps the candidates in keep and records why.
+func (d *Detector) narrow(keep []int, why string) {
+	d.evidence = append(d.evidence, why)
+	if d.cands == nil {
+		d.cands = append([]int(nil), keep...)
+		sort.Ints(d.cands)
+		return
+	}
+	var out []int
+	for _, p := range d.cands {
+		for _, k := range keep {
+			if p == k {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	d.cands = out
+}
+
+// configure follows a configuration packet.
+func (d *Detector) configure(id int32, payload []byte) {
+	if !d.configured {
+		d.configured = true
+		d.narrow([]int{764, 765, 766, 767}, "configuration phase after login")
+	}
+	switch {
+	case len(payload) == 0 && id == 0x02:
+		d.narrow([]int{764, 765}, "FinishConfiguration id 0x02")
+		d.finished = true
+	case len(payload) == 0 && id == 0x03:
+		if d.registries && !d.v121 {
+			d.narrow([]int{766}, "no registry new in 1.21")
+		}
+		d.narrow([]int{766, 767}, "FinishConfiguration id 0x03")
+		d.finished = true
+	case enabledFeatures(payload):
+		switch id {
+		case 0x07:
+			d.narrow([]int{764}, "UpdateEnabledFeatures id 0x07")
+		case 0x08:
+			d.narrow([]int{765}, "UpdateEnabledFeatures id 0x08")
+		case 0x0C:
+			d.narrow([]int{766, 767}, "UpdateEnabledFeatures id 0x0C")
+		}
+	case id == 0x07:
+		// 1.20.5+ RegistryData: registry:string entries...
+		r := wire.NewDecoder(payload)
+		name := r.String()
+		if r.Err != nil || !strings.HasPrefix(name, "minecraft:") {
+			return
+		}
+		d.registries = true
+		switch name {
+		case "minecraft:enchantment", "minecraft:jukebox_song", "minecraft:painting_variant":
+			if !d.v121 {
+				d.v121 = true
+				d.narrow([]int{767}, "registry "+name)
+			}
+		}
+	}
+}
+
+// joinGame narrows the candidates by the first play packet.
+func (d *Detector) joinGame(id int32, payload []byte) {
+	d.phase = Play
+	cands := joinGameIDs[id]
+	if cands == nil || !joinGameShape(payload) {
+		d.narrow(nil, fmt.Sprintf("first play packet 0x%02X is no known join game packet", id))
+		return
+	}
+	if d.loggedIn && !d.configured {
+		var pre []int
+		for _, p := range cands {
+			if p < 764 {
+				pre = append(pre, p)
+			}
+		}
+		d.narrow([]int{754, 755, 756, 757, 758, 759, 760, 761, 762, 763}, "no configuration phase after login")
+		cands = pre
+	}
+	d.narrow(cands, fmt.Sprintf("join game id 0x%02X", id))
+
+	// The registry codec in the join game packet of releases before 1.20.2
+	// tells some of them apart.
+	switch id {
+	case 0x24:
+		if bytes.Contains(payload, []byte("minecraft:chat_type")) {
+			d.narrow([]int{761}, "chat_type registry")
+		} else {
+			d.narrow([]int{754}, "no chat_type registry")
+		}
+	case 0x26:
+		if bytes.Contains(payload, []byte("#minecraft:infiniburn")) {
+			d.narrow([]int{758}, "infiniburn block tag")
+		} else {
+			d.narrow([]int{755, 756, 757}, "no infiniburn block tag")
+		}
+	}
+}
+
+// loginSuccess reports whether p looks like a login success payload:
+// uuid:16 name:string ... (1.16+).
+func loginSuccess(p []byte) bool {
+	d := wire.NewDecoder(p)
+	d.Skip(16)
+	name := d.String()
+	return d.Err == nil && len(name) > 0 && len(name) <= 16
+}
+
+// joinGameShape reports whether p looks like a join game payload:
+// entity:i32 hardcore:bool ...
+func joinGameShape(p []byte) bool {
+	d := wire.NewDecoder(p)
+	d.Int()
+	b := d.Byte()
+	return d.Err == nil && b <= 1
+}
+
+// enabledFeatures reports whether p looks like an UpdateEnabledFeatures
+// payload: flags:varint×string, vanilla servers sending "minecraft:vanilla".
+func enabledFeatures(p []byte) bool {
+	d := wire.NewDecoder(p)
+	n := d.VarInt()
+	vanilla := false
+	for ; n > 0 && n < 64 && d.Err == nil; n-- {
+		if d.String() == "minecraft:vanilla" {
+			vanilla = true
+		}
+	}
+	return vanilla && d.Err == nil && n == 0 && len(d.B) == 0
+}
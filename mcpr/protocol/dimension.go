@@ -0,0 +1,56 @@
+package protocol
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+
+// dimensionDecoders extract the dimension name from the play Login and Respawn
+// packets of a protocol version, keyed by protocol. Layouts change between
+// releases, so each table needs its own decoder.
+var dimensionDecoders = map[int]func(name string, p []byte) (string, error){
+	764: dimension764,
+}
+
+// Dimension reports the dimension (e.g. "minecraft:the_nether") a clientbound
+// play packet moves the client into. ok is false for packets other than Login
+// and Respawn, when the protocol has no decoder, or when the payload is
+// malformed.
+func (t *Table) Dimension(id int32, payload []byte) (dim string, ok bool) {
+	dec := dimensionDecoders[t.Protocol]
+	if dec == nil {
+		return "", false
+	}
+	name := t.Name(Clientbound, Play, id)
+	if name != "Login" && name != "Respawn" {
+		return "", false
+	}
+	dim, err := dec(name, payload)
+	return dim, err == nil
+}
+
+// HasDimensions reports whether Dimension can decode this protocol.
+func (t *Table) HasDimensions() bool {
+	return dimensionDecoders[t.Protocol] != nil
+}
+
+// 1.20.2:
+//
+//	Login:   entity:i32 hardcore:bool worlds:varint×string maxPlayers:varint
+//	         viewDistance:varint simulationDistance:varint reducedDebug:bool
+//	         respawnScreen:bool limitedCrafting:bool dimensionType:string
+//	         dimension:string ...
+//	Respawn: dimensionType:string dimension:string ...
+func dimension764(name string, p []byte) (string, error) {
+	d := wire.NewDecoder(p)
+	if name == "Login" {
+		d.Skip(5)
+		for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+			_ = d.String()
+		}
+		d.VarInt()
+		d.VarInt()
+		d.VarInt()
+		d.Skip(3)
+	}
+	_ = d.String()
+	dim := d.String()
+	return dim, d.Err
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+
+// playerDecoders extract the players added to the tab list by the
+// PlayerInfoUpdate packet of a protocol version, keyed by protocol.
+var playerDecoders = map[int]func(p []byte) ([]string, error){
+	764: players764,
+}
+
+// Players reports the UUIDs of the players a clientbound play packet adds to
+// the tab list. ok is false for packets other than PlayerInfoUpdate, when the
+// protocol has no decoder, or when the payload is malformed.
+func (t *Table) Players(id int32, payload []byte) (uuids []string, ok bool) {
+	dec := playerDecoders[t.Protocol]
+	if dec == nil || t.Name(Clientbound, Play, id) != "PlayerInfoUpdate" {
+		return nil, false
+	}
+	uuids, err := dec(payload)
+	return uuids, err == nil
+}
+
+// HasPlayers reports whether Players can decode this protocol.
+func (t *Table) HasPlayers() bool {
+	return playerDecoders[t.Protocol] != nil
+}
+
+// 1.20.2:
+//
+//	PlayerInfoUpdate: actions:byte count:varint, then per player uuid and,
+//	for each action bit in order: 0x01 name:string properties:varint×(name:string
+//	value:string signed:bool [signature:string]); 0x02 chat session:bool
+//	[session:uuid expiry:long key:bytes signature:bytes]; 0x04 game mode:varint;
+//	0x08 listed:bool; 0x10 latency:varint; 0x20 display name:bool [chat]
+//
+// Only entries with the add action (0x01) are new players.
+func players764(p []byte) ([]string, error) {
+	d := wire.NewDecoder(p)
+	actions := d.Byte()
+	var out []string
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		uuid := d.UUID()
+		if actions&0x01 != 0 {
+			out = append(out, uuid)
+			_ = d.String()
+			for p := d.VarInt(); p > 0 && d.Err == nil; p-- {
+				_ = d.String()
+				_ = d.String()
+				if d.Bool() {
+					_ = d.String()
+				}
+			}
+		}
+		if actions&0x02 != 0 && d.Bool() {
+			d.Skip(16 + 8)
+			d.ByteArray()
+			d.ByteArray()
+		}
+		if actions&0x04 != 0 {
+			d.VarInt()
+		}
+		if actions&0x08 != 0 {
+			d.Bool()
+		}
+		if actions&0x10 != 0 {
+			d.VarInt()
+		}
+		if actions&0x20 != 0 && d.Bool() {
+			_ = d.String()
+		}
+	}
+	return out, d.Err
+}
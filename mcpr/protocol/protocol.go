@@ -0,0 +1,95 @@
+// Package protocol holds per-version Minecraft packet tables used by the
+// protocol-aware parts of mc-replay-go (filters, inspection, warnings).
+//
+// Tables map packet ids to Mojang-mapped names for each connection state and
+// direction. Only a few protocol versions are bundled; callers must handle
+// Lookup returning false and fall back to numeric ids.
+package protocol
+
+import "fmt"
+
+// State is a connection state of the Minecraft protocol.
+type State int
+
+const (
+	Handshake State = iota
+	Status
+	Login
+	Configuration
+	Play
+)
+
+func (s State) String() string {
+	switch s {
+	case Handshake:
+		return "handshake"
+	case Status:
+		return "status"
+	case Login:
+		return "login"
+	case Configuration:
+		return "configuration"
+	case Play:
+		return "play"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Direction is the direction a packet travels.
+type Direction int
+
+const (
+	Clientbound Direction = iota
+	Serverbound
+)
+
+// Table maps packet ids to names for one protocol version.
+type Table struct {
+	Protocol int
+	Version  string // Minecraft release name, e.g. "1.20.2"
+
+	clientbound map[State][]string
+	serverbound map[State][]string
+}
+
+var tables = map[int]*Table{
+	764: table764,
+}
+
+// Lookup returns the packet table for a protocol version.
+func Lookup(protocol int) (*Table, bool) {
+	t, ok := tables[protocol]
+	return t, ok
+}
+
+func (t *Table) names(dir Direction, s State) []string {
+	if dir == Serverbound {
+		return t.serverbound[s]
+	}
+	return t.clientbound[s]
+}
+
+// Name returns the packet name for id, or "" if the id is not known.
+func (t *Table) Name(dir Direction, s State, id int32) string {
+	names := t.names(dir, s)
+	if id < 0 || int(id) >= len(names) {
+		return ""
+	}
+	return names[id]
+}
+
+// ID returns the packet id for name in the given state and direction.
+func (t *Table) ID(dir Direction, s State, name string) (int32, bool) {
+	for i, n := range t.names(dir, s) {
+		if n == name {
+			return int32(i), true
+		}
+	}
+	return 0, false
+}
+
+// Count returns the number of known packet ids in the given state and direction.
+// Valid ids are 0..Count-1.
+func (t *Table) Count(dir Direction, s State) int {
+	return len(t.names(dir, s))
+}
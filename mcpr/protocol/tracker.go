@@ -0,0 +1,40 @@
+package protocol
+
+// Tracker follows the connection state of a clientbound packet stream.
+//
+// ReplayMod recordings start with the login phase (GameProfile / login
+// success), followed by configuration (1.20.2+) and play. Streams captured by
+// adapters after login can start the tracker in Play instead.
+type Tracker struct {
+	table *Table
+	state State
+}
+
+// NewTracker returns a tracker for the given table starting in state s.
+func NewTracker(t *Table, s State) *Tracker {
+	return &Tracker{table: t, state: s}
+}
+
+// State returns the state the next packet will be interpreted in.
+func (tr *Tracker) State() State {
+	return tr.state
+}
+
+// Observe returns the state packet id was sent in and advances the tracker
+// if the packet switches states.
+func (tr *Tracker) Observe(id int32) State {
+	s := tr.state
+	switch tr.table.Name(Clientbound, s, id) {
+	case "GameProfile":
+		if tr.table.Count(Clientbound, Configuration) > 0 {
+			tr.state = Configuration
+		} else {
+			tr.state = Play
+		}
+	case "FinishConfiguration":
+		tr.state = Play
+	case "StartConfiguration":
+		tr.state = Configuration
+	}
+	return s
+}
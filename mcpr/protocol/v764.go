@@ -0,0 +1,223 @@
+package protocol
+
+// Packet names for protocol 764 (Minecraft 1.20.2), following the Mojang
+// mappings used by github.com/Tnze/go-mc data/packetid. The index is the packet id.
+var table764 = &Table{
+	Protocol: 764,
+	Version:  "1.20.2",
+	clientbound: map[State][]string{
+		Status: {
+			"Response",
+			"PongResponse",
+		},
+		Login: {
+			"Disconnect",
+			"Hello",
+			"GameProfile",
+			"LoginCompression",
+			"CustomQuery",
+		},
+		Configuration: {
+			"CustomPayload",
+			"Disconnect",
+			"FinishConfiguration",
+			"KeepAlive",
+			"Ping",
+			"RegistryData",
+			"ResourcePack",
+			"UpdateEnabledFeatures",
+			"UpdateTags",
+		},
+		Play: {
+			"BundleDelimiter",
+			"AddEntity",
+			"AddExperienceOrb",
+			"Animate",
+			"AwardStats",
+			"BlockChangedAck",
+			"BlockDestruction",
+			"BlockEntityData",
+			"BlockEvent",
+			"BlockUpdate",
+			"BossEvent",
+			"ChangeDifficulty",
+			"ChunkBatchFinished",
+			"ChunkBatchStart",
+			"ChunksBiomes",
+			"ClearTitles",
+			"CommandSuggestions",
+			"Commands",
+			"ContainerClose",
+			"ContainerSetContent",
+			"ContainerSetData",
+			"ContainerSetSlot",
+			"Cooldown",
+			"CustomChatCompletions",
+			"CustomPayload",
+			"DamageEvent",
+			"DeleteChat",
+			"Disconnect",
+			"DisguisedChat",
+			"EntityEvent",
+			"Explode",
+			"ForgetLevelChunk",
+			"GameEvent",
+			"HorseScreenOpen",
+			"HurtAnimation",
+			"InitializeBorder",
+			"KeepAlive",
+			"LevelChunkWithLight",
+			"LevelEvent",
+			"LevelParticles",
+			"LightUpdate",
+			"Login",
+			"MapItemData",
+			"MerchantOffers",
+			"MoveEntityPos",
+			"MoveEntityPosRot",
+			"MoveEntityRot",
+			"MoveVehicle",
+			"OpenBook",
+			"OpenScreen",
+			"OpenSignEditor",
+			"Ping",
+			"PongResponse",
+			"PlaceGhostRecipe",
+			"PlayerAbilities",
+			"PlayerChat",
+			"PlayerCombatEnd",
+			"PlayerCombatEnter",
+			"PlayerCombatKill",
+			"PlayerInfoRemove",
+			"PlayerInfoUpdate",
+			"PlayerLookAt",
+			"PlayerPosition",
+			"Recipe",
+			"RemoveEntities",
+			"RemoveMobEffect",
+			"ResourcePack",
+			"Respawn",
+			"RotateHead",
+			"SectionBlocksUpdate",
+			"SelectAdvancementsTab",
+			"ServerData",
+			"SetActionBarText",
+			"SetBorderCenter",
+			"SetBorderLerpSize",
+			"SetBorderSize",
+			"SetBorderWarningDelay",
+			"SetBorderWarningDistance",
+			"SetCamera",
+			"SetCarriedItem",
+			"SetChunkCacheCenter",
+			"SetChunkCacheRadius",
+			"SetDefaultSpawnPosition",
+			"SetDisplayObjective",
+			"SetEntityData",
+			"SetEntityLink",
+			"SetEntityMotion",
+			"SetEquipment",
+			"SetExperience",
+			"SetHealth",
+			"SetObjective",
+			"SetPassengers",
+			"SetPlayerTeam",
+			"SetScore",
+			"SetSimulationDistance",
+			"SetSubtitleText",
+			"SetTime",
+			"SetTitleText",
+			"SetTitlesAnimation",
+			"SoundEntity",
+			"Sound",
+			"StartConfiguration",
+			"StopSound",
+			"SystemChat",
+			"TabList",
+			"TagQuery",
+			"TakeItemEntity",
+			"TeleportEntity",
+			"UpdateAdvancements",
+			"UpdateAttributes",
+			"UpdateMobEffect",
+			"UpdateRecipes",
+			"UpdateTags",
+		},
+	},
+	serverbound: map[State][]string{
+		Status: {
+			"Request",
+			"PingRequest",
+		},
+		Login: {
+			"Hello",
+			"Key",
+			"CustomQueryAnswer",
+			"LoginAcknowledged",
+		},
+		Configuration: {
+			"ClientInformation",
+			"CustomPayload",
+			"FinishConfiguration",
+			"KeepAlive",
+			"Pong",
+			"ResourcePack",
+		},
+		Play: {
+			"AcceptTeleportation",
+			"BlockEntityTagQuery",
+			"ChangeDifficulty",
+			"ChatAck",
+			"ChatCommand",
+			"Chat",
+			"ChatSessionUpdate",
+			"ChunkBatchReceived",
+			"ClientCommand",
+			"ClientInformation",
+			"CommandSuggestion",
+			"ConfigurationAcknowledged",
+			"ContainerButtonClick",
+			"ContainerClick",
+			"ContainerClose",
+			"CustomPayload",
+			"EditBook",
+			"EntityTagQuery",
+			"Interact",
+			"JigsawGenerate",
+			"KeepAlive",
+			"LockDifficulty",
+			"MovePlayerPos",
+			"MovePlayerPosRot",
+			"MovePlayerRot",
+			"MovePlayerStatusOnly",
+			"MoveVehicle",
+			"PaddleBoat",
+			"PickItem",
+			"PingRequest",
+			"PlaceRecipe",
+			"PlayerAbilities",
+			"PlayerAction",
+			"PlayerCommand",
+			"PlayerInput",
+			"Pong",
+			"RecipeBookChangeSettings",
+			"RecipeBookSeenRecipe",
+			"RenameItem",
+			"ResourcePack",
+			"SeenAdvancements",
+			"SelectTrade",
+			"SetBeacon",
+			"SetCarriedItem",
+			"SetCommandBlock",
+			"SetCommandMinecart",
+			"SetCreativeModeSlot",
+			"SetJigsawBlock",
+			"SetStructureBlock",
+			"SignUpdate",
+			"Swing",
+			"TeleportToEntity",
+			"UseItemOn",
+			"UseItem",
+		},
+	},
+}
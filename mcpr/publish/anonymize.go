@@ -0,0 +1,285 @@
+package publish
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// rewriter returns the share-safe form of a packet's payload.
+type rewriter func(a *anonymizer, p []byte) ([]byte, error)
+
+// profile lists, per connection state, the clientbound packets a published
+// copy keeps: as they are if the rewriter is nil, rewritten otherwise. The
+// others are dropped.
+type profile map[protocol.State]map[string]rewriter
+
+// profiles by protocol.
+var profiles = map[int]profile{
+	764: profile764,
+}
+
+// anonymizer is the transform stage applying a profile.
+type anonymizer struct {
+	profile    profile
+	table      *protocol.Table
+	key        []byte
+	dx, dz     int32                 // offset in chunks
+	serverName string                // replaces Meta.ServerName
+	ids        map[[16]byte][16]byte // pseudonymous UUIDs by original
+	players    map[[16]byte]string   // pseudonyms by original UUID
+	names      map[string]bool       // original player names
+	levels     map[string]string     // renamed dimensions
+	dropped    map[string]int64
+	malformed  int64
+}
+
+func newAnonymizer(prof profile, key []byte, offset [2]int32, serverName string) *anonymizer {
+	return &anonymizer{
+		profile:    prof,
+		key:        key,
+		dx:         offset[0],
+		dz:         offset[1],
+		serverName: serverName,
+		ids:        map[[16]byte][16]byte{},
+		players:    map[[16]byte]string{},
+		names:      map[string]bool{},
+		levels:     map[string]string{},
+		dropped:    map[string]int64{},
+	}
+}
+
+func (a *anonymizer) Apply(p *transform.Packet) bool {
+	name := a.table.Name(protocol.Clientbound, p.State, p.ID)
+	rw, ok := a.profile[p.State][name]
+	if !ok {
+		if name == "" {
+			name = fmt.Sprintf("%s 0x%02X", p.State, p.ID)
+		}
+		a.dropped[name]++
+		return false
+	}
+	if rw == nil {
+		return true
+	}
+	out, err := rw(a, p.Payload)
+	if err != nil {
+		// What cannot be parsed cannot be vetted
+		a.malformed++
+		return false
+	}
+	p.Payload = out
+	return true
+}
+
+// UpdateMeta replaces the players and the server in the metadata.
+func (a *anonymizer) UpdateMeta(m *mcpr.Meta) {
+	players := make([]string, 0, len(m.Players))
+	for _, p := range m.Players {
+		u, err := uuid.Parse(p)
+		if err != nil {
+			continue
+		}
+		players = append(players, uuid.UUID(a.uuid(u[:])).String())
+	}
+	m.Players = players
+	m.ServerName, m.CustomServerName = a.serverName, ""
+}
+
+// uuid returns the pseudonymous UUID of u, a random-looking version 4 UUID
+// derived from u and the key.
+func (a *anonymizer) uuid(u []byte) [16]byte {
+	var k [16]byte
+	copy(k[:], u)
+	if v, ok := a.ids[k]; ok {
+		return v
+	}
+	h := hmac.New(sha256.New, a.key)
+	h.Write(k[:])
+	var v [16]byte
+	copy(v[:], h.Sum(nil))
+	v[6] = v[6]&0x0f | 0x40
+	v[8] = v[8]&0x3f | 0x80
+	a.ids[k] = v
+	return v
+}
+
+// player returns the pseudonym of the player with UUID u, named name.
+func (a *anonymizer) player(u []byte, name string) string {
+	var k [16]byte
+	copy(k[:], u)
+	if p, ok := a.players[k]; ok {
+		return p
+	}
+	p := fmt.Sprintf("Player%d", len(a.players)+1)
+	a.players[k] = p
+	a.names[name] = true
+	return p
+}
+
+// level returns the name of a dimension in the copy: vanilla dimensions keep
+// theirs, those of the server are numbered.
+func (a *anonymizer) level(name string) string {
+	if strings.HasPrefix(name, "minecraft:") {
+		return name
+	}
+	if l, ok := a.levels[name]; ok {
+		return l
+	}
+	l := fmt.Sprintf("published:level%d", len(a.levels)+1)
+	a.levels[name] = l
+	return l
+}
+
+// movePos moves a block position (x:26 z:26 y:12 bits).
+func (a *anonymizer) movePos(v int64) int64 {
+	x, z, y := v>>38, v<<26>>38, v<<52>>52
+	x += int64(a.dx) * 16
+	z += int64(a.dz) * 16
+	return (x&0x3ffffff)<<38 | (z&0x3ffffff)<<12 | y&0xfff
+}
+
+// moveChunk moves a chunk position (z in the upper, x in the lower half).
+func (a *anonymizer) moveChunk(v int64) int64 {
+	x, z := int32(v)+a.dx, int32(v>>32)+a.dz
+	return int64(z)<<32 | int64(uint32(x))
+}
+
+// moveSection moves a section position (x:22 z:22 y:20 bits).
+func (a *anonymizer) moveSection(v int64) int64 {
+	x, z, y := v>>42, v<<22>>42, v<<44>>44
+	x += int64(a.dx)
+	z += int64(a.dz)
+	return (x&0x3fffff)<<42 | (z&0x3fffff)<<20 | y&0xfffff
+}
+
+// editor copies a payload while a decoder walks it, replacing some of the
+// fields read; the fields not replaced and whatever is left unread are
+// copied as they are.
+type editor struct {
+	p    []byte
+	d    *wire.Decoder
+	done int // bytes of p copied to out or replaced
+	out  []byte
+}
+
+func newEditor(p []byte) *editor {
+	return &editor{p: p, d: wire.NewDecoder(p), out: make([]byte, 0, len(p))}
+}
+
+// pos returns the decoder's offset in p.
+func (e *editor) pos() int {
+	return len(e.p) - len(e.d.B)
+}
+
+// replace replaces the fields read by f with what f appends to out.
+func (e *editor) replace(f func(out []byte) []byte) {
+	e.out = append(e.out, e.p[e.done:e.pos()]...)
+	e.out = f(e.out)
+	e.done = e.pos()
+}
+
+// cut leaves out the fields from offset start up to the decoder's position.
+func (e *editor) cut(start int) {
+	e.out = append(e.out, e.p[e.done:start]...)
+	e.done = e.pos()
+}
+
+// finish returns the edited payload.
+func (e *editor) finish() ([]byte, error) {
+	if e.d.Err != nil {
+		return nil, e.d.Err
+	}
+	return append(e.out, e.p[e.done:]...), nil
+}
+
+// end returns the edited payload up to offset start, followed by tail.
+func (e *editor) end(start int, tail ...byte) ([]byte, error) {
+	if e.d.Err != nil {
+		return nil, e.d.Err
+	}
+	return append(append(e.out, e.p[e.done:start]...), tail...), nil
+}
+
+// uuid replaces a UUID with its pseudonym and returns the original.
+func (e *editor) uuid(a *anonymizer) []byte {
+	var orig []byte
+	e.replace(func(b []byte) []byte {
+		orig = e.d.Raw(16)
+		v := a.uuid(orig)
+		return append(b, v[:]...)
+	})
+	return orig
+}
+
+// x and z move a double coordinate.
+func (e *editor) x(a *anonymizer) { e.double(float64(a.dx) * 16) }
+func (e *editor) z(a *anonymizer) { e.double(float64(a.dz) * 16) }
+
+// xyz moves the doubles x, y, z.
+func (e *editor) xyz(a *anonymizer) {
+	e.x(a)
+	e.d.Double()
+	e.z(a)
+}
+
+func (e *editor) double(delta float64) {
+	e.replace(func(b []byte) []byte {
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(e.d.Double()+delta))
+	})
+}
+
+// int adds delta to an int.
+func (e *editor) int(delta int32) {
+	e.replace(func(b []byte) []byte {
+		return binary.BigEndian.AppendUint32(b, uint32(e.d.Int()+delta))
+	})
+}
+
+// varInt adds delta to a VarInt.
+func (e *editor) varInt(delta int32) {
+	e.replace(func(b []byte) []byte {
+		return tmcpr.AppendVarInt(b, e.d.VarInt()+delta)
+	})
+}
+
+// long replaces a long v with f(v).
+func (e *editor) long(f func(int64) int64) {
+	e.replace(func(b []byte) []byte {
+		return binary.BigEndian.AppendUint64(b, uint64(f(e.d.Long())))
+	})
+}
+
+// position moves a block position.
+func (e *editor) position(a *anonymizer) {
+	e.long(a.movePos)
+}
+
+// level renames a dimension, see anonymizer.level.
+func (e *editor) level(a *anonymizer) {
+	e.replace(func(b []byte) []byte {
+		return appendString(b, a.level(e.d.String()))
+	})
+}
+
+// clearNBT replaces an NBT tag with an absent one.
+func (e *editor) clearNBT() {
+	e.replace(func(b []byte) []byte {
+		e.d.NBT(true)
+		return append(b, 0)
+	})
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(tmcpr.AppendVarInt(b, int32(len(s))), s...)
+}
@@ -0,0 +1,260 @@
+// Package publish makes share-safe copies of replays. One call scrubs the
+// players' identities, moves the world to other coordinates, removes chat
+// and everything else carrying free text, watermarks the copy, renders its
+// thumbnail and validates the result, so that a replay can be posted
+// publicly without revealing who played, where, or on which server.
+//
+// The rules are vetted per protocol: every packet type is kept as it is,
+// rewritten or dropped, and types the profile does not list are dropped, so
+// nothing it was not written for can leak. Publish fails for protocols
+// without a profile; there is one for 764 (Minecraft 1.20.2).
+//
+// The copy keeps the terrain and builds, entities and their movement,
+// sounds, the world border and the time of day. Players get pseudonyms
+// ("Player1", ...), unrelated UUIDs and default skins. Chat, titles, boss
+// bars, scoreboards, teams, the tab list's texts, particles and maps are
+// dropped; sign text, banner patterns, head owners and other block entity
+// data, item names and enchantments, custom entity names, markers' names
+// and camera paths are removed. Anything else the server wrote into the
+// world, such as text built from blocks, stays.
+package publish
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/thumbnail"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// ErrUnsupported is returned for replays of protocols without a profile.
+var ErrUnsupported = errors.New("publish: protocol not supported")
+
+// Tag is added to the tags of published copies (see mcpr.ExtMeta), whose
+// other tags are removed.
+const Tag = "published"
+
+// Options control Publish. Zero values select the defaults.
+type Options struct {
+	// Offset moves the world by this many chunks on X and Z. Nil picks a
+	// random offset of 1,000 to 20,000 chunks in each direction.
+	Offset *[2]int32
+
+	// Key derives the players' UUIDs in the copy. Nil picks a random key, so
+	// that copies cannot be linked to each other; copies published with the
+	// same key give each player the same UUID.
+	Key []byte
+
+	// Watermark names a marker at the start of the copy, which ReplayMod
+	// shows on its timeline, e.g. "example.org, CC BY 4.0".
+	Watermark string
+
+	// ServerName is the server named in the copy's metadata; by default
+	// none is.
+	ServerName string
+
+	// NoThumbnail leaves the copy without thumbnail instead of rendering a
+	// map of its terrain (see package thumbnail). The source's thumbnail,
+	// a screenshot that may show names, is never carried over.
+	NoThumbnail bool
+
+	// StartInPlay is set for recordings captured after login, see
+	// transform.Options.
+	StartInPlay bool
+}
+
+// Report describes a published copy.
+type Report struct {
+	Offset     [2]int32 // blocks added to X and Z
+	Players    int      // players given pseudonyms
+	PacketsIn  int64
+	PacketsOut int64
+	Dropped    map[string]int64 // packets dropped by the profile, by name
+	Malformed  int64            // packets dropped because they could not be parsed
+	Thumbnail  bool             // whether a thumbnail was rendered
+	Validation *mcpr.Validation // of the copy
+}
+
+// Publish writes a share-safe copy of the replay at src to dst, as the
+// package describes. The copy starts a new processing log and does not
+// name src (see transform.Options.NewHistory); its other entries, such as
+// annotations and assets, are not carried over.
+//
+// Once written, the copy is validated and searched for the players' UUIDs
+// and names and the server's name. If one is found, the copy is removed and
+// Publish fails: the profile missed a packet and the copy is not safe. Names
+// shorter than five characters are not searched for, as they occur by
+// chance in chunk data.
+func Publish(src, dst string, opts Options) (*Report, error) {
+	r, err := mcpr.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	meta := r.Meta
+	markers, err := r.Markers()
+	_ = r.Close()
+	if err != nil {
+		return nil, err
+	}
+	prof := profiles[meta.Protocol]
+	if prof == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, meta.Protocol)
+	}
+
+	key := opts.Key
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	var offset [2]int32
+	if opts.Offset != nil {
+		offset = *opts.Offset
+	} else if offset, err = randomOffset(); err != nil {
+		return nil, err
+	}
+	a := newAnonymizer(prof, key, offset, opts.ServerName)
+	rep := &Report{Offset: [2]int32{offset[0] * 16, offset[1] * 16}}
+
+	var thumb []byte
+	if !opts.NoThumbnail {
+		// The terrain is the same at any offset; a replay without chunks
+		// simply has no thumbnail
+		if thumb, err = thumbnail.Render(src, thumbnail.Options{}); err == nil {
+			rep.Thumbnail = true
+		}
+	}
+	out := []mcpr.Marker{}
+	if opts.Watermark != "" {
+		out = append(out, mcpr.Marker{Name: opts.Watermark})
+	}
+	for _, m := range markers {
+		m.Name = ""
+		if m.Position != nil {
+			pos := *m.Position
+			pos.X += float64(rep.Offset[0])
+			pos.Z += float64(rep.Offset[1])
+			m.Position = &pos
+		}
+		out = append(out, m)
+	}
+
+	p, _ := transform.ParsePipeline("")
+	p.Append("publish", func(env transform.Env, _ transform.Args) (transform.Stage, error) {
+		if env.Table == nil {
+			return nil, fmt.Errorf("%w: no packet table for protocol %d", ErrUnsupported, env.Meta.Protocol)
+		}
+		a.table = env.Table
+		return a, nil
+	})
+	stats, err := transform.RewriteFile(src, dst, p, transform.Options{
+		StartInPlay: opts.StartInPlay,
+		Entries:     func(string) bool { return false },
+		Markers:     out,
+		Timelines:   map[string]mcpr.Timeline{},
+		Thumbnail:   thumb,
+		Tags:        []string{Tag},
+		Operation:   "publish",
+		NewHistory:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rep.PacketsIn, rep.PacketsOut = stats.PacketsIn, stats.PacketsOut
+	rep.Players, rep.Dropped, rep.Malformed = len(a.players), a.dropped, a.malformed
+
+	if rep.Validation, err = mcpr.ValidatePath(dst); err != nil {
+		return nil, err
+	}
+	if err := checkLeaks(dst, secrets(a, meta)); err != nil {
+		_ = os.Remove(dst)
+		_ = os.Remove(mcpr.SidecarPath(dst))
+		return nil, err
+	}
+	return rep, nil
+}
+
+// randomOffset returns a random offset in chunks, see Options.Offset.
+func randomOffset() ([2]int32, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return [2]int32{}, err
+	}
+	var o [2]int32
+	for i := range o {
+		v := binary.BigEndian.Uint32(b[4*i:])
+		o[i] = 1000 + int32(v>>1%19001)
+		if v&1 != 0 {
+			o[i] = -o[i]
+		}
+	}
+	return o, nil
+}
+
+// secrets returns what a published copy must not contain, with a
+// description of each.
+func secrets(a *anonymizer, meta mcpr.Meta) map[string]string {
+	pseudonyms := map[string]bool{}
+	for _, p := range a.players {
+		pseudonyms[p] = true
+	}
+	s := map[string]string{}
+	for k := range a.players {
+		u := uuid.UUID(k)
+		s[string(k[:])] = "the UUID " + u.String()
+		s[u.String()] = "the UUID " + u.String()
+	}
+	for _, p := range meta.Players {
+		if u, err := uuid.Parse(p); err == nil {
+			s[string(u[:])] = "the UUID " + u.String()
+		}
+	}
+	for n := range a.names {
+		if len(n) >= 5 && !pseudonyms[n] {
+			s[n] = fmt.Sprintf("the player name %q", n)
+		}
+	}
+	for _, n := range []string{meta.ServerName, meta.CustomServerName} {
+		if len(n) >= 5 {
+			s[n] = fmt.Sprintf("the server name %q", n)
+		}
+	}
+	return s
+}
+
+// checkLeaks searches the packets of the replay at path for secrets.
+func checkLeaks(path string, secrets map[string]string) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+	r, err := mcpr.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := r.SetPacketNames(true); err != nil {
+		return err
+	}
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for s, desc := range secrets {
+			if bytes.Contains(p.Payload, []byte(s)) {
+				return fmt.Errorf("publish: %s still appears in the copy, in a %s packet at %d ms; the copy is not safe and was removed", desc, p.Name, p.Time)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/nbt"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+var (
+	alice      = uuid.MustParse("5b1f6a8e-7c3d-4e2a-9f10-0a1b2c3d4e5f")
+	aliceName  = "AliceTheBuilder"
+	serverName = "secret.example.org"
+)
+
+// id returns the play-state id of a clientbound packet of protocol 764.
+func id(t *testing.T, name string) int32 {
+	t.Helper()
+	tab, _ := protocol.Lookup(764)
+	v, ok := tab.ID(protocol.Clientbound, protocol.Play, name)
+	if !ok {
+		t.Fatalf("no packet %s", name)
+	}
+	return v
+}
+
+func appendDouble(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// writeFixture writes a protocol 764 replay starting in the play state, in
+// which alice joins, chats, is spawned at (100, 64, -50), teleported to
+// (10, 70, 20) and writes her name on a sign at (3, 64, 5); extra packets
+// follow as they are.
+func writeFixture(t *testing.T, path string, protocolVersion int, extra ...[]byte) {
+	t.Helper()
+	w, err := mcpr.Create(path, mcpr.Meta{
+		Protocol:   protocolVersion,
+		ServerName: serverName,
+		Players:    []string{alice.String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(ms uint32, name string, p []byte) {
+		if err := w.WritePacket(ms, id(t, name), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Name with a skin property
+	info := []byte{0x01, 1}
+	info = append(info, alice[:]...)
+	info = appendString(info, aliceName)
+	info = append(info, 1)
+	info = appendString(info, "textures")
+	info = appendString(info, "skin of "+aliceName)
+	info = append(info, 0)
+	write(0, "PlayerInfoUpdate", info)
+
+	write(100, "SystemChat", append(appendString(nil, aliceName+" joined the game"), 0))
+
+	spawn := tmcpr.AppendVarInt(nil, 7)
+	spawn = append(spawn, alice[:]...)
+	spawn = tmcpr.AppendVarInt(spawn, 122)
+	spawn = appendDouble(appendDouble(appendDouble(spawn, 100), 64), -50)
+	spawn = append(spawn, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	write(200, "AddEntity", spawn)
+
+	pos := appendDouble(appendDouble(appendDouble(nil, 10), 70), 20)
+	pos = append(pos, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1)
+	write(300, "PlayerPosition", pos)
+
+	var text bytes.Buffer
+	err = nbt.Encode(&text, "", map[string]any{
+		"front_text": map[string]any{
+			"messages": []any{`"` + aliceName + ` was here"`, `""`, `""`, `""`},
+		},
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := binary.BigEndian.AppendUint64(nil, uint64(3)<<38|uint64(5)<<12|64)
+	sign = tmcpr.AppendVarInt(sign, 7)
+	sign = append(sign, text.Bytes()...)
+	write(400, "BlockEntityData", sign)
+
+	for i, p := range extra {
+		write(uint32(500+i*100), "Animate", p)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	writeFixture(t, src, 764)
+
+	rep, err := Publish(src, dst, Options{
+		Offset:      &[2]int32{1000, -2000},
+		NoThumbnail: true,
+		StartInPlay: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [2]int32{16000, -32000}; rep.Offset != want {
+		t.Errorf("offset = %v, want %v", rep.Offset, want)
+	}
+	if rep.Players != 1 {
+		t.Errorf("players = %d, want 1", rep.Players)
+	}
+	if rep.Dropped["SystemChat"] != 1 {
+		t.Errorf("dropped = %v, want one SystemChat", rep.Dropped)
+	}
+
+	// Publish has run checkLeaks with what the anonymizer saw; search again
+	// for everything the fixture holds
+	err = checkLeaks(dst, map[string]string{
+		string(alice[:]): "alice's UUID",
+		alice.String():   "alice's UUID string",
+		aliceName:        "alice's name",
+		serverName:       "the server's name",
+		"skin of":        "alice's skin",
+		"was here":       "the sign's text",
+		"joined":         "the chat",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := mcpr.ReadMeta(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ServerName != "" || len(meta.Players) != 1 || meta.Players[0] == alice.String() {
+		t.Errorf("meta server = %q, players = %v; want no server and a pseudonymous player", meta.ServerName, meta.Players)
+	}
+
+	r, err := mcpr.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.SetPacketNames(true); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[p.Name] = true
+		switch p.Name {
+		case "PlayerInfoUpdate":
+			if !bytes.Contains(p.Payload, []byte("Player1")) {
+				t.Errorf("PlayerInfoUpdate %x has no pseudonym", p.Payload)
+			}
+		case "AddEntity":
+			// entity:varint uuid type:varint
+			xyz := p.Payload[1+16+1:]
+			checkXYZ(t, p.Name, xyz, 100+16000, 64, -50-32000)
+		case "PlayerPosition":
+			checkXYZ(t, p.Name, p.Payload, 10+16000, 70, 20-32000)
+		case "BlockEntityData":
+			v := int64(binary.BigEndian.Uint64(p.Payload))
+			x, z, y := v>>38, v<<26>>38, v<<52>>52
+			if x != 3+16000 || y != 64 || z != 5-32000 {
+				t.Errorf("sign at %d %d %d, want %d 64 %d", x, y, z, 3+16000, 5-32000)
+			}
+		}
+	}
+	for _, name := range []string{"PlayerInfoUpdate", "AddEntity", "PlayerPosition", "BlockEntityData"} {
+		if !seen[name] {
+			t.Errorf("no %s in the copy", name)
+		}
+	}
+	if seen["SystemChat"] {
+		t.Error("chat in the copy")
+	}
+}
+
+func checkXYZ(t *testing.T, name string, p []byte, x, y, z float64) {
+	t.Helper()
+	var got [3]float64
+	for i := range got {
+		got[i] = math.Float64frombits(binary.BigEndian.Uint64(p[8*i:]))
+	}
+	if want := [3]float64{x, y, z}; got != want {
+		t.Errorf("%s at %v, want %v", name, got, want)
+	}
+}
+
+func TestPublishUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	w, err := mcpr.Create(src, mcpr.Meta{Protocol: 47})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Publish(src, dst, Options{NoThumbnail: true})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("err = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("stat copy: %v, want not exist", err)
+	}
+}
+
+func TestPublishLeak(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	// Animate is kept as it is, so the profile cannot scrub a name in it
+	writeFixture(t, src, 764, append([]byte{7}, aliceName...))
+
+	_, err := Publish(src, dst, Options{NoThumbnail: true, StartInPlay: true})
+	if err == nil || !strings.Contains(err.Error(), aliceName) {
+		t.Fatalf("err = %v, want a leak of %q", err, aliceName)
+	}
+	for _, path := range []string{dst, mcpr.SidecarPath(dst)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("stat %s: %v, want not exist", filepath.Base(path), err)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package publish
+
+import (
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// profile764 is the profile of protocol 764 (Minecraft 1.20.2). Among the
+// packets dropped: chat, titles, boss bars, scoreboards, teams, the tab
+// list's texts, server data and brand, commands, recipes, advancements,
+// statistics, screens, books, maps and particles, whose data can hold
+// items and block positions.
+var profile764 = profile{
+	protocol.Login: {
+		"GameProfile":      gameProfile764,
+		"LoginCompression": nil,
+	},
+	protocol.Configuration: {
+		"FinishConfiguration":   nil,
+		"KeepAlive":             nil,
+		"Ping":                  nil,
+		"RegistryData":          nil,
+		"UpdateEnabledFeatures": nil,
+		"UpdateTags":            nil,
+	},
+	protocol.Play: {
+		"AddEntity":                addEntity764,
+		"AddExperienceOrb":         addExperienceOrb764,
+		"Animate":                  nil,
+		"BlockChangedAck":          nil,
+		"BlockDestruction":         blockDestruction764,
+		"BlockEntityData":          blockEntityData764,
+		"BlockEvent":               blockPos764,
+		"BlockUpdate":              blockPos764,
+		"BundleDelimiter":          nil,
+		"ChangeDifficulty":         nil,
+		"ChunkBatchFinished":       nil,
+		"ChunkBatchStart":          nil,
+		"ChunksBiomes":             chunksBiomes764,
+		"ContainerClose":           nil,
+		"ContainerSetContent":      containerSetContent764,
+		"ContainerSetData":         nil,
+		"ContainerSetSlot":         containerSetSlot764,
+		"Cooldown":                 nil,
+		"DamageEvent":              damageEvent764,
+		"EntityEvent":              nil,
+		"Explode":                  xyz764,
+		"ForgetLevelChunk":         forgetLevelChunk764,
+		"GameEvent":                nil,
+		"HurtAnimation":            nil,
+		"InitializeBorder":         borderCenter764,
+		"KeepAlive":                nil,
+		"LevelChunkWithLight":      levelChunk764,
+		"LevelEvent":               levelEvent764,
+		"LightUpdate":              lightUpdate764,
+		"Login":                    login764,
+		"MoveEntityPos":            nil,
+		"MoveEntityPosRot":         nil,
+		"MoveEntityRot":            nil,
+		"MoveVehicle":              xyz764,
+		"Ping":                     nil,
+		"PlayerAbilities":          nil,
+		"PlayerCombatEnd":          nil,
+		"PlayerCombatEnter":        nil,
+		"PlayerInfoRemove":         playerInfoRemove764,
+		"PlayerInfoUpdate":         playerInfoUpdate764,
+		"PlayerLookAt":             playerLookAt764,
+		"PlayerPosition":           playerPosition764,
+		"PongResponse":             nil,
+		"RemoveEntities":           nil,
+		"RemoveMobEffect":          nil,
+		"Respawn":                  respawn764,
+		"RotateHead":               nil,
+		"SectionBlocksUpdate":      sectionBlocksUpdate764,
+		"SetBorderCenter":          borderCenter764,
+		"SetBorderLerpSize":        nil,
+		"SetBorderSize":            nil,
+		"SetBorderWarningDelay":    nil,
+		"SetBorderWarningDistance": nil,
+		"SetCamera":                nil,
+		"SetCarriedItem":           nil,
+		"SetChunkCacheCenter":      chunkCacheCenter764,
+		"SetChunkCacheRadius":      nil,
+		"SetDefaultSpawnPosition":  blockPos764,
+		"SetEntityData":            entityData764,
+		"SetEntityLink":            nil,
+		"SetEntityMotion":          nil,
+		"SetEquipment":             setEquipment764,
+		"SetExperience":            nil,
+		"SetHealth":                nil,
+		"SetPassengers":            nil,
+		"SetSimulationDistance":    nil,
+		"SetTime":                  nil,
+		"Sound":                    sound764,
+		"SoundEntity":              nil,
+		"StartConfiguration":       nil,
+		"StopSound":                nil,
+		"TakeItemEntity":           nil,
+		"TeleportEntity":           teleportEntity764,
+		"UpdateAttributes":         nil,
+		"UpdateMobEffect":          nil,
+		"UpdateTags":               nil,
+	},
+}
+
+// GameProfile: uuid name:string properties:varint×(name:string value:string
+// signed:bool [signature:string])
+//
+// The properties hold the skin, which identifies the player as well.
+func gameProfile764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	u := e.uuid(a)
+	e.replace(func(b []byte) []byte { return appendString(b, a.player(u, e.d.String())) })
+	e.replace(func(b []byte) []byte {
+		skipProperties764(e.d)
+		return append(b, 0)
+	})
+	return e.finish()
+}
+
+func skipProperties764(d *wire.Decoder) {
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		_ = d.String()
+		_ = d.String()
+		if d.Bool() {
+			_ = d.String()
+		}
+	}
+}
+
+// PlayerInfoUpdate: actions:byte count:varint, then per player uuid and,
+// for each action bit in order: 0x01 name:string properties:varint×(name:string
+// value:string signed:bool [signature:string]); 0x02 chat session:bool
+// [session:uuid expiry:long key:bytes signature:bytes]; 0x04 game mode:varint;
+// 0x08 listed:bool; 0x10 latency:varint; 0x20 display name:bool [chat]
+//
+// Names become pseudonyms; skins, chat sessions (whose key identifies the
+// player) and display names are removed.
+func playerInfoUpdate764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	actions := e.d.Byte()
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		u := e.uuid(a)
+		if actions&0x01 != 0 {
+			e.replace(func(b []byte) []byte { return appendString(b, a.player(u, e.d.String())) })
+			e.replace(func(b []byte) []byte {
+				skipProperties764(e.d)
+				return append(b, 0)
+			})
+		}
+		if actions&0x02 != 0 {
+			e.replace(func(b []byte) []byte {
+				if e.d.Bool() {
+					e.d.Skip(16 + 8)
+					e.d.ByteArray()
+					e.d.ByteArray()
+				}
+				return append(b, 0)
+			})
+		}
+		if actions&0x04 != 0 {
+			e.d.VarInt()
+		}
+		if actions&0x08 != 0 {
+			e.d.Bool()
+		}
+		if actions&0x10 != 0 {
+			e.d.VarInt()
+		}
+		if actions&0x20 != 0 {
+			e.replace(func(b []byte) []byte {
+				if e.d.Bool() {
+					_ = e.d.String()
+				}
+				return append(b, 0)
+			})
+		}
+	}
+	return e.finish()
+}
+
+// PlayerInfoRemove: count:varint uuid×count
+func playerInfoRemove764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		e.uuid(a)
+	}
+	return e.finish()
+}
+
+// Login (play): entity:int hardcore:bool dimensions:varint×string
+// maxPlayers:varint view:varint simulation:varint reducedDebug:bool
+// respawnScreen:bool limitedCrafting:bool dimensionType:string, then as
+// Respawn after its dimension type
+func login764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.Int()
+	e.d.Bool()
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		e.level(a)
+	}
+	e.d.VarInt()
+	e.d.VarInt()
+	e.d.VarInt()
+	e.d.Skip(3)
+	_ = e.d.String()
+	spawn764(a, e)
+	return e.finish()
+}
+
+// Respawn: dimensionType:string dimension:string hashedSeed:long
+// gameMode:byte previousGameMode:byte debug:bool flat:bool death:bool
+// [dimension:string position] portalCooldown:varint dataKept:byte
+func respawn764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	_ = e.d.String()
+	spawn764(a, e)
+	return e.finish()
+}
+
+// spawn764 rewrites the fields Login and Respawn share. The hashed seed,
+// which identifies the world, is zeroed; it only seeds biome blending.
+func spawn764(a *anonymizer, e *editor) {
+	e.level(a)
+	e.long(func(int64) int64 { return 0 })
+	e.d.Skip(4)
+	if e.d.Bool() {
+		e.level(a)
+		e.position(a)
+	}
+}
+
+// AddEntity: entity:varint uuid type:varint x:double y:double z:double ...
+func addEntity764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.VarInt()
+	e.uuid(a)
+	e.d.VarInt()
+	e.xyz(a)
+	return e.finish()
+}
+
+// AddExperienceOrb, TeleportEntity: entity:varint x:double y:double z:double ...
+func addExperienceOrb764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.VarInt()
+	e.xyz(a)
+	return e.finish()
+}
+
+func teleportEntity764(a *anonymizer, p []byte) ([]byte, error) {
+	return addExperienceOrb764(a, p)
+}
+
+// PlayerLookAt: anchor:varint x:double y:double z:double ...
+func playerLookAt764(a *anonymizer, p []byte) ([]byte, error) {
+	return addExperienceOrb764(a, p)
+}
+
+// Explode, MoveVehicle: x:double y:double z:double ...
+func xyz764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.xyz(a)
+	return e.finish()
+}
+
+// PlayerPosition: x:double y:double z:double yaw:float pitch:float
+// relative:byte teleport:varint; relative coordinates (flags 0x01, 0x04)
+// stay as they are.
+func playerPosition764(a *anonymizer, p []byte) ([]byte, error) {
+	d := wire.NewDecoder(p)
+	d.Skip(3*8 + 2*4)
+	relative := d.Byte()
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	e := newEditor(p)
+	if relative&0x01 == 0 {
+		e.x(a)
+	} else {
+		e.d.Double()
+	}
+	e.d.Double()
+	if relative&0x04 == 0 {
+		e.z(a)
+	}
+	return e.finish()
+}
+
+// DamageEvent: entity:varint type:varint cause:varint direct:varint
+// source:bool [x:double y:double z:double]
+func damageEvent764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	for i := 0; i < 4; i++ {
+		e.d.VarInt()
+	}
+	if e.d.Bool() {
+		e.xyz(a)
+	}
+	return e.finish()
+}
+
+// InitializeBorder, SetBorderCenter: x:double z:double ...
+func borderCenter764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.x(a)
+	e.z(a)
+	return e.finish()
+}
+
+// BlockEvent, BlockUpdate, SetDefaultSpawnPosition: position ...
+func blockPos764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.position(a)
+	return e.finish()
+}
+
+// BlockDestruction: entity:varint position stage:byte
+func blockDestruction764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.VarInt()
+	e.position(a)
+	return e.finish()
+}
+
+// LevelEvent: event:int position data:int global:bool
+func levelEvent764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.Int()
+	e.position(a)
+	return e.finish()
+}
+
+// BlockEntityData: position type:varint data:nbt
+//
+// The data (sign text, banner patterns, head owners, container names) is
+// removed.
+func blockEntityData764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.position(a)
+	e.d.VarInt()
+	e.clearNBT()
+	return e.finish()
+}
+
+// LevelChunkWithLight: x:int z:int heightmaps:nbt data:bytes
+// blockEntities:varint×(xz:byte y:short type:varint data:nbt) light...
+//
+// Block entity data is removed as for BlockEntityData.
+func levelChunk764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.int(a.dx)
+	e.int(a.dz)
+	e.d.NBT(true)
+	e.d.ByteArray()
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		e.d.Skip(3)
+		e.d.VarInt()
+		e.clearNBT()
+	}
+	return e.finish()
+}
+
+// ForgetLevelChunk: chunk:long
+func forgetLevelChunk764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.long(a.moveChunk)
+	return e.finish()
+}
+
+// ChunksBiomes: count:varint×(chunk:long data:bytes)
+func chunksBiomes764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		e.long(a.moveChunk)
+		e.d.ByteArray()
+	}
+	return e.finish()
+}
+
+// LightUpdate, SetChunkCacheCenter: x:varint z:varint ...
+func lightUpdate764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.varInt(a.dx)
+	e.varInt(a.dz)
+	return e.finish()
+}
+
+func chunkCacheCenter764(a *anonymizer, p []byte) ([]byte, error) {
+	return lightUpdate764(a, p)
+}
+
+// SectionBlocksUpdate: section:long blocks:varint×varlong
+func sectionBlocksUpdate764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.long(a.moveSection)
+	return e.finish()
+}
+
+// Sound: sound:varint(id+1, 0 followed by name:string range:bool [float])
+// source:varint x:int y:int z:int (×8) ...
+func sound764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	if e.d.VarInt() == 0 {
+		_ = e.d.String()
+		if e.d.Bool() {
+			e.d.Float()
+		}
+	}
+	e.d.VarInt()
+	e.int(a.dx * 16 * 8)
+	e.d.Int()
+	e.int(a.dz * 16 * 8)
+	return e.finish()
+}
+
+// ContainerSetContent: window:byte state:varint items:varint×slot carried:slot
+func containerSetContent764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.Byte()
+	e.d.VarInt()
+	for n := e.d.VarInt(); n > 0 && e.d.Err == nil; n-- {
+		slot764(e)
+	}
+	slot764(e)
+	return e.finish()
+}
+
+// ContainerSetSlot: window:byte state:varint index:short slot
+func containerSetSlot764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.Byte()
+	e.d.VarInt()
+	e.d.Short()
+	slot764(e)
+	return e.finish()
+}
+
+// SetEquipment: entity:varint, then slot:byte (0x80: more follow) item:slot
+func setEquipment764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.VarInt()
+	for e.d.Err == nil {
+		more := e.d.Byte()&0x80 != 0
+		slot764(e)
+		if !more {
+			break
+		}
+	}
+	return e.finish()
+}
+
+// slot764 reads an item stack, present:bool [item:varint count:byte
+// data:nbt], removing its data: names, lore, enchantments, book contents
+// and head owners.
+func slot764(e *editor) {
+	if e.d.Bool() {
+		e.d.VarInt()
+		e.d.Byte()
+		e.clearNBT()
+	}
+}
+
+// SetEntityData: entity:varint, then entries index:byte (0xff ends them)
+// type:varint value
+//
+// Custom names, text display contents and NBT values are left out, item
+// stacks lose their data, owner UUIDs become pseudonyms and positions are
+// moved. Particle values have a length that depends on the particle; they
+// and the entries after them are left out.
+func entityData764(a *anonymizer, p []byte) ([]byte, error) {
+	e := newEditor(p)
+	e.d.VarInt()
+	for e.d.Err == nil {
+		start := e.pos()
+		if e.d.Byte() == 0xff {
+			break
+		}
+		switch typ := e.d.VarInt(); typ {
+		case 0: // byte
+			e.d.Byte()
+		case 1, 12, 14, 15, 19, 20, 21, 22, 24, 25: // varint, direction, block state, pose, variants...
+			e.d.VarInt()
+		case 2: // varlong
+			e.d.VarLong()
+		case 3: // float
+			e.d.Float()
+		case 4: // string
+			_ = e.d.String()
+		case 5: // component
+			_ = e.d.String()
+			e.cut(start)
+		case 6: // optional component
+			if e.d.Bool() {
+				_ = e.d.String()
+			}
+			e.cut(start)
+		case 7: // item stack
+			slot764(e)
+		case 8: // boolean
+			e.d.Bool()
+		case 9, 26: // rotations, vector
+			e.d.Skip(12)
+		case 10: // block position
+			e.position(a)
+		case 11: // optional block position
+			if e.d.Bool() {
+				e.position(a)
+			}
+		case 13: // optional UUID
+			if e.d.Bool() {
+				e.uuid(a)
+			}
+		case 16: // NBT
+			e.d.NBT(true)
+			e.cut(start)
+		case 18: // villager data
+			e.d.VarInt()
+			e.d.VarInt()
+			e.d.VarInt()
+		case 23: // optional global position
+			if e.d.Bool() {
+				e.level(a)
+				e.position(a)
+			}
+		case 27: // quaternion
+			e.d.Skip(16)
+		default: // particle, unknown
+			return e.end(start, 0xff)
+		}
+	}
+	return e.finish()
+}
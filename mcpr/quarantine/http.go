@@ -0,0 +1,118 @@
+package quarantine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler serves the quarantine as a JSON API, relative to where it is
+// mounted (use http.StripPrefix):
+//
+//	GET    /             list the reports, oldest first
+//	GET    /NAME         the report of NAME
+//	POST   /NAME/retry   retry NAME: 200 with {"path": ...} if it passed,
+//	                     422 with the updated report if not
+//	DELETE /NAME         delete NAME and its report
+//
+// It has no authentication of its own; wrap it or bind it to a private
+// network.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(s.serveHTTP)
+}
+
+func (s *Store) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	name, action, _ := strings.Cut(path, "/")
+	switch {
+	case name == "" && req.Method == http.MethodGet:
+		reports, err := s.List()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		if reports == nil {
+			reports = []Report{}
+		}
+		writeJSON(w, http.StatusOK, reports)
+	case name != "" && action == "" && req.Method == http.MethodGet:
+		r, err := s.Get(name)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, r)
+	case name != "" && action == "" && req.Method == http.MethodDelete:
+		if err := s.Delete(name); err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case name != "" && action == "retry" && req.Method == http.MethodPost:
+		dst, r, err := s.Retry(name)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, map[string]string{"path": dst})
+		case errors.Is(err, ErrStillInvalid):
+			writeJSON(w, http.StatusUnprocessableEntity, r)
+		default:
+			httpError(w, err)
+		}
+	case name == "" || action == "" || action == "retry":
+		w.Header().Set("Allow", allowed(name, action))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func allowed(name, action string) string {
+	switch {
+	case name == "":
+		return http.MethodGet
+	case action == "":
+		return http.MethodGet + ", " + http.MethodDelete
+	}
+	return http.MethodPost
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Webhook returns a Notify function that POSTs each report as JSON to url,
+// e.g. an alerting or chat-ops endpoint. Failures are logged through the
+// Store's Logf, not retried.
+func (s *Store) Webhook(url string) func(Report) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(r Report) {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("%s", resp.Status)
+			}
+		}
+		if err != nil {
+			s.logf("quarantine: notify %s about %s: %v", url, r.Name, err)
+		}
+	}
+}
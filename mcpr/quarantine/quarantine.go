@@ -0,0 +1,347 @@
+// Package quarantine keeps replays that fail validation aside instead of
+// rejecting them silently, for services that ingest uploaded replays. Each
+// quarantined replay is stored next to a JSON report of why it failed;
+// operators list, retry and delete them through Store or its HTTP API (see
+// Handler), and Notify tells them when something lands in quarantine.
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// ReportSuffix is appended to a quarantined replay's name for its report.
+const ReportSuffix = ".report.json"
+
+// Report describes a quarantined replay.
+type Report struct {
+	Name     string    `json:"name"`   // file name in the quarantine directory
+	Source   string    `json:"source"` // where the replay came from, e.g. its upload path
+	Size     int64     `json:"size"`
+	Time     time.Time `json:"time"`  // when it was quarantined
+	Error    string    `json:"error"` // why validation failed
+	Warnings []string  `json:"warnings,omitempty"`
+	Retries  int       `json:"retries,omitempty"` // failed Retry calls
+}
+
+var (
+	// ErrNotFound is returned for names not in the quarantine.
+	ErrNotFound = errors.New("quarantine: no such replay")
+
+	// ErrStillInvalid is wrapped by the error of a Retry that failed
+	// validation again.
+	ErrStillInvalid = errors.New("quarantine: replay still invalid")
+)
+
+// Store is a quarantine directory. Its methods are safe for concurrent use.
+type Store struct {
+	Dir string
+
+	// Accepted is the directory replays that pass Retry are moved to; by
+	// default they go back to their Source path, to be ingested again, which
+	// must then be absolute.
+	Accepted string
+
+	// Notify, if set, is called with the report of every replay quarantined,
+	// by Check or Put once the replay is in place. The Store is not locked
+	// meanwhile, so Notify may use it.
+	Notify func(Report)
+
+	Logf func(format string, args ...any) // defaults to log.Printf
+
+	mu sync.Mutex
+}
+
+func (s *Store) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Check validates the replay at path (see mcpr.Validate). A replay that
+// fails is moved into the quarantine with its report, which Check returns
+// along with ok false; source names it in the report and defaults to the
+// absolute path.
+// err is only set if the replay could not be checked or moved.
+func (s *Store) Check(path, source string) (r Report, ok bool, err error) {
+	if source == "" {
+		source = absPath(path)
+	}
+	v, verr := validate(path)
+	if verr == nil {
+		return r, true, nil
+	}
+	r = Report{Source: source, Error: verr.Error()}
+	if v != nil {
+		r.Warnings = v.Warnings
+	}
+	r, err = s.put(path, r)
+	return r, false, err
+}
+
+// Put moves the replay at path into the quarantine with a report giving
+// reason, for replays rejected by checks other than validation.
+func (s *Store) Put(path, source string, reason error) (Report, error) {
+	if source == "" {
+		source = absPath(path)
+	}
+	return s.put(path, Report{Source: source, Error: reason.Error()})
+}
+
+func (s *Store) put(path string, r Report) (Report, error) {
+	r, err := s.move(path, r)
+	if err == nil && s.Notify != nil {
+		// Outside the lock: a notifier may take a while, e.g. a webhook, or
+		// call back into the Store
+		n := r
+		n.Warnings = append([]string(nil), r.Warnings...)
+		s.Notify(n)
+	}
+	return r, err
+}
+
+// move moves the replay at path into the quarantine with its report r.
+func (s *Store) move(path string, r Report) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return r, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return r, err
+	}
+	r.Name = s.freeName(filepath.Base(path))
+	r.Size = info.Size()
+	r.Time = time.Now().UTC()
+	if err := s.writeReport(r); err != nil {
+		return r, err
+	}
+	if err := moveFile(path, filepath.Join(s.Dir, r.Name)); err != nil {
+		_ = os.Remove(s.reportPath(r.Name))
+		return r, err
+	}
+	s.logf("quarantine: %s: %s", r.Source, r.Error)
+	return r, nil
+}
+
+// freeName returns base, or base with a number added, whichever is not taken.
+func (s *Store) freeName(base string) string {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := base
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(s.Dir, name)); errors.Is(err, fs.ErrNotExist) {
+			return name
+		}
+		name = stem + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// List returns the reports of all quarantined replays, oldest first.
+func (s *Store) List() ([]Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ents, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reports []Report
+	for _, e := range ents {
+		name, ok := strings.CutSuffix(e.Name(), ReportSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		r, err := s.report(name)
+		if err != nil {
+			s.logf("quarantine: %s: %v", e.Name(), err)
+			continue
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Time.Before(reports[j].Time) })
+	return reports, nil
+}
+
+// Get returns the report of the quarantined replay name.
+func (s *Store) Get(name string) (Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report(name)
+}
+
+// Retry validates the quarantined replay name again, e.g. after the rules
+// were relaxed or the file was repaired in place. If it passes it leaves the
+// quarantine for Accepted or its Source path, which Retry returns; otherwise
+// its report is updated and returned with an error wrapping ErrStillInvalid.
+func (s *Store) Retry(name string) (string, Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.report(name)
+	if err != nil {
+		return "", r, err
+	}
+	path := filepath.Join(s.Dir, name)
+	v, verr := validate(path)
+	if verr != nil {
+		r.Retries++
+		r.Error = verr.Error()
+		r.Warnings = nil
+		if v != nil {
+			r.Warnings = v.Warnings
+		}
+		if err := s.writeReport(r); err != nil {
+			return "", r, err
+		}
+		return "", r, fmt.Errorf("%w: %v", ErrStillInvalid, verr)
+	}
+	dst, err := s.destination(r)
+	if err != nil {
+		return "", r, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", r, err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return "", r, fmt.Errorf("quarantine: %s already exists", dst)
+	}
+	if err := moveFile(path, dst); err != nil {
+		return "", r, err
+	}
+	s.logf("quarantine: %s passed on retry, moved to %s", name, dst)
+	return dst, r, os.Remove(s.reportPath(name))
+}
+
+// destination returns where the replay of r goes when it passes Retry. The
+// Source of a report is whatever the caller gave Check or Put, so it is only
+// used as a path if it is an absolute one outside the quarantine.
+func (s *Store) destination(r Report) (string, error) {
+	if s.Accepted != "" {
+		base := filepath.Base(r.Source)
+		if base == "." || base == ".." || base == string(filepath.Separator) {
+			base = r.Name
+		}
+		return filepath.Join(s.Accepted, base), nil
+	}
+	src := filepath.Clean(r.Source)
+	if r.Source == "" || !filepath.IsAbs(src) {
+		return "", fmt.Errorf("quarantine: source %q of %s is not an absolute path; set Accepted", r.Source, r.Name)
+	}
+	if rel, err := filepath.Rel(absPath(s.Dir), src); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("quarantine: source %s of %s is inside the quarantine", src, r.Name)
+	}
+	return src, nil
+}
+
+// Delete removes the quarantined replay name and its report.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.report(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(s.reportPath(name))
+}
+
+func (s *Store) reportPath(name string) string {
+	return filepath.Join(s.Dir, name+ReportSuffix)
+}
+
+// report reads the report of name, which must be a plain file name.
+func (s *Store) report(name string) (Report, error) {
+	var r Report
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return r, ErrNotFound
+	}
+	b, err := os.ReadFile(s.reportPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, ErrNotFound
+	}
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, fmt.Errorf("parse %s%s: %w", name, ReportSuffix, err)
+	}
+	return r, nil
+}
+
+func (s *Store) writeReport(r Report) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.reportPath(r.Name) + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.reportPath(r.Name))
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// validate runs mcpr.Validate on the file at path.
+func validate(path string) (*mcpr.Validation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return mcpr.Validate(f, info.Size())
+}
+
+// moveFile renames src to dst, copying across file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
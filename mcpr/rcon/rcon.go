@@ -0,0 +1,241 @@
+// Package rcon implements the Source RCON protocol used by Minecraft servers
+// ("enable-rcon" in server.properties): a client for sending console commands
+// and a server so admin tooling that speaks RCON can control a recording
+// service the same way it controls the game server.
+package rcon
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet types. Auth responses and command requests share the value 2.
+const (
+	typeResponse = 0
+	typeCommand  = 2
+	typeAuthResp = 2
+	typeAuth     = 3
+)
+
+// maxBody is the longest body of a response packet; longer responses are
+// split. maxPacket bounds the size field of incoming packets.
+const (
+	maxBody   = 4096
+	maxPacket = maxBody + 10
+)
+
+// ErrAuth is returned by Dial when the server rejects the password.
+var ErrAuth = errors.New("rcon: authentication failed")
+
+type packet struct {
+	id   int32
+	typ  int32
+	body string
+}
+
+func writePacket(w io.Writer, p packet) error {
+	buf := make([]byte, 14+len(p.body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(10+len(p.body)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(p.id))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(p.typ))
+	copy(buf[12:], p.body) // followed by two NUL bytes
+	_, err := w.Write(buf)
+	return err
+}
+
+func readPacket(r io.Reader) (packet, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return packet{}, err
+	}
+	size := int32(binary.LittleEndian.Uint32(hdr[0:]))
+	if size < 10 || size > maxPacket {
+		return packet{}, fmt.Errorf("rcon: invalid packet size %d", size)
+	}
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{
+		id:   int32(binary.LittleEndian.Uint32(hdr[4:])),
+		typ:  int32(binary.LittleEndian.Uint32(hdr[8:])),
+		body: string(body[:len(body)-2]),
+	}, nil
+}
+
+// Client is an authenticated RCON connection. It is safe for concurrent use;
+// commands are sent one at a time.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	next int32
+}
+
+// Dial connects to addr and authenticates with password.
+func Dial(addr, password string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, next: 1}
+	if err := writePacket(conn, packet{id: c.next, typ: typeAuth, body: password}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// Some servers send an empty response before the auth result
+		if p.typ != typeAuthResp {
+			continue
+		}
+		if p.id == -1 {
+			conn.Close()
+			return nil, ErrAuth
+		}
+		return c, nil
+	}
+}
+
+// Command runs cmd and returns the server's response. Servers split
+// responses longer than maxBody into several packets; as the last one is not
+// marked, cmd is followed by a request of an unknown type, whose answer comes
+// after all of them.
+func (c *Client) Command(cmd string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, end := c.next+1, c.next+2
+	c.next = end
+	if err := writePacket(c.conn, packet{id: id, typ: typeCommand, body: cmd}); err != nil {
+		return "", err
+	}
+	if err := writePacket(c.conn, packet{id: end, typ: typeResponse}); err != nil {
+		return "", err
+	}
+	var resp strings.Builder
+	for {
+		p, err := readPacket(c.conn)
+		if err != nil {
+			return "", err
+		}
+		if p.id == end {
+			return resp.String(), nil
+		}
+		if p.id != id {
+			return "", fmt.Errorf("rcon: response id %d, want %d", p.id, id)
+		}
+		resp.WriteString(p.body)
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Server accepts RCON connections and passes authenticated commands to Handler.
+type Server struct {
+	Password string
+	Handler  func(cmd string) string
+
+	// Logf, if set, receives connection events. Defaults to log.Printf.
+	Logf func(format string, args ...any)
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// ListenAndServe listens on addr and serves until ctx is done.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if s.Password == "" {
+		return errors.New("rcon: empty password")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is done.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() { <-ctx.Done(); _ = ln.Close() }()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer stop()
+			if err := s.serveConn(conn); err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				s.logf("rcon %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	authed := false
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		switch {
+		case p.typ == typeAuth:
+			authed = p.body == s.Password
+			id := p.id
+			if !authed {
+				id = -1
+				s.logf("rcon %s: rejected password", conn.RemoteAddr())
+			}
+			if err := writePacket(conn, packet{id: id, typ: typeAuthResp}); err != nil {
+				return err
+			}
+		case !authed:
+			return errors.New("command before authentication")
+		case p.typ == typeCommand:
+			resp := s.Handler(p.body)
+			for {
+				n := min(len(resp), maxBody)
+				if err := writePacket(conn, packet{id: p.id, typ: typeResponse, body: resp[:n]}); err != nil {
+					return err
+				}
+				if resp = resp[n:]; resp == "" {
+					break
+				}
+			}
+		default:
+			// As the game server does; clients use it to find the end of a
+			// response split into several packets
+			if err := writePacket(conn, packet{id: p.id, typ: typeResponse, body: fmt.Sprintf("Unknown request %x", p.typ)}); err != nil {
+				return err
+			}
+		}
+	}
+}
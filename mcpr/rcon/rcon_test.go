@@ -0,0 +1,186 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeServer accepts one connection on a local port and runs serve on it,
+// returning the address to dial.
+func fakeServer(t *testing.T, serve func(conn net.Conn) error) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if err := serve(conn); err != nil {
+			t.Errorf("fake server: %v", err)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// auth answers the client's login like the game server: an empty response,
+// then the result.
+func auth(conn net.Conn, password string) error {
+	p, err := readPacket(conn)
+	if err != nil {
+		return err
+	}
+	if p.typ != typeAuth {
+		return errors.New("no auth request")
+	}
+	if err := writePacket(conn, packet{id: p.id, typ: typeResponse}); err != nil {
+		return err
+	}
+	id := p.id
+	if p.body != password {
+		id = -1
+	}
+	return writePacket(conn, packet{id: id, typ: typeAuthResp})
+}
+
+// trickle writes b a few bytes at a time, so that packets arrive in pieces.
+type trickle struct{ net.Conn }
+
+func (c trickle) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		k := min(len(b), 7)
+		m, err := c.Conn.Write(b[:k])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		b = b[k:]
+	}
+	return n, nil
+}
+
+func TestDialAuth(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"accepted", "secret", nil},
+		{"rejected", "guess", ErrAuth},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			addr := fakeServer(t, func(conn net.Conn) error {
+				return auth(conn, "secret")
+			})
+			cl, err := Dial(addr, c.password)
+			if !errors.Is(err, c.want) {
+				t.Fatalf("Dial = %v, want %v", err, c.want)
+			}
+			if cl != nil {
+				cl.Close()
+			}
+		})
+	}
+}
+
+func TestCommandFragmented(t *testing.T) {
+	parts := []string{strings.Repeat("a", maxBody), strings.Repeat("b", maxBody), "c"}
+	addr := fakeServer(t, func(conn net.Conn) error {
+		if err := auth(conn, "secret"); err != nil {
+			return err
+		}
+		cmd, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		if cmd.typ != typeCommand || cmd.body != "list" {
+			return errors.New("unexpected command " + cmd.body)
+		}
+		// The server answers the marker only after the whole response
+		end, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		for _, s := range parts {
+			if err := writePacket(trickle{conn}, packet{id: cmd.id, typ: typeResponse, body: s}); err != nil {
+				return err
+			}
+		}
+		return writePacket(conn, packet{id: end.id, typ: typeResponse, body: "Unknown request 0"})
+	})
+
+	cl, err := Dial(addr, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	got, err := cl.Command("list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(parts, ""); got != want {
+		t.Errorf("response of %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 2*maxBody+1)
+	srv := &Server{
+		Password: "secret",
+		Handler: func(cmd string) string {
+			if cmd == "long" {
+				return long
+			}
+			return "ran " + cmd
+		},
+		Logf: t.Logf,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := Dial(ln.Addr().String(), "guess"); !errors.Is(err, ErrAuth) {
+		t.Errorf("Dial with a wrong password = %v, want %v", err, ErrAuth)
+	}
+	cl, err := Dial(ln.Addr().String(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	for _, c := range []struct{ cmd, want string }{
+		{"status", "ran status"},
+		{"long", long},
+		{"", "ran "},
+	} {
+		got, err := cl.Command(c.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("Command(%q) = %d bytes, want %d", c.cmd, len(got), len(c.want))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package mcpr
+
+import (
+    "errors"
+    "fmt"
+    "io"
+)
+
+// ErrTooLarge is returned by ReadAllPackets for recordings beyond its limits.
+var ErrTooLarge = errors.New("mcpr: recording exceeds read limits")
+
+// ReadAllOptions bound what ReadAllPackets holds in memory. A zero field uses
+// the value from DefaultReadAllOptions; a negative one removes the limit.
+type ReadAllOptions struct {
+    MaxPackets int   // number of packets
+    MaxBytes   int64 // total payload bytes
+}
+
+// DefaultReadAllOptions fit short test and sample recordings, not sessions of
+// hours, which should be streamed with a Reader.
+var DefaultReadAllOptions = ReadAllOptions{
+    MaxPackets: 1_000_000,
+    MaxBytes:   256 << 20,
+}
+
+// ReadAllPackets returns every packet of the replay at path, for small tools
+// and tests that do not need the streaming Reader. It fails with an error
+// wrapping ErrTooLarge as soon as the recording exceeds a limit of opts,
+// having held at most one packet beyond it.
+func ReadAllPackets(path string, opts ReadAllOptions) ([]Packet, error) {
+    if opts.MaxPackets == 0 {
+        opts.MaxPackets = DefaultReadAllOptions.MaxPackets
+    }
+    if opts.MaxBytes == 0 {
+        opts.MaxBytes = DefaultReadAllOptions.MaxBytes
+    }
+    r, err := OpenReader(path)
+    if err != nil {
+        return nil, err
+    }
+    defer r.Close()
+    var (
+        pkts  []Packet
+        bytes int64
+    )
+    for {
+        p, err := r.Next()
+        if err == io.EOF {
+            return pkts, nil
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+        bytes += int64(len(p.Payload))
+        switch {
+        case opts.MaxPackets > 0 && len(pkts) >= opts.MaxPackets:
+            return nil, fmt.Errorf("%s: %w: more than %d packets", path, ErrTooLarge, opts.MaxPackets)
+        case opts.MaxBytes > 0 && bytes > opts.MaxBytes:
+            return nil, fmt.Errorf("%s: %w: more than %d payload bytes", path, ErrTooLarge, opts.MaxBytes)
+        }
+        pkts = append(pkts, p)
+    }
+}
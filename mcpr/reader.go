@@ -0,0 +1,363 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// Packet is a packet read from a replay's recording.tmcpr.
+type Packet struct {
+    Time    uint32 // milliseconds since the start of the recording
+    RawTime uint32 // Time as recorded, see Reader.NormalizeTimes
+    ID      int32
+    Name    string // packet name, if enabled with Reader.SetPacketNames
+    Payload []byte // owned by the caller
+}
+
+// ReaderIndexInterval is the spacing in ms of the time index a Reader builds
+// while reading replays that were written without one.
+const ReaderIndexInterval = 10000
+
+// Reader reads an existing replay: its metadata up front and its packets one
+// at a time, decompressing recording.tmcpr as it goes so memory use does not
+// depend on the length of the recording. Archives failing CheckArchive are
+// refused. A Reader is not safe for concurrent use.
+type Reader struct {
+    Meta Meta
+
+    zc    io.Closer     // the file opened by OpenReader
+    files []*zip.File   // all entries, see Entries
+    rec   *zip.File     // recording.tmcpr
+    sum   *zip.File     // recording.tmcpr.crc32, if present
+    rc    io.ReadCloser
+    fr    *tmcpr.Reader
+    ix    *tmcpr.Index  // from recording.tmcpr.index, or built while reading
+    build bool          // ix is built while reading
+    peek  *Packet       // packet read ahead by SeekToTime
+    prev  int64         // raw time of the last frame read since open, or -1
+    base  uint32        // subtracted from packet times, see NormalizeTimes
+    norm  *Timing       // set by NormalizeTimes
+    keep  func(ts uint32, id int32) bool // see SetFilter
+    lenient bool        // see SetLenient
+    names *packetNamer  // see SetPacketNames
+    skipped []SkippedRange
+    err   error         // first error other than io.EOF, see Err
+}
+
+// OpenReader opens the replay at path and parses its metaData.json.
+func OpenReader(path string) (*Reader, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, fmt.Errorf("open %s: %w", path, err)
+    }
+    r, err := newReader(&zr.Reader)
+    if err != nil {
+        _ = zr.Close()
+        return nil, fmt.Errorf("open %s: %w", path, err)
+    }
+    r.zc = zr
+    return r, nil
+}
+
+// NewReader reads the replay of size bytes in ra, e.g. a bytes.Reader over
+// an embedded fixture or a reader issuing HTTP range requests, without a
+// temporary file. ra must stay valid until the Reader is no longer used.
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+    zr, err := zip.NewReader(ra, size)
+    if err != nil {
+        return nil, err
+    }
+    if err := CheckArchive(zr.File, DefaultArchiveLimits); err != nil {
+        return nil, err
+    }
+    return newReader(zr)
+}
+
+func newReader(zr *zip.Reader) (*Reader, error) {
+    r := &Reader{files: zr.File}
+    var metaFile, ixFile *zip.File
+    for _, f := range zr.File {
+        switch f.Name {
+        case "recording.tmcpr":
+            r.rec = f
+        case "metaData.json":
+            metaFile = f
+        case tmcpr.IndexEntryName:
+            ixFile = f
+        case "recording.tmcpr.crc32":
+            r.sum = f
+        }
+    }
+    if r.rec == nil || metaFile == nil {
+        return nil, errors.New("missing recording.tmcpr or metaData.json")
+    }
+    var err error
+    if r.Meta, err = decodeMeta(metaFile); err != nil {
+        return nil, err
+    }
+    if ixFile != nil {
+        r.ix = readIndex(ixFile)
+    }
+    if r.ix == nil {
+        r.ix = &tmcpr.Index{Interval: ReaderIndexInterval}
+        r.build = true
+    }
+    return r, nil
+}
+
+// readIndex parses the index entry f, or returns nil if it is unusable; the
+// Reader then builds its own.
+func readIndex(f *zip.File) *tmcpr.Index {
+    rc, err := f.Open()
+    if err != nil {
+        return nil
+    }
+    defer rc.Close()
+    ix, err := tmcpr.ReadIndex(rc)
+    if err != nil {
+        return nil
+    }
+    return ix
+}
+
+// Next returns the next packet. It returns io.EOF after the last packet and
+// io.ErrUnexpectedEOF if the recording ends inside a frame, unless the Reader
+// is lenient (see SetLenient).
+func (r *Reader) Next() (Packet, error) {
+    p, peeked, err := r.nextHeader()
+    if err != nil || peeked {
+        return p, err
+    }
+    if p.Payload, err = r.fr.Payload(); err != nil {
+        return Packet{}, r.fail(err)
+    }
+    return p, nil
+}
+
+// NextStream is like Next, but returns the payload as a stream instead of in
+// p.Payload, which is nil. It is read straight from the decompressed
+// recording, so consumers of large packets such as chunk data that decode
+// only their start, or copy them elsewhere, do not allocate them whole. The
+// stream is valid until the next call on r; the part left unread is skipped.
+// Payloads of packed frames, lenient Readers and SeekToTime's look-ahead
+// are in memory anyway and returned as a bytes.Reader.
+func (r *Reader) NextStream() (Packet, io.Reader, error) {
+    p, peeked, err := r.nextHeader()
+    if err != nil {
+        return p, nil, err
+    }
+    if peeked {
+        b := p.Payload
+        p.Payload = nil
+        return p, bytes.NewReader(b), nil
+    }
+    pr, err := r.fr.PayloadReader()
+    if err != nil {
+        return Packet{}, nil, r.fail(err)
+    }
+    return p, pr, nil
+}
+
+// nextHeader reads up to the payload of the next packet the filter keeps,
+// which the caller must then finish, unless it is the packet SeekToTime read
+// ahead: that is returned whole with peeked set.
+func (r *Reader) nextHeader() (p Packet, peeked bool, err error) {
+    if r.peek != nil {
+        p := *r.peek
+        r.peek = nil
+        r.prev = int64(p.RawTime)
+        return p, true, nil
+    }
+    if r.fr == nil {
+        if err := r.open(0); err != nil {
+            return Packet{}, false, err
+        }
+    }
+    for {
+        ts, id, err := r.fr.NextHeader()
+        if err != nil {
+            return Packet{}, false, r.fail(err)
+        }
+        if r.build {
+            r.ix.Add(ts, r.fr.Offset())
+        }
+        r.prev = int64(ts)
+        p := Packet{RawTime: ts, ID: id}
+        if r.names != nil {
+            p.Name = r.names.name(id)
+        }
+        if ts > r.base {
+            p.Time = ts - r.base
+        }
+        if r.keep != nil && !r.keep(p.Time, id) {
+            if err := r.fr.Skip(); err != nil {
+                return Packet{}, false, r.fail(err)
+            }
+            continue
+        }
+        return p, false, nil
+    }
+}
+
+// SetFilter makes Next return only the packets keep accepts, given their
+// time (normalized, see NormalizeTimes) and id. The others are skipped
+// without allocating their payloads, which makes scanning a long recording
+// for a few kinds of packets, such as chat, much cheaper. SeekToTime and
+// Packets honor the filter; nil removes it.
+func (r *Reader) SetFilter(keep func(ts uint32, id int32) bool) {
+    r.keep = keep
+}
+
+// fail records err, unless io.EOF, for Err and returns it.
+func (r *Reader) fail(err error) error {
+    if err != io.EOF && r.err == nil {
+        r.err = err
+    }
+    return err
+}
+
+// open positions the Reader at stream offset off of recording.tmcpr, which
+// must be a frame boundary.
+func (r *Reader) open(off int64) error {
+    if r.rc != nil {
+        _ = r.rc.Close()
+        r.rc, r.fr = nil, nil
+    }
+    rc, err := r.openAt(off)
+    if err != nil {
+        r.err = fmt.Errorf("open recording.tmcpr: %w", err)
+        return r.err
+    }
+    r.rc = rc
+    r.fr = tmcpr.NewReaderAt(rc, off)
+    if r.lenient {
+        r.fr.SetLenient(r.skip)
+    }
+    if r.names != nil {
+        r.names.reset(off)
+    }
+    r.peek, r.prev = nil, -1
+    return nil
+}
+
+// openAt opens recording.tmcpr at stream offset off. A stored (uncompressed)
+// entry is read in place from off; a compressed one is decompressed up to it.
+// Reads from the start go through zip.File.Open, which checks the entry's
+// CRC-32 at its end.
+func (r *Reader) openAt(off int64) (io.ReadCloser, error) {
+    if off > 0 && r.rec.Method == zip.Store {
+        raw, err := r.rec.OpenRaw()
+        if err != nil {
+            return nil, err
+        }
+        if s, ok := raw.(io.Seeker); ok {
+            if _, err := s.Seek(off, io.SeekStart); err != nil {
+                return nil, err
+            }
+            return io.NopCloser(raw), nil
+        }
+    }
+    rc, err := r.rec.Open()
+    if err != nil {
+        return nil, err
+    }
+    if _, err := io.CopyN(io.Discard, rc, off); err != nil {
+        _ = rc.Close()
+        return nil, err
+    }
+    return rc, nil
+}
+
+// SeekToTime positions the Reader so that Next returns the first packet at
+// or after ms, or io.EOF if there is none. It starts from the nearest entry
+// of the replay's time index (see Writer.SetIndexInterval); for replays
+// without one, the Reader indexes the packets it reads, so only the part of
+// the recording not read yet is scanned. Seeking forward from the current
+// position never rewinds. A compressed recording is decompressed up to the
+// index entry, though frames before it are skipped without being parsed; a
+// stored one (see WithRecordingCompression) is read from the entry directly,
+// so seeks cost the same anywhere in it. After NormalizeTimes, ms is a
+// normalized time.
+func (r *Reader) SeekToTime(ms uint32) error {
+    raw := ms + r.base
+    if raw < ms {
+        raw = math.MaxUint32
+    }
+    var off int64
+    if e, ok := r.ix.Lookup(raw); ok {
+        off = e.Offset
+    }
+    // Continue from the current position if no packet at or after ms has
+    // been returned yet and it is not behind the index entry
+    if r.fr == nil || r.fr.Offset() < off || r.prev >= int64(raw) {
+        if err := r.open(off); err != nil {
+            return err
+        }
+    }
+    for {
+        p, err := r.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if p.RawTime >= raw {
+            r.peek = &p
+            return nil
+        }
+    }
+}
+
+// Err returns the first error other than io.EOF met while reading packets,
+// for callers iterating with Packets.
+func (r *Reader) Err() error {
+    return r.err
+}
+
+// Close closes the replay. For a Reader from NewReader it does not close the
+// underlying io.ReaderAt.
+func (r *Reader) Close() error {
+    if r.rc != nil {
+        _ = r.rc.Close()
+    }
+    if r.zc == nil {
+        return nil
+    }
+    return r.zc.Close()
+}
+
+// TMCPRReader reads packets from a bare recording.tmcpr stream, e.g. one
+// extracted from a replay by other tools:
+// [time:int32][length:int32][VarInt packet id][payload], big endian.
+type TMCPRReader struct {
+    fr      *tmcpr.Reader
+    skipped []SkippedRange
+}
+
+// NewTMCPRReader returns a TMCPRReader reading from r. It buffers its input.
+func NewTMCPRReader(r io.Reader) *TMCPRReader {
+    return &TMCPRReader{fr: tmcpr.NewReader(r)}
+}
+
+// Next returns the next packet. It returns io.EOF at the end of the stream
+// and io.ErrUnexpectedEOF if the stream ends inside a frame.
+func (r *TMCPRReader) Next() (Packet, error) {
+    f, err := r.fr.Next()
+    if err != nil {
+        return Packet{}, err
+    }
+    return Packet{Time: f.Time, RawTime: f.Time, ID: f.ID, Payload: f.Payload}, nil
+}
+
+// Offset returns the stream offset of the next frame, as used by the time
+// index.
+func (r *TMCPRReader) Offset() int64 {
+    return r.fr.Offset()
+}
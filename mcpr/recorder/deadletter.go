@@ -0,0 +1,104 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DeadLetter is a packet the recorder failed to write, as stored in the
+// dead-letter file (see SetDeadLetter). Together with the replay's id and
+// path it is enough to append the packet to the recording later.
+type DeadLetter struct {
+	Time      time.Time `json:"time"`           // when writing failed
+	Recording string    `json:"recording"`      // id of the replay, see mcpr.Writer.ID
+	Path      string    `json:"path,omitempty"` // file being written, for recorders from NewFile
+	TS        uint32    `json:"ts"`             // recorder timestamp in ms
+	ID        int32     `json:"id"`
+	Payload   []byte    `json:"payload"`
+	Error     string    `json:"error"`
+}
+
+// SetDeadLetter makes the recorder append packets it fails to write (a writer
+// closed underneath it, a disk error, a panic while writing) to the file at
+// path, one JSON DeadLetter per line, instead of only returning the error.
+// The file is opened for each failure, so it is only created if one occurs
+// and may be shared by several recorders. An empty path disables it.
+func (r *Recorder) SetDeadLetter(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadLetter = path
+}
+
+// write writes a packet to the current file, diverting it to the dead-letter
+// file if that fails.
+func (r *Recorder) write(ts uint32, id int32, payload []byte) (err error) {
+	if r.deadLetter == "" {
+		return r.w.WritePacket(r.rel(ts), id, payload)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("recorder: panic writing packet: %v", p)
+		}
+		if err != nil {
+			err = r.divert(ts, id, payload, err)
+		}
+	}()
+	return r.w.WritePacket(r.rel(ts), id, payload)
+}
+
+// divert appends a failed packet to the dead-letter file and returns cause,
+// annotated if the packet could not be saved either.
+func (r *Recorder) divert(ts uint32, id int32, payload []byte, cause error) error {
+	dl := DeadLetter{
+		Time:      time.Now().UTC(),
+		Recording: r.w.ID(),
+		Path:      r.path,
+		TS:        ts,
+		ID:        id,
+		Payload:   payload,
+		Error:     cause.Error(),
+	}
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("%w (dead letter: %v)", cause, err)
+	}
+	f, err := os.OpenFile(r.deadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w (dead letter: %v)", cause, err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w (dead letter: %v)", cause, err)
+	}
+	return fmt.Errorf("%w (saved to %s)", cause, r.deadLetter)
+}
+
+// ReadDeadLetters returns the packets stored in a dead-letter file, oldest
+// first.
+func ReadDeadLetters(path string) ([]DeadLetter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []DeadLetter
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(sc.Bytes(), &dl); err != nil {
+			return out, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		out = append(out, dl)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,201 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// NameData is what a NameTemplate can refer to.
+type NameData struct {
+	Player   string    // name of the recording player, "" if unknown
+	Server   string    // server address or name
+	Date     time.Time // start of the recording
+	Seq      int       // set by NameTemplate.Next
+	Protocol int
+}
+
+// NameTemplate names the replays of a recording service after their session,
+// so that operators get an organized archive without wrapper scripts. It is a
+// text/template over NameData, e.g.
+//
+//	replays/{{.Player}}/{{.Date.Format "2006-01-02"}}-{{.Server}}-{{.Seq}}.mcpr
+//
+// Besides the builtins, templates may use these functions:
+//
+//	lower, upper         change the case of a string
+//	replace OLD NEW S    replace every OLD in S with NEW
+//	default DEF S        DEF if S is empty, else S
+//	date LAYOUT T        T.Format(LAYOUT), e.g. {{.Date | date "2006-01"}}
+//
+// Player and Server are made safe as path elements before the template sees
+// them: characters other than letters, digits, '.', '-' and '_' become '_'.
+// A NameTemplate is safe for concurrent use.
+type NameTemplate struct {
+	text   string
+	t      *template.Template
+	seqful bool // the template renders Seq
+
+	mu  sync.Mutex
+	seq int
+}
+
+// templateAction matches the actions of a template, see Glob.
+var templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+var nameFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// ParseNameTemplate parses a name template. It fails for templates that
+// do not parse or do not render for an empty NameData, such as ones
+// referring to unknown fields.
+func ParseNameTemplate(text string) (*NameTemplate, error) {
+	t, err := template.New("name").Funcs(nameFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	nt := &NameTemplate{text: text, t: t}
+	first, err := nt.Execute(NameData{Seq: 1})
+	if err != nil {
+		return nil, err
+	}
+	second, err := nt.Execute(NameData{Seq: 2})
+	if err != nil {
+		return nil, err
+	}
+	nt.seqful = first != second
+	return nt, nil
+}
+
+// String returns the template's text.
+func (nt *NameTemplate) String() string {
+	return nt.text
+}
+
+// Execute renders the name for d as is.
+func (nt *NameTemplate) Execute(d NameData) (string, error) {
+	d.Player, d.Server = safeElem(d.Player), safeElem(d.Server)
+	var b strings.Builder
+	if err := nt.t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("name template: %w", err)
+	}
+	name := filepath.Clean(b.String())
+	if name == "." || strings.HasSuffix(b.String(), "/") {
+		return "", fmt.Errorf("name template %q: no file name for %+v", nt.text, d)
+	}
+	return name, nil
+}
+
+// Next renders the name of the next recording and creates its directory.
+// d.Seq is one more than in the previous call, starting at 1, skipping
+// numbers whose name is taken, so a restarted service does not overwrite its
+// earlier recordings. Templates not using Seq render the same name for
+// sessions alike, e.g. of the same day; when it is taken, "-2", "-3" and so
+// on is added before the extension.
+func (nt *NameTemplate) Next(d NameData) (string, error) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	for {
+		nt.seq++
+		d.Seq = nt.seq
+		name, err := nt.Execute(d)
+		if err != nil {
+			return "", err
+		}
+		if !nt.seqful {
+			name = freeName(name)
+		} else if exists(name) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// freeName returns name, or name with a numeric suffix before its extension
+// if name is taken.
+func freeName(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; exists(name); n++ {
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return name
+}
+
+// exists reports whether something is at name. Names that cannot be
+// checked are left for creating the file to report.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// Glob returns the directory above the first templated path element and a
+// pattern, relative to it, matching every name the template renders, e.g.
+// "replays" and "*/*-*-*.mcpr" for the example above, so retention tools
+// such as diskguard.Retention can find the recordings. Actions rendering a
+// '/' add directory levels the pattern does not match.
+func (nt *NameTemplate) Glob() (dir, pattern string) {
+	const action = "\x00"
+	elems := strings.Split(filepath.ToSlash(templateAction.ReplaceAllString(nt.text, action)), "/")
+	i := 0
+	for i < len(elems)-1 && !strings.Contains(elems[i], action) {
+		i++
+	}
+	for j := i; j < len(elems); j++ {
+		e := strings.ReplaceAll(elems[j], action, "*")
+		for strings.Contains(e, "**") {
+			e = strings.ReplaceAll(e, "**", "*")
+		}
+		elems[j] = e
+	}
+	if !nt.seqful {
+		// Allow for the suffix Next adds to taken names
+		last := elems[len(elems)-1]
+		ext := path.Ext(last)
+		elems[len(elems)-1] = strings.ReplaceAll(strings.TrimSuffix(last, ext)+"*", "**", "*") + ext
+	}
+	dir = filepath.FromSlash(strings.Join(elems[:i], "/"))
+	if dir == "" {
+		dir = "."
+	}
+	return dir, filepath.FromSlash(strings.Join(elems[i:], "/"))
+}
+
+// safeElem makes s usable as (part of) a path element.
+func safeElem(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			b[i] = '_'
+		}
+	}
+	if s := string(b); s != "." && s != ".." {
+		return s
+	}
+	return "_"
+}
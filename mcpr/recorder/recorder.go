@@ -5,12 +5,20 @@
 package recorder
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/reallyoldfogie/mc-replay-go/mcpr"
 )
 
+// ErrClosed is returned for packets recorded after Close, or after a limit
+// closed the recorder (see Limits.Next).
+var ErrClosed = errors.New("recorder: closed")
+
 // Recorder streams packets to an underlying mcpr.Writer and computes
 // timestamps relative to its start time.
 type Recorder struct {
@@ -18,55 +26,291 @@ type Recorder struct {
 	start  time.Time
 	mu     sync.Mutex
 	closed bool
+	sinks  []Sink
+
+	path       string              // set by NewFile
+	opts       []mcpr.WriterOption // given to NewFile, for continuation files too
+	onFinalize []func(path string)
+
+	limits  Limits
+	part    int    // 1 for the first file
+	offset  uint32 // recording time at which the current file started
+	packets int64  // packets in the current file
+
+	deadLetter string // see SetDeadLetter
+}
+
+// Limits bound the files a recorder writes, so unattended recorders never
+// produce unbounded replays. Zero fields are unlimited.
+type Limits struct {
+	MaxDuration time.Duration // recording time per file
+	MaxPackets  int64         // packets per file
+
+	// Next, if set, returns the path of the file to continue in once a limit
+	// is reached; part is 2 for the first continuation (see Parts). Without
+	// it the recorder closes at the limit. Only recorders from NewFile
+	// continue; others always close.
+	Next func(part int) string
+
+	// Start, if set, is called with the writer of each continuation file
+	// before any packet is written to it: to apply writer options such as
+	// SetSidecar, or to write the state a replay must begin with (a
+	// continuation starts mid-session, without login or chunks).
+	Start func(w *mcpr.Writer) error
+}
+
+// Parts returns a Limits.Next naming continuations of path as
+// "name-part2.mcpr", "name-part3.mcpr", ...
+func Parts(path string) func(part int) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return func(part int) string {
+		return fmt.Sprintf("%s-part%d%s", base, part, ext)
+	}
 }
 
-// New creates a Recorder writing to the given io.Writer using the provided metadata.
-// See mcpr.NewWriter for details. The recorder start time is set to now.
+// Sink receives a copy of every recorded packet, for example a
+// replayserver.Relay mirroring the recording to spectators. *mcpr.Writer also
+// satisfies Sink.
+type Sink interface {
+	WritePacket(ts uint32, packetID int32, payload []byte) error
+}
+
+// New creates a Recorder writing to w, which the caller creates (see
+// mcpr.NewWriter) and the Recorder's Close closes. The recorder start time is
+// set to now.
 func New(w *mcpr.Writer) *Recorder {
 	return &Recorder{w: w, start: time.Now()}
 }
 
-// NewFile creates and owns an MCPR file at path using the given metadata.
+// NewFile creates and owns an MCPR file at path using the given metadata and
+// writer options, which also apply to continuation files (see SetLimits).
 // Use Close() when finished.
-func NewFile(path string, meta mcpr.Meta) (*Recorder, error) {
-	w, err := mcpr.Create(path, meta)
+func NewFile(path string, meta mcpr.Meta, opts ...mcpr.WriterOption) (*Recorder, error) {
+	w, err := mcpr.Create(path, meta, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &Recorder{w: w, start: time.Now()}, nil
+	return &Recorder{w: w, start: time.Now(), path: path, opts: opts}, nil
+}
+
+// SetLimits sets the limits of each file. Reaching one finalizes the current
+// file, calling the OnFinalize callbacks with its path, and then continues in
+// the next file or closes the recorder (see Limits.Next). Timestamps in each
+// file start at 0; sinks keep receiving the recorder's own timestamps.
+func (r *Recorder) SetLimits(l Limits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = l
 }
 
 // RecordNow records a packet with the current timestamp relative to start.
 // id is the protocol packet id; payload are the packet bytes after the varint id.
 func (r *Recorder) RecordNow(id int32, payload []byte) error {
+	r.mu.Lock()
+	ts := uint32(time.Since(r.start).Milliseconds())
+	return r.writeUnlock(ts, id, payload)
+}
+
+// RecordAt records a packet with an explicit millisecond timestamp.
+func (r *Recorder) RecordAt(ts uint32, id int32, payload []byte) error {
+	r.mu.Lock()
+	return r.writeUnlock(ts, id, payload)
+}
+
+// RecordAtTime records a packet received at t, for example a time captured in
+// the network read loop before the packet waited in a handler queue. t is
+// converted relative to the recorder's start; times before it are recorded
+// at 0.
+func (r *Recorder) RecordAtTime(t time.Time, id int32, payload []byte) error {
+	r.mu.Lock()
+	var ts uint32
+	if d := t.Sub(r.start); d > 0 {
+		ts = uint32(d.Milliseconds())
+	}
+	return r.writeUnlock(ts, id, payload)
+}
+
+// writeUnlock writes a packet, finalizing the current file first if it
+// reached a limit, and unlocks r.mu. Packets arriving after the recorder
+// closed fail with ErrClosed and go to the dead-letter file if one is set. Finalize callbacks run after unlocking.
+func (r *Recorder) writeUnlock(ts uint32, id int32, payload []byte) error {
+	if r.closed {
+		var err error = ErrClosed
+		if r.deadLetter != "" {
+			err = r.divert(ts, id, payload, err)
+		}
+		r.mu.Unlock()
+		return err
+	}
+	finalized, err := r.rollover(ts)
+	if err == nil && r.closed {
+		// A limit closed the recorder with nowhere to continue
+		err = ErrClosed
+	}
+	if err == nil {
+		for _, s := range r.sinks {
+			_ = s.WritePacket(ts, id, payload)
+		}
+		err = r.write(ts, id, payload)
+		r.packets++
+	} else if r.deadLetter != "" {
+		err = r.divert(ts, id, payload, err)
+	}
+	fns := r.onFinalize
+	r.mu.Unlock()
+	if finalized != "" {
+		for _, fn := range fns {
+			fn(finalized)
+		}
+	}
+	return err
+}
+
+// rel converts a recorder timestamp to one in the current file.
+func (r *Recorder) rel(ts uint32) uint32 {
+	if ts < r.offset {
+		return 0
+	}
+	return ts - r.offset
+}
+
+// rollover finalizes the current file if writing a packet at ts would exceed
+// a limit, then continues in the next file or closes the recorder. It returns
+// the path of the finalized file for recorders from NewFile.
+func (r *Recorder) rollover(ts uint32) (string, error) {
+	l := r.limits
+	full := l.MaxPackets > 0 && r.packets >= l.MaxPackets ||
+		l.MaxDuration > 0 && time.Duration(r.rel(ts))*time.Millisecond >= l.MaxDuration
+	if !full {
+		return "", nil
+	}
+	meta := r.w.Meta()
+	if err := r.w.Close(); err != nil {
+		r.closed = true
+		return "", err
+	}
+	finalized := r.path
+	if r.path == "" || l.Next == nil {
+		r.closed = true
+		return finalized, nil
+	}
+	if r.part == 0 {
+		r.part = 1
+	}
+	r.part++
+	next := l.Next(r.part)
+	meta.ID, meta.Duration, meta.Date = "", 0, 0
+	w, err := mcpr.Create(next, meta, r.opts...)
+	if err != nil {
+		r.closed = true
+		return finalized, fmt.Errorf("continue in %s: %w", next, err)
+	}
+	r.w, r.path, r.offset, r.packets = w, next, ts, 0
+	if l.Start != nil {
+		if err := l.Start(w); err != nil {
+			return finalized, fmt.Errorf("start %s: %w", next, err)
+		}
+	}
+	return finalized, nil
+}
+
+// Snapshot returns a view of the current file as recorded so far, see
+// mcpr.Writer.Snapshot. The writer needs snapshots enabled (for continuation
+// files, in Limits.Start).
+func (r *Recorder) Snapshot() (*mcpr.Snapshot, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.closed {
-		return nil
+		return nil, ErrClosed
+	}
+	return r.w.Snapshot()
+}
+
+// Annotate adds a note at the current time to the current file, see
+// mcpr.Writer.Annotate. No-op after Close().
+func (r *Recorder) Annotate(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
 	}
 	ts := uint32(time.Since(r.start).Milliseconds())
-	return r.w.WritePacket(ts, id, payload)
+	r.w.Annotate(r.rel(ts), key, value)
 }
 
-// RecordAt records a packet with an explicit millisecond timestamp.
-func (r *Recorder) RecordAt(ts uint32, id int32, payload []byte) error {
+// Mark adds a marker named name at the current time to the current file, see
+// mcpr.Writer.AddMarker. pos may be nil. No-op after Close().
+func (r *Recorder) Mark(name string, pos *mcpr.MarkerPosition) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.closed {
-		return nil
+		return
 	}
-	return r.w.WritePacket(ts, id, payload)
+	ts := uint32(time.Since(r.start).Milliseconds())
+	r.w.AddMarker(mcpr.Marker{Time: int(r.rel(ts)), Name: name, Position: pos})
+}
+
+// AddSink attaches a sink that receives every packet recorded from now on.
+// Sinks are best-effort: their errors do not affect the recording.
+func (r *Recorder) AddSink(s Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, s)
 }
 
 // Close finalizes the MCPR file (writing metaData.json and ZIP central directory).
+// On success, OnFinalize callbacks run before Close returns.
 func (r *Recorder) Close() error {
+	return r.close(nil)
+}
+
+// CloseWithMeta is Close with metadata learned at the end of the session
+// (see mcpr.Writer.CloseWithMeta). The patch is applied under the recorder's
+// lock, so it cannot race packets or setters from other goroutines.
+func (r *Recorder) CloseWithMeta(patch mcpr.MetaPatch) error {
+	return r.close(&patch)
+}
+
+func (r *Recorder) close(patch *mcpr.MetaPatch) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 	if r.closed {
+		r.mu.Unlock()
 		return nil
 	}
 	r.closed = true
-	return r.w.Close()
+	var err error
+	if patch != nil {
+		err = r.w.CloseWithMeta(*patch)
+	} else {
+		err = r.w.Close()
+	}
+	fns := r.onFinalize
+	r.mu.Unlock()
+	if err != nil || r.path == "" {
+		return err
+	}
+	for _, fn := range fns {
+		fn(r.path)
+	}
+	return nil
+}
+
+// OnFinalize registers fn to be called with the file path once a recorder
+// created by NewFile has been closed and validated, e.g. to start an upload
+// (see package upload). Callbacks run synchronously in Close; start a
+// goroutine for slow work. Recorders from New have no path and never call fn.
+func (r *Recorder) OnFinalize(fn func(path string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onFinalize = append(r.onFinalize, fn)
+}
+
+// ID returns the unique identifier of the underlying recording (see mcpr.Writer.ID).
+func (r *Recorder) ID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.w.ID()
 }
 
 // SetSelfID annotates the recording with the recorder's player entity id.
@@ -0,0 +1,242 @@
+package mcpr
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// RemoteFile reads a file served over HTTP with range requests, as an
+// io.ReaderAt for NewReader. Only the ranges read are downloaded: opening a
+// replay fetches its central directory and metaData.json, reading packets
+// fetches recording.tmcpr as far as it is read. Reads are served from
+// blocks of at least 64 KiB; sequential reads fetch exponentially larger
+// blocks, up to 4 MiB, so streaming a recording does not take a request per
+// frame. The most recent blocks, 8 MiB in all, are kept for rereading.
+//
+// If the file changes on the server while it is read (its ETag or
+// Last-Modified differs), reads fail. A RemoteFile is safe for concurrent
+// use.
+//
+// RemoteFile, OpenRemote and OpenURL are experimental and may change in a
+// minor release.
+type RemoteFile struct {
+    client *http.Client
+    ctx    context.Context
+    url    string
+    size   int64
+    check  [2]string // ETag and Last-Modified of the first response, see get
+
+    mu      sync.Mutex
+    blocks  []remoteBlock // most recently used last
+    cached  int64         // bytes in blocks
+    seqEnd  int64         // end of the last block fetched
+    window  int64         // size of the next sequential fetch
+    fetched int64
+    reqs    int
+}
+
+type remoteBlock struct {
+    off  int64
+    data []byte
+}
+
+const (
+    remoteMinBlock = 64 << 10
+    remoteMaxBlock = 4 << 20
+    remoteCache    = 8 << 20
+)
+
+// OpenRemote opens the file at url for reading with range requests, using
+// client (http.DefaultClient if nil). ctx bounds every request made through
+// the RemoteFile. It fails if the server does not answer range requests.
+func OpenRemote(ctx context.Context, client *http.Client, url string) (*RemoteFile, error) {
+    if client == nil {
+        client = http.DefaultClient
+    }
+    f := &RemoteFile{client: client, ctx: ctx, url: url, window: remoteMinBlock}
+    // The first block also tells the size; most replays fit in it entirely
+    // or have their central directory near the end, fetched next
+    resp, err := f.get(0, remoteMinBlock-1)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if f.size, err = contentRangeSize(resp.Header.Get("Content-Range")); err != nil {
+        return nil, fmt.Errorf("%s: %w", url, err)
+    }
+    data, err := io.ReadAll(io.LimitReader(resp.Body, remoteMinBlock))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", url, err)
+    }
+    f.check = [2]string{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+    f.add(remoteBlock{off: 0, data: data})
+    return f, nil
+}
+
+// OpenURL opens the replay at url as OpenRemote reads it, to inspect its
+// metadata, entries and packets without downloading all of it. Use
+// OpenRemote and NewReader instead to see how much was downloaded.
+func OpenURL(ctx context.Context, client *http.Client, url string) (*Reader, error) {
+    f, err := OpenRemote(ctx, client, url)
+    if err != nil {
+        return nil, err
+    }
+    r, err := NewReader(f, f.Size())
+    if err != nil {
+        return nil, fmt.Errorf("open %s: %w", url, err)
+    }
+    return r, nil
+}
+
+// Size returns the size of the file.
+func (f *RemoteFile) Size() int64 {
+    return f.size
+}
+
+// Fetched returns the bytes downloaded so far and the number of requests.
+func (f *RemoteFile) Fetched() (bytes int64, requests int) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.fetched, f.reqs
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *RemoteFile) ReadAt(p []byte, off int64) (int, error) {
+    if off < 0 {
+        return 0, errors.New("mcpr: negative offset")
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    n := 0
+    for n < len(p) {
+        at := off + int64(n)
+        if at >= f.size {
+            return n, io.EOF
+        }
+        b, err := f.block(at, int64(len(p)-n))
+        if err != nil {
+            return n, err
+        }
+        n += copy(p[n:], b.data[at-b.off:])
+    }
+    return n, nil
+}
+
+// block returns a block holding off, fetching one of at least want bytes
+// if none is cached.
+func (f *RemoteFile) block(off, want int64) (remoteBlock, error) {
+    for i := len(f.blocks) - 1; i >= 0; i-- {
+        b := f.blocks[i]
+        if off >= b.off && off < b.off+int64(len(b.data)) {
+            f.blocks = append(append(f.blocks[:i], f.blocks[i+1:]...), b)
+            return b, nil
+        }
+    }
+    if off == f.seqEnd {
+        f.window = min(f.window*2, remoteMaxBlock)
+    } else {
+        f.window = remoteMinBlock
+    }
+    end := min(off+max(want, f.window), f.size) - 1
+    resp, err := f.get(off, end)
+    if err != nil {
+        return remoteBlock{}, err
+    }
+    defer resp.Body.Close()
+    data := make([]byte, end-off+1)
+    if _, err := io.ReadFull(resp.Body, data); err != nil {
+        return remoteBlock{}, fmt.Errorf("%s: %w", f.url, err)
+    }
+    b := remoteBlock{off: off, data: data}
+    f.seqEnd = end + 1
+    f.add(b)
+    return b, nil
+}
+
+// add caches b, evicting the least recently used blocks beyond remoteCache.
+func (f *RemoteFile) add(b remoteBlock) {
+    f.blocks = append(f.blocks, b)
+    f.cached += int64(len(b.data))
+    for f.cached > remoteCache && len(f.blocks) > 1 {
+        f.cached -= int64(len(f.blocks[0].data))
+        f.blocks = f.blocks[1:]
+    }
+}
+
+// get requests bytes first to last of the file; the response is partial.
+//
+// After the first response, a strong ETag is sent as If-Range, so a changed
+// file comes back whole (200) instead of partial. Weak ETags (W/"...") cannot
+// be used there, nor in If-Match, which both require a strong comparison; the
+// request then carries If-Unmodified-Since if there was a Last-Modified, and
+// the ETag of each partial response is compared weakly with the first.
+func (f *RemoteFile) get(first, last int64) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(f.ctx, http.MethodGet, f.url, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+    etag, modified := f.check[0], f.check[1]
+    conditional := false
+    switch {
+    case etag != "" && !strings.HasPrefix(etag, "W/"):
+        req.Header.Set("If-Range", etag)
+        conditional = true
+    case modified != "":
+        req.Header.Set("If-Unmodified-Since", modified)
+        conditional = true
+    }
+    f.reqs++
+    resp, err := f.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    switch resp.StatusCode {
+    case http.StatusPartialContent:
+        if etag != "" && !weakETagMatch(etag, resp.Header.Get("ETag")) {
+            err = errors.New("file changed on the server while reading")
+            break
+        }
+        f.fetched += resp.ContentLength
+        return resp, nil
+    case http.StatusOK:
+        if conditional {
+            err = errors.New("file changed on the server while reading")
+        } else {
+            err = errors.New("server does not support range requests")
+        }
+    case http.StatusPreconditionFailed:
+        err = errors.New("file changed on the server while reading")
+    default:
+        err = fmt.Errorf("HTTP %s", resp.Status)
+    }
+    _ = resp.Body.Close()
+    return nil, fmt.Errorf("%s: %w", f.url, err)
+}
+
+// weakETagMatch compares two entity tags ignoring their W/ prefixes (RFC 9110
+// weak comparison). A missing tag b matches, since not every server repeats
+// it on partial responses.
+func weakETagMatch(a, b string) bool {
+    return b == "" || strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// contentRangeSize returns the complete length from a Content-Range header
+// such as "bytes 0-65535/1048576".
+func contentRangeSize(h string) (int64, error) {
+    i := strings.LastIndexByte(h, '/')
+    if !strings.HasPrefix(h, "bytes ") || i < 0 {
+        return 0, fmt.Errorf("invalid Content-Range %q", h)
+    }
+    size, err := strconv.ParseInt(h[i+1:], 10, 64)
+    if err != nil || size <= 0 {
+        return 0, fmt.Errorf("Content-Range %q has no size", h)
+    }
+    return size, nil
+}
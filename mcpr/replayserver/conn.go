@@ -0,0 +1,159 @@
+package replayserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/playback"
+)
+
+// Login-phase clientbound packet ids, stable across protocol versions.
+const (
+	loginDisconnect  = 0x00
+	loginEncryption  = 0x01
+	loginSuccess     = 0x02
+	loginCompression = 0x03
+	loginPlugin      = 0x04
+)
+
+// serverInfo is what connecting clients see before the replay starts.
+type serverInfo struct {
+	protocol int
+	version  string
+	motd     string
+	players  int
+}
+
+// handshake reads the client's handshake and handles status requests. It
+// returns true once a client of the right protocol version has started
+// logging in and is ready to receive the replay.
+func handshake(conn net.Conn, br *bufio.Reader, info serverInfo) (bool, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	id, data, err := readPacket(br)
+	if err != nil {
+		return false, err
+	}
+	if id != 0x00 {
+		return false, fmt.Errorf("expected handshake, got packet 0x%02X", id)
+	}
+	pr := payloadReader{bytes.NewReader(data)}
+	clientProto, err := pr.varInt()
+	if err != nil {
+		return false, err
+	}
+	if _, err := pr.string(); err != nil { // server address
+		return false, err
+	}
+	if _, err := pr.Seek(2, io.SeekCurrent); err != nil { // port
+		return false, err
+	}
+	next, err := pr.varInt()
+	if err != nil {
+		return false, err
+	}
+
+	switch next {
+	case 1:
+		return false, status(conn, br, info)
+	case 2:
+		if _, _, err := readPacket(br); err != nil { // login start
+			return false, err
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		if int(clientProto) != info.protocol {
+			msg, _ := json.Marshal(map[string]string{"text": fmt.Sprintf(
+				"This replay was recorded with protocol %d, your client uses %d", info.protocol, clientProto)})
+			return false, writePacket(conn, loginDisconnect, appendString(nil, string(msg)))
+		}
+		go func() { _, _ = io.Copy(io.Discard, br) }() // client packets are ignored
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported next state %d", next)
+	}
+}
+
+func status(conn net.Conn, br *bufio.Reader, info serverInfo) error {
+	if _, _, err := readPacket(br); err != nil { // status request
+		return err
+	}
+	resp, _ := json.Marshal(map[string]any{
+		"version":     map[string]any{"name": info.version, "protocol": info.protocol},
+		"players":     map[string]any{"max": 100, "online": info.players},
+		"description": map[string]any{"text": info.motd},
+	})
+	if err := writePacket(conn, 0x00, appendString(nil, string(resp))); err != nil {
+		return err
+	}
+	id, data, err := readPacket(br)
+	if err != nil {
+		return err
+	}
+	if id == 0x01 { // ping: echo payload as pong
+		return writePacket(conn, 0x01, data)
+	}
+	return nil
+}
+
+// spectator writes replay packets to a logged-in client. Login packets that
+// would switch the connection to encryption or compression are not forwarded.
+type spectator struct {
+	bw      *bufio.Writer
+	inLogin bool
+}
+
+func newSpectator(conn net.Conn) *spectator {
+	return &spectator{bw: bufio.NewWriter(conn), inLogin: true}
+}
+
+func (s *spectator) emit(pk playback.Packet) error {
+	if s.inLogin {
+		switch pk.ID {
+		case loginEncryption, loginCompression, loginPlugin:
+			return nil
+		case loginSuccess:
+			s.inLogin = false
+		}
+	}
+	return writePacket(s.bw, pk.ID, pk.Payload)
+}
+
+func (s *spectator) flush() error {
+	return s.bw.Flush()
+}
+
+// clientGone reports whether err just means the client went away.
+func clientGone(err error) bool {
+	return errors.Is(err, io.EOF) || connReset(err)
+}
+
+// acceptLoop accepts connections on ln until ctx is cancelled and runs handle
+// for each in its own goroutine.
+func acceptLoop(ctx context.Context, ln net.Listener, logf func(string, ...any), handle func(net.Conn) error) error {
+	go func() { <-ctx.Done(); _ = ln.Close() }()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := handle(conn); err != nil {
+				if clientGone(err) {
+					logf("[replayserver] %s: client disconnected", conn.RemoteAddr())
+				} else {
+					logf("[replayserver] %s: %v", conn.RemoteAddr(), err)
+				}
+			}
+		}()
+	}
+}
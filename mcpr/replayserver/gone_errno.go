@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package replayserver
+
+import (
+	"errors"
+	"syscall"
+)
+
+// connReset reports whether err is the peer closing or resetting the
+// connection under a write.
+func connReset(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,7 @@
+package replayserver
+
+// connReset reports whether err is the peer closing or resetting the
+// connection under a write. Plan 9 has no errno values to tell them by.
+func connReset(err error) bool {
+	return false
+}
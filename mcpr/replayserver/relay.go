@@ -0,0 +1,251 @@
+package replayserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/membudget"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/playback"
+)
+
+// Relay mirrors a recording in progress to spectator clients.
+//
+// Feed it packets with WritePacket as they are recorded (it satisfies the same
+// WritePacket signature as mcpr.Writer, so it can be attached as a recorder
+// sink). Each spectator first receives everything recorded so far, so it has
+// the full world state, then follows the live stream Delay behind real time.
+//
+// All packets are kept in memory for the lifetime of the relay so that late
+// joiners can catch up, unless Memory bounds them.
+type Relay struct {
+	// Delay holds back the live stream, e.g. to prevent spectators from
+	// ghosting in competitive matches.
+	Delay time.Duration
+	// MOTD is shown in the client's server list.
+	MOTD string
+	// Logf receives connection events. Defaults to log.Printf.
+	Logf func(format string, args ...any)
+	// Memory, if set, bounds the packets kept for catch-up. When it is
+	// exhausted the oldest packets are dropped: connected spectators skip
+	// them if they lag behind, and new spectators are refused since they
+	// could no longer be shown the world from the start.
+	Memory *membudget.Account
+
+	protocol int
+
+	mu       sync.Mutex
+	frames   []tmcpr.Frame
+	dropped  int           // frames evicted from the front of frames, see Memory
+	base     time.Time     // wall time of timestamp 0
+	changed  chan struct{} // closed and replaced whenever frames or closed change
+	closed   bool
+	viewers  int
+	released bool // frames and Memory given back, see Close
+}
+
+// NewRelay returns a relay for a recording using the given protocol version.
+func NewRelay(protocol int, delay time.Duration) *Relay {
+	return &Relay{protocol: protocol, Delay: delay, changed: make(chan struct{})}
+}
+
+func (r *Relay) logf(format string, args ...any) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+var relayTimer = perf.NewTimer("replayserver.Relay.WritePacket")
+
+// WritePacket appends a recorded packet. The payload is copied.
+func (r *Relay) WritePacket(ts uint32, packetID int32, payload []byte) error {
+	defer relayTimer.Since(time.Now())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.New("replayserver: relay closed")
+	}
+	if len(r.frames) == 0 {
+		r.base = time.Now().Add(-time.Duration(ts) * time.Millisecond)
+	}
+	n := frameCost(payload)
+	reserved := r.Memory.TryReserve(n)
+	for !reserved && len(r.frames) > 0 {
+		r.evict()
+		reserved = r.Memory.TryReserve(n)
+	}
+	if !reserved {
+		r.Memory.Reserve(n)
+	}
+	r.frames = append(r.frames, tmcpr.Frame{Time: ts, ID: packetID, Payload: append([]byte(nil), payload...)})
+	r.notify()
+	return nil
+}
+
+// frameCost estimates the memory of a buffered frame.
+func frameCost(payload []byte) int64 {
+	return int64(len(payload)) + 48
+}
+
+// evict drops the oldest frame to make room within Memory.
+func (r *Relay) evict() {
+	if r.dropped == 0 {
+		r.logf("[replayserver] memory budget reached; dropping the oldest packets, new spectators are refused")
+	}
+	r.Memory.Release(frameCost(r.frames[0].Payload))
+	r.frames[0] = tmcpr.Frame{}
+	r.frames = r.frames[1:]
+	r.dropped++
+}
+
+// Close marks the end of the recording. Spectators receive the remaining
+// packets and are then disconnected.
+// The buffered packets and their Memory account are released once the last
+// spectator has finished.
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		r.notify()
+		r.releaseIfDone()
+	}
+	return nil
+}
+
+// releaseIfDone frees the buffered packets and closes Memory once the relay
+// is closed and no spectator is left to read them.
+func (r *Relay) releaseIfDone() {
+	if !r.closed || r.viewers > 0 || r.released {
+		return
+	}
+	r.frames, r.released = nil, true
+	r.Memory.Close()
+}
+
+func (r *Relay) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// ListenAndServe listens on addr and serves spectators until ctx is cancelled.
+func (r *Relay) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return r.Serve(ctx, ln)
+}
+
+// Serve accepts spectator connections on ln until ctx is cancelled.
+func (r *Relay) Serve(ctx context.Context, ln net.Listener) error {
+	return acceptLoop(ctx, ln, r.logf, func(conn net.Conn) error {
+		return r.serveConn(ctx, conn)
+	})
+}
+
+func (r *Relay) serveConn(ctx context.Context, conn net.Conn) error {
+	r.mu.Lock()
+	info := serverInfo{protocol: r.protocol, motd: r.MOTD, players: r.viewers}
+	r.mu.Unlock()
+	if info.motd == "" {
+		info.motd = "Live replay"
+	}
+	ok, err := handshake(conn, bufio.NewReader(conn), info)
+	if !ok || err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.dropped > 0 {
+		r.mu.Unlock()
+		r.logf("[replayserver] %s: refused, the start of the recording was dropped (memory budget)", conn.RemoteAddr())
+		return nil
+	}
+	if r.released {
+		r.mu.Unlock()
+		r.logf("[replayserver] %s: refused, the recording has ended", conn.RemoteAddr())
+		return nil
+	}
+	r.viewers++
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.viewers--
+		r.releaseIfDone()
+		r.mu.Unlock()
+	}()
+	r.logf("[replayserver] %s: spectating live (delay %s)", conn.RemoteAddr(), r.Delay)
+
+	// Wait for the recording to start so its time base is known
+	r.mu.Lock()
+	for len(r.frames) == 0 && !r.closed {
+		changed := r.changed
+		r.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+		r.mu.Lock()
+	}
+	live := time.Since(r.base) - r.Delay
+	r.mu.Unlock()
+	if live < 0 {
+		// Joined within the first Delay of the recording
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(-live):
+		}
+		live = 0
+	}
+
+	sp := newSpectator(conn)
+	i := 0
+	p := playback.New(func() (playback.Source, error) {
+		i = 0
+		return playback.SourceFunc(func() (playback.Packet, error) {
+			r.mu.Lock()
+			for i >= r.dropped+len(r.frames) {
+				closed, changed := r.closed, r.changed
+				r.mu.Unlock()
+				if closed {
+					return playback.Packet{}, io.EOF
+				}
+				if err := sp.flush(); err != nil {
+					return playback.Packet{}, err
+				}
+				select {
+				case <-ctx.Done():
+					return playback.Packet{}, io.EOF
+				case <-changed:
+				}
+				r.mu.Lock()
+			}
+			if i < r.dropped {
+				// Fell behind the memory budget; skip what was dropped
+				i = r.dropped
+			}
+			f := r.frames[i-r.dropped]
+			r.mu.Unlock()
+			i++
+			return playback.Packet{Time: f.Time, ID: f.ID, Payload: f.Payload}, nil
+		}), nil
+	})
+	p.OnIdle = sp.flush
+	p.Seek(uint32(live.Milliseconds())) // catch up on everything recorded so far
+	if err := p.Run(ctx, sp.emit); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return sp.flush()
+}
@@ -0,0 +1,98 @@
+// Package replayserver serves replays to vanilla Minecraft clients.
+//
+// Server plays a recorded .mcpr file; Relay mirrors a recording that is still
+// in progress to spectators. Both answer status pings and, when a client logs
+// in, stream the recording's packets with their original pacing. The client
+// simply watches: everything it sends after login is read and discarded. No
+// encryption or compression is used, so clients must connect directly (the
+// server behaves like an offline-mode server).
+//
+// The recording must include the login phase (login success onwards), as
+// ReplayMod and proxy recordings do; the client's protocol version must match
+// the replay's.
+package replayserver
+
+import (
+	"bufio"
+	"context"
+
+	"log"
+	"net"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/playback"
+)
+
+// Server serves one replay file to connecting clients.
+type Server struct {
+	// Path is the .mcpr file to serve.
+	Path string
+	// MOTD is shown in the client's server list. Defaults to the replay's server name.
+	MOTD string
+	// Speed scales playback; 2.0 plays twice as fast. Zero means 1.0.
+	Speed float64
+	// Logf receives connection events. Defaults to log.Printf.
+	Logf func(format string, args ...any)
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// ListenAndServe listens on addr and serves clients until ctx is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is cancelled. Each client gets its
+// own independent playback of the replay.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	a, err := archive.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	_ = a.Close() // only checking that the replay opens; each client reopens it
+	return acceptLoop(ctx, ln, s.logf, func(conn net.Conn) error {
+		return s.serveConn(ctx, conn)
+	})
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) error {
+	a, err := archive.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	info := serverInfo{protocol: a.Meta.Protocol, version: a.Meta.MCVersion, motd: s.MOTD}
+	if info.motd == "" {
+		info.motd = "Replay of " + a.Meta.ServerName
+	}
+	_ = a.Close()
+	ok, err := handshake(conn, bufio.NewReader(conn), info)
+	if !ok || err != nil {
+		return err
+	}
+
+	s.logf("[replayserver] %s: streaming %s", conn.RemoteAddr(), s.Path)
+	sp := newSpectator(conn)
+	p := playback.New(playback.FileSource(s.Path))
+	p.OnIdle = sp.flush
+	if s.Speed > 0 {
+		p.SetSpeed(s.Speed)
+	}
+	if err := p.Run(ctx, sp.emit); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	s.logf("[replayserver] %s: replay finished", conn.RemoteAddr())
+	return sp.flush()
+}
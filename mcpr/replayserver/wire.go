@@ -0,0 +1,73 @@
+package replayserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// maxClientPacket bounds packets read from clients before login completes.
+const maxClientPacket = 1 << 16
+
+// readPacket reads one uncompressed packet from a client.
+func readPacket(br *bufio.Reader) (int32, []byte, error) {
+	n, err := tmcpr.ReadVarInt(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n <= 0 || n > maxClientPacket {
+		return 0, nil, fmt.Errorf("invalid packet length %d", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return 0, nil, err
+	}
+	id, k, err := tmcpr.DecodeVarInt(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, body[k:], nil
+}
+
+// writePacket writes one uncompressed packet to a client.
+func writePacket(w io.Writer, id int32, payload []byte) error {
+	idBuf := binary.AppendUvarint(nil, uint64(uint32(id)))
+	buf := make([]byte, 0, 5+len(idBuf)+len(payload))
+	buf = binary.AppendUvarint(buf, uint64(len(idBuf)+len(payload)))
+	buf = append(buf, idBuf...)
+	buf = append(buf, payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// payloadReader decodes protocol fields from a packet payload.
+type payloadReader struct {
+	*bytes.Reader
+}
+
+func (r payloadReader) varInt() (int32, error) {
+	return tmcpr.ReadVarInt(r)
+}
+
+func (r payloadReader) string() (string, error) {
+	n, err := r.varInt()
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || int(n) > r.Len() {
+		return "", errors.New("invalid string length")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
@@ -0,0 +1,113 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// ErrUnsafeArchive is returned for archives that could trick a reader or a
+// tool extracting or rewriting them: duplicate or path-traversing entry
+// names, entries sharing compressed data, or sizes beyond ArchiveLimits.
+var ErrUnsafeArchive = errors.New("mcpr: unsafe archive")
+
+// ArchiveLimits bound the archives this package reads, since replays may come
+// from untrusted uploads.
+type ArchiveLimits struct {
+    MaxEntries      int    // number of entries
+    MaxUncompressed uint64 // total declared uncompressed size in bytes
+}
+
+// DefaultArchiveLimits are applied when opening replays. They are far above
+// what real replays need (a day-long recording is a few GiB uncompressed).
+var DefaultArchiveLimits = ArchiveLimits{
+    MaxEntries:      10000,
+    MaxUncompressed: 64 << 30,
+}
+
+// SafeEntryName reports whether an entry name is a plain relative path:
+// not empty or absolute, no drive letter, backslash, NUL, or "." or ".."
+// element. Only such names are safe to extract or copy into another archive.
+func SafeEntryName(name string) bool {
+    if name == "" || strings.HasPrefix(name, "/") || strings.ContainsAny(name, "\\\x00") {
+        return false
+    }
+    if len(name) >= 2 && name[1] == ':' {
+        return false
+    }
+    for i, el := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+        if el == ".." || el == "." || el == "" && i > 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// CheckArchive returns an error wrapping ErrUnsafeArchive if files, the
+// entries of a replay archive, have duplicate or unsafe names, overlapping
+// data (as in "non-recursive" zip bombs) or exceed lim.
+func CheckArchive(files []*zip.File, lim ArchiveLimits) error {
+    seen := make(map[string]bool, len(files))
+    for _, f := range files {
+        if !SafeEntryName(f.Name) {
+            return fmt.Errorf("%w: entry name %q", ErrUnsafeArchive, f.Name)
+        }
+        if seen[f.Name] {
+            return fmt.Errorf("%w: duplicate entry %q", ErrUnsafeArchive, f.Name)
+        }
+        seen[f.Name] = true
+    }
+    return checkLayout(files, lim)
+}
+
+// checkLayout is CheckArchive without the name checks, for callers that
+// handle bad names themselves (the validator and CleanFile).
+func checkLayout(files []*zip.File, lim ArchiveLimits) error {
+    if lim.MaxEntries > 0 && len(files) > lim.MaxEntries {
+        return fmt.Errorf("%w: %d entries (limit %d)", ErrUnsafeArchive, len(files), lim.MaxEntries)
+    }
+    var total uint64
+    for _, f := range files {
+        total += f.UncompressedSize64
+        if lim.MaxUncompressed > 0 && total > lim.MaxUncompressed {
+            return fmt.Errorf("%w: more than %d bytes uncompressed", ErrUnsafeArchive, lim.MaxUncompressed)
+        }
+    }
+
+    // Entries must not share compressed data: overlapping entries let a small
+    // file expand to many times the limit above
+    type span struct {
+        start, end int64
+        name       string
+    }
+    spans := make([]span, 0, len(files))
+    for _, f := range files {
+        off, err := f.DataOffset()
+        if err != nil {
+            return fmt.Errorf("entry %s: %w", f.Name, err)
+        }
+        spans = append(spans, span{off, off + int64(f.CompressedSize64), f.Name})
+    }
+    sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+    for i := 1; i < len(spans); i++ {
+        if spans[i].start < spans[i-1].end {
+            return fmt.Errorf("%w: entries %s and %s overlap", ErrUnsafeArchive, spans[i-1].name, spans[i].name)
+        }
+    }
+    return nil
+}
+
+// openZip opens the replay at path after checking it with CheckArchive.
+func openZip(path string) (*zip.ReadCloser, error) {
+    zr, err := zip.OpenReader(path)
+    if err != nil {
+        return nil, err
+    }
+    if err := CheckArchive(zr.File, DefaultArchiveLimits); err != nil {
+        _ = zr.Close()
+        return nil, err
+    }
+    return zr, nil
+}
@@ -0,0 +1,359 @@
+package mcpr
+
+import (
+    "encoding/binary"
+    "fmt"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// SamplingLevel is how much adaptive sampling leaves out, see
+// Writer.SetSampling. Each level includes the ones before it.
+type SamplingLevel int
+
+const (
+    SampleAll       SamplingLevel = iota // everything is recorded
+    SampleParticles                      // particles are dropped
+    SampleMovement                       // entity movement is merged to one update per entity per 100ms
+    SampleSounds                         // sounds are dropped
+)
+
+func (l SamplingLevel) String() string {
+    switch l {
+    case SampleAll:
+        return "all"
+    case SampleParticles:
+        return "no particles"
+    case SampleMovement:
+        return "no particles, decimated movement"
+    case SampleSounds:
+        return "no particles, decimated movement, no sounds"
+    }
+    return fmt.Sprintf("SamplingLevel(%d)", int(l))
+}
+
+// Sampling configures adaptive sampling, see Writer.SetSampling.
+type Sampling struct {
+    Rate    int           // packets per second of recording time above which the source is overloaded
+    Sustain time.Duration // how long overload lasts before the next level applies; default 2s
+    Recover time.Duration // how long the rate stays at or below Rate before a level is lifted; default 10s
+
+    // OnChange, if set, is called with the new level and the rate of the
+    // second that caused the change, e.g. to log it.
+    OnChange func(level SamplingLevel, rate int)
+}
+
+// SampledPeriod is a stretch of a recording written at a sampling level
+// above SampleAll, as kept in metaDataExt.json.
+type SampledPeriod struct {
+    Start   uint32        `json:"start"` // ms
+    End     uint32        `json:"end"`
+    Level   SamplingLevel `json:"level"`
+    Dropped int64         `json:"dropped"` // packets not written as received
+}
+
+// decimateMS is how often movement of one entity is written in SampleMovement.
+const decimateMS = 100
+
+// sampler implements adaptive sampling, see Writer.SetSampling.
+type sampler struct {
+    cfg   Sampling
+    state *protocol.Tracker
+    level SamplingLevel
+
+    particles, sounds      map[int32]bool
+    pos, posRot, rot       int32 // movement packets merged by decimation
+    head, motion, teleport int32
+
+    win     uint32 // start of the current second
+    count   int    // packets offered in it
+    over    uint32 // ms of sustained overload
+    under   uint32 // ms of sustained normal rate
+    periods []SampledPeriod
+    moves   map[int32]*pendingMove // by entity id
+    sweep   uint32                 // next time to flush due moves
+    out     []sampledFrame
+}
+
+// pendingMove is movement of one entity held back by decimation.
+type pendingMove struct {
+    sent       uint32 // time movement of the entity was last written
+    dx, dy, dz int32  // sum of the relative moves held back
+    moved      bool
+    rot        []byte // yaw, pitch
+    onGround   byte
+    head       []byte // head yaw
+    motion     []byte // velocity
+}
+
+type sampledFrame struct {
+    ts      uint32
+    id      int32
+    payload []byte
+}
+
+// SetSampling makes the writer thin out the recording while its source sends
+// more than s.Rate packets per second, instead of falling behind or dropping
+// packets at random, so replays of overloaded servers stay watchable. After
+// s.Sustain of overload it stops recording particles; if the overload
+// persists, it merges the movement of each entity into one update per 100ms,
+// adding up relative moves so that positions stay exact; then it stops
+// recording sounds. Each level is lifted again after s.Recover at a normal
+// rate. Rates are measured on the timestamps of the packets written, dropped
+// ones included, in whole seconds.
+//
+// Only play packets are sampled. The stretches written at each level are
+// recorded in metaDataExt.json (ExtMeta.Sampled), so viewers can tell a
+// thinned-out recording from a quiet server.
+//
+// initial is the connection state of the first packet, as for
+// TrackDimensions. Call it before writing packets; a Rate of 0 disables
+// sampling. It fails if the writer's protocol has no packet table.
+//
+// Deprecated: Use WithSampling.
+func (w *Writer) SetSampling(s Sampling, initial protocol.State) error {
+    defer w.lock().unlock()
+    if s.Rate <= 0 {
+        w.samp = nil
+        return nil
+    }
+    t, ok := protocol.Lookup(w.meta.Protocol)
+    if !ok {
+        return fmt.Errorf("mcpr: no packet table for protocol %d", w.meta.Protocol)
+    }
+    if s.Sustain <= 0 {
+        s.Sustain = 2 * time.Second
+    }
+    if s.Recover <= 0 {
+        s.Recover = 10 * time.Second
+    }
+    id := func(name string) int32 {
+        if id, ok := t.ID(protocol.Clientbound, protocol.Play, name); ok {
+            return id
+        }
+        return -1
+    }
+    ids := func(names ...string) map[int32]bool {
+        m := map[int32]bool{}
+        for _, n := range names {
+            if id, ok := t.ID(protocol.Clientbound, protocol.Play, n); ok {
+                m[id] = true
+            }
+        }
+        return m
+    }
+    w.samp = &sampler{
+        cfg:       s,
+        state:     protocol.NewTracker(t, initial),
+        particles: ids("LevelParticles"),
+        // StopSound is kept: sounds started before sampling must still end
+        sounds:   ids("Sound", "SoundEntity"),
+        pos:      id("MoveEntityPos"),
+        posRot:   id("MoveEntityPosRot"),
+        rot:      id("MoveEntityRot"),
+        head:     id("RotateHead"),
+        motion:   id("SetEntityMotion"),
+        teleport: id("TeleportEntity"),
+        moves:    map[int32]*pendingMove{},
+    }
+    return nil
+}
+
+// SamplingLevel returns the current sampling level; SampleAll unless
+// SetSampling is in effect.
+func (w *Writer) SamplingLevel() SamplingLevel {
+    defer w.lock().unlock()
+    w.drain()
+    if w.samp == nil {
+        return SampleAll
+    }
+    return w.samp.level
+}
+
+// filter feeds a packet at ts and returns the frames to write in its place:
+// none, the packet, or held-back movement followed by the packet. The result
+// is only valid until the next call.
+func (s *sampler) filter(ts uint32, id int32, payload []byte) []sampledFrame {
+    s.out = s.out[:0]
+    s.measure(ts)
+    if s.state.Observe(id) != protocol.Play {
+        s.flush(ts, true)
+        return append(s.out, sampledFrame{ts, id, payload})
+    }
+    if ts >= s.sweep {
+        s.flush(ts, false)
+        s.sweep = ts + decimateMS/2
+    }
+    switch {
+    case s.level >= SampleParticles && s.particles[id],
+        s.level >= SampleSounds && s.sounds[id]:
+        s.periods[len(s.periods)-1].Dropped++
+        return s.out
+    case s.level >= SampleMovement && !s.decimate(ts, id, payload):
+        return s.out
+    }
+    return append(s.out, sampledFrame{ts, id, payload})
+}
+
+// measure counts a packet at ts and changes the level once a second.
+func (s *sampler) measure(ts uint32) {
+    if ts < s.win+1000 {
+        s.count++
+        return
+    }
+    rate := s.count
+    if ts >= s.win+2000 {
+        // Seconds without packets count as normal
+        s.under += (ts-s.win)/1000*1000 - 1000
+    }
+    s.win = ts - (ts-s.win)%1000
+    s.count = 1
+    if rate > s.cfg.Rate {
+        s.over += 1000
+        s.under = 0
+    } else {
+        s.under += 1000
+        s.over = 0
+    }
+    switch {
+    case s.over >= uint32(s.cfg.Sustain/time.Millisecond) && s.level < SampleSounds:
+        s.over = 0
+        s.setLevel(ts, s.level+1, rate)
+    case s.under >= uint32(s.cfg.Recover/time.Millisecond) && s.level > SampleAll:
+        s.under = 0
+        s.setLevel(ts, s.level-1, rate)
+    }
+}
+
+func (s *sampler) setLevel(ts uint32, level SamplingLevel, rate int) {
+    if s.level > SampleAll {
+        s.periods[len(s.periods)-1].End = ts
+    }
+    if s.level >= SampleMovement && level < SampleMovement {
+        s.flush(ts, true)
+    }
+    s.level = level
+    if level > SampleAll {
+        s.periods = append(s.periods, SampledPeriod{Start: ts, Level: level})
+    }
+    if s.cfg.OnChange != nil {
+        s.cfg.OnChange(level, rate)
+    }
+}
+
+// decimate holds back movement of an entity written less than decimateMS
+// ago, merging it into what is pending, and reports whether the packet is to
+// be written as is. Packets it cannot parse are written.
+func (s *sampler) decimate(ts uint32, id int32, payload []byte) bool {
+    if id != s.pos && id != s.posRot && id != s.rot && id != s.head && id != s.motion && id != s.teleport {
+        return true
+    }
+    eid, n, err := tmcpr.DecodeVarInt(payload)
+    if err != nil {
+        return true
+    }
+    body := payload[n:]
+    m := s.moves[eid]
+    if id == s.teleport {
+        // Absolute: pending moves no longer apply
+        if m != nil {
+            *m = pendingMove{sent: ts}
+        }
+        return true
+    }
+    if m == nil {
+        s.moves[eid] = &pendingMove{sent: ts}
+        return true
+    }
+    due := ts-m.sent >= decimateMS
+    switch {
+    case (id == s.pos && len(body) == 7) || (id == s.posRot && len(body) == 9):
+        dx := int32(int16(binary.BigEndian.Uint16(body[0:2])))
+        dy := int32(int16(binary.BigEndian.Uint16(body[2:4])))
+        dz := int32(int16(binary.BigEndian.Uint16(body[4:6])))
+        if !fitsDelta(m.dx+dx) || !fitsDelta(m.dy+dy) || !fitsDelta(m.dz+dz) {
+            s.emit(ts, eid, m)
+        }
+        m.dx, m.dy, m.dz, m.moved = m.dx+dx, m.dy+dy, m.dz+dz, true
+        if id == s.posRot {
+            m.rot = append(m.rot[:0], body[6:8]...)
+        }
+        m.onGround = body[len(body)-1]
+    case id == s.rot && len(body) == 3:
+        m.rot = append(m.rot[:0], body[0:2]...)
+        m.onGround = body[2]
+    case id == s.head && len(body) == 1:
+        m.head = append(m.head[:0], body[0])
+    case id == s.motion && len(body) == 6:
+        m.motion = append(m.motion[:0], body...)
+    default:
+        return true
+    }
+    if due {
+        s.emit(ts, eid, m)
+    } else {
+        s.periods[len(s.periods)-1].Dropped++
+    }
+    return false
+}
+
+func fitsDelta(d int32) bool {
+    return d >= -32768 && d <= 32767
+}
+
+// flush writes held-back movement: all of it, or that of entities due for
+// an update, forgetting entities that have not moved for a while.
+func (s *sampler) flush(ts uint32, all bool) {
+    for eid, m := range s.moves {
+        if all || ts-m.sent >= decimateMS {
+            s.emit(ts, eid, m)
+            if all || ts-m.sent >= 10*decimateMS {
+                delete(s.moves, eid)
+            }
+        }
+    }
+}
+
+// emit appends the movement pending for entity eid as packets at ts.
+func (s *sampler) emit(ts uint32, eid int32, m *pendingMove) {
+    if !m.moved && m.rot == nil && m.head == nil && m.motion == nil {
+        return
+    }
+    packet := func(id int32, body ...byte) {
+        s.out = append(s.out, sampledFrame{ts, id, append(encodeVarInt(eid), body...)})
+    }
+    delta := func() []byte {
+        var b [6]byte
+        binary.BigEndian.PutUint16(b[0:2], uint16(int16(m.dx)))
+        binary.BigEndian.PutUint16(b[2:4], uint16(int16(m.dy)))
+        binary.BigEndian.PutUint16(b[4:6], uint16(int16(m.dz)))
+        return b[:]
+    }
+    switch {
+    case m.moved && m.rot != nil:
+        packet(s.posRot, append(append(delta(), m.rot...), m.onGround)...)
+    case m.moved:
+        packet(s.pos, append(delta(), m.onGround)...)
+    case m.rot != nil:
+        packet(s.rot, append(m.rot, m.onGround)...)
+    }
+    if m.head != nil {
+        packet(s.head, m.head...)
+    }
+    if m.motion != nil {
+        packet(s.motion, m.motion...)
+    }
+    *m = pendingMove{sent: ts}
+}
+
+// finish flushes held-back movement at ts and closes the last period.
+func (s *sampler) finish(ts uint32) []sampledFrame {
+    s.out = s.out[:0]
+    s.flush(ts, true)
+    if s.level > SampleAll {
+        s.periods[len(s.periods)-1].End = ts
+    }
+    return s.out
+}
@@ -0,0 +1,285 @@
+// Package schedule decides when scheduled recordings run. A Schedule is a set
+// of windows given either as fixed start/end times or as cron expressions with
+// a duration, e.g. for servers that only want replays of event nights.
+//
+// Spec forms accepted by Parse:
+//
+//	2026-10-20T20:00/2026-10-20T23:00   fixed window (local time unless an offset is given)
+//	2026-10-20T20:00/3h                 fixed start with a duration
+//	0 20 * * FRI 3h                     every Friday 20:00 for three hours
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a period during which recording is enabled. End is exclusive.
+type Window struct {
+	Start, End time.Time
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+func (w Window) String() string {
+	return w.Start.Format("2006-01-02 15:04") + " – " + w.End.Format("2006-01-02 15:04")
+}
+
+// rule is one entry of a Schedule.
+type rule interface {
+	// latest returns the window containing t that ends last, if any.
+	latest(t time.Time) (Window, bool)
+	// next returns the first window starting after t, if any.
+	next(t time.Time) (Window, bool)
+}
+
+// Schedule is a set of recording windows.
+type Schedule struct {
+	rules []rule
+}
+
+// Parse builds a schedule from one or more specs (see package doc).
+func Parse(specs ...string) (*Schedule, error) {
+	s := &Schedule{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		var r rule
+		var err error
+		if strings.Contains(spec, "/") && !strings.Contains(spec, " ") {
+			r, err = parseFixed(spec)
+		} else {
+			r, err = parseCron(spec)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Active returns the window containing t, if recording should be on. When
+// windows overlap the one ending last is returned.
+func (s *Schedule) Active(t time.Time) (Window, bool) {
+	var best Window
+	found := false
+	for _, r := range s.rules {
+		if w, ok := r.latest(t); ok && (!found || w.End.After(best.End)) {
+			best, found = w, true
+		}
+	}
+	return best, found
+}
+
+// Next returns the earliest window starting after t.
+func (s *Schedule) Next(t time.Time) (Window, bool) {
+	var best Window
+	found := false
+	for _, r := range s.rules {
+		if w, ok := r.next(t); ok && (!found || w.Start.Before(best.Start)) {
+			best, found = w, true
+		}
+	}
+	return best, found
+}
+
+// fixed is a one-off window.
+type fixed Window
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+func parseTime(s string) (time.Time, error) {
+	for _, l := range timeLayouts {
+		if t, err := time.ParseInLocation(l, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func parseFixed(spec string) (rule, error) {
+	a, b, _ := strings.Cut(spec, "/")
+	start, err := parseTime(a)
+	if err != nil {
+		return nil, err
+	}
+	var end time.Time
+	if d, err := time.ParseDuration(b); err == nil {
+		end = start.Add(d)
+	} else if end, err = parseTime(b); err != nil {
+		return nil, err
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end before start")
+	}
+	return fixed{Start: start, End: end}, nil
+}
+
+func (f fixed) latest(t time.Time) (Window, bool) {
+	return Window(f), Window(f).Contains(t)
+}
+
+func (f fixed) next(t time.Time) (Window, bool) {
+	return Window(f), f.Start.After(t)
+}
+
+// cron is a recurring window: a five-field cron expression (minute hour
+// day-of-month month day-of-week) giving start times, plus a duration.
+type cron struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+	domStar, dowStar              bool
+	dur                           time.Duration
+}
+
+var (
+	monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	dayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+func parseCron(spec string) (rule, error) {
+	f := strings.Fields(spec)
+	if len(f) != 6 {
+		return nil, fmt.Errorf("want \"min hour dom month dow duration\"")
+	}
+	c := &cron{domStar: f[2] == "*", dowStar: f[4] == "*"}
+	var err error
+	if c.minute, err = parseField(f[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseField(f[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseField(f[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseField(f[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseField(f[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is Sunday too
+	}
+	if c.dur, err = time.ParseDuration(f[5]); err != nil || c.dur <= 0 {
+		return nil, fmt.Errorf("invalid duration %q", f[5])
+	}
+	return c, nil
+}
+
+// parseField parses a cron field: "*", "5", "1-5", "*/15", "MON-FRI", or a
+// comma-separated list of those. names (if any) map to min, min+1, ...
+func parseField(s string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = fieldValue(a, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = fieldValue(b, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func fieldValue(s string, min, max int, names []string) (int, error) {
+	for i, n := range names {
+		if strings.EqualFold(s, n) {
+			return min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid value %q (want %d-%d)", s, min, max)
+	}
+	return v, nil
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+	return dom || dow // cron: either restricted day field may match
+}
+
+// searchLimit bounds the search for the next start, e.g. for "0 0 30 2 *".
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// nextStart returns the first start time at or after t.
+func (c *cron) nextStart(t time.Time) (time.Time, bool) {
+	if r := t.Truncate(time.Minute); r.Before(t) {
+		t = r.Add(time.Minute)
+	}
+	limit := t.Add(searchLimit)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		if !c.dayMatches(t) {
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func (c *cron) latest(t time.Time) (Window, bool) {
+	var w Window
+	found := false
+	for s, ok := c.nextStart(t.Add(-c.dur).Add(time.Nanosecond)); ok && !s.After(t); s, ok = c.nextStart(s.Add(time.Minute)) {
+		w, found = Window{Start: s, End: s.Add(c.dur)}, true
+	}
+	return w, found
+}
+
+func (c *cron) next(t time.Time) (Window, bool) {
+	s, ok := c.nextStart(t.Add(time.Nanosecond))
+	return Window{Start: s, End: s.Add(c.dur)}, ok
+}
@@ -0,0 +1,373 @@
+// Package scoreboard reconstructs the scoreboard (objectives, scores, display
+// slots, teams) and the boss bars of a replay over time, so minigame results
+// can be read from recordings.
+//
+// Events are decoded from the clientbound packets; Timeline.At replays them
+// to the state the client saw at any time. Text fields are plain text with
+// the original JSON chat components kept alongside.
+package scoreboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Display slots of SetDisplayObjective. Slots 3-18 are the sidebars shown to
+// members of teams of each of the 16 colors.
+const (
+	DisplayList      = 0
+	DisplaySidebar   = 1
+	DisplayBelowName = 2
+)
+
+// Objective is a scoreboard objective and its scores.
+type Objective struct {
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+	RawName     string           `json:"rawDisplayName,omitempty"` // JSON chat component
+	Hearts      bool             `json:"hearts,omitempty"`         // rendered as hearts instead of numbers
+	Scores      map[string]int32 `json:"scores"`                   // by score holder (player name or entity UUID)
+}
+
+// Score is one entry of a ranking.
+type Score struct {
+	Holder string `json:"holder"`
+	Value  int32  `json:"value"`
+}
+
+// Ranking returns the scores from highest to lowest, ties by holder name, as
+// the sidebar orders them.
+func (o *Objective) Ranking() []Score {
+	out := make([]Score, 0, len(o.Scores))
+	for h, v := range o.Scores {
+		out = append(out, Score{Holder: h, Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Value != out[j].Value {
+			return out[i].Value > out[j].Value
+		}
+		return out[i].Holder < out[j].Holder
+	})
+	return out
+}
+
+// Team is a scoreboard team.
+type Team struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+	Prefix      string   `json:"prefix,omitempty"`
+	Suffix      string   `json:"suffix,omitempty"`
+	Color       int      `json:"color"` // chat color index; 21 is reset (none)
+	Members     []string `json:"members"`
+}
+
+// BossBar is a boss bar shown at the top of the screen.
+type BossBar struct {
+	UUID     string  `json:"uuid"`
+	Title    string  `json:"title"`
+	RawTitle string  `json:"rawTitle,omitempty"` // JSON chat component
+	Health   float32 `json:"health"`             // 0-1
+	Color    int     `json:"color"`              // pink, blue, red, green, yellow, purple, white
+	Division int     `json:"division"`           // none, 6, 10, 12 or 20 notches
+	Flags    byte    `json:"flags"`              // 1 darken sky, 2 dragon bar, 4 fog
+}
+
+// State is the scoreboard and boss bars at one point in time.
+type State struct {
+	Objectives map[string]*Objective `json:"objectives"`
+	Display    map[int]string        `json:"display"` // display slot → objective name
+	Teams      map[string]*Team      `json:"teams"`
+	BossBars   map[string]*BossBar   `json:"bossBars"` // by UUID
+}
+
+// Sidebar returns the objective shown in the sidebar, or nil.
+func (s *State) Sidebar() *Objective {
+	return s.Objectives[s.Display[DisplaySidebar]]
+}
+
+func newState() *State {
+	return &State{
+		Objectives: map[string]*Objective{},
+		Display:    map[int]string{},
+		Teams:      map[string]*Team{},
+		BossBars:   map[string]*BossBar{},
+	}
+}
+
+// Event is one decoded update; exactly one of its pointer fields is set.
+type Event struct {
+	Time      uint32          `json:"time"` // ms
+	Objective *ObjectiveEvent `json:"objective,omitempty"`
+	Display   *DisplayEvent   `json:"display,omitempty"`
+	Score     *ScoreEvent     `json:"score,omitempty"`
+	Team      *TeamEvent      `json:"team,omitempty"`
+	BossBar   *BossBarEvent   `json:"bossBar,omitempty"`
+}
+
+// ObjectiveEvent creates, updates or removes an objective.
+type ObjectiveEvent struct {
+	Action string    `json:"action"` // create, remove, update
+	Info   Objective `json:"info"`   // without scores
+}
+
+// DisplayEvent shows an objective in a display slot ("" clears it).
+type DisplayEvent struct {
+	Slot      int    `json:"slot"`
+	Objective string `json:"objective"`
+}
+
+// ScoreEvent sets or removes a score. An empty Objective removes the holder
+// from all objectives.
+type ScoreEvent struct {
+	Action    string `json:"action"` // set, remove
+	Holder    string `json:"holder"`
+	Objective string `json:"objective"`
+	Value     int32  `json:"value,omitempty"`
+}
+
+// TeamEvent creates, removes or updates a team, or changes its members.
+type TeamEvent struct {
+	Action  string   `json:"action"` // create, remove, update, join, leave
+	Info    Team     `json:"info"`   // Name only, except for create and update
+	Members []string `json:"members,omitempty"`
+}
+
+// BossBarEvent adds, removes or updates a boss bar.
+type BossBarEvent struct {
+	Action string  `json:"action"` // add, remove, health, title, style, flags
+	Bar    BossBar `json:"bar"`    // UUID and the fields the action sets
+}
+
+// Timeline is the scoreboard history of a replay.
+type Timeline struct {
+	Protocol int     `json:"protocol"`
+	Events   []Event `json:"events"`
+}
+
+// At reconstructs the state at time t (ms).
+func (tl *Timeline) At(t uint32) *State {
+	s := newState()
+	for _, ev := range tl.Events {
+		if ev.Time > t {
+			break
+		}
+		s.apply(ev)
+	}
+	return s
+}
+
+// Final returns the state at the end of the replay.
+func (tl *Timeline) Final() *State {
+	return tl.At(^uint32(0))
+}
+
+// WriteJSON writes the timeline as indented JSON.
+func (tl *Timeline) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tl)
+}
+
+func (s *State) apply(ev Event) {
+	switch {
+	case ev.Objective != nil:
+		o := ev.Objective.Info
+		switch ev.Objective.Action {
+		case "create":
+			o.Scores = map[string]int32{}
+			s.Objectives[o.Name] = &o
+		case "update":
+			if cur := s.Objectives[o.Name]; cur != nil {
+				cur.DisplayName, cur.RawName, cur.Hearts = o.DisplayName, o.RawName, o.Hearts
+			}
+		case "remove":
+			delete(s.Objectives, o.Name)
+			for slot, name := range s.Display {
+				if name == o.Name {
+					delete(s.Display, slot)
+				}
+			}
+		}
+	case ev.Display != nil:
+		if ev.Display.Objective == "" {
+			delete(s.Display, ev.Display.Slot)
+		} else {
+			s.Display[ev.Display.Slot] = ev.Display.Objective
+		}
+	case ev.Score != nil:
+		sc := ev.Score
+		switch {
+		case sc.Action == "set":
+			if o := s.Objectives[sc.Objective]; o != nil {
+				o.Scores[sc.Holder] = sc.Value
+			}
+		case sc.Objective == "":
+			for _, o := range s.Objectives {
+				delete(o.Scores, sc.Holder)
+			}
+		default:
+			if o := s.Objectives[sc.Objective]; o != nil {
+				delete(o.Scores, sc.Holder)
+			}
+		}
+	case ev.Team != nil:
+		te := ev.Team
+		cur := s.Teams[te.Info.Name]
+		switch te.Action {
+		case "create":
+			t := te.Info
+			t.Members = append([]string{}, te.Members...)
+			s.Teams[t.Name] = &t
+		case "remove":
+			delete(s.Teams, te.Info.Name)
+		case "update":
+			if cur != nil {
+				members := cur.Members
+				*cur = te.Info
+				cur.Members = members
+			}
+		case "join":
+			if cur != nil {
+				cur.Members = append(cur.Members, te.Members...)
+			}
+		case "leave":
+			if cur != nil {
+				cur.Members = without(cur.Members, te.Members)
+			}
+		}
+	case ev.BossBar != nil:
+		b := ev.BossBar.Bar
+		cur := s.BossBars[b.UUID]
+		if ev.BossBar.Action == "add" {
+			s.BossBars[b.UUID] = &b
+			return
+		}
+		if cur == nil {
+			return
+		}
+		switch ev.BossBar.Action {
+		case "remove":
+			delete(s.BossBars, b.UUID)
+		case "health":
+			cur.Health = b.Health
+		case "title":
+			cur.Title, cur.RawTitle = b.Title, b.RawTitle
+		case "style":
+			cur.Color, cur.Division = b.Color, b.Division
+		case "flags":
+			cur.Flags = b.Flags
+		}
+	}
+}
+
+func without(list, remove []string) []string {
+	drop := map[string]bool{}
+	for _, r := range remove {
+		drop[r] = true
+	}
+	out := list[:0:0]
+	for _, m := range list {
+		if !drop[m] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// ErrUnsupported is returned for protocols without scoreboard decoders.
+var ErrUnsupported = errors.New("scoreboard: protocol not supported")
+
+// decoders decode the scoreboard and boss bar packets of a protocol version,
+// keyed by protocol and packet name.
+var decoders = map[int]map[string]func(d *wire.Decoder) Event{
+	764: {
+		"SetObjective":        objective764,
+		"SetDisplayObjective": display764,
+		"SetScore":            score764,
+		"SetPlayerTeam":       team764,
+		"BossEvent":           bossBar764,
+	},
+}
+
+// Analyzer builds a Timeline from the clientbound packets of a recording.
+type Analyzer struct {
+	tracker *protocol.Tracker
+	byID    map[int32]func(d *wire.Decoder) Event
+	tl      Timeline
+}
+
+// NewAnalyzer returns an analyzer for a recording of the given protocol that
+// starts in state s (protocol.Login for ReplayMod recordings).
+func NewAnalyzer(proto int, s protocol.State) (*Analyzer, error) {
+	table, ok := protocol.Lookup(proto)
+	decs := decoders[proto]
+	if !ok || decs == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, proto)
+	}
+	a := &Analyzer{
+		tracker: protocol.NewTracker(table, s),
+		byID:    map[int32]func(d *wire.Decoder) Event{},
+		tl:      Timeline{Protocol: proto, Events: []Event{}},
+	}
+	for name, dec := range decs {
+		if id, ok := table.ID(protocol.Clientbound, protocol.Play, name); ok {
+			a.byID[id] = dec
+		}
+	}
+	return a, nil
+}
+
+// Observe feeds one packet.
+func (a *Analyzer) Observe(ts uint32, id int32, payload []byte) error {
+	if a.tracker.Observe(id) != protocol.Play {
+		return nil
+	}
+	dec := a.byID[id]
+	if dec == nil {
+		return nil
+	}
+	d := wire.NewDecoder(payload)
+	ev := dec(d)
+	if d.Err != nil {
+		return fmt.Errorf("packet 0x%02x at %d ms: %w", id, ts, d.Err)
+	}
+	if ev.Objective == nil && ev.Display == nil && ev.Score == nil && ev.Team == nil && ev.BossBar == nil {
+		return nil
+	}
+	ev.Time = ts
+	a.tl.Events = append(a.tl.Events, ev)
+	return nil
+}
+
+// Timeline returns the events observed so far.
+func (a *Analyzer) Timeline() *Timeline {
+	return &a.tl
+}
+
+// Extract builds the scoreboard timeline of the replay at path.
+func Extract(path string) (*Timeline, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	a, err := NewAnalyzer(ar.Meta.Protocol, protocol.Login)
+	if err != nil {
+		return nil, err
+	}
+	err = ar.Each(func(f tmcpr.Frame) error {
+		return a.Observe(f.Time, f.ID, f.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.Timeline(), nil
+}
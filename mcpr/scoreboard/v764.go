@@ -0,0 +1,98 @@
+package scoreboard
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+
+// 1.20.2 layouts. Chat components are JSON strings.
+
+// SetObjective: name:string mode:byte [displayName:chat type:varint]
+func objective764(d *wire.Decoder) Event {
+	o := Objective{Name: d.String()}
+	mode := d.Byte()
+	if mode == 0 || mode == 2 {
+		o.RawName = d.String()
+		o.DisplayName = wire.PlainText(o.RawName)
+		o.Hearts = d.VarInt() == 1
+	}
+	action := map[byte]string{0: "create", 1: "remove", 2: "update"}[mode]
+	if action == "" {
+		return Event{}
+	}
+	return Event{Objective: &ObjectiveEvent{Action: action, Info: o}}
+}
+
+// SetDisplayObjective: position:varint name:string
+func display764(d *wire.Decoder) Event {
+	slot := int(d.VarInt())
+	return Event{Display: &DisplayEvent{Slot: slot, Objective: d.String()}}
+}
+
+// SetScore: holder:string action:varint objective:string [value:varint]
+func score764(d *wire.Decoder) Event {
+	sc := &ScoreEvent{Action: "set", Holder: d.String()}
+	if d.VarInt() == 1 {
+		sc.Action = "remove"
+	}
+	sc.Objective = d.String()
+	if sc.Action == "set" {
+		sc.Value = d.VarInt()
+	}
+	return Event{Score: sc}
+}
+
+// SetPlayerTeam: name:string mode:byte, then for create/update:
+// displayName:chat friendlyFlags:byte nameTagVisibility:string
+// collisionRule:string color:varint prefix:chat suffix:chat, and for
+// create/join/leave: count:varint members:string×count
+func team764(d *wire.Decoder) Event {
+	te := &TeamEvent{Info: Team{Name: d.String()}}
+	mode := d.Byte()
+	te.Action = map[byte]string{0: "create", 1: "remove", 2: "update", 3: "join", 4: "leave"}[mode]
+	if te.Action == "" {
+		return Event{}
+	}
+	if mode == 0 || mode == 2 {
+		te.Info.DisplayName = wire.PlainText(d.String())
+		d.Skip(1)
+		_ = d.String()
+		_ = d.String()
+		te.Info.Color = int(d.VarInt())
+		te.Info.Prefix = wire.PlainText(d.String())
+		te.Info.Suffix = wire.PlainText(d.String())
+	}
+	if mode == 0 || mode == 3 || mode == 4 {
+		for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+			te.Members = append(te.Members, d.String())
+		}
+	}
+	return Event{Team: te}
+}
+
+// BossEvent: uuid action:varint, then per action:
+// 0 add: title:chat health:float color:varint division:varint flags:byte
+// 1 remove, 2 health:float, 3 title:chat, 4 style: color:varint division:varint,
+// 5 flags:byte
+func bossBar764(d *wire.Decoder) Event {
+	ev := &BossBarEvent{Bar: BossBar{UUID: d.UUID()}}
+	b := &ev.Bar
+	action := d.VarInt()
+	if action == 0 || action == 3 {
+		b.RawTitle = d.String()
+		b.Title = wire.PlainText(b.RawTitle)
+	}
+	if action == 0 || action == 2 {
+		b.Health = d.Float()
+	}
+	if action == 0 || action == 4 {
+		b.Color = int(d.VarInt())
+		b.Division = int(d.VarInt())
+	}
+	if action == 0 || action == 5 {
+		b.Flags = d.Byte()
+	}
+	names := []string{"add", "remove", "health", "title", "style", "flags"}
+	if action < 0 || int(action) >= len(names) {
+		return Event{}
+	}
+	ev.Action = names[action]
+	return Event{BossBar: ev}
+}
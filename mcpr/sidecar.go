@@ -0,0 +1,72 @@
+package mcpr
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Sidecar is the content of the optional companion file written next to a
+// replay as <path>.json (e.g. session.mcpr.json). It lets indexing services
+// read metadata, stats, and checksums without opening the ZIP archive.
+type Sidecar struct {
+    Meta           Meta   `json:"meta"`
+    Packets        int64  `json:"packets"`
+    RecordingBytes int64  `json:"recordingBytes"` // uncompressed size of recording.tmcpr
+    RecordingCRC32 uint32 `json:"recordingCrc32"` // same value as recording.tmcpr.crc32
+    Size           int64  `json:"size"`           // size of the .mcpr file in bytes
+    SHA256         string `json:"sha256"`         // hex SHA-256 of the .mcpr file
+
+    Dimensions []DimensionSegment `json:"dimensions,omitempty"` // see Writer.TrackDimensions
+}
+
+// SidecarPath returns the sidecar file path for the replay at path.
+func SidecarPath(path string) string {
+    return path + ".json"
+}
+
+// WriteSidecar writes the sidecar for the replay at path. Size and SHA256 are
+// computed from the replay file; the remaining fields are taken from sc.
+// The file is written to a temporary name and renamed into place so readers
+// never observe a partial sidecar.
+func WriteSidecar(path string, sc Sidecar) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    h := sha256.New()
+    n, err := io.Copy(h, f)
+    _ = f.Close()
+    if err != nil {
+        return fmt.Errorf("hash %s: %w", path, err)
+    }
+    sc.Size = n
+    sc.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+    b, err := json.MarshalIndent(sc, "", "  ")
+    if err != nil {
+        return fmt.Errorf("marshal sidecar: %w", err)
+    }
+    dst := SidecarPath(path)
+    tmp := dst + ".tmp"
+    if err := os.WriteFile(tmp, b, 0o644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, dst)
+}
+
+// ReadSidecar reads the sidecar for the replay at path.
+func ReadSidecar(path string) (Sidecar, error) {
+    var sc Sidecar
+    b, err := os.ReadFile(SidecarPath(path))
+    if err != nil {
+        return sc, err
+    }
+    if err := json.Unmarshal(b, &sc); err != nil {
+        return sc, fmt.Errorf("parse sidecar: %w", err)
+    }
+    return sc, nil
+}
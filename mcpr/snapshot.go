@@ -0,0 +1,285 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "time"
+)
+
+// EnableSnapshots makes the writer keep an uncompressed copy of
+// recording.tmcpr in a temporary file in dir (os.TempDir() if empty), so
+// Snapshot can expose the recording while it is being written. The copy is
+// removed on Close. Call it before writing packets.
+//
+// Deprecated: Use WithSnapshots.
+func (w *Writer) EnableSnapshots(dir string) error {
+    defer w.lock().unlock()
+    if w.closed {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if w.recBytes > 0 {
+        return fmt.Errorf("mcpr: EnableSnapshots called after packets were written")
+    }
+    if w.spool != nil {
+        return nil
+    }
+    f, err := os.CreateTemp(dir, "mcpr-snapshot-*.tmcpr")
+    if err != nil {
+        return err
+    }
+    w.spool = f
+    if w.recw != nil { // else newWriter adds the spool once the recording entry exists
+        w.recw = io.MultiWriter(w.recw, f)
+    }
+    return nil
+}
+
+// SpoolPath returns the path of the uncompressed copy of recording.tmcpr kept
+// for snapshots, or "" if snapshots are not enabled. Other processes can
+// follow the recording in it with OpenTail; it is removed on Close.
+func (w *Writer) SpoolPath() string {
+    defer w.lock().unlock()
+    if w.spool == nil {
+        return ""
+    }
+    return w.spool.Name()
+}
+
+// closeSpool removes the snapshot copy; open snapshots keep their handle.
+func (w *Writer) closeSpool() {
+    if w.spool == nil {
+        return
+    }
+    _ = w.spool.Close()
+    _ = os.Remove(w.spool.Name())
+    w.spool = nil
+}
+
+// Snapshot returns a consistent, read-only view of everything recorded so
+// far as a complete replay archive: recording.tmcpr (stored, not
+// compressed), metaData.json, mods.json, recording.tmcpr.crc32, markers and
+// annotations. The metadata is provisional: Duration is the latest timestamp
+// written, and players or tags added later are missing. Packets written after
+// the call do not change the snapshot, which can be read, seeked, uploaded or
+// opened with zip.NewReader(s, s.Size()) while recording continues. It needs
+// EnableSnapshots.
+//
+// Taking a snapshot costs no copy of the recording, which is read from the
+// snapshot file on demand. Close the snapshot when done. Snapshots stay
+// readable after the writer is closed on systems that allow removing open
+// files (not Windows).
+func (w *Writer) Snapshot() (*Snapshot, error) {
+    defer w.lock().unlock()
+    w.drain()
+    if err := w.writable(); err != nil {
+        return nil, err
+    }
+    if w.spool == nil {
+        return nil, fmt.Errorf("mcpr: snapshots not enabled, see EnableSnapshots")
+    }
+    f, err := os.Open(w.spool.Name())
+    if err != nil {
+        return nil, err
+    }
+    s, err := w.snapshot(f)
+    if err != nil {
+        _ = f.Close()
+        return nil, err
+    }
+    return s, nil
+}
+
+func (w *Writer) snapshot(f *os.File) (*Snapshot, error) {
+    now := time.Now()
+    meta := w.metaCopy()
+    meta.Duration = int(w.end())
+    if meta.Generator == "" {
+        meta.Generator = "mc-replay-go"
+    }
+
+    sw := &segmentWriter{file: f}
+    zw := zip.NewWriter(sw)
+    n := uint64(w.recBytes)
+    rec, err := zw.CreateRaw(&zip.FileHeader{
+        Name:               "recording.tmcpr",
+        Method:             zip.Store,
+        CRC32:              w.crc32.Sum32(),
+        CompressedSize64:   n,
+        UncompressedSize64: n,
+        Modified:           now,
+    })
+    if err != nil {
+        return nil, err
+    }
+    // The recording's bytes are not copied: the next n bytes reaching sw
+    // become a reference to the snapshot file
+    if err := zw.Flush(); err != nil {
+        return nil, err
+    }
+    sw.ref = int64(n)
+    if _, err := io.CopyN(rec, zeros{}, int64(n)); err != nil {
+        return nil, err
+    }
+
+    type entry struct {
+        name string
+        v    interface{}
+    }
+    entries := []entry{
+        {"metaData.json", meta},
+        {"mods.json", map[string][]interface{}{"requiredMods": {}}},
+        {"recording.tmcpr.crc32", w.crc32.Sum32()},
+    }
+    if len(w.markers) > 0 {
+        entries = append(entries, entry{MarkersEntryName, w.markers})
+    }
+    if len(w.annotations) > 0 {
+        entries = append(entries, entry{AnnotationsEntryName, w.annotations})
+    }
+    for _, e := range entries {
+        ew, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: now})
+        if err != nil {
+            return nil, err
+        }
+        if err := json.NewEncoder(ew).Encode(e.v); err != nil {
+            return nil, err
+        }
+    }
+    if err := zw.Close(); err != nil {
+        return nil, err
+    }
+
+    s := &Snapshot{Meta: meta, name: meta.ID + ".mcpr", mod: now, segs: sw.segs, file: f}
+    s.SectionReader = io.NewSectionReader(s, 0, sw.size)
+    return s, nil
+}
+
+// Snapshot is a replay archive of a recording in progress, see
+// Writer.Snapshot. It implements fs.File, io.ReadSeeker and io.ReaderAt.
+type Snapshot struct {
+    *io.SectionReader
+
+    Meta Meta // provisional metadata as written to the snapshot
+
+    name string
+    mod  time.Time
+    segs []segment
+    file *os.File
+}
+
+// segment is a part of a snapshot: bytes in memory or a range of the
+// snapshot file starting at offset 0 (the recording).
+type segment struct {
+    off  int64 // offset in the snapshot
+    mem  []byte
+    file int64 // length in the file, if mem is nil
+}
+
+// ReadAt implements io.ReaderAt; callers normally use the embedded
+// SectionReader.
+func (s *Snapshot) ReadAt(p []byte, off int64) (int, error) {
+    n := 0
+    for _, seg := range s.segs {
+        if len(p) == 0 {
+            break
+        }
+        size := seg.file
+        if seg.mem != nil {
+            size = int64(len(seg.mem))
+        }
+        if off >= seg.off+size {
+            continue
+        }
+        rel := off - seg.off
+        want := size - rel
+        if want > int64(len(p)) {
+            want = int64(len(p))
+        }
+        var k int
+        if seg.mem != nil {
+            k = copy(p[:want], seg.mem[rel:])
+        } else {
+            var err error
+            if k, err = s.file.ReadAt(p[:want], rel); err != nil && k < int(want) {
+                return n + k, err
+            }
+        }
+        n += k
+        off += int64(k)
+        p = p[k:]
+    }
+    if len(p) > 0 {
+        return n, io.EOF
+    }
+    return n, nil
+}
+
+// Stat returns the snapshot's size and creation time under the name
+// "<id>.mcpr".
+func (s *Snapshot) Stat() (fs.FileInfo, error) {
+    return snapshotInfo{s}, nil
+}
+
+// Close releases the snapshot's handle on the recording.
+func (s *Snapshot) Close() error {
+    return s.file.Close()
+}
+
+type snapshotInfo struct{ s *Snapshot }
+
+func (i snapshotInfo) Name() string       { return i.s.name }
+func (i snapshotInfo) Size() int64        { return i.s.Size() }
+func (i snapshotInfo) Mode() fs.FileMode  { return 0o444 }
+func (i snapshotInfo) ModTime() time.Time { return i.s.mod }
+func (i snapshotInfo) IsDir() bool        { return false }
+func (i snapshotInfo) Sys() interface{}   { return nil }
+
+// segmentWriter collects the snapshot archive, turning the next ref bytes
+// written into a reference to the snapshot file.
+type segmentWriter struct {
+    file *os.File
+    ref  int64
+    segs []segment
+    size int64
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+    n := len(p)
+    if sw.ref > 0 {
+        k := int64(len(p))
+        if k > sw.ref {
+            k = sw.ref
+        }
+        if last := len(sw.segs) - 1; last >= 0 && sw.segs[last].mem == nil {
+            sw.segs[last].file += k
+        } else {
+            sw.segs = append(sw.segs, segment{off: sw.size, file: k})
+        }
+        sw.ref -= k
+        sw.size += k
+        p = p[k:]
+    }
+    if len(p) > 0 {
+        if last := len(sw.segs) - 1; last >= 0 && sw.segs[last].mem != nil {
+            sw.segs[last].mem = append(sw.segs[last].mem, p...)
+        } else {
+            sw.segs = append(sw.segs, segment{off: sw.size, mem: append([]byte(nil), p...)})
+        }
+        sw.size += int64(len(p))
+    }
+    return n, nil
+}
+
+// zeros stands in for the recording's bytes, see segmentWriter.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+    for i := range p {
+        p[i] = 0
+    }
+    return len(p), nil
+}
@@ -0,0 +1,241 @@
+// Package splits detects the standard speedrun splits in a replay (nether
+// entry, bastion, fortress, nether exit, stronghold, end entry, dragon death,
+// credits) and reports their times, so verifiers get timing straight from the
+// recording.
+//
+// Times are real time since the start of the recording, not in-game time.
+// Splits come from dimension changes, advancements granted while recording
+// (advancements already held when the player joined are ignored), the ender
+// dragon's boss bar and the credits.
+package splits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Split names, in run order.
+const (
+	Nether     = "nether"
+	Bastion    = "bastion"
+	Fortress   = "fortress"
+	NetherExit = "nether-exit"
+	Stronghold = "stronghold"
+	End        = "end"
+	Dragon     = "dragon"
+	Credits    = "credits"
+)
+
+// advancements that complete a split.
+var advancements = map[string]string{
+	"minecraft:story/enter_the_nether": Nether,
+	"minecraft:nether/find_bastion":    Bastion,
+	"minecraft:nether/find_fortress":   Fortress,
+	"minecraft:story/follow_ender_eye": Stronghold,
+	"minecraft:story/enter_the_end":    End,
+	"minecraft:end/kill_dragon":        Dragon,
+}
+
+// Split is the first time a split was reached.
+type Split struct {
+	Name   string `json:"name"`
+	Time   uint32 `json:"time"`   // ms since the start of the recording
+	Source string `json:"source"` // dimension, advancement, bossbar or credits
+}
+
+// Report lists the splits reached, in time order.
+type Report struct {
+	Protocol int     `json:"protocol"`
+	Splits   []Split `json:"splits"`
+}
+
+// Get returns the named split.
+func (r *Report) Get(name string) (Split, bool) {
+	for _, s := range r.Splits {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Split{}, false
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes one line per split with its time and segment length.
+func (r *Report) WriteText(w io.Writer) error {
+	var prev uint32
+	for _, s := range r.Splits {
+		if _, err := fmt.Fprintf(w, "%-12s %s  (+%s)  %s\n", s.Name, formatTime(s.Time), formatTime(s.Time-prev), s.Source); err != nil {
+			return err
+		}
+		prev = s.Time
+	}
+	return nil
+}
+
+// Markers returns one replay marker per split.
+func (r *Report) Markers() []mcpr.Marker {
+	out := make([]mcpr.Marker, 0, len(r.Splits))
+	for _, s := range r.Splits {
+		out = append(out, mcpr.Marker{Time: int(s.Time), Name: "Split: " + s.Name})
+	}
+	return out
+}
+
+// formatTime formats ms as M:SS.mmm (H:MM:SS.mmm from an hour).
+func formatTime(ms uint32) string {
+	h, m, s, f := ms/3600000, ms/60000%60, ms/1000%60, ms%1000
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d.%03d", h, m, s, f)
+	}
+	return fmt.Sprintf("%d:%02d.%03d", m, s, f)
+}
+
+// ErrUnsupported is returned for protocols without decoders.
+var ErrUnsupported = errors.New("splits: protocol not supported")
+
+// decoders decode the advancement updates of a protocol version. They return
+// the advancements with a criterion achieved in an update that is not the
+// initial (reset) one.
+var decoders = map[int]func(d *wire.Decoder) []string{
+	764: advancements764,
+}
+
+// Analyzer detects splits in the clientbound packets of a recording.
+type Analyzer struct {
+	table   *protocol.Table
+	tracker *protocol.Tracker
+	advance func(d *wire.Decoder) []string
+	report  Report
+	seen    map[string]bool
+
+	dim       string
+	dragonBar string  // UUID of the ender dragon's boss bar
+	dragonHP  float32 // its last health
+}
+
+// NewAnalyzer returns an analyzer for a recording of the given protocol that
+// starts in state s (protocol.Login for ReplayMod recordings).
+func NewAnalyzer(proto int, s protocol.State) (*Analyzer, error) {
+	table, ok := protocol.Lookup(proto)
+	dec := decoders[proto]
+	if !ok || dec == nil || !table.HasDimensions() {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, proto)
+	}
+	return &Analyzer{
+		table:   table,
+		tracker: protocol.NewTracker(table, s),
+		advance: dec,
+		report:  Report{Protocol: proto, Splits: []Split{}},
+		seen:    map[string]bool{},
+	}, nil
+}
+
+// Observe feeds one packet.
+func (a *Analyzer) Observe(ts uint32, id int32, payload []byte) error {
+	if a.tracker.Observe(id) != protocol.Play {
+		return nil
+	}
+	if dim, ok := a.table.Dimension(id, payload); ok {
+		// The first dimension is where the player joined, not an entry
+		switch {
+		case a.dim == "":
+		case dim == "minecraft:the_nether":
+			a.split(ts, Nether, "dimension")
+		case dim == "minecraft:the_end":
+			a.split(ts, End, "dimension")
+		case dim == "minecraft:overworld" && a.dim == "minecraft:the_nether":
+			a.split(ts, NetherExit, "dimension")
+		}
+		a.dim = dim
+		return nil
+	}
+	d := wire.NewDecoder(payload)
+	name := a.table.Name(protocol.Clientbound, protocol.Play, id)
+	switch name {
+	case "UpdateAdvancements":
+		for _, adv := range a.advance(d) {
+			if s, ok := advancements[adv]; ok {
+				a.split(ts, s, "advancement")
+			}
+		}
+	case "BossEvent":
+		// The dragon's bar drops to zero health before it is removed; it is
+		// also removed, at non-zero health, when the player leaves the End
+		uuid := d.UUID()
+		switch d.VarInt() {
+		case 0:
+			title := d.String()
+			if k, _, _ := wire.Translation(title); k == "entity.minecraft.ender_dragon" {
+				a.dragonBar, a.dragonHP = uuid, d.Float()
+			}
+		case 1:
+			if uuid == a.dragonBar && a.dragonHP == 0 {
+				a.split(ts, Dragon, "bossbar")
+			}
+		case 2:
+			if uuid == a.dragonBar {
+				a.dragonHP = d.Float()
+			}
+		}
+	case "GameEvent":
+		// Event 4 (win game) with value 1 rolls the credits
+		if ev, v := d.Byte(), d.Float(); ev == 4 && v == 1 {
+			a.split(ts, Credits, "credits")
+		}
+	default:
+		return nil
+	}
+	if d.Err != nil {
+		return fmt.Errorf("%s at %d ms: %w", name, ts, d.Err)
+	}
+	return nil
+}
+
+func (a *Analyzer) split(ts uint32, name, source string) {
+	if a.seen[name] {
+		return
+	}
+	a.seen[name] = true
+	a.report.Splits = append(a.report.Splits, Split{Name: name, Time: ts, Source: source})
+	sort.SliceStable(a.report.Splits, func(i, j int) bool { return a.report.Splits[i].Time < a.report.Splits[j].Time })
+}
+
+// Report returns the splits detected so far.
+func (a *Analyzer) Report() *Report {
+	return &a.report
+}
+
+// Extract detects the splits in the replay at path.
+func Extract(path string) (*Report, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	a, err := NewAnalyzer(ar.Meta.Protocol, protocol.Login)
+	if err != nil {
+		return nil, err
+	}
+	err = ar.Each(func(f tmcpr.Frame) error {
+		return a.Observe(f.Time, f.ID, f.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.Report(), nil
+}
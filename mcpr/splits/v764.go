@@ -0,0 +1,61 @@
+package splits
+
+import "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+
+// UpdateAdvancements (1.20.2): reset:bool
+//
+//	added:varint×(id:string parent:bool[string] display:bool[display]
+//	    requirements:varint×(varint×string) telemetry:bool)
+//	removed:varint×string
+//	progress:varint×(id:string criteria:varint×(name:string achieved:bool[date:long]))
+//
+// display: title:chat description:chat icon:slot frame:varint flags:int
+// [background:string if flags&1] x:float y:float
+func advancements764(d *wire.Decoder) []string {
+	reset := d.Bool()
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		_ = d.String()
+		if d.Bool() {
+			_ = d.String()
+		}
+		if d.Bool() {
+			_ = d.String()
+			_ = d.String()
+			if d.Bool() {
+				d.VarInt()
+				d.Byte()
+				d.NBT(true)
+			}
+			d.VarInt()
+			if d.Int()&1 != 0 {
+				_ = d.String()
+			}
+			d.Skip(8)
+		}
+		for r := d.VarInt(); r > 0 && d.Err == nil; r-- {
+			for c := d.VarInt(); c > 0 && d.Err == nil; c-- {
+				_ = d.String()
+			}
+		}
+		d.Bool()
+	}
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		_ = d.String()
+	}
+	var done []string
+	for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+		id := d.String()
+		achieved := false
+		for c := d.VarInt(); c > 0 && d.Err == nil; c-- {
+			_ = d.String()
+			if d.Bool() {
+				d.Long()
+				achieved = true
+			}
+		}
+		if achieved && !reset {
+			done = append(done, id)
+		}
+	}
+	return done
+}
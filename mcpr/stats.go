@@ -0,0 +1,55 @@
+package mcpr
+
+import "io"
+
+// RecordingStats summarizes the packets of a replay, see Reader.Stats.
+type RecordingStats struct {
+    Packets int
+    Bytes   int64         // size of the frames, headers included: the uncompressed recording.tmcpr
+    MinTime uint32        // time of the earliest packet, 0 if there are none
+    MaxTime uint32        // time of the latest packet
+    IDs     map[int32]int // number of packets per packet id
+}
+
+// Stats scans the whole recording and summarizes its packets. Only the frame
+// headers are parsed; payloads are skipped without being allocated or handed
+// to the caller, which makes it much faster than reading every packet with
+// Next. Times are normalized after NormalizeTimes; the filter (SetFilter) is
+// ignored, and a lenient Reader counts only the packets it does not skip.
+//
+// Stats rewinds the Reader, so Next continues from the first packet, and
+// indexes the recording for SeekToTime as a full read would.
+func (r *Reader) Stats() (RecordingStats, error) {
+    s := RecordingStats{IDs: map[int32]int{}}
+    if err := r.open(0); err != nil {
+        return s, err
+    }
+    for {
+        ts, id, err := r.fr.NextHeader()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return s, r.fail(err)
+        }
+        off := r.fr.Offset()
+        if r.build {
+            r.ix.Add(ts, off)
+        }
+        if err := r.fr.Skip(); err != nil {
+            return s, r.fail(err)
+        }
+        var t uint32
+        if ts > r.base {
+            t = ts - r.base
+        }
+        if s.Packets == 0 || t < s.MinTime {
+            s.MinTime = t
+        }
+        s.MaxTime = max(s.MaxTime, t)
+        s.Packets++
+        s.Bytes += r.fr.Offset() - off
+        s.IDs[id]++
+    }
+    return s, r.open(0)
+}
@@ -0,0 +1,37 @@
+package mcpr
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "sync/atomic"
+)
+
+// ErrWarning is wrapped by the errors strict mode returns in place of
+// warnings, see SetStrictMode.
+var ErrWarning = errors.New("mcpr: warning in strict mode")
+
+var strictMode atomic.Bool
+
+// SetStrictMode makes the library fail wherever it would otherwise log a
+// warning and carry on, for pipelines where a silently odd replay is worse
+// than none. It applies to the whole process:
+//   - writers created afterwards start out strict, see Writer.SetStrict;
+//   - Validate, ValidateFS, ValidateFile and ValidateFileQuiet return their
+//     warnings as an error wrapping ErrWarning.
+//
+// Since a writer from Create validates the file on Close, strict writers and
+// the transforms writing through them fail on validation warnings too.
+func SetStrictMode(on bool) {
+    strictMode.Store(on)
+}
+
+// StrictMode reports whether SetStrictMode is in effect.
+func StrictMode() bool {
+    return strictMode.Load()
+}
+
+// warningsError returns the warnings as one error wrapping ErrWarning.
+func warningsError(warnings []string) error {
+    return fmt.Errorf("%w: %s", ErrWarning, strings.Join(warnings, "; "))
+}
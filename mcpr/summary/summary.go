@@ -0,0 +1,196 @@
+// Package summary describes a replay for humans: metadata, length, markers,
+// dimensions and the most frequent packets, rendered as a standalone HTML
+// page that can be shared alongside the .mcpr file.
+package summary
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Summary is the information shown for a replay.
+type Summary struct {
+	Name        string // file name
+	Meta        mcpr.Meta
+	Size        int64
+	Packets     int64
+	Markers     []mcpr.Marker
+	Annotations []mcpr.Annotation
+	Dimensions  []mcpr.DimensionSegment
+	TopPackets  []PacketCount // most frequent packets, at most 10
+}
+
+// PacketCount is the number of packets with one id.
+type PacketCount struct {
+	ID    int32
+	Name  string // "" when the protocol has no packet table
+	Count int64
+}
+
+// Build reads the replay at path and summarizes it.
+func Build(path string) (*Summary, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	s := &Summary{Name: fi.Name(), Meta: a.Meta, Size: fi.Size()}
+
+	fr, rc, err := a.Frames()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	table, _ := protocol.Lookup(a.Meta.Protocol)
+	var tracker *protocol.Tracker
+	if table != nil {
+		tracker = protocol.NewTracker(table, protocol.Login)
+	}
+	type key struct {
+		state protocol.State
+		id    int32
+	}
+	counts := map[key]int64{}
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.Packets++
+		k := key{state: protocol.Play, id: f.ID}
+		if tracker != nil {
+			k.state = tracker.Observe(f.ID)
+		}
+		counts[k]++
+	}
+	for k, n := range counts {
+		pc := PacketCount{ID: k.id, Count: n}
+		if table != nil {
+			pc.Name = table.Name(protocol.Clientbound, k.state, k.id)
+		}
+		s.TopPackets = append(s.TopPackets, pc)
+	}
+	sort.Slice(s.TopPackets, func(i, j int) bool {
+		if s.TopPackets[i].Count != s.TopPackets[j].Count {
+			return s.TopPackets[i].Count > s.TopPackets[j].Count
+		}
+		return s.TopPackets[i].ID < s.TopPackets[j].ID
+	})
+	if len(s.TopPackets) > 10 {
+		s.TopPackets = s.TopPackets[:10]
+	}
+
+	if s.Markers, err = mcpr.ReadMarkers(path); err != nil {
+		return nil, err
+	}
+	if s.Annotations, err = mcpr.ReadAnnotations(path); err != nil {
+		return nil, err
+	}
+	if s.Dimensions, err = mcpr.ReadDimensions(path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Duration returns the replay length.
+func (s *Summary) Duration() time.Duration {
+	return time.Duration(s.Meta.Duration) * time.Millisecond
+}
+
+// Text returns a one-paragraph plain-text description, e.g. for chat messages.
+func (s *Summary) Text() string {
+	server := s.Meta.ServerName
+	if server == "" {
+		server = "unknown server"
+	}
+	t := fmt.Sprintf("%s: %s on %s, recorded %s (%s, %d packets",
+		s.Name, s.Duration().Round(time.Second), server,
+		time.UnixMilli(s.Meta.Date).UTC().Format("2006-01-02 15:04 MST"), formatBytes(s.Size), s.Packets)
+	if n := len(s.Markers); n > 0 {
+		t += fmt.Sprintf(", %d markers", n)
+	}
+	if n := len(s.Annotations); n > 0 {
+		t += fmt.Sprintf(", %d annotations", n)
+	}
+	return t + ")"
+}
+
+// WriteHTML renders the summary as a standalone HTML page.
+func (s *Summary) WriteHTML(w io.Writer) error {
+	return page.Execute(w, s)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func clock(ms int) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+var page = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"clock": clock,
+	"ms":    func(v uint32) string { return clock(int(v)) },
+	"date":  func(ms int64) string { return time.UnixMilli(ms).UTC().Format("2006-01-02 15:04:05 MST") },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:48em;margin:2em auto;padding:0 1em;color:#222}
+table{border-collapse:collapse;margin-bottom:1.5em}td,th{padding:.2em .8em;text-align:left;border-bottom:1px solid #ddd}
+th{background:#f4f4f4}.num{text-align:right}
+</style></head><body>
+<h1>{{.Name}}</h1>
+<table>
+<tr><th>Server</th><td>{{with .Meta.ServerName}}{{.}}{{else}}–{{end}}</td></tr>
+<tr><th>Recorded</th><td>{{date .Meta.Date}}</td></tr>
+<tr><th>Duration</th><td>{{clock .Meta.Duration}}</td></tr>
+<tr><th>Version</th><td>{{with .Meta.MCVersion}}{{.}} {{end}}(protocol {{.Meta.Protocol}})</td></tr>
+<tr><th>Size</th><td>{{bytes .Size}}, {{.Packets}} packets</td></tr>
+<tr><th>Players</th><td>{{len .Meta.Players}}</td></tr>
+{{with .Meta.Generator}}<tr><th>Generator</th><td>{{.}}</td></tr>{{end}}
+{{with .Meta.ID}}<tr><th>ID</th><td><code>{{.}}</code></td></tr>{{end}}
+</table>
+{{with .Markers}}<h2>Markers</h2>
+<table><tr><th>Time</th><th>Name</th></tr>
+{{range .}}<tr><td>{{clock .Time}}</td><td>{{.Name}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Annotations}}<h2>Annotations</h2>
+<table><tr><th>Time</th><th>Key</th><th>Note</th></tr>
+{{range .}}<tr><td>{{ms .Time}}</td><td>{{.Key}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Dimensions}}<h2>Dimensions</h2>
+<table><tr><th>From</th><th>To</th><th>Dimension</th></tr>
+{{range .}}<tr><td>{{ms .Start}}</td><td>{{ms .End}}</td><td>{{.Dimension}}{{if gt .Visit 1}} (visit {{.Visit}}){{end}}</td></tr>
+{{end}}</table>{{end}}
+{{with .TopPackets}}<h2>Most frequent packets</h2>
+<table><tr><th>Packet</th><th class="num">Count</th></tr>
+{{range .}}<tr><td>{{with .Name}}{{.}}{{else}}0x{{printf "%02x" .ID}}{{end}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+</body></html>
+`))
@@ -0,0 +1,130 @@
+package mcpr
+
+import (
+    "context"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// Tail follows a bare recording.tmcpr file that is still being written, such
+// as the spool file of a Writer with snapshots (see Writer.SpoolPath) or a raw
+// dump a recorder appends to, the way tail -f follows a log: Next returns
+// each frame once it is complete and waits for more at the end of the file.
+// A Tail is not safe for concurrent use.
+type Tail struct {
+    Poll time.Duration // how often to check for new data at the end; default 250ms
+
+    f    *os.File
+    path string
+    off  int64
+}
+
+// OpenTail opens the recording.tmcpr file at path for following from its
+// first frame.
+func OpenTail(path string) (*Tail, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    return &Tail{f: f, path: path}, nil
+}
+
+// Next returns the next frame, waiting until one is complete. It returns
+// io.EOF once the file has been removed or replaced (as the spool file is
+// when its Writer closes) and every complete frame was returned, or
+// io.ErrUnexpectedEOF if it then ends inside a frame. It returns ctx.Err()
+// if ctx is done first.
+func (t *Tail) Next(ctx context.Context) (Packet, error) {
+    poll := t.Poll
+    if poll <= 0 {
+        poll = 250 * time.Millisecond
+    }
+    for {
+        p, err := t.read()
+        if err != io.EOF {
+            return p, err
+        }
+        // At the end: more frames may follow unless the file is gone. Read
+        // once more after noticing, for frames written before it went.
+        if t.gone() {
+            if p, err = t.read(); err == io.EOF && t.partial() {
+                err = io.ErrUnexpectedEOF
+            }
+            return p, err
+        }
+        select {
+        case <-ctx.Done():
+            return Packet{}, ctx.Err()
+        case <-time.After(poll):
+        }
+    }
+}
+
+// read returns the frame at t.off if it is complete, or io.EOF.
+func (t *Tail) read() (Packet, error) {
+    var hdr [8]byte
+    if _, err := t.f.ReadAt(hdr[:], t.off); err != nil {
+        return Packet{}, eofOr(err)
+    }
+    ts := binary.BigEndian.Uint32(hdr[0:4])
+    n := binary.BigEndian.Uint32(hdr[4:8])
+    if n == 0 || n > tmcpr.MaxFrameSize {
+        return Packet{}, fmt.Errorf("tmcpr: invalid frame length %d at offset %d", n, t.off)
+    }
+    body := make([]byte, n)
+    if _, err := t.f.ReadAt(body, t.off+int64(len(hdr))); err != nil {
+        return Packet{}, eofOr(err)
+    }
+    id, k, err := tmcpr.DecodeVarInt(body)
+    if err != nil {
+        return Packet{}, fmt.Errorf("tmcpr: packet id at offset %d: %w", t.off, err)
+    }
+    payload := body[k:]
+    if id == tmcpr.PackedID {
+        if id, payload, err = tmcpr.Unpack(payload); err != nil {
+            return Packet{}, err
+        }
+    }
+    t.off += int64(len(hdr)) + int64(n)
+    return Packet{Time: ts, RawTime: ts, ID: id, Payload: payload}, nil
+}
+
+// eofOr maps a short read to io.EOF: the frame is not complete yet.
+func eofOr(err error) error {
+    if errors.Is(err, io.EOF) {
+        return io.EOF
+    }
+    return err
+}
+
+// gone reports whether the file at t.path was removed or replaced.
+func (t *Tail) gone() bool {
+    fi, err := os.Stat(t.path)
+    if err != nil {
+        return true
+    }
+    own, err := t.f.Stat()
+    return err != nil || !os.SameFile(fi, own)
+}
+
+// partial reports whether bytes of an incomplete frame follow t.off.
+func (t *Tail) partial() bool {
+    fi, err := t.f.Stat()
+    return err == nil && fi.Size() > t.off
+}
+
+// Offset returns the file offset of the next frame.
+func (t *Tail) Offset() int64 {
+    return t.off
+}
+
+// Close closes the file.
+func (t *Tail) Close() error {
+    return t.f.Close()
+}
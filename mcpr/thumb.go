@@ -0,0 +1,76 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "bytes"
+    "fmt"
+    "io"
+)
+
+// ThumbEntryName is the archive entry ReplayMod shows as the replay's
+// thumbnail in its replay viewer.
+const ThumbEntryName = "thumb"
+
+// thumbMagic precedes the image data in the thumb entry.
+var thumbMagic = []byte{0, 1, 1, 2, 3, 5, 8}
+
+// SetThumbnail sets the replay's thumbnail, written on Close unless the caller
+// supplied a thumb entry. img is an encoded image; ReplayMod writes JPEG but
+// reads any format Java's ImageIO does, including PNG. It is best 16:9.
+func (w *Writer) SetThumbnail(img []byte) {
+    defer w.lock().unlock()
+    w.thumb = img
+}
+
+func (w *Writer) writeThumbnail() error {
+    if w.thumb == nil || w.entries[ThumbEntryName] {
+        return nil
+    }
+    tw, err := w.createEntry(ThumbEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", ThumbEntryName, err)
+    }
+    if _, err := tw.Write(thumbMagic); err != nil {
+        return err
+    }
+    _, err = tw.Write(w.thumb)
+    return err
+}
+
+// ReadThumbnail returns the encoded thumbnail image of the replay at path, or
+// nil if it has none.
+func ReadThumbnail(path string) ([]byte, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return readThumbnail(zr.File)
+}
+
+// Thumbnail returns the encoded thumbnail image of the replay, see
+// ReadThumbnail.
+func (r *Reader) Thumbnail() ([]byte, error) {
+    return readThumbnail(r.files)
+}
+
+func readThumbnail(files []*zip.File) ([]byte, error) {
+    for _, f := range files {
+        if f.Name == ThumbEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer rc.Close()
+            b, err := io.ReadAll(rc)
+            if err != nil {
+                return nil, err
+            }
+            if !bytes.HasPrefix(b, thumbMagic) {
+                return nil, fmt.Errorf("%s: missing header", ThumbEntryName)
+            }
+            return b[len(thumbMagic):], nil
+        }
+    }
+    return nil, nil
+}
@@ -0,0 +1,162 @@
+package thumbnail
+
+import (
+	"image/color"
+	"strings"
+	"sync"
+
+	"github.com/Tnze/go-mc/level/block"
+)
+
+// Base colors of the in-game map for the block groups rendered here.
+var (
+	colGrass     = color.RGBA{127, 178, 56, 255}
+	colSand      = color.RGBA{247, 233, 163, 255}
+	colLava      = color.RGBA{255, 90, 0, 255}
+	colIce       = color.RGBA{160, 160, 255, 255}
+	colMetal     = color.RGBA{167, 167, 167, 255}
+	colPlant     = color.RGBA{0, 124, 0, 255}
+	colSnow      = color.RGBA{255, 255, 255, 255}
+	colClay      = color.RGBA{164, 168, 184, 255}
+	colDirt      = color.RGBA{151, 109, 77, 255}
+	colStone     = color.RGBA{112, 112, 112, 255}
+	colWater     = color.RGBA{64, 64, 255, 255}
+	colWood      = color.RGBA{143, 119, 72, 255}
+	colQuartz    = color.RGBA{255, 252, 245, 255}
+	colPodzol    = color.RGBA{129, 86, 49, 255}
+	colNether    = color.RGBA{112, 2, 0, 255}
+	colDeepslate = color.RGBA{100, 100, 100, 255}
+	colCrimson   = color.RGBA{189, 48, 49, 255}
+	colWarped    = color.RGBA{22, 126, 134, 255}
+	colBlack     = color.RGBA{25, 25, 25, 255}
+	colBrown     = color.RGBA{102, 76, 51, 255}
+	colPurple    = color.RGBA{127, 63, 178, 255}
+	colOrange    = color.RGBA{216, 127, 51, 255}
+)
+
+// dyeColors are the map colors of the 16 dye-colored block families (wool,
+// concrete, carpet, ...), by name prefix.
+var dyeColors = map[string]color.RGBA{
+	"white":      {255, 255, 255, 255},
+	"orange":     colOrange,
+	"magenta":    {178, 76, 216, 255},
+	"light_blue": {102, 153, 216, 255},
+	"yellow":     {229, 229, 51, 255},
+	"lime":       {127, 204, 25, 255},
+	"pink":       {242, 127, 165, 255},
+	"gray":       {76, 76, 76, 255},
+	"light_gray": {153, 153, 153, 255},
+	"cyan":       {76, 127, 153, 255},
+	"purple":     colPurple,
+	"blue":       {51, 76, 178, 255},
+	"brown":      colBrown,
+	"green":      {102, 127, 51, 255},
+	"red":        {153, 51, 51, 255},
+	"black":      colBlack,
+}
+
+// exactColors are blocks whose name alone decides their color.
+var exactColors = map[string]color.RGBA{
+	"grass_block": colGrass, "moss_block": colPlant, "moss_carpet": colPlant,
+	"water": colWater, "bubble_column": colWater, "kelp": colWater, "kelp_plant": colWater,
+	"seagrass": colWater, "tall_seagrass": colWater,
+	"lava": colLava, "magma_block": colNether,
+	"sand": colSand, "sandstone": colSand, "end_stone": colSand, "birch_planks": colSand,
+	"red_sand": colOrange, "red_sandstone": colOrange,
+	"snow": colSnow, "snow_block": colSnow, "powder_snow": colSnow,
+	"ice": colIce, "packed_ice": colIce, "blue_ice": colIce, "frosted_ice": colIce,
+	"dirt": colDirt, "coarse_dirt": colDirt, "rooted_dirt": colDirt, "farmland": colDirt, "dirt_path": colDirt,
+	"podzol": colPodzol, "mycelium": colPurple, "mud": colBrown,
+	"clay": colClay, "gravel": colStone, "bedrock": colStone,
+	"netherrack": colNether, "soul_sand": colBrown, "soul_soil": colBrown,
+	"crimson_nylium": colCrimson, "warped_nylium": colWarped,
+	"obsidian": colBlack, "crying_obsidian": colBlack, "basalt": colBlack, "blackstone": colBlack,
+	"iron_block": colMetal, "quartz_block": colQuartz,
+}
+
+// seeThrough blocks are skipped when looking for the top block of a column.
+var seeThrough = map[string]bool{
+	"air": true, "cave_air": true, "void_air": true, "barrier": true,
+	"light": true, "structure_void": true, "glass": true, "glass_pane": true,
+}
+
+var (
+	stateColorsOnce sync.Once
+	stateColors     []color.RGBA // by block state id; alpha 0 for see-through
+)
+
+// colorOf returns the top-down color of a block state.
+func colorOf(state int32) color.RGBA {
+	stateColorsOnce.Do(func() {
+		stateColors = make([]color.RGBA, len(block.StateList))
+		for i, b := range block.StateList {
+			stateColors[i] = blockColor(strings.TrimPrefix(b.ID(), "minecraft:"))
+		}
+	})
+	if state < 0 || int(state) >= len(stateColors) {
+		return colStone
+	}
+	return stateColors[state]
+}
+
+// blockColor approximates the map color of a block from its name.
+func blockColor(name string) color.RGBA {
+	if seeThrough[name] || strings.HasSuffix(name, "_glass") || strings.HasSuffix(name, "_glass_pane") {
+		return color.RGBA{}
+	}
+	if c, ok := exactColors[name]; ok {
+		return c
+	}
+	for _, dye := range []string{"light_blue", "light_gray"} {
+		if strings.HasPrefix(name, dye+"_") {
+			return dyed(dyeColors[dye], name)
+		}
+	}
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		if c, ok := dyeColors[name[:i]]; ok {
+			return dyed(c, name)
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, "_leaves"), strings.Contains(name, "grass"), strings.Contains(name, "fern"),
+		strings.HasSuffix(name, "_sapling"), strings.Contains(name, "vine"), name == "lily_pad", strings.Contains(name, "bush"):
+		return colPlant
+	case strings.HasPrefix(name, "crimson_"):
+		return colCrimson
+	case strings.HasPrefix(name, "warped_"):
+		return colWarped
+	case strings.Contains(name, "nether"):
+		return colNether
+	case strings.Contains(name, "deepslate"):
+		return colDeepslate
+	case strings.HasSuffix(name, "_log"), strings.HasSuffix(name, "_wood"), strings.Contains(name, "planks"),
+		strings.HasSuffix(name, "_fence"), strings.HasSuffix(name, "_door"), strings.Contains(name, "bamboo"):
+		return colWood
+	case strings.Contains(name, "sandstone"):
+		return colSand
+	case strings.Contains(name, "quartz"):
+		return colQuartz
+	case strings.Contains(name, "copper"):
+		return colOrange
+	}
+	return colStone
+}
+
+// dyed darkens terracotta, which is much duller than wool or concrete.
+func dyed(c color.RGBA, name string) color.RGBA {
+	if strings.Contains(name, "terracotta") {
+		return shade(c, 0.65)
+	}
+	return c
+}
+
+func shade(c color.RGBA, f float64) color.RGBA {
+	scale := func(v uint8) uint8 {
+		x := float64(v) * f
+		if x > 255 {
+			x = 255
+		}
+		return uint8(x)
+	}
+	return color.RGBA{scale(c.R), scale(c.G), scale(c.B), c.A}
+}
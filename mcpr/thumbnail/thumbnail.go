@@ -0,0 +1,312 @@
+// Package thumbnail renders a top-down, map-style image of the terrain
+// loaded at the start of a replay and sets it as the replay's thumbnail, so
+// replays get a recognizable preview without running the game.
+//
+// Only the color of the topmost block of each column is drawn, with the
+// in-game map's relief shading. Block colors are approximated from block
+// names; state ids are resolved with go-mc's block table, which must match
+// the replay's version.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/transform"
+)
+
+// Options control rendering. Zero values select the defaults.
+type Options struct {
+	// Window is how long after the first chunk arrives chunks are collected
+	// (default 10s). Rendering also stops at the first dimension change. A
+	// negative Window collects the chunks of the whole recording, skipping
+	// those of other dimensions than the first.
+	Window time.Duration
+	// Width and Height of the image in pixels (default 640×360, 16:9 like
+	// ReplayMod's own thumbnails).
+	Width, Height int
+	// Scale is the size of a block in pixels (default 2).
+	Scale int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window == 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.Width <= 0 {
+		o.Width = 640
+	}
+	if o.Height <= 0 {
+		o.Height = 360
+	}
+	if o.Scale <= 0 {
+		o.Scale = 2
+	}
+	return o
+}
+
+// background is drawn where no chunk was loaded.
+var background = color.RGBA{24, 24, 28, 255}
+
+// ErrUnsupported is returned for protocols without chunk decoders or whose
+// block states go-mc does not describe.
+var ErrUnsupported = errors.New("thumbnail: protocol not supported")
+
+// ErrNoChunks is returned when the replay has no chunk data to render.
+var ErrNoChunks = errors.New("thumbnail: no chunks in replay")
+
+// blockProtocol is the protocol of go-mc's block state table.
+const blockProtocol = 764
+
+// decoders decode LevelChunkWithLight, keyed by protocol.
+var decoders = map[int]func(d *wire.Decoder) (x, z int32, sections []section){
+	764: chunk764,
+}
+
+// column is the top block of each position of a chunk.
+type column struct {
+	color  [256]color.RGBA
+	height [256]int16
+}
+
+// Renderer collects the chunks of a recording and draws them.
+type Renderer struct {
+	table   *protocol.Table
+	tracker *protocol.Tracker
+	decode  func(d *wire.Decoder) (x, z int32, sections []section)
+	opts    Options
+
+	chunks   map[[2]int32]*column
+	first    uint32 // time of the first chunk
+	done     bool
+	dim      string
+	chunkDim string     // dimension of the collected chunks
+	center   [2]float64 // block x, z of the player
+	located  bool
+}
+
+// NewRenderer returns a renderer for a recording of the given protocol that
+// starts in state s (protocol.Login for ReplayMod recordings).
+func NewRenderer(proto int, s protocol.State, opts Options) (*Renderer, error) {
+	table, ok := protocol.Lookup(proto)
+	dec := decoders[proto]
+	if !ok || dec == nil || proto != blockProtocol {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupported, proto)
+	}
+	return &Renderer{
+		table:   table,
+		tracker: protocol.NewTracker(table, s),
+		decode:  dec,
+		opts:    opts.withDefaults(),
+		chunks:  map[[2]int32]*column{},
+	}, nil
+}
+
+// Done reports whether the renderer has all the chunks it will use.
+func (r *Renderer) Done() bool {
+	return r.done
+}
+
+// Observe feeds one packet.
+func (r *Renderer) Observe(ts uint32, id int32, payload []byte) error {
+	if r.done || r.tracker.Observe(id) != protocol.Play {
+		return nil
+	}
+	if dim, ok := r.table.Dimension(id, payload); ok {
+		if r.opts.Window > 0 && r.dim != "" && dim != r.dim && len(r.chunks) > 0 {
+			r.done = true
+		}
+		r.dim = dim
+		return nil
+	}
+	if r.opts.Window > 0 && len(r.chunks) > 0 && time.Duration(ts-r.first)*time.Millisecond > r.opts.Window {
+		r.done = true
+		return nil
+	}
+	d := wire.NewDecoder(payload)
+	switch r.table.Name(protocol.Clientbound, protocol.Play, id) {
+	case "PlayerPosition":
+		// x, y, z are absolute for the first teleport after joining
+		x, _, z := d.Double(), d.Double(), d.Double()
+		if d.Err == nil && !r.located {
+			r.center, r.located = [2]float64{x, z}, true
+		}
+	case "LevelChunkWithLight":
+		x, z, sections := r.decode(d)
+		if d.Err != nil {
+			return fmt.Errorf("LevelChunkWithLight at %d ms: %w", ts, d.Err)
+		}
+		if len(r.chunks) == 0 {
+			r.first, r.chunkDim = ts, r.dim
+		} else if r.dim != r.chunkDim {
+			return nil
+		}
+		r.chunks[[2]int32{x, z}] = tops(sections)
+	}
+	return nil
+}
+
+// tops finds the topmost visible block of each position of a chunk.
+func tops(sections []section) *column {
+	c := &column{}
+	for i := 0; i < 256; i++ {
+		c.height[i] = math.MinInt16
+	}
+	for xz := 0; xz < 256; xz++ {
+	column:
+		for si := len(sections) - 1; si >= 0; si-- {
+			s := &sections[si]
+			if s.empty {
+				continue
+			}
+			for y := 15; y >= 0; y-- {
+				if col := colorOf(s.state(y*256 + xz)); col.A != 0 {
+					c.color[xz] = col
+					c.height[xz] = int16(si*16 + y)
+					break column
+				}
+			}
+		}
+	}
+	return c
+}
+
+// at returns the top block at world position x, z.
+func (r *Renderer) at(x, z int) (color.RGBA, int16, bool) {
+	c := r.chunks[[2]int32{int32(x >> 4), int32(z >> 4)}]
+	if c == nil {
+		return color.RGBA{}, 0, false
+	}
+	i := (z&15)*16 + x&15
+	if c.height[i] == math.MinInt16 {
+		return color.RGBA{}, 0, false
+	}
+	return c.color[i], c.height[i], true
+}
+
+// pixel returns the shaded color of the top block at world position x, z.
+func (r *Renderer) pixel(x, z int) (color.RGBA, bool) {
+	col, h, ok := r.at(x, z)
+	if !ok {
+		return color.RGBA{}, false
+	}
+	// Map relief: lighter where the terrain rises towards the south
+	if _, hn, ok := r.at(x, z-1); ok {
+		switch {
+		case h > hn:
+			col = shade(col, 1.0)
+		case h < hn:
+			col = shade(col, 180.0/255)
+		default:
+			col = shade(col, 220.0/255)
+		}
+	}
+	return col, true
+}
+
+// Center returns the block x, z of the player's first position, or the middle
+// of the loaded area if the recording has none.
+func (r *Renderer) Center() (x, z float64) {
+	if r.located || len(r.chunks) == 0 {
+		return r.center[0], r.center[1]
+	}
+	for pos := range r.chunks {
+		x += float64(pos[0])*16 + 8
+		z += float64(pos[1])*16 + 8
+	}
+	return x / float64(len(r.chunks)), z / float64(len(r.chunks))
+}
+
+// Image draws the collected chunks centered on the player (or on the loaded
+// area if the recording has no position).
+func (r *Renderer) Image() (*image.RGBA, error) {
+	if len(r.chunks) == 0 {
+		return nil, ErrNoChunks
+	}
+	cx, cz := r.Center()
+	o := r.opts
+	img := image.NewRGBA(image.Rect(0, 0, o.Width, o.Height))
+	x0 := int(math.Floor(cx)) - o.Width/o.Scale/2
+	z0 := int(math.Floor(cz)) - o.Height/o.Scale/2
+	for py := 0; py < o.Height; py++ {
+		for px := 0; px < o.Width; px++ {
+			col, ok := r.pixel(x0+px/o.Scale, z0+py/o.Scale)
+			if !ok {
+				col = background
+			}
+			img.SetRGBA(px, py, col)
+		}
+	}
+	return img, nil
+}
+
+// PNG encodes the image as PNG.
+func (r *Renderer) PNG() ([]byte, error) {
+	img, err := r.Image()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load feeds the replay at path to a new renderer until it is done.
+func Load(path string, opts Options) (*Renderer, error) {
+	ar, err := archive.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+	r, err := NewRenderer(ar.Meta.Protocol, protocol.Login, opts)
+	if err != nil {
+		return nil, err
+	}
+	errDone := errors.New("done")
+	err = ar.Each(func(f tmcpr.Frame) error {
+		if err := r.Observe(f.Time, f.ID, f.Payload); err != nil {
+			return err
+		}
+		if r.Done() {
+			return errDone
+		}
+		return nil
+	})
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render renders the replay at path as PNG.
+func Render(path string, opts Options) ([]byte, error) {
+	r, err := Load(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.PNG()
+}
+
+// Set renders the replay at src and writes it with the image as thumbnail to
+// dst, which may equal src.
+func Set(src, dst string, opts Options) error {
+	img, err := Render(src, opts)
+	if err != nil {
+		return err
+	}
+	p, _ := transform.ParsePipeline("")
+	_, err = transform.RewriteFile(src, dst, p, transform.Options{Thumbnail: img})
+	return err
+}
@@ -0,0 +1,177 @@
+package thumbnail
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// TileSize is the width and height of a map tile in pixels.
+const TileSize = 256
+
+// TileOptions control tile export. Zero values select the defaults.
+type TileOptions struct {
+	// Zooms is the number of zoom levels (default 5). The highest, Zooms-1,
+	// draws one block per pixel; each level below halves the scale.
+	Zooms int
+}
+
+// TileSet describes exported tiles; it is written as tiles.json next to them.
+//
+// Tiles are laid out as {z}/{x}/{y}.png for Leaflet's L.CRS.Simple: at the
+// highest zoom, tile x, y covers blocks x*256 to x*256+255 and z*256 to
+// z*256+255, and the block at x, z is at LatLng(-z/2^MaxZoom, x/2^MaxZoom).
+type TileSet struct {
+	Dimension string     `json:"dimension"`
+	TileSize  int        `json:"tileSize"`
+	MinZoom   int        `json:"minZoom"`
+	MaxZoom   int        `json:"maxZoom"`
+	Bounds    [2][2]int  `json:"bounds"` // [[minX, minZ], [maxX, maxZ]] in blocks
+	Center    [2]float64 `json:"center"` // block x, z, see Renderer.Center
+	Tiles     int        `json:"tiles"`  // number of tiles written
+}
+
+// LatLng returns the Leaflet coordinates of block x, z.
+func (ts *TileSet) LatLng(x, z float64) [2]float64 {
+	f := float64(int(1) << ts.MaxZoom)
+	return [2]float64{-z / f, x / f}
+}
+
+// WriteTiles writes the collected chunks as map tiles to dir. Pixels outside
+// loaded chunks are transparent and tiles without any chunk are not written.
+func (r *Renderer) WriteTiles(dir string, opts TileOptions) (*TileSet, error) {
+	if len(r.chunks) == 0 {
+		return nil, ErrNoChunks
+	}
+	if opts.Zooms <= 0 {
+		opts.Zooms = 5
+	}
+	ts := &TileSet{Dimension: r.chunkDim, TileSize: TileSize, MaxZoom: opts.Zooms - 1}
+	ts.Center[0], ts.Center[1] = r.Center()
+
+	level := map[[2]int]*image.RGBA{}
+	first := true
+	for pos := range r.chunks {
+		cx, cz := int(pos[0]), int(pos[1])
+		if first || cx*16 < ts.Bounds[0][0] {
+			ts.Bounds[0][0] = cx * 16
+		}
+		if first || cz*16 < ts.Bounds[0][1] {
+			ts.Bounds[0][1] = cz * 16
+		}
+		if first || cx*16+15 > ts.Bounds[1][0] {
+			ts.Bounds[1][0] = cx*16 + 15
+		}
+		if first || cz*16+15 > ts.Bounds[1][1] {
+			ts.Bounds[1][1] = cz*16 + 15
+		}
+		first = false
+		// 16 chunks per tile side at one block per pixel
+		level[[2]int{cx >> 4, cz >> 4}] = nil
+	}
+	for t := range level {
+		level[t] = r.tile(t[0], t[1])
+	}
+
+	for z := ts.MaxZoom; ; z-- {
+		for t, img := range level {
+			if err := writeTile(dir, z, t[0], t[1], img); err != nil {
+				return nil, err
+			}
+			ts.Tiles++
+		}
+		if z == ts.MinZoom {
+			break
+		}
+		level = zoomOut(level)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "tiles.json"))
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ts); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ts, f.Close()
+}
+
+// tile draws the highest-zoom tile tx, tz.
+func (r *Renderer) tile(tx, tz int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	for py := 0; py < TileSize; py++ {
+		for px := 0; px < TileSize; px++ {
+			if col, ok := r.pixel(tx*TileSize+px, tz*TileSize+py); ok {
+				img.SetRGBA(px, py, col)
+			}
+		}
+	}
+	return img
+}
+
+// zoomOut combines each 2×2 group of tiles into one tile of the zoom level
+// below, averaging the opaque pixels of each 2×2 block of pixels.
+func zoomOut(level map[[2]int]*image.RGBA) map[[2]int]*image.RGBA {
+	out := map[[2]int]*image.RGBA{}
+	for t, src := range level {
+		p := [2]int{t[0] >> 1, t[1] >> 1}
+		dst := out[p]
+		if dst == nil {
+			dst = image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+			out[p] = dst
+		}
+		ox, oy := (t[0]&1)*TileSize/2, (t[1]&1)*TileSize/2
+		for py := 0; py < TileSize/2; py++ {
+			for px := 0; px < TileSize/2; px++ {
+				var sum [3]int
+				n := 0
+				for _, c := range []color.RGBA{
+					src.RGBAAt(2*px, 2*py), src.RGBAAt(2*px+1, 2*py),
+					src.RGBAAt(2*px, 2*py+1), src.RGBAAt(2*px+1, 2*py+1),
+				} {
+					if c.A != 0 {
+						sum[0], sum[1], sum[2] = sum[0]+int(c.R), sum[1]+int(c.G), sum[2]+int(c.B)
+						n++
+					}
+				}
+				if n > 0 {
+					dst.SetRGBA(ox+px, oy+py, color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 255})
+				}
+			}
+		}
+	}
+	return out
+}
+
+func writeTile(dir string, z, x, y int, img *image.RGBA) error {
+	path := filepath.Join(dir, fmt.Sprint(z), fmt.Sprint(x), fmt.Sprint(y)+".png")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Tiles renders every chunk of the replay at path in the dimension the
+// recording starts in and writes them as map tiles to dir.
+func Tiles(path, dir string, opts TileOptions) (*TileSet, error) {
+	r, err := Load(path, Options{Window: -1})
+	if err != nil {
+		return nil, err
+	}
+	return r.WriteTiles(dir, opts)
+}
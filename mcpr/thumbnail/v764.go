@@ -0,0 +1,92 @@
+package thumbnail
+
+import (
+	"encoding/binary"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/wire"
+)
+
+// LevelChunkWithLight (1.20.2): x:int z:int heightmaps:nbt data:bytes ...
+//
+// data holds the chunk's sections bottom to top, each blockCount:short then
+// the block states and biomes as paletted containers.
+func chunk764(d *wire.Decoder) (x, z int32, sections []section) {
+	x, z = d.Int(), d.Int()
+	d.NBT(true)
+	data := wire.NewDecoder(d.ByteArray())
+	for len(data.B) > 0 && data.Err == nil {
+		count := data.Short()
+		s := palettedBlocks764(data)
+		s.empty = count == 0
+		skipBiomes764(data)
+		sections = append(sections, s)
+	}
+	if d.Err == nil {
+		d.Err = data.Err
+	}
+	return x, z, sections
+}
+
+// palettedBlocks764 reads the block states of a section: bits:byte, then a
+// single value (bits 0), a palette (bits 1-8, at least 4 used) or nothing
+// (global ids), then data:varint×long with entries not spanning longs.
+func palettedBlocks764(d *wire.Decoder) section {
+	var s section
+	s.bits = int(d.Byte())
+	switch {
+	case s.bits == 0:
+		s.palette = []int32{d.VarInt()}
+	case s.bits <= 8:
+		if s.bits < 4 {
+			s.bits = 4
+		}
+		for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+			s.palette = append(s.palette, d.VarInt())
+		}
+	}
+	s.data = d.Raw(int(d.VarInt()) * 8)
+	return s
+}
+
+// skipBiomes764 skips a biome container: like blocks, but indirect for bits 1-3.
+func skipBiomes764(d *wire.Decoder) {
+	bits := d.Byte()
+	switch {
+	case bits == 0:
+		d.VarInt()
+	case bits <= 3:
+		for n := d.VarInt(); n > 0 && d.Err == nil; n-- {
+			d.VarInt()
+		}
+	}
+	d.Skip(int(d.VarInt()) * 8)
+}
+
+// section is one 16×16×16 block of a chunk column.
+type section struct {
+	empty   bool
+	bits    int
+	palette []int32 // nil for global ids
+	data    []byte  // big-endian longs
+}
+
+// state returns the block state at index y*256+z*16+x.
+func (s *section) state(i int) int32 {
+	if s.bits == 0 {
+		return s.palette[0]
+	}
+	perLong := 64 / s.bits
+	li := i / perLong
+	if (li+1)*8 > len(s.data) {
+		return 0
+	}
+	v := binary.BigEndian.Uint64(s.data[li*8:])
+	v = v >> (uint(i%perLong) * uint(s.bits)) & (1<<uint(s.bits) - 1)
+	if s.palette == nil {
+		return int32(v)
+	}
+	if int(v) >= len(s.palette) {
+		return 0
+	}
+	return s.palette[v]
+}
@@ -0,0 +1,259 @@
+package mcpr
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+)
+
+// TimelinesEntryName is the archive entry ReplayMod's editor stores camera
+// paths in, replacing the paths.json of older versions.
+const TimelinesEntryName = "timelines.json"
+
+// Keyframe property names used by ReplayMod's simple path editor.
+const (
+    PropTimestamp = "timestamp"       // replay time in ms, an integer
+    PropPosition  = "camera:position" // [x, y, z]
+    PropRotation  = "camera:rotation" // [yaw, pitch, roll]
+)
+
+// Interpolator types known to ReplayMod.
+const (
+    InterpolatorLinear     = "linear"
+    InterpolatorCubic      = "cubic-spline"
+    InterpolatorCatmullRom = "catmull-rom-spline"
+)
+
+// Timeline is a set of keyframe paths edited together. timelines.json maps
+// timeline names to timelines: "" is the one open in the editor, others are
+// saved presets. The simple path editor uses two paths, the first for
+// PropTimestamp keyframes and the second for the camera.
+type Timeline struct {
+    Paths []Path
+}
+
+// Path is a sequence of keyframes. Segments has an entry per pair of
+// adjacent keyframes: the index of its interpolator in Interpolators, or nil
+// for none.
+type Path struct {
+    Keyframes     []Keyframe     `json:"keyframes"`
+    Segments      []*int         `json:"segments"`
+    Interpolators []Interpolator `json:"interpolators"`
+}
+
+// Keyframe sets properties at a point of a path. Time is the position in the
+// rendered video in ms, not the replay time (see PropTimestamp). Properties
+// hold ReplayMod's JSON encoding of each value; the typed accessors cover
+// the properties of the simple path editor.
+type Keyframe struct {
+    Time       int64                      `json:"time"`
+    Properties map[string]json.RawMessage `json:"properties"`
+}
+
+// Interpolator interpolates the listed properties over the segments that
+// refer to it. Alpha is the parameter of InterpolatorCatmullRom.
+type Interpolator struct {
+    Type       string
+    Alpha      float64
+    Properties []string
+}
+
+// interpolatorJSON is ReplayMod's form: {"type":"linear","properties":[...]},
+// where type is {"type":"catmull-rom-spline","alpha":0.5} for Catmull-Rom.
+type interpolatorJSON struct {
+    Type       json.RawMessage `json:"type"`
+    Properties []string        `json:"properties"`
+}
+
+type catmullRomJSON struct {
+    Type  string  `json:"type"`
+    Alpha float64 `json:"alpha"`
+}
+
+// MarshalJSON encodes the timeline as ReplayMod's array of paths.
+func (t Timeline) MarshalJSON() ([]byte, error) {
+    paths := t.Paths
+    if paths == nil {
+        paths = []Path{}
+    }
+    return json.Marshal(paths)
+}
+
+// UnmarshalJSON decodes a timeline in ReplayMod's form.
+func (t *Timeline) UnmarshalJSON(b []byte) error {
+    return json.Unmarshal(b, &t.Paths)
+}
+
+// MarshalJSON encodes p in ReplayMod's form, with empty lists rather than null.
+func (p Path) MarshalJSON() ([]byte, error) {
+    type path Path
+    out := path(p)
+    if out.Keyframes == nil {
+        out.Keyframes = []Keyframe{}
+    }
+    if out.Segments == nil {
+        out.Segments = []*int{}
+    }
+    if out.Interpolators == nil {
+        out.Interpolators = []Interpolator{}
+    }
+    return json.Marshal(out)
+}
+
+// MarshalJSON encodes k in ReplayMod's form.
+func (k Keyframe) MarshalJSON() ([]byte, error) {
+    type keyframe Keyframe
+    out := keyframe(k)
+    if out.Properties == nil {
+        out.Properties = map[string]json.RawMessage{}
+    }
+    return json.Marshal(out)
+}
+
+// MarshalJSON encodes in in ReplayMod's form.
+func (in Interpolator) MarshalJSON() ([]byte, error) {
+    var j interpolatorJSON
+    var err error
+    if in.Type == InterpolatorCatmullRom {
+        j.Type, err = json.Marshal(catmullRomJSON{Type: in.Type, Alpha: in.Alpha})
+    } else {
+        j.Type, err = json.Marshal(in.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+    j.Properties = in.Properties
+    if j.Properties == nil {
+        j.Properties = []string{}
+    }
+    return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes an interpolator in ReplayMod's form.
+func (in *Interpolator) UnmarshalJSON(b []byte) error {
+    var j interpolatorJSON
+    if err := json.Unmarshal(b, &j); err != nil {
+        return err
+    }
+    *in = Interpolator{Properties: j.Properties}
+    if json.Unmarshal(j.Type, &in.Type) == nil {
+        return nil
+    }
+    var c catmullRomJSON
+    if err := json.Unmarshal(j.Type, &c); err != nil {
+        return fmt.Errorf("interpolator type: %w", err)
+    }
+    in.Type, in.Alpha = c.Type, c.Alpha
+    return nil
+}
+
+// Timestamp returns the PropTimestamp property.
+func (k Keyframe) Timestamp() (int, bool) {
+    var v int
+    return v, k.get(PropTimestamp, &v)
+}
+
+// SetTimestamp sets the PropTimestamp property.
+func (k *Keyframe) SetTimestamp(ms int) {
+    k.set(PropTimestamp, ms)
+}
+
+// Position returns the PropPosition property.
+func (k Keyframe) Position() ([3]float64, bool) {
+    var v [3]float64
+    return v, k.get(PropPosition, &v)
+}
+
+// SetPosition sets the PropPosition property.
+func (k *Keyframe) SetPosition(x, y, z float64) {
+    k.set(PropPosition, [3]float64{x, y, z})
+}
+
+// Rotation returns the PropRotation property.
+func (k Keyframe) Rotation() ([3]float32, bool) {
+    var v [3]float32
+    return v, k.get(PropRotation, &v)
+}
+
+// SetRotation sets the PropRotation property.
+func (k *Keyframe) SetRotation(yaw, pitch, roll float32) {
+    k.set(PropRotation, [3]float32{yaw, pitch, roll})
+}
+
+func (k Keyframe) get(name string, v any) bool {
+    raw, ok := k.Properties[name]
+    return ok && json.Unmarshal(raw, v) == nil
+}
+
+func (k *Keyframe) set(name string, v any) {
+    b, err := json.Marshal(v)
+    if err != nil {
+        panic(err) // numbers and arrays of them always marshal
+    }
+    if k.Properties == nil {
+        k.Properties = map[string]json.RawMessage{}
+    }
+    k.Properties[name] = b
+}
+
+// SetTimeline sets the timeline name written to timelines.json on Close, or
+// removes it if t is nil. It has no effect if the caller supplies
+// timelines.json itself via CreateEntry or CopyEntry.
+func (w *Writer) SetTimeline(name string, t *Timeline) {
+    defer w.lock().unlock()
+    if t == nil {
+        delete(w.timelines, name)
+        return
+    }
+    if w.timelines == nil {
+        w.timelines = map[string]Timeline{}
+    }
+    w.timelines[name] = *t
+}
+
+func (w *Writer) writeTimelines() error {
+    if len(w.timelines) == 0 || w.entries[TimelinesEntryName] {
+        return nil
+    }
+    tw, err := w.createEntry(TimelinesEntryName)
+    if err != nil {
+        return fmt.Errorf("create %s: %w", TimelinesEntryName, err)
+    }
+    return json.NewEncoder(tw).Encode(w.timelines)
+}
+
+// ReadTimelines returns the timelines stored in the replay at path by name,
+// or nil if it has none.
+func ReadTimelines(path string) (map[string]Timeline, error) {
+    zr, err := openZip(path)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return readTimelines(zr.File)
+}
+
+// Timelines returns the timelines stored in the replay's timelines.json by
+// name, or nil if it has none. Pass them to Writer.SetTimeline to transfer
+// camera paths to another replay.
+func (r *Reader) Timelines() (map[string]Timeline, error) {
+    return readTimelines(r.files)
+}
+
+func readTimelines(files []*zip.File) (map[string]Timeline, error) {
+    for _, f := range files {
+        if f.Name == TimelinesEntryName {
+            rc, err := f.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer rc.Close()
+            var ts map[string]Timeline
+            if err := json.NewDecoder(rc).Decode(&ts); err != nil {
+                return nil, fmt.Errorf("parse %s: %w", TimelinesEntryName, err)
+            }
+            return ts, nil
+        }
+    }
+    return nil, nil
+}
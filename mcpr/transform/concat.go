@@ -0,0 +1,219 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// Concat writes the replays srcs back to back into dst, e.g. the parts of a
+// session split by recorder limits. Each replay starts where the previous one
+// ends (its duration or its last packet, whichever is later). All replays
+// must have the same protocol.
+//
+// The metadata is merged with mcpr.MergeMeta; markers are carried over with
+// their times shifted and tags are combined. Other entries are carried over
+// according to opts.Entries, the first replay's copy winning when several
+// have an entry. opts.Markers, Thumbnail and Tags replace the merged ones as
+// for RewriteFile, and PackThreshold and Lenient apply as well; StartInPlay
+// is ignored. Skipped offsets are those of the replay they were found in.
+func Concat(dst string, srcs []string, opts Options) (Stats, error) {
+	var stats Stats
+	if len(srcs) == 0 {
+		return stats, errors.New("concat: no replays")
+	}
+	metas := make([]mcpr.Meta, len(srcs))
+	for i, src := range srcs {
+		m, err := mcpr.ReadMeta(src)
+		if err != nil {
+			return stats, err
+		}
+		if i > 0 && m.Protocol != metas[0].Protocol {
+			return stats, fmt.Errorf("concat: %s has protocol %d, %s has %d", src, m.Protocol, srcs[0], metas[0].Protocol)
+		}
+		metas[i] = m
+	}
+	meta := mcpr.MergeMeta(metas...)
+	meta.Duration = 0 // recomputed by the writer
+
+	tmp := dst + ".tmp"
+	w, err := mcpr.Create(tmp, meta,
+		mcpr.WithRecordingCompression(opts.Compression),
+		mcpr.WithSidecar(hasSidecar(srcs[0])),
+		mcpr.WithPackThreshold(opts.PackThreshold))
+	if err != nil {
+		return stats, err
+	}
+	fail := func(err error) (Stats, error) {
+		_ = w.Close()
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+
+	var (
+		base  uint32
+		tags  []string
+		guess *mcpr.ProtocolGuess
+		steps []mcpr.ProcessingStep
+	)
+	for i, src := range srcs {
+		end, crc, err := concatOne(w, src, base, opts, &stats)
+		if err != nil {
+			return fail(err)
+		}
+		if opts.Markers == nil {
+			ms, err := mcpr.ReadMarkers(src)
+			if err != nil {
+				return fail(err)
+			}
+			for _, m := range ms {
+				m.Time += int(base)
+				w.AddMarker(m)
+			}
+		}
+		ext, err := mcpr.ReadExtMeta(src)
+		if err != nil {
+			return fail(err)
+		}
+		tags = append(tags, ext.Tags...)
+		if guess == nil {
+			guess = ext.ProtocolGuess
+		}
+		if i == 0 && !opts.NewHistory {
+			// Earlier rewrites of the first replay stay traceable
+			if steps, err = mcpr.ReadProcessingLog(src); err != nil {
+				return fail(err)
+			}
+		}
+		step := mcpr.ProcessingStep{
+			Tool:        opts.Tool,
+			Operation:   opts.Operation,
+			Source:      metas[i].ID,
+			SourceCRC32: crc,
+		}
+		if opts.NewHistory {
+			step.Source, step.SourceCRC32 = "", ""
+		}
+		steps = append(steps, step)
+		if d := uint32(metas[i].Duration); metas[i].Duration > 0 && base+d > end {
+			end = base + d
+		}
+		base = end
+	}
+	// Entries can only be added after the recording is complete
+	copied := map[string]bool{}
+	for _, src := range srcs {
+		if err := concatEntries(w, src, opts, copied, &stats); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, m := range opts.Markers {
+		w.AddMarker(m)
+	}
+	if opts.Thumbnail != nil {
+		w.SetThumbnail(opts.Thumbnail)
+	}
+	if opts.Tags != nil {
+		tags = opts.Tags
+	}
+	w.AddTags(tags...)
+	w.SetProtocolGuess(guess)
+	for _, s := range steps {
+		if s.Tool == "" {
+			s.Tool = filepath.Base(os.Args[0])
+		}
+		if s.Operation == "" {
+			s.Operation = fmt.Sprintf("concat(%d)", len(srcs))
+		}
+		w.AddProcessingStep(s)
+	}
+	if err := w.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return stats, err
+	}
+	if _, err := os.Stat(mcpr.SidecarPath(tmp)); err == nil {
+		if err := os.Rename(mcpr.SidecarPath(tmp), mcpr.SidecarPath(dst)); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// concatOne copies the packets of src to w shifted by base. It returns the
+// time of the last packet written and the recording checksum of src.
+func concatOne(w *mcpr.Writer, src string, base uint32, opts Options, stats *Stats) (uint32, string, error) {
+	zr, err := archive.Open(src)
+	if err != nil {
+		return base, "", err
+	}
+	defer zr.Close()
+	fr, rec, err := zr.Frames()
+	if err != nil {
+		return base, "", err
+	}
+	defer rec.Close()
+	if opts.Lenient {
+		fr.SetLenient(func(s tmcpr.Skipped) { stats.Skipped = append(stats.Skipped, mcpr.SkippedRange(s)) })
+	}
+	end := base
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return end, "", fmt.Errorf("read %s: %w", src, err)
+		}
+		stats.PacketsIn++
+		t := base + f.Time
+		if t < base {
+			return end, "", fmt.Errorf("concat: %s: packet times overflow", src)
+		}
+		if err := w.WritePacket(t, f.ID, f.Payload); err != nil {
+			return end, "", err
+		}
+		stats.PacketsOut++
+		if t > end {
+			end = t
+		}
+	}
+	return end, readEntry(zr, "recording.tmcpr.crc32"), nil
+}
+
+// concatEntries copies the entries of src selected by opts and not in copied.
+func concatEntries(w *mcpr.Writer, src string, opts Options, copied map[string]bool, stats *Stats) error {
+	zr, err := archive.Open(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		switch {
+		case managedEntries[f.Name], f.Name == mcpr.ProcessingEntryName,
+			f.Name == mcpr.MarkersEntryName, f.Name == mcpr.ExtMetaEntryName,
+			opts.Thumbnail != nil && f.Name == mcpr.ThumbEntryName,
+			copied[f.Name]:
+			continue
+		}
+		if opts.Entries != nil && !opts.Entries(f.Name) {
+			stats.EntriesDropped++
+			continue
+		}
+		if err := w.CopyEntry(f); err != nil {
+			return fmt.Errorf("copy %s: %w", f.Name, err)
+		}
+		copied[f.Name] = true
+		stats.EntriesCopied++
+	}
+	return nil
+}
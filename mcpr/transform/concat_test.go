@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// writeReplay writes a replay with one packet at each of times.
+func writeReplay(t *testing.T, path string, meta mcpr.Meta, times ...uint32) {
+	t.Helper()
+	w, err := mcpr.Create(path, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range times {
+		if err := w.WritePacket(ts, 0x01, []byte{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcatMeta(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.mcpr")
+	b := filepath.Join(dir, "b.mcpr")
+	out := filepath.Join(dir, "out.mcpr")
+	writeReplay(t, a, mcpr.Meta{Protocol: 765, Date: 2000, Generator: "proxyrec", Players: []string{"p1", "p2"}}, 0, 400, 1000)
+	writeReplay(t, b, mcpr.Meta{Protocol: 765, Date: 1000, Generator: "bot", Players: []string{"p2", "p3"}}, 0, 500)
+	ma, err := mcpr.ReadMeta(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Concat(out, []string{a, b}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mcpr.ReadMeta(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"p1", "p2", "p3"}; !reflect.DeepEqual(m.Players, want) {
+		t.Errorf("players = %v, want %v", m.Players, want)
+	}
+	if m.Date != 1000 {
+		t.Errorf("date = %d, want the earliest, 1000", m.Date)
+	}
+	if m.Generator != "proxyrec + bot" {
+		t.Errorf("generator = %q, want %q", m.Generator, "proxyrec + bot")
+	}
+	// b starts where a ends, so its last packet is at 1000+500
+	if m.Duration != 1500 {
+		t.Errorf("duration = %d, want 1500", m.Duration)
+	}
+	if m.ID == "" || m.ID == ma.ID {
+		t.Errorf("id = %q, want a new one", m.ID)
+	}
+}
+
+func TestConcatProtocolMismatch(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.mcpr")
+	b := filepath.Join(dir, "b.mcpr")
+	writeReplay(t, a, mcpr.Meta{Protocol: 764}, 0)
+	writeReplay(t, b, mcpr.Meta{Protocol: 765}, 0)
+	if _, err := Concat(filepath.Join(dir, "out.mcpr"), []string{a, b}, Options{}); err == nil {
+		t.Fatal("Concat of different protocols succeeded")
+	}
+}
+
+func TestTrimMeta(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	writeReplay(t, src, mcpr.Meta{Protocol: 765, Date: 10000, Players: []string{"p1", "p1", "p2"}}, 0, 1000, 2000, 3000)
+
+	p, err := ParsePipeline("trim(1000,2500)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RewriteFile(src, dst, p, Options{StartInPlay: true}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mcpr.ReadMeta(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"p1", "p2"}; !reflect.DeepEqual(m.Players, want) {
+		t.Errorf("players = %v, want %v", m.Players, want)
+	}
+	if m.Date != 11000 {
+		t.Errorf("date = %d, want the trimmed start, 11000", m.Date)
+	}
+	if m.Duration != 1000 {
+		t.Errorf("duration = %d, want 1000", m.Duration)
+	}
+}
@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"path"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+)
+
+// EntryFilter decides whether an archive entry is carried over from the
+// source replay to the rewritten one. It returns true to keep the entry.
+type EntryFilter func(name string) bool
+
+// managedEntries are never copied: the writer writes them anew, the
+// dimension and latency entries only if the source has them (see
+// RewriteFile).
+var managedEntries = map[string]bool{
+	"recording.tmcpr":        true,
+	"recording.tmcpr.crc32":  true,
+	"metaData.json":          true,
+	tmcpr.IndexEntryName:     true,
+	mcpr.DimensionsEntryName: true,
+	mcpr.LatencyEntryName:    true,
+}
+
+// DropEntries returns a filter that drops entries matching any pattern.
+// Patterns use path.Match syntax; a pattern ending in "/" matches every entry
+// under that directory.
+func DropEntries(patterns ...string) EntryFilter {
+	return func(name string) bool {
+		return !matchAny(patterns, name)
+	}
+}
+
+// KeepOnly returns a filter that keeps only entries matching a pattern.
+// Pattern syntax is the same as for DropEntries.
+func KeepOnly(patterns ...string) EntryFilter {
+	return func(name string) bool {
+		return matchAny(patterns, name)
+	}
+}
+
+// AllEntries returns a filter keeping entries accepted by every filter.
+// Nil filters are ignored.
+func AllEntries(filters ...EntryFilter) EntryFilter {
+	return func(name string) bool {
+		for _, f := range filters {
+			if f != nil && !f(name) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(name, p) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
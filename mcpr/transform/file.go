@@ -0,0 +1,471 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/archive"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Options control RewriteFile.
+type Options struct {
+	// StartInPlay treats the recording as starting in the play state instead of
+	// the login phase ReplayMod recordings begin with. Set it for streams
+	// captured after login (e.g. via the tnze adapter).
+	StartInPlay bool
+
+	// Entries selects which additional archive entries (markers, assets,
+	// custom files) are carried over. Nil keeps all of them.
+	Entries EntryFilter
+
+	// Markers, when non-nil, replace the source's markers.json.
+	Markers []mcpr.Marker
+
+	// Timelines, when non-nil, replace the source's timelines.json (camera
+	// paths, see mcpr.Timeline), e.g. to transfer them from another replay.
+	Timelines map[string]mcpr.Timeline
+
+	// Thumbnail, when non-nil, replaces the source's thumbnail (an encoded
+	// image, see mcpr.Writer.SetThumbnail).
+	Thumbnail []byte
+
+	// Tags, when non-nil, replace the source's tags (see mcpr.ExtMeta).
+	Tags []string
+
+	// Meta, when non-nil, is applied to the output's metadata as the
+	// replay is finalized (see mcpr.Writer.CloseWithMeta).
+	Meta *mcpr.MetaPatch
+
+	// Lenient salvages damaged recordings: corrupt frames are skipped and
+	// listed in Stats.Skipped instead of failing the rewrite (see
+	// mcpr.Reader.SetLenient).
+	Lenient bool
+
+	// PackThreshold packs the payloads of at least that many bytes in the
+	// output (see mcpr.Writer.SetPackThreshold). 0 writes no packed frames,
+	// flattening packed sources.
+	PackThreshold int
+
+	// Compression is the compression of the output's recording.tmcpr (see
+	// mcpr.WithRecordingCompression), e.g. Store for fast seeking.
+	Compression mcpr.Compression
+
+	// Tool and Operation describe the rewrite in the processing log (see
+	// mcpr.ProcessingStep). Tool defaults to the program name and Operation
+	// to the pipeline and the entries replaced.
+	Tool      string
+	Operation string
+
+	// NewHistory starts the output's processing log afresh instead of
+	// carrying the sources' over, and leaves the sources out of the steps
+	// recorded, for copies that must not be traceable to their originals.
+	NewHistory bool
+
+	// Context cancels the rewrite, which then fails with its error, and
+	// bounds the life of plugin processes (see Env.Context). Nil means the
+	// rewrite runs to the end.
+	Context context.Context
+}
+
+// A rewrite feeds the pipeline batches of up to rewriteBatch packets or
+// rewriteBatchBytes of payload, see BatchStage.
+const (
+	rewriteBatch      = 256
+	rewriteBatchBytes = 1 << 20
+)
+
+var rewriteTimer = perf.NewTimer("transform.RewriteFile")
+
+// Stats summarizes a rewrite.
+type Stats struct {
+	PacketsIn      int64
+	PacketsOut     int64
+	EntriesCopied  int
+	EntriesDropped int
+	Skipped        []mcpr.SkippedRange // see Options.Lenient
+}
+
+// RewriteFile streams the replay at src through p and writes the result to dst.
+// dst may equal src; the output is written to a temporary file and renamed
+// into place. Additional entries are carried over according to opts.Entries.
+// If src has a sidecar (see mcpr.Sidecar), one is written for dst too. The
+// rewrite is appended to the processing log carried over from src.
+//
+// When the pipeline changes packet times, markers, timelines and annotations
+// are moved along if every stage implements TimeMapper and dropped (counted
+// in Stats.EntriesDropped) otherwise. When it only drops packets, the frame
+// indexes of annotations are still moved to the frames that remain. Dimension segments and latency
+// estimates are computed again from the output's packets.
+func RewriteFile(src, dst string, p *Pipeline, opts Options) (Stats, error) {
+	defer rewriteTimer.Since(time.Now())
+	var stats Stats
+	zr, err := archive.Open(src)
+	if err != nil {
+		return stats, err
+	}
+	defer zr.Close()
+
+	meta := mcpr.MergeMeta(zr.Meta) // drops duplicate players
+	env := Env{Meta: zr.Meta}
+	if t, ok := protocol.Lookup(meta.Protocol); ok {
+		env.Table = t
+	}
+	env.Context = opts.Context
+	stage, err := p.Build(env)
+	if err != nil {
+		return stats, err
+	}
+	defer closeStage(stage)
+	updateMeta(stage, &meta)
+
+	fr, rec, err := zr.Frames()
+	if err != nil {
+		return stats, err
+	}
+	defer rec.Close()
+	if opts.Lenient {
+		fr.SetLenient(func(s tmcpr.Skipped) { stats.Skipped = append(stats.Skipped, mcpr.SkippedRange(s)) })
+	}
+
+	// The output is a new recording derived from src: let the writer assign
+	// a fresh id (MergeMeta cleared it) and recompute the duration.
+	meta.Duration = 0
+	tmp := dst + ".tmp"
+	wopts := []mcpr.WriterOption{
+		mcpr.WithRecordingCompression(opts.Compression),
+		mcpr.WithSidecar(hasSidecar(src)),
+		mcpr.WithPackThreshold(opts.PackThreshold),
+	}
+	if ix, err := zr.Index(); err == nil {
+		// Offsets change with the stream; rebuild the index at the same interval
+		wopts = append(wopts, mcpr.WithIndexInterval(ix.Interval))
+	}
+	initial := protocol.Login
+	if opts.StartInPlay {
+		initial = protocol.Play
+	}
+	if hasEntry(zr, mcpr.DimensionsEntryName) {
+		// Segment times change with the stream; let the writer recompute them
+		wopts = append(wopts, mcpr.WithDimensions(initial))
+	}
+	if hasEntry(zr, mcpr.LatencyEntryName) {
+		// latency.bin has one lag per frame, which no longer line up once
+		// frames are dropped; let the writer estimate them again
+		wopts = append(wopts, mcpr.WithLatency(initial))
+	}
+	w, err := mcpr.Create(tmp, meta, wopts...)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+
+	var tracker *protocol.Tracker
+	if env.Table != nil && !opts.StartInPlay {
+		tracker = protocol.NewTracker(env.Table, protocol.Login)
+	}
+	// Annotations refer to frames by index; remember where the annotated
+	// frames end up in case they have to be moved (see timedEntries)
+	anns, err := mcpr.ReadAnnotations(src)
+	if err != nil {
+		_ = w.Close()
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	var frames map[int64]int64
+	if len(anns) > 0 {
+		frames = make(map[int64]int64, len(anns))
+		for _, a := range anns {
+			if a.Frame >= 0 {
+				frames[a.Frame] = -1
+			}
+		}
+	}
+	var retimed bool
+	var end uint32
+	// Packets go through the pipeline in batches, see BatchStage
+	var (
+		batch      []Packet
+		keep       []bool
+		times      []uint32 // the packets' times before the pipeline
+		batchBytes int
+	)
+	flush := func() error {
+		applyBatch(stage, batch, keep)
+		for i := range batch {
+			in := stats.PacketsIn - int64(len(batch)) + int64(i)
+			if keep[i] {
+				pk := &batch[i]
+				if err := w.WritePacket(pk.Time, pk.ID, pk.Payload); err != nil {
+					return err
+				}
+				stats.PacketsOut++
+				retimed = retimed || pk.Time != times[i]
+				end = max(end, pk.Time)
+			}
+			if _, ok := frames[in]; ok {
+				frames[in] = stats.PacketsOut - 1
+			}
+		}
+		batch, keep, times, batchBytes = batch[:0], keep[:0], times[:0], 0
+		return nil
+	}
+	for {
+		f, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = w.Close()
+			_ = os.Remove(tmp)
+			return stats, fmt.Errorf("read %s: %w", src, err)
+		}
+		stats.PacketsIn++
+		pk := Packet{Time: f.Time, ID: f.ID, Payload: f.Payload, State: protocol.Play}
+		if tracker != nil {
+			pk.State = tracker.Observe(f.ID)
+		}
+		batch, keep, times = append(batch, pk), append(keep, true), append(times, f.Time)
+		batchBytes += len(pk.Payload)
+		if len(batch) < rewriteBatch && batchBytes < rewriteBatchBytes {
+			continue
+		}
+		err = flush()
+		if err == nil && opts.Context != nil {
+			err = opts.Context.Err()
+		}
+		if err != nil {
+			_ = w.Close()
+			_ = os.Remove(tmp)
+			return stats, err
+		}
+	}
+	if err := flush(); err != nil {
+		_ = w.Close()
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	// Stages such as plugins report failures when closed
+	if err := closeStage(stage); err != nil {
+		_ = w.Close()
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	var steps []mcpr.ProcessingStep
+	if !opts.NewHistory {
+		if steps, err = mcpr.ReadProcessingLog(src); err != nil {
+			_ = w.Close()
+			_ = os.Remove(tmp)
+			return stats, err
+		}
+	}
+	tm, canRetime := timeMapper(stage)
+	for _, f := range zr.File {
+		if managedEntries[f.Name] || f.Name == mcpr.ProcessingEntryName || (opts.Markers != nil && f.Name == mcpr.MarkersEntryName) ||
+			(opts.Timelines != nil && f.Name == mcpr.TimelinesEntryName) ||
+			(opts.Thumbnail != nil && f.Name == mcpr.ThumbEntryName) || f.Name == mcpr.ExtMetaEntryName {
+			continue
+		}
+		if opts.Entries != nil && !opts.Entries(f.Name) {
+			stats.EntriesDropped++
+			continue
+		}
+		if retimed && timedEntries[f.Name] {
+			// Times in the entry no longer match the packets: move them
+			// along if the pipeline says how, otherwise drop the entry
+			if !canRetime {
+				stats.EntriesDropped++
+				continue
+			}
+			if err := retimeEntry(src, f.Name, w, tm, end, anns, frames); err != nil {
+				_ = w.Close()
+				_ = os.Remove(tmp)
+				return stats, fmt.Errorf("retime %s: %w", f.Name, err)
+			}
+			stats.EntriesCopied++
+			continue
+		}
+		if f.Name == mcpr.AnnotationsEntryName && stats.PacketsOut < stats.PacketsIn {
+			// Times still match but frames were dropped: move the frame
+			// indexes to the frames that remain
+			if err := writeAnnotations(w, retimeAnnotations(anns, sameTimes, frames)); err != nil {
+				_ = w.Close()
+				_ = os.Remove(tmp)
+				return stats, fmt.Errorf("retime %s: %w", f.Name, err)
+			}
+			stats.EntriesCopied++
+			continue
+		}
+		if err := w.CopyEntry(f); err != nil {
+			_ = w.Close()
+			_ = os.Remove(tmp)
+			return stats, fmt.Errorf("copy %s: %w", f.Name, err)
+		}
+		stats.EntriesCopied++
+	}
+	for _, m := range opts.Markers {
+		w.AddMarker(m)
+	}
+	for name, t := range opts.Timelines {
+		w.SetTimeline(name, &t)
+	}
+	if opts.Thumbnail != nil {
+		w.SetThumbnail(opts.Thumbnail)
+	}
+	// metaDataExt.json is regenerated: the tags may be replaced and whether
+	// the output is packed depends on opts
+	ext, err := mcpr.ReadExtMeta(src)
+	if err != nil {
+		_ = w.Close()
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	if opts.Tags != nil {
+		ext.Tags = opts.Tags
+	}
+	w.AddTags(ext.Tags...)
+	w.SetProtocolGuess(ext.ProtocolGuess)
+	for _, s := range steps {
+		w.AddProcessingStep(s)
+	}
+	step := mcpr.ProcessingStep{
+		Tool:        opts.Tool,
+		Operation:   opts.Operation,
+		Source:      zr.Meta.ID,
+		SourceCRC32: readEntry(zr, "recording.tmcpr.crc32"),
+	}
+	if step.Tool == "" {
+		step.Tool = filepath.Base(os.Args[0])
+	}
+	if step.Operation == "" {
+		step.Operation = describe(p, opts)
+	}
+	if opts.NewHistory {
+		step.Source, step.SourceCRC32 = "", ""
+	}
+	w.AddProcessingStep(step)
+	var patch mcpr.MetaPatch
+	if opts.Meta != nil {
+		patch = *opts.Meta
+	}
+	if err := w.CloseWithMeta(patch); err != nil {
+		_ = os.Remove(tmp)
+		return stats, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return stats, err
+	}
+	if _, err := os.Stat(mcpr.SidecarPath(tmp)); err == nil {
+		if err := os.Rename(mcpr.SidecarPath(tmp), mcpr.SidecarPath(dst)); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// retimeEntry writes the timed entry name of src to w with its times mapped
+// through tm (see timedEntries).
+func retimeEntry(src, name string, w *mcpr.Writer, tm TimeMapper, end uint32, anns []mcpr.Annotation, frames map[int64]int64) error {
+	switch name {
+	case mcpr.MarkersEntryName:
+		ms, err := mcpr.ReadMarkers(src)
+		if err != nil {
+			return err
+		}
+		for _, m := range retimeMarkers(ms, tm) {
+			w.AddMarker(m)
+		}
+	case mcpr.TimelinesEntryName:
+		ts, err := mcpr.ReadTimelines(src)
+		if err != nil {
+			return err
+		}
+		for name, t := range retimeTimelines(ts, tm, end) {
+			w.SetTimeline(name, &t)
+		}
+	case mcpr.AnnotationsEntryName:
+		return writeAnnotations(w, retimeAnnotations(anns, tm, frames))
+	}
+	return nil
+}
+
+// Flatten rewrites the replay at src to dst without packed frames (see
+// mcpr.Writer.SetPackThreshold), for ReplayMod. dst may equal src.
+func Flatten(src, dst string) (Stats, error) {
+	return RewriteFile(src, dst, &Pipeline{}, Options{Operation: "flatten"})
+}
+
+// describe names what a rewrite changes, e.g. "trim(0,5m), markers".
+func describe(p *Pipeline, opts Options) string {
+	var ops []string
+	if p.Len() > 0 {
+		ops = append(ops, p.String())
+	}
+	if opts.Markers != nil {
+		ops = append(ops, "markers")
+	}
+	if opts.Timelines != nil {
+		ops = append(ops, "timelines")
+	}
+	if opts.Thumbnail != nil {
+		ops = append(ops, "thumbnail")
+	}
+	if opts.Tags != nil {
+		ops = append(ops, "tags")
+	}
+	if opts.Meta != nil {
+		ops = append(ops, "meta")
+	}
+	if opts.Entries != nil {
+		ops = append(ops, "entries")
+	}
+	if opts.PackThreshold > 0 {
+		ops = append(ops, "pack")
+	}
+	if opts.Lenient {
+		ops = append(ops, "lenient")
+	}
+	if len(ops) == 0 {
+		return "copy"
+	}
+	return strings.Join(ops, ", ")
+}
+
+// readEntry returns the contents of a small text entry, or "" if it is
+// missing or unreadable.
+func readEntry(zr *archive.Archive, name string) string {
+	rc, err := zr.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, 1<<10))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// hasSidecar reports whether the replay at path has a sidecar file.
+func hasSidecar(path string) bool {
+	_, err := os.Stat(mcpr.SidecarPath(path))
+	return err == nil
+}
+
+func hasEntry(zr *archive.Archive, name string) bool {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
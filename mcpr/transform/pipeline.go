@@ -0,0 +1,169 @@
+package transform
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+type stageSpec struct {
+	name string
+	args Args
+	src  string
+	f    Factory // for stages added with Append
+}
+
+// Pipeline is a parsed, not yet instantiated, sequence of stages.
+type Pipeline struct {
+	specs []stageSpec
+}
+
+// ParsePipeline parses a pipeline expression such as
+// "trim(0,5m)|filter(preset=cinematic)|rescale(2.0)". Stage names must be
+// registered; arguments are validated when the pipeline is built.
+func ParsePipeline(s string) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, part := range strings.Split(s, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		spec, err := parseStage(part)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := lookup(spec.name); !ok {
+			return nil, fmt.Errorf("unknown stage %q", spec.name)
+		}
+		p.specs = append(p.specs, spec)
+	}
+	return p, nil
+}
+
+func parseStage(s string) (stageSpec, error) {
+	spec := stageSpec{src: s, args: Args{Named: map[string][]string{}}}
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		spec.name = s
+		return spec, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return spec, fmt.Errorf("stage %q: missing ')'", s)
+	}
+	spec.name = strings.TrimSpace(s[:open])
+	inner := strings.TrimSpace(s[open+1 : len(s)-1])
+	if inner == "" {
+		return spec, nil
+	}
+	for _, arg := range strings.Split(inner, ",") {
+		arg = strings.TrimSpace(arg)
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			k = strings.TrimSpace(k)
+			spec.args.Named[k] = append(spec.args.Named[k], strings.TrimSpace(v))
+		} else {
+			spec.args.Positional = append(spec.args.Positional, arg)
+		}
+	}
+	return spec, nil
+}
+
+// Len returns the number of stages in the pipeline.
+func (p *Pipeline) Len() int {
+	return len(p.specs)
+}
+
+// String returns the pipeline in its textual form.
+func (p *Pipeline) String() string {
+	parts := make([]string, len(p.specs))
+	for i, s := range p.specs {
+		parts[i] = s.src
+	}
+	return strings.Join(parts, "|")
+}
+
+// Append adds a stage built by f without registering it, e.g. one whose
+// state the caller inspects after the rewrite. name stands for it in String.
+func (p *Pipeline) Append(name string, f Factory) {
+	p.specs = append(p.specs, stageSpec{name: name, src: name, f: f})
+}
+
+// Build instantiates every stage for env and returns them chained into one.
+// The chain implements io.Closer, closing the stages that do (such as
+// plugins); callers must close it when done.
+func (p *Pipeline) Build(env Env) (Stage, error) {
+	chain := make(chainStage, 0, len(p.specs))
+	for _, spec := range p.specs {
+		f := spec.f
+		if f == nil {
+			f, _ = lookup(spec.name)
+		}
+		st, err := f(env, spec.args)
+		if err != nil {
+			_ = chain.Close()
+			return nil, fmt.Errorf("stage %s: %w", spec.src, err)
+		}
+		chain = append(chain, st)
+	}
+	return chain, nil
+}
+
+type chainStage []Stage
+
+// Close closes the stages implementing io.Closer and returns the first error.
+func (c chainStage) Close() error {
+	var first error
+	for _, st := range c {
+		if err := closeStage(st); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// closeStage closes st if it implements io.Closer.
+func closeStage(st Stage) error {
+	if c, ok := st.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// UpdateMeta lets every stage implementing MetaStage update m, in order.
+func (c chainStage) UpdateMeta(m *mcpr.Meta) {
+	for _, st := range c {
+		updateMeta(st, m)
+	}
+}
+
+func (c chainStage) Apply(p *Packet) bool {
+	for _, st := range c {
+		if !st.Apply(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyBatch runs the batch through every stage in order, each stage seeing
+// the packets the stages before it kept.
+func (c chainStage) ApplyBatch(ps []Packet, keep []bool) {
+	for _, st := range c {
+		applyBatch(st, ps, keep)
+	}
+}
+
+// applyBatch applies st to the packets of ps whose keep flag is set, as a
+// batch if st is a BatchStage and one by one otherwise.
+func applyBatch(st Stage, ps []Packet, keep []bool) {
+	if b, ok := st.(BatchStage); ok {
+		b.ApplyBatch(ps, keep)
+		return
+	}
+	for i := range ps {
+		if keep[i] {
+			keep[i] = st.Apply(&ps[i])
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Plugins are stages running in a separate process, so third parties can
+// extend pipelines without recompiling the tools. They are served with
+// hashicorp/go-plugin over gRPC: the host starts the plugin executable, which
+// calls ServePlugin, and talks to it over a local gRPC connection. What the
+// plugin prints goes to the host's stderr. Plugins are experimental: the API
+// and the protocol may change in a minor release.
+//
+// The plugin serves pluginService with three unary methods:
+//
+//	Start(BytesValue) Empty       JSON {"meta":{...},"args":{...}}; builds the stage
+//	ApplyBatch(BytesValue) BytesValue
+//	Close(Empty) Empty            closes the stage
+//
+// An ApplyBatch request is a count [n:uint32] followed by n frames
+//
+//	[time:uint32][id:int32][state:uint8][len:uint32][payload]
+//
+// (big endian); the reply answers each frame in order with a byte 0 to drop
+// the packet or 1 followed by the possibly modified frame. Errors are gRPC
+// statuses whose message is the stage's error.
+//
+// A plugin that does not start or answer a call within PluginTimeout is
+// considered hung and killed, as it is when the Env's Context is done.
+var pluginHandshake = plugin.HandshakeConfig{
+	ProtocolVersion:  3,
+	MagicCookieKey:   "MCPR_TRANSFORM_PLUGIN",
+	MagicCookieValue: "stage",
+}
+
+const (
+	// pluginName is the name the stage is dispensed under.
+	pluginName = "stage"
+
+	// pluginService is the gRPC service of a plugin, see pluginHandshake.
+	pluginService = "mcpr.transform.Stage"
+)
+
+// MaxPluginPayload bounds the payload length a plugin may return.
+const MaxPluginPayload = 32 << 20
+
+const (
+	// maxPluginBatch bounds the number of frames in a batch.
+	maxPluginBatch = 1 << 16
+
+	// pluginBatchBytes is the payload size from which a batch is split, so
+	// that requests and replies stay well below maxPluginMessage.
+	pluginBatchBytes = 4 << 20
+
+	// maxPluginMessage bounds a gRPC message either way.
+	maxPluginMessage = 256 << 20
+)
+
+// PluginTimeout is how long a plugin may take to start or to answer a batch
+// of packets.
+var PluginTimeout = time.Minute
+
+type pluginHello struct {
+	Meta mcpr.Meta `json:"meta"`
+	Args Args      `json:"args"`
+}
+
+// RegisterPlugin makes the plugin executable at path available to pipelines
+// as stage name. Its arguments are passed to the plugin unchanged.
+func RegisterPlugin(name, path string) {
+	Register(name, func(env Env, args Args) (Stage, error) {
+		return StartPlugin(path, env, args)
+	})
+}
+
+// StartPlugin starts the plugin executable at path for env and args. The
+// returned stage implements BatchStage and io.Closer; RewriteFile closes it
+// when done. A plugin that fails mid-stream drops the remaining packets and
+// its error is returned by Close.
+func StartPlugin(path string, env Env, args Args) (Stage, error) {
+	ctx := env.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  pluginHandshake,
+		Plugins:          plugin.PluginSet{pluginName: &stagePlugin{}},
+		Cmd:              exec.CommandContext(ctx, path),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		StartTimeout:     PluginTimeout,
+		SyncStdout:       os.Stderr,
+		SyncStderr:       os.Stderr,
+		Logger:           hclog.NewNullLogger(), // failures are returned instead
+	})
+	s := &pluginStage{path: path, ctx: ctx, client: client}
+	if err := s.start(env, args); err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+	return s, nil
+}
+
+type pluginStage struct {
+	path   string
+	ctx    context.Context
+	client *plugin.Client
+	conn   *grpc.ClientConn
+	err    error // first failure; packets are dropped afterwards
+
+	closed   bool
+	closeErr error
+}
+
+func (s *pluginStage) start(env Env, args Args) error {
+	rpc, err := s.client.Client()
+	if err != nil {
+		return err
+	}
+	raw, err := rpc.Dispense(pluginName)
+	if err != nil {
+		return err
+	}
+	s.conn = raw.(*grpc.ClientConn)
+	hello, err := json.Marshal(pluginHello{Meta: env.Meta, Args: args})
+	if err != nil {
+		return err
+	}
+	return s.call("Start", wrapperspb.Bytes(hello), &emptypb.Empty{})
+}
+
+// call invokes method of the plugin, which must answer within
+// PluginTimeout, and returns the plugin's error message as an error.
+func (s *pluginStage) call(method string, in, out proto.Message) error {
+	ctx, cancel := context.WithTimeout(s.ctx, PluginTimeout)
+	defer cancel()
+	err := s.conn.Invoke(ctx, "/"+pluginService+"/"+method, in, out,
+		grpc.MaxCallRecvMsgSize(maxPluginMessage), grpc.MaxCallSendMsgSize(maxPluginMessage))
+	switch {
+	case err == nil:
+		return nil
+	case s.ctx.Err() != nil:
+		return s.ctx.Err()
+	case ctx.Err() != nil:
+		return fmt.Errorf("no answer within %v", PluginTimeout)
+	}
+	return errors.New(status.Convert(err).Message())
+}
+
+// Apply sends p to the plugin as a batch of one.
+func (s *pluginStage) Apply(p *Packet) bool {
+	ps, keep := []Packet{*p}, []bool{true}
+	s.ApplyBatch(ps, keep)
+	*p = ps[0]
+	return keep[0]
+}
+
+// ApplyBatch sends the packets to keep to the plugin, in as few batches as
+// the limits on their count and size allow.
+func (s *pluginStage) ApplyBatch(ps []Packet, keep []bool) {
+	var idx []int
+	for i := range ps {
+		if keep[i] {
+			if s.err != nil {
+				keep[i] = false
+				continue
+			}
+			idx = append(idx, i)
+		}
+	}
+	for len(idx) > 0 && s.err == nil {
+		n, size := 1, len(ps[idx[0]].Payload)
+		for n < len(idx) && n < maxPluginBatch && size+len(ps[idx[n]].Payload) <= pluginBatchBytes {
+			size += len(ps[idx[n]].Payload)
+			n++
+		}
+		if err := s.roundTrip(ps, keep, idx[:n]); err != nil {
+			s.err = fmt.Errorf("plugin %s: %w", s.path, err)
+			break
+		}
+		idx = idx[n:]
+	}
+	// The packets not answered are dropped
+	for _, i := range idx {
+		keep[i] = false
+	}
+}
+
+// roundTrip sends the packets ps[i] for i in idx and applies the answers.
+func (s *pluginStage) roundTrip(ps []Packet, keep []bool, idx []int) error {
+	var req bytes.Buffer
+	_ = binary.Write(&req, binary.BigEndian, uint32(len(idx)))
+	for _, i := range idx {
+		writePluginFrame(&req, &ps[i])
+	}
+	reply := &wrapperspb.BytesValue{}
+	if err := s.call("ApplyBatch", wrapperspb.Bytes(req.Bytes()), reply); err != nil {
+		return err
+	}
+	r := bytes.NewReader(reply.Value)
+	for k, i := range idx {
+		if err := readAnswer(r, &ps[i], &keep[i]); err != nil {
+			return fmt.Errorf("packet %d of the batch: %w", k, err)
+		}
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%d bytes after the last answer", r.Len())
+	}
+	return nil
+}
+
+// readAnswer reads the plugin's answer for p.
+func readAnswer(r *bytes.Reader, p *Packet, keep *bool) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	switch b {
+	case 0:
+		*keep = false
+		return nil
+	case 1:
+		return readPluginFrame(r, p)
+	}
+	return fmt.Errorf("invalid reply byte %d", b)
+}
+
+// Close closes the plugin's stage and stops the plugin. Later calls return
+// the same result.
+func (s *pluginStage) Close() error {
+	if s.closed {
+		return s.closeErr
+	}
+	s.closed = true
+	var err error
+	if s.err == nil {
+		err = s.call("Close", &emptypb.Empty{}, &emptypb.Empty{})
+	}
+	s.client.Kill()
+	switch {
+	case s.err != nil:
+		s.closeErr = s.err
+	case err != nil:
+		s.closeErr = fmt.Errorf("plugin %s: %w", s.path, err)
+	}
+	return s.closeErr
+}
+
+func writePluginFrame(w *bytes.Buffer, p *Packet) {
+	var hdr [13]byte
+	binary.BigEndian.PutUint32(hdr[0:4], p.Time)
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(p.ID))
+	hdr[8] = byte(p.State)
+	binary.BigEndian.PutUint32(hdr[9:13], uint32(len(p.Payload)))
+	w.Write(hdr[:])
+	w.Write(p.Payload)
+}
+
+func readPluginFrame(r *bytes.Reader, p *Packet) error {
+	var hdr [13]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(hdr[9:13])
+	if n > MaxPluginPayload {
+		return fmt.Errorf("payload of %d bytes exceeds limit", n)
+	}
+	if int64(n) > int64(r.Len()) {
+		return io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, n)
+	_, _ = io.ReadFull(r, payload)
+	*p = Packet{
+		Time:    binary.BigEndian.Uint32(hdr[0:4]),
+		ID:      int32(binary.BigEndian.Uint32(hdr[4:8])),
+		State:   protocol.State(hdr[8]),
+		Payload: payload,
+	}
+	return nil
+}
+
+// ServePlugin serves the plugin side: it builds a stage with f when the host
+// starts it and applies it to the packets the host sends, until the host is
+// done. Call it from a plugin's main; it returns when main should. Run by
+// anything but a host, it prints an explanation and exits with status 1.
+func ServePlugin(f Factory) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: pluginHandshake,
+		Plugins:         plugin.PluginSet{pluginName: &stagePlugin{factory: f}},
+		GRPCServer: func(opts []grpc.ServerOption) *grpc.Server {
+			opts = append(opts, grpc.MaxRecvMsgSize(maxPluginMessage), grpc.MaxSendMsgSize(maxPluginMessage))
+			return grpc.NewServer(opts...)
+		},
+	})
+}
+
+// stagePlugin is the go-plugin side of a plugin stage: the host dispenses
+// the gRPC connection, the plugin registers a stageServer for factory.
+type stagePlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	factory Factory // plugin side only
+}
+
+func (p *stagePlugin) GRPCServer(_ *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&stageServiceDesc, &stageServer{factory: p.factory})
+	return nil
+}
+
+func (p *stagePlugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, c *grpc.ClientConn) (any, error) {
+	return c, nil
+}
+
+// stageServer implements pluginService for the stage built by factory.
+type stageServer struct {
+	factory Factory
+
+	mu sync.Mutex // calls are serialized, as stages are not concurrent
+	st Stage
+}
+
+func (s *stageServer) start(in proto.Message) (proto.Message, error) {
+	var hello pluginHello
+	if err := json.Unmarshal(in.(*wrapperspb.BytesValue).Value, &hello); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "parse start: %v", err)
+	}
+	if s.st != nil {
+		return nil, status.Error(codes.FailedPrecondition, "already started")
+	}
+	env := Env{Meta: hello.Meta}
+	if t, ok := protocol.Lookup(hello.Meta.Protocol); ok {
+		env.Table = t
+	}
+	if hello.Args.Named == nil {
+		hello.Args.Named = map[string][]string{}
+	}
+	st, err := s.factory(env, hello.Args)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.st = st
+	return &emptypb.Empty{}, nil
+}
+
+func (s *stageServer) applyBatch(in proto.Message) (proto.Message, error) {
+	if s.st == nil {
+		return nil, status.Error(codes.FailedPrecondition, "not started")
+	}
+	r := bytes.NewReader(in.(*wrapperspb.BytesValue).Value)
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "short batch")
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > maxPluginBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "batch of %d packets exceeds limit", n)
+	}
+	ps, keep := make([]Packet, n), make([]bool, n)
+	for i := range ps {
+		if err := readPluginFrame(r, &ps[i]); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "packet %d: %v", i, err)
+		}
+		keep[i] = true
+	}
+	applyBatch(s.st, ps, keep)
+	var out bytes.Buffer
+	for i := range ps {
+		if !keep[i] {
+			out.WriteByte(0)
+			continue
+		}
+		out.WriteByte(1)
+		writePluginFrame(&out, &ps[i])
+	}
+	return wrapperspb.Bytes(out.Bytes()), nil
+}
+
+func (s *stageServer) close(proto.Message) (proto.Message, error) {
+	if err := closeStage(s.st); err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// stageServiceDesc describes pluginService to gRPC.
+var stageServiceDesc = grpc.ServiceDesc{
+	ServiceName: pluginService,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		stageMethod("Start", func() proto.Message { return &wrapperspb.BytesValue{} }, (*stageServer).start),
+		stageMethod("ApplyBatch", func() proto.Message { return &wrapperspb.BytesValue{} }, (*stageServer).applyBatch),
+		stageMethod("Close", func() proto.Message { return &emptypb.Empty{} }, (*stageServer).close),
+	},
+}
+
+// stageMethod describes the unary method name of pluginService, which
+// decodes its request into newIn() and calls call.
+func stageMethod(name string, newIn func() proto.Message, call func(*stageServer, proto.Message) (proto.Message, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, icpt grpc.UnaryServerInterceptor) (any, error) {
+			in := newIn()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			h := func(_ context.Context, req any) (any, error) {
+				s := srv.(*stageServer)
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				return call(s, req.(proto.Message))
+			}
+			if icpt == nil {
+				return h(ctx, in)
+			}
+			return icpt(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + pluginService + "/" + name}, h)
+		},
+	}
+}
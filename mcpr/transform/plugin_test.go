@@ -0,0 +1,165 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// pluginEnv makes the test binary act as a plugin, see TestMain.
+const pluginEnv = "MCPR_TEST_PLUGIN"
+
+// TestMain runs the test binary as the plugin named by pluginEnv when the
+// tests start it through StartPlugin.
+func TestMain(m *testing.M) {
+	switch os.Getenv(pluginEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "drop-odd":
+		// Drops packets with odd ids and doubles the payload of the others
+		ServePlugin(func(Env, Args) (Stage, error) {
+			return StageFunc(func(p *Packet) bool {
+				p.Payload = append(p.Payload, p.Payload...)
+				return p.ID%2 == 0
+			}), nil
+		})
+	case "hang":
+		// Starts, then never answers a packet
+		ServePlugin(func(Env, Args) (Stage, error) {
+			return StageFunc(func(*Packet) bool {
+				select {}
+			}), nil
+		})
+	case "refuse":
+		ServePlugin(func(Env, Args) (Stage, error) {
+			return nil, errors.New("refused")
+		})
+	}
+	os.Exit(0)
+}
+
+// startTestPlugin starts the test binary as plugin mode.
+func startTestPlugin(t *testing.T, mode string, env Env) (Stage, error) {
+	t.Helper()
+	t.Setenv(pluginEnv, mode)
+	return StartPlugin(os.Args[0], env, Args{})
+}
+
+func TestPluginRewrite(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.mcpr")
+	dst := filepath.Join(dir, "out.mcpr")
+	// Enough payload that a batch does not fit in a pipe's buffer
+	const n = 1000
+	payload := bytes.Repeat([]byte{7}, 4096)
+	w, err := mcpr.Create(src, mcpr.Meta{Protocol: 765})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := w.WritePacket(uint32(i), int32(i%4), payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(pluginEnv, "drop-odd")
+	p := &Pipeline{}
+	p.Append("drop-odd", func(env Env, args Args) (Stage, error) {
+		return StartPlugin(os.Args[0], env, args)
+	})
+	stats, err := RewriteFile(src, dst, p, Options{StartInPlay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PacketsIn != n || stats.PacketsOut != n/2 {
+		t.Errorf("packets in/out = %d/%d, want %d/%d", stats.PacketsIn, stats.PacketsOut, n, n/2)
+	}
+
+	r, err := mcpr.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; ; i += 2 {
+		pk, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			if i != n {
+				t.Errorf("output ends at packet %d, want %d", i, n)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pk.Time != uint32(i) || pk.ID%2 != 0 || len(pk.Payload) != 2*len(payload) {
+			t.Fatalf("packet %d: time %d, id %d, %d bytes; want time %d, an even id and %d bytes",
+				i/2, pk.Time, pk.ID, len(pk.Payload), i, 2*len(payload))
+		}
+	}
+}
+
+func TestPluginApply(t *testing.T) {
+	st, err := startTestPlugin(t, "drop-odd", Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Packet{Time: 5, ID: 2, Payload: []byte{1, 2}}
+	if !st.Apply(&p) || !bytes.Equal(p.Payload, []byte{1, 2, 1, 2}) || p.Time != 5 {
+		t.Errorf("Apply kept = false or packet = %+v, want the payload doubled", p)
+	}
+	if p := (Packet{ID: 3}); st.Apply(&p) {
+		t.Error("Apply kept a packet the plugin drops")
+	}
+	if err := closeStage(st); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPluginRefused(t *testing.T) {
+	_, err := startTestPlugin(t, "refuse", Env{})
+	if err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("StartPlugin = %v, want the plugin's error", err)
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	defer func(d time.Duration) { PluginTimeout = d }(PluginTimeout)
+	PluginTimeout = 200 * time.Millisecond
+	st, err := startTestPlugin(t, "hang", Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := (Packet{ID: 2}); st.Apply(&p) {
+		t.Error("Apply kept a packet the plugin never answered")
+	}
+	err = closeStage(st)
+	if err == nil || !strings.Contains(err.Error(), "no answer within") {
+		t.Errorf("Close = %v, want a timeout", err)
+	}
+}
+
+func TestPluginContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st, err := startTestPlugin(t, "hang", Env{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if p := (Packet{ID: 2}); st.Apply(&p) {
+		t.Error("Apply kept a packet the plugin never answered")
+	}
+	if err := closeStage(st); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// remapStates are the states whose packet ids remap can change, by name.
+var remapStates = map[string]protocol.State{
+	"login":         protocol.Login,
+	"configuration": protocol.Configuration,
+	"play":          protocol.Play,
+}
+
+// remap(FROM:TO, ..., STATE=FROM:TO, table=FILE) rewrites packet ids through
+// a table, to salvage recordings whose recorder wrote the ids of another
+// protocol. Positional pairs apply to play packets; login=, configuration=
+// and play= pairs to that state. table names a file with one "STATE FROM TO"
+// mapping per line ('#' starts a comment). FROM is a decimal or 0x-prefixed
+// id; a play TO may also be a packet name of the replay's protocol. Ids
+// without a mapping are kept, and a mapping applies once, so pairs can swap
+// ids. Connection states are followed using the recorded ids, which must be
+// right for the state changes (login success, finish configuration).
+func newRemap(env Env, args Args) (Stage, error) {
+	table := map[protocol.State]map[int32]int32{}
+	add := func(state protocol.State, pair string) error {
+		from, to, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("invalid mapping %q, want FROM:TO", pair)
+		}
+		return addMapping(env, table, state, strings.TrimSpace(from), strings.TrimSpace(to))
+	}
+	for _, pair := range args.Positional {
+		if err := add(protocol.Play, pair); err != nil {
+			return nil, err
+		}
+	}
+	for key, pairs := range args.Named {
+		if key == "table" {
+			continue
+		}
+		state, ok := remapStates[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown state %q", key)
+		}
+		for _, pair := range pairs {
+			if err := add(state, pair); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, path := range args.Named["table"] {
+		if err := readRemapTable(env, table, path); err != nil {
+			return nil, err
+		}
+	}
+	if len(table) == 0 {
+		return nil, fmt.Errorf("want remap(FROM:TO, ..., STATE=FROM:TO, table=FILE)")
+	}
+	return keepTimes(func(p *Packet) bool {
+		if to, ok := table[p.State][p.ID]; ok {
+			p.ID = to
+		}
+		return true
+	}), nil
+}
+
+// readRemapTable adds the mappings in the file at path to table.
+func readRemapTable(env Env, table map[protocol.State]map[int32]int32, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: want STATE FROM TO", path, line)
+		}
+		state, ok := remapStates[fields[0]]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown state %q", path, line, fields[0])
+		}
+		if err := addMapping(env, table, state, fields[1], fields[2]); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// addMapping parses one mapping and adds it to table. Target ids must exist
+// in the replay's protocol when its packet table is known.
+func addMapping(env Env, table map[protocol.State]map[int32]int32, state protocol.State, from, to string) error {
+	f, err := parseID(from)
+	if err != nil {
+		return err
+	}
+	var t int32
+	if state == protocol.Play {
+		t, err = resolvePacket(env, to)
+	} else {
+		t, err = parseID(to)
+	}
+	if err != nil {
+		return err
+	}
+	if env.Table != nil && int(t) >= env.Table.Count(protocol.Clientbound, state) {
+		return fmt.Errorf("%s packet %#x does not exist in protocol %d", state, t, env.Meta.Protocol)
+	}
+	if table[state] == nil {
+		table[state] = map[int32]int32{}
+	}
+	if _, dup := table[state][f]; dup {
+		return fmt.Errorf("%s packet %#x mapped twice", state, f)
+	}
+	table[state][f] = t
+	return nil
+}
+
+// parseID parses a decimal or 0x-prefixed packet id.
+func parseID(s string) (int32, error) {
+	base, digits := 10, s
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base, digits = 16, s[2:]
+	}
+	v, err := strconv.ParseUint(digits, base, 31)
+	if err != nil {
+		return 0, fmt.Errorf("invalid packet id %q", s)
+	}
+	return int32(v), nil
+}
@@ -0,0 +1,128 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// TimeMapper is implemented by stages whose effect on packet times is a fixed
+// function of the time, such as trim and rescale, or that leave times alone,
+// such as filter, whose MapTime returns t unchanged. RewriteFile uses it to move
+// markers, camera paths and annotations along with the packets. MapTime
+// returns false for times that fall outside the output.
+type TimeMapper interface {
+	MapTime(t uint32) (uint32, bool)
+}
+
+// timedEntries hold replay times. RewriteFile copies them unchanged when a
+// pipeline leaves packet times alone, moves them with a TimeMapper when it
+// does not, and drops them if the pipeline has no TimeMapper.
+var timedEntries = map[string]bool{
+	mcpr.MarkersEntryName:     true,
+	mcpr.TimelinesEntryName:   true,
+	mcpr.AnnotationsEntryName: true,
+}
+
+// sameTimes maps times of a pipeline that left them alone.
+var sameTimes TimeMapper = keepTimes(nil)
+
+// timeMapper returns the TimeMapper for st, a chain only having one if every
+// stage in it does.
+func timeMapper(st Stage) (TimeMapper, bool) {
+	if c, ok := st.(chainStage); ok {
+		for _, s := range c {
+			if _, ok := s.(TimeMapper); !ok {
+				return nil, false
+			}
+		}
+		return c, true
+	}
+	tm, ok := st.(TimeMapper)
+	return tm, ok
+}
+
+// MapTime maps t through every stage in order.
+func (c chainStage) MapTime(t uint32) (uint32, bool) {
+	for _, st := range c {
+		var ok bool
+		if t, ok = st.(TimeMapper).MapTime(t); !ok {
+			return 0, false
+		}
+	}
+	return t, true
+}
+
+// retimeMarkers maps the markers' times through tm, dropping those outside
+// the output.
+func retimeMarkers(ms []mcpr.Marker, tm TimeMapper) []mcpr.Marker {
+	var out []mcpr.Marker
+	for _, m := range ms {
+		if m.Time < 0 {
+			continue
+		}
+		t, ok := tm.MapTime(uint32(m.Time))
+		if !ok {
+			continue
+		}
+		m.Time = int(t)
+		out = append(out, m)
+	}
+	return out
+}
+
+// retimeTimelines maps the replay times (PropTimestamp) of the timelines'
+// keyframes through tm. A keyframe whose time falls outside the output is
+// clamped to the output's end so the camera path keeps its shape.
+func retimeTimelines(ts map[string]mcpr.Timeline, tm TimeMapper, end uint32) map[string]mcpr.Timeline {
+	for name, tl := range ts {
+		for _, p := range tl.Paths {
+			for i := range p.Keyframes {
+				k := &p.Keyframes[i]
+				ms, ok := k.Timestamp()
+				if !ok || ms < 0 {
+					continue
+				}
+				t, ok := tm.MapTime(uint32(ms))
+				if !ok {
+					t = end
+				}
+				k.SetTimestamp(int(t))
+			}
+		}
+		ts[name] = tl
+	}
+	return ts
+}
+
+// retimeAnnotations maps the annotations' times through tm and their frame
+// indexes through frames (input frame index to the index of the latest
+// output frame at or before it), dropping those outside the output.
+func retimeAnnotations(as []mcpr.Annotation, tm TimeMapper, frames map[int64]int64) []mcpr.Annotation {
+	var out []mcpr.Annotation
+	for _, a := range as {
+		t, ok := tm.MapTime(a.Time)
+		if !ok {
+			continue
+		}
+		a.Time = t
+		if a.Frame >= 0 {
+			a.Frame = frames[a.Frame]
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// writeAnnotations stores as in the output's annotations.json.
+func writeAnnotations(w *mcpr.Writer, as []mcpr.Annotation) error {
+	if len(as) == 0 {
+		return nil
+	}
+	aw, err := w.CreateEntry(mcpr.AnnotationsEntryName)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", mcpr.AnnotationsEntryName, err)
+	}
+	return json.NewEncoder(aw).Encode(as)
+}
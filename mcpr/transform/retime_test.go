@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+)
+
+// writeMarked writes a replay with a packet every second from 0 to 10 s,
+// alternating ids 0x01 and 0x11, an annotation after each frame index in
+// notes and markers at markers.
+func writeMarked(t *testing.T, path string, notes []int, markers ...int) {
+	t.Helper()
+	w, err := mcpr.Create(path, mcpr.Meta{Protocol: 765})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 10; i++ {
+		id := int32(0x01)
+		if i%2 == 1 {
+			id = 0x11
+		}
+		if err := w.WritePacket(uint32(i*1000), id, []byte{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range notes {
+			if n == i {
+				w.Annotate(uint32(i*1000), "note", strconv.Itoa(i))
+			}
+		}
+	}
+	for _, ms := range markers {
+		w.AddMarker(mcpr.Marker{Time: ms})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetimeTrimFilter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	writeMarked(t, src, nil, 500, 2000, 5000, 9000)
+
+	p, err := ParsePipeline("trim(1000,8000)|filter(drop=0x11)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := RewriteFile(src, dst, p, Options{StartInPlay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.EntriesDropped != 0 {
+		t.Errorf("dropped %d entries, want 0", stats.EntriesDropped)
+	}
+	ms, err := mcpr.ReadMarkers(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var times []int
+	for _, m := range ms {
+		times = append(times, m.Time)
+	}
+	if want := []int{1000, 4000}; !reflect.DeepEqual(times, want) {
+		t.Errorf("marker times = %v, want %v", times, want)
+	}
+}
+
+func TestFilterAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mcpr")
+	dst := filepath.Join(dir, "dst.mcpr")
+	writeMarked(t, src, []int{4, 5, 10})
+
+	p, err := ParsePipeline("filter(drop=0x11)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RewriteFile(src, dst, p, Options{StartInPlay: true}); err != nil {
+		t.Fatal(err)
+	}
+	as, err := mcpr.ReadAnnotations(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Frames 0, 2, ... 10 remain; frame 5 was dropped, so its note moves to
+	// the frame before it
+	want := []mcpr.Annotation{
+		{Time: 4000, Frame: 2, Key: "note", Value: "4"},
+		{Time: 5000, Frame: 2, Key: "note", Value: "5"},
+		{Time: 10000, Frame: 5, Key: "note", Value: "10"},
+	}
+	if !reflect.DeepEqual(as, want) {
+		t.Errorf("annotations = %+v, want %+v", as, want)
+	}
+}
@@ -0,0 +1,312 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Presets group clientbound play packet names for the filter stage.
+var Presets = map[string][]string{
+	"chat":      {"PlayerChat", "SystemChat", "DisguisedChat", "DeleteChat"},
+	"particles": {"LevelParticles"},
+	"sounds":    {"Sound", "SoundEntity", "StopSound"},
+	// cinematic removes HUD-level clutter that distracts from rendered footage.
+	"cinematic": {
+		"PlayerChat", "SystemChat", "DisguisedChat", "DeleteChat",
+		"SetActionBarText", "SetTitleText", "SetSubtitleText", "SetTitlesAnimation", "ClearTitles",
+		"BossEvent", "TabList", "SetDisplayObjective",
+	},
+}
+
+func init() {
+	Register("trim", newTrim)
+	Register("filter", newFilter)
+	Register("scrub-chat", newScrubChat)
+	Register("rescale", newRescale)
+	Register("dimension", newDimension)
+	Register("remap", newRemap)
+}
+
+// trim(start[,end]) keeps the window [start,end] and shifts it to t=0.
+// Packets before start are kept at t=0 so the world state they carry
+// (chunks, entities) is still present when playback begins.
+func newTrim(_ Env, args Args) (Stage, error) {
+	if len(args.Positional) < 1 || len(args.Positional) > 2 {
+		return nil, fmt.Errorf("want trim(start[,end])")
+	}
+	start, err := ParseMillis(args.Positional[0])
+	if err != nil {
+		return nil, err
+	}
+	end := ^uint32(0)
+	if len(args.Positional) == 2 {
+		if end, err = ParseMillis(args.Positional[1]); err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("end %d before start %d", end, start)
+		}
+	}
+	return &trimStage{start: start, end: end}, nil
+}
+
+type trimStage struct {
+	start, end uint32
+}
+
+func (s *trimStage) Apply(p *Packet) bool {
+	if p.Time > s.end {
+		return false
+	}
+	if p.Time < s.start {
+		p.Time = 0
+	} else {
+		p.Time -= s.start
+	}
+	return true
+}
+
+// MapTime drops times outside the window; unlike packets, markers before
+// start are not kept at t=0.
+func (s *trimStage) MapTime(t uint32) (uint32, bool) {
+	if t < s.start || t > s.end {
+		return 0, false
+	}
+	return t - s.start, true
+}
+
+// UpdateMeta moves the recording date to the new start.
+func (s *trimStage) UpdateMeta(m *mcpr.Meta) {
+	if m.Date != 0 {
+		m.Date += int64(s.start)
+	}
+}
+
+// filter(preset=NAME, drop=PACKET, keep=PACKET) drops play packets by preset or
+// by name/id. When keep is given, only the listed play packets are retained.
+// Packets outside the play state are never filtered.
+func newFilter(env Env, args Args) (Stage, error) {
+	drop := map[int32]bool{}
+	for _, preset := range args.Named["preset"] {
+		names, ok := Presets[preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q", preset)
+		}
+		if env.Table == nil {
+			return nil, fmt.Errorf("preset %q needs a packet table, none for protocol %d", preset, env.Meta.Protocol)
+		}
+		for _, n := range names {
+			if id, ok := env.PlayID(n); ok {
+				drop[id] = true
+			}
+		}
+	}
+	for _, v := range args.Named["drop"] {
+		id, err := resolvePacket(env, v)
+		if err != nil {
+			return nil, err
+		}
+		drop[id] = true
+	}
+	var keep map[int32]bool
+	if vs := args.Named["keep"]; len(vs) > 0 {
+		keep = map[int32]bool{}
+		for _, v := range vs {
+			id, err := resolvePacket(env, v)
+			if err != nil {
+				return nil, err
+			}
+			keep[id] = true
+		}
+	}
+	if len(drop) == 0 && keep == nil {
+		return nil, fmt.Errorf("want filter(preset=..., drop=..., keep=...)")
+	}
+	return keepTimes(func(p *Packet) bool {
+		if p.State != protocol.Play {
+			return true
+		}
+		if keep != nil && !keep[p.ID] {
+			return false
+		}
+		return !drop[p.ID]
+	}), nil
+}
+
+// scrub-chat drops all chat message packets.
+func newScrubChat(env Env, _ Args) (Stage, error) {
+	return newFilter(env, Args{Named: map[string][]string{"preset": {"chat"}}})
+}
+
+// rescale(factor) changes playback speed: factor 2.0 plays twice as fast.
+func newRescale(_ Env, args Args) (Stage, error) {
+	if len(args.Positional) != 1 {
+		return nil, fmt.Errorf("want rescale(factor)")
+	}
+	f, err := strconv.ParseFloat(args.Positional[0], 64)
+	if err != nil || f <= 0 {
+		return nil, fmt.Errorf("invalid factor %q", args.Positional[0])
+	}
+	return &rescaleStage{factor: f}, nil
+}
+
+type rescaleStage struct {
+	factor float64
+	err    error
+}
+
+func (s *rescaleStage) Apply(p *Packet) bool {
+	t, ok := s.MapTime(p.Time)
+	if !ok {
+		if s.err == nil {
+			s.err = fmt.Errorf("rescale(%g): time %d ms exceeds the maximum replay length", s.factor, p.Time)
+		}
+		return false
+	}
+	p.Time = t
+	return true
+}
+
+// MapTime returns false for times that would not fit in a uint32.
+func (s *rescaleStage) MapTime(t uint32) (uint32, bool) {
+	v := float64(t) / s.factor
+	if v > math.MaxUint32 {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// Close reports times that overflowed, failing the rewrite.
+func (s *rescaleStage) Close() error {
+	return s.err
+}
+
+// dimensionGlobal lists play packets that carry session-wide state rather than
+// world state; the dimension stage keeps them from before the chosen stay.
+var dimensionGlobal = []string{
+	"Login", "UpdateTags", "Commands", "UpdateRecipes", "UpdateAdvancements",
+	"PlayerInfoUpdate", "PlayerInfoRemove", "ChangeDifficulty", "PlayerAbilities",
+	"ServerData", "TabList", "SetCarriedItem", "ContainerSetContent",
+	"SetExperience", "SetHealth",
+}
+
+// dimension(name[,visit]) extracts one stay in a dimension, shifted to t=0.
+// name may omit the "minecraft:" namespace; visit counts stays in that
+// dimension from 1 (the default). The stay begins with the Login or Respawn
+// packet that entered the dimension and ends at the next dimension change.
+// Packets outside the play state and session-wide play packets (Login, tags,
+// tab list, ...) from before the stay are kept at t=0 so the client can join;
+// everything after the stay is dropped.
+func newDimension(env Env, args Args) (Stage, error) {
+	if len(args.Positional) < 1 || len(args.Positional) > 2 {
+		return nil, fmt.Errorf("want dimension(name[,visit])")
+	}
+	if env.Table == nil || !env.Table.HasDimensions() {
+		return nil, fmt.Errorf("dimension needs packet decoding, none for protocol %d", env.Meta.Protocol)
+	}
+	want := args.Positional[0]
+	if !strings.Contains(want, ":") {
+		want = "minecraft:" + want
+	}
+	visit := 1
+	if len(args.Positional) == 2 {
+		v, err := strconv.Atoi(args.Positional[1])
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid visit %q", args.Positional[1])
+		}
+		visit = v
+	}
+	global := map[int32]bool{}
+	for _, n := range dimensionGlobal {
+		if id, ok := env.PlayID(n); ok {
+			global[id] = true
+		}
+	}
+
+	return &dimensionStage{env: env, want: want, visit: visit, global: global, visits: map[string]int{}}, nil
+}
+
+// Phases of the dimension stage.
+const (
+	beforeStay = iota
+	inStay
+	afterStay
+)
+
+type dimensionStage struct {
+	env    Env
+	want   string
+	visit  int
+	global map[int32]bool
+
+	phase  int
+	cur    string
+	visits map[string]int
+	start  uint32 // time the stay began
+	stop   uint32 // time it ended, once phase is afterStay
+}
+
+func (s *dimensionStage) Apply(p *Packet) bool {
+	if s.phase == afterStay {
+		return false
+	}
+	if p.State == protocol.Play {
+		if dim, ok := s.env.Table.Dimension(p.ID, p.Payload); ok && dim != s.cur {
+			s.cur = dim
+			s.visits[dim]++
+			switch {
+			case dim == s.want && s.visits[dim] == s.visit:
+				s.phase, s.start = inStay, p.Time
+			case s.phase == inStay:
+				s.phase, s.stop = afterStay, p.Time
+				return false
+			}
+		}
+	}
+	if s.phase == inStay {
+		p.Time -= s.start
+		return true
+	}
+	p.Time = 0
+	return p.State != protocol.Play || s.global[p.ID]
+}
+
+// MapTime shifts times within the stay as Apply did; it is only called once
+// every packet went through, when the stay is known.
+func (s *dimensionStage) MapTime(t uint32) (uint32, bool) {
+	if s.phase == beforeStay || t < s.start || s.phase == afterStay && t >= s.stop {
+		return 0, false
+	}
+	return t - s.start, true
+}
+
+// keepTimes adapts a function that never changes packet times, such as a
+// filter, to a Stage that moves no timed entries either.
+type keepTimes func(p *Packet) bool
+
+// Apply calls f(p).
+func (f keepTimes) Apply(p *Packet) bool { return f(p) }
+
+// MapTime returns t unchanged.
+func (f keepTimes) MapTime(t uint32) (uint32, bool) { return t, true }
+
+// resolvePacket parses a packet reference: a decimal or 0x-prefixed id, or a
+// clientbound play packet name from the replay's protocol table.
+func resolvePacket(env Env, s string) (int32, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err := strconv.ParseUint(s[2:], 16, 31)
+		return int32(v), err
+	}
+	if v, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return int32(v), nil
+	}
+	if id, ok := env.PlayID(s); ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown packet %q for protocol %d", s, env.Meta.Protocol)
+}
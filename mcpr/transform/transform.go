@@ -0,0 +1,160 @@
+// Package transform rewrites replays through a pipeline of composable stages
+// in a single streaming pass.
+//
+// A pipeline is written as stage calls separated by '|':
+//
+//	trim(0,5m)|filter(preset=cinematic)|scrub-chat|rescale(2.0)
+//
+// Each stage sees every packet in order and may modify it or drop it. Stages
+// are looked up by name in a registry; Register adds new ones.
+package transform
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr"
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+// Packet is a single frame flowing through a pipeline. Stages may modify any
+// field in place.
+type Packet struct {
+	Time    uint32
+	ID      int32
+	Payload []byte
+	State   protocol.State // connection state the packet was recorded in
+}
+
+// Stage processes packets. Apply returns false to drop the packet.
+type Stage interface {
+	Apply(p *Packet) bool
+}
+
+// StageFunc adapts a function to the Stage interface.
+type StageFunc func(p *Packet) bool
+
+// Apply calls f(p).
+func (f StageFunc) Apply(p *Packet) bool { return f(p) }
+
+// BatchStage is implemented by stages that handle packets more efficiently in
+// groups, such as plugins, which would otherwise pay a round trip to their
+// process per packet. ApplyBatch applies the stage to the packets of ps whose
+// keep flag is set, in order, and clears the flags of those it drops.
+// RewriteFile feeds pipelines in batches; other stages see the packets one
+// at a time as before.
+type BatchStage interface {
+	Stage
+	ApplyBatch(ps []Packet, keep []bool)
+}
+
+// MetaStage is implemented by stages that change what the recording's
+// metadata describes, such as trim moving its start. RewriteFile calls
+// UpdateMeta on the source's metadata before writing any packet.
+type MetaStage interface {
+	UpdateMeta(m *mcpr.Meta)
+}
+
+// updateMeta calls UpdateMeta if st implements MetaStage.
+func updateMeta(st Stage, m *mcpr.Meta) {
+	if ms, ok := st.(MetaStage); ok {
+		ms.UpdateMeta(m)
+	}
+}
+
+// Env describes the replay a pipeline is being built for.
+type Env struct {
+	Meta  mcpr.Meta
+	Table *protocol.Table // nil when no packet table exists for Meta.Protocol
+
+	// Context bounds the life of what stages start, such as plugin
+	// processes, which are killed when it is done. Nil means no bound.
+	Context context.Context
+}
+
+// PlayID resolves a clientbound play packet name to its id using the Env's
+// protocol table.
+func (e Env) PlayID(name string) (int32, bool) {
+	if e.Table == nil {
+		return 0, false
+	}
+	return e.Table.ID(protocol.Clientbound, protocol.Play, name)
+}
+
+// Args are the arguments of a stage call: positional values and key=value pairs.
+type Args struct {
+	Positional []string
+	Named      map[string][]string
+}
+
+// Get returns the last value given for key, or "" when absent.
+func (a Args) Get(key string) string {
+	v := a.Named[key]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[len(v)-1]
+}
+
+// Factory builds a stage from its arguments for a specific replay.
+type Factory func(env Env, args Args) (Stage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a stage available to pipelines under name.
+// It panics if name is already registered.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("transform: Register called twice for " + name)
+	}
+	registry[name] = f
+}
+
+// Stages returns the names of all registered stages, sorted.
+func Stages() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := registry[name]
+	return f, ok
+}
+
+// ParseMillis parses a timestamp argument. Plain integers are milliseconds;
+// anything else is parsed with time.ParseDuration (e.g. "5m", "1m30s", "250ms").
+// Times beyond a uint32 of milliseconds (about 49 days) are rejected.
+func ParseMillis(s string) (uint32, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative time %q", s)
+	}
+	if ms := d.Milliseconds(); ms > math.MaxUint32 {
+		return 0, fmt.Errorf("time %q out of range", s)
+	}
+	return uint32(d.Milliseconds()), nil
+}
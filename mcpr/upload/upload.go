@@ -0,0 +1,394 @@
+// Package upload sends finished replays to a tus (https://tus.io) server with
+// resumable, checksummed transfers. Progress survives process restarts: the
+// upload URL is kept in a state file next to the replay until the transfer
+// completes, so a flaky uplink only costs the current chunk.
+//
+// Chunks carry a SHA-1 Upload-Checksum (tus checksum extension) and the
+// creation request sends the whole file's SHA-256 as upload metadata for
+// server-side verification. Before an upload is reported complete the server's
+// offset and length are checked against the file, along with the sha256 when
+// the server echoes the metadata back on HEAD.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+)
+
+const tusVersion = "1.0.0"
+
+var uploadTimer = perf.NewTimer("upload.Upload")
+
+// Defaults for Uploader fields left zero.
+const (
+	DefaultChunkSize  = 8 << 20
+	DefaultMaxRetries = 8
+)
+
+// StatePath returns the file recording an unfinished upload of path.
+func StatePath(path string) string {
+	return path + ".upload"
+}
+
+// state is persisted in StatePath while an upload is in progress.
+type state struct {
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Uploader uploads files to a tus endpoint.
+type Uploader struct {
+	Endpoint   string      // tus creation URL
+	Header     http.Header // extra request headers, e.g. Authorization
+	ChunkSize  int64       // bytes per PATCH request; 0 means DefaultChunkSize
+	MaxRetries int         // attempts per request before giving up; 0 means DefaultMaxRetries
+
+	HTTPClient *http.Client                     // defaults to http.DefaultClient
+	Logf       func(format string, args ...any) // defaults to log.Printf
+}
+
+// httpError is a non-success response.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("upload: %d %s", e.status, http.StatusText(e.status))
+	}
+	return fmt.Sprintf("upload: %d %s: %s", e.status, http.StatusText(e.status), e.msg)
+}
+
+// retryable reports whether a request failure is worth retrying.
+func retryable(err error) bool {
+	var he *httpError
+	if errors.As(err, &he) {
+		// 409: offset conflict, 460: checksum mismatch; both fixed by retrying
+		return he.status >= 500 || he.status == http.StatusTooManyRequests ||
+			he.status == http.StatusConflict || he.status == 460
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (u *Uploader) logf(format string, args ...any) {
+	if u.Logf != nil {
+		u.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Upload transfers the file at path, resuming an earlier attempt if a state
+// file exists for the same content, and returns the upload URL.
+func (u *Uploader) Upload(ctx context.Context, path string) (string, error) {
+	defer uploadTimer.Since(time.Now())
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	st, offset, err := u.resume(ctx, path, fi.Size(), sum)
+	if err != nil {
+		return "", err
+	}
+	if st == nil {
+		st = &state{Size: fi.Size(), SHA256: sum}
+		err = u.retry(ctx, "create", func() error {
+			st.URL, err = u.create(ctx, filepath.Base(path), st)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := saveState(path, st); err != nil {
+			return "", err
+		}
+	}
+
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	buf := make([]byte, chunkSize)
+	for offset < st.Size {
+		err = u.retry(ctx, "patch", func() error {
+			// Read at the current offset on every attempt: a 409 below moves
+			// offset to wherever the server actually is.
+			n, err := f.ReadAt(buf, offset)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			next, err := u.patch(ctx, st.URL, offset, buf[:n])
+			if err != nil {
+				var he *httpError
+				if errors.As(err, &he) && he.status == http.StatusConflict {
+					// Our offset is stale (e.g. a lost response); ask the server
+					if info, herr := u.head(ctx, st.URL); herr == nil {
+						offset = info.offset
+					}
+				}
+				return err
+			}
+			offset = next
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := u.verify(ctx, f, st); err != nil {
+		return "", err
+	}
+	_ = os.Remove(StatePath(path))
+	return st.URL, nil
+}
+
+// verify confirms the server holds the complete file with the recorded
+// length and checksum, and that the local file did not change while it was
+// being sent, before the state file is forgotten.
+func (u *Uploader) verify(ctx context.Context, f *os.File, st *state) error {
+	info, err := u.head(ctx, st.URL)
+	if err != nil {
+		return err
+	}
+	if info.offset != st.Size {
+		return fmt.Errorf("upload: server has %d of %d bytes", info.offset, st.Size)
+	}
+	if info.length >= 0 && info.length != st.Size {
+		return fmt.Errorf("upload: server length %d, want %d", info.length, st.Size)
+	}
+	if info.sha256 != "" && info.sha256 != st.SHA256 {
+		return fmt.Errorf("upload: server sha256 %s, want %s", info.sha256, st.SHA256)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, st.Size)); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != st.SHA256 {
+		return fmt.Errorf("upload: file changed during upload (sha256 %s, want %s)", sum, st.SHA256)
+	}
+	return nil
+}
+
+// resume loads a saved upload for the same content and asks the server for
+// its offset. It returns a nil state if there is nothing to resume.
+func (u *Uploader) resume(ctx context.Context, path string, size int64, sum string) (*state, int64, error) {
+	b, err := os.ReadFile(StatePath(path))
+	if err != nil {
+		return nil, 0, nil
+	}
+	var st state
+	if json.Unmarshal(b, &st) != nil || st.Size != size || st.SHA256 != sum || st.URL == "" {
+		return nil, 0, nil
+	}
+	var info headInfo
+	err = u.retry(ctx, "head", func() error {
+		info, err = u.head(ctx, st.URL)
+		return err
+	})
+	var he *httpError
+	if errors.As(err, &he) && (he.status == http.StatusNotFound || he.status == http.StatusGone) {
+		return nil, 0, nil // expired on the server; start over
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	u.logf("upload: resuming %s at %d/%d bytes", filepath.Base(path), info.offset, size)
+	return &st, info.offset, nil
+}
+
+func saveState(path string, st *state) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(StatePath(path), b, 0o644)
+}
+
+// retry runs fn with exponential backoff and jitter while it fails with a
+// retryable error.
+func (u *Uploader) retry(ctx context.Context, what string, fn func() error) error {
+	max := u.MaxRetries
+	if max <= 0 {
+		max = DefaultMaxRetries
+	}
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || attempt >= max {
+			return err
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		u.logf("upload: %s failed (attempt %d/%d): %v; retrying in %s", what, attempt, max, err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+func (u *Uploader) do(ctx context.Context, method, target string, body []byte, hdr map[string]string) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range u.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	hc := u.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &httpError{status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+	return resp, nil
+}
+
+func (u *Uploader) create(ctx context.Context, name string, st *state) (string, error) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	resp, err := u.do(ctx, http.MethodPost, u.Endpoint, nil, map[string]string{
+		"Upload-Length":   strconv.FormatInt(st.Size, 10),
+		"Upload-Metadata": "filename " + b64(name) + ",sha256 " + b64(st.SHA256),
+	})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("upload: creation response without Location")
+	}
+	base, err := url.Parse(u.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(loc)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// headInfo is what a HEAD request reports about an upload. length is -1
+// when the server deferred it and sha256 is empty when the server does not
+// echo the creation metadata.
+type headInfo struct {
+	offset int64
+	length int64
+	sha256 string
+}
+
+func (u *Uploader) head(ctx context.Context, target string) (headInfo, error) {
+	resp, err := u.do(ctx, http.MethodHead, target, nil, nil)
+	if err != nil {
+		return headInfo{}, err
+	}
+	resp.Body.Close()
+	off, err := parseOffset(resp)
+	if err != nil {
+		return headInfo{}, err
+	}
+	info := headInfo{offset: off, length: -1}
+	if l, err := strconv.ParseInt(resp.Header.Get("Upload-Length"), 10, 64); err == nil {
+		info.length = l
+	}
+	info.sha256 = metadataValue(resp.Header.Get("Upload-Metadata"), "sha256")
+	return info, nil
+}
+
+// metadataValue decodes key from a tus Upload-Metadata header, returning ""
+// if it is absent or malformed.
+func metadataValue(hdr, key string) string {
+	for _, pair := range strings.Split(hdr, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if k != key {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return ""
+}
+
+func (u *Uploader) patch(ctx context.Context, target string, offset int64, chunk []byte) (int64, error) {
+	sum := sha1.Sum(chunk)
+	resp, err := u.do(ctx, http.MethodPatch, target, chunk, map[string]string{
+		"Content-Type":    "application/offset+octet-stream",
+		"Upload-Offset":   strconv.FormatInt(offset, 10),
+		"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	next, err := parseOffset(resp)
+	if err != nil {
+		return 0, err
+	}
+	if next != offset+int64(len(chunk)) {
+		return 0, fmt.Errorf("upload: server at offset %d, want %d", next, offset+int64(len(chunk)))
+	}
+	return next, nil
+}
+
+func parseOffset(resp *http.Response) (int64, error) {
+	off, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("upload: bad Upload-Offset %q", resp.Header.Get("Upload-Offset"))
+	}
+	return off, nil
+}
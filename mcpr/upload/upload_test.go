@@ -0,0 +1,254 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tusServer is a minimal tus server keeping uploads in memory.
+type tusServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	uploads map[string]*tusUpload
+	creates int
+	patches []int64 // offsets of PATCH requests, in order
+
+	// lose is the number of PATCH requests still to be stored but answered
+	// with a 500, as if the response got lost
+	lose int
+	// onPatch is called after a PATCH is stored, with the new offset
+	onPatch func(offset int64)
+}
+
+type tusUpload struct {
+	data   []byte
+	length int64
+	meta   string
+	status int // answers every request if non-zero, e.g. 404
+}
+
+func newTusServer(t *testing.T) *tusServer {
+	s := &tusServer{uploads: map[string]*tusUpload{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// add stores an upload of length bytes holding data and returns its URL.
+func (s *tusServer) add(data []byte, length int64, meta string, status int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := "/files/" + strconv.Itoa(len(s.uploads)+1)
+	s.uploads[id] = &tusUpload{data: data, length: length, meta: meta, status: status}
+	return s.URL + id
+}
+
+// requests returns the number of uploads created and the offsets patched.
+func (s *tusServer) requests() (int, []int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.creates, append([]int64(nil), s.patches...)
+}
+
+func (s *tusServer) data(url string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads[strings.TrimPrefix(url, s.URL)].data
+}
+
+func (s *tusServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodPost {
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad length", http.StatusBadRequest)
+			return
+		}
+		s.creates++
+		id := "/files/" + strconv.Itoa(len(s.uploads)+1)
+		s.uploads[id] = &tusUpload{length: length, meta: r.Header.Get("Upload-Metadata")}
+		w.Header().Set("Location", id)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	up := s.uploads[r.URL.Path]
+	if up == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if up.status != 0 {
+		w.WriteHeader(up.status)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(up.data)))
+		w.Header().Set("Upload-Length", strconv.FormatInt(up.length, 10))
+		w.Header().Set("Upload-Metadata", up.meta)
+	case http.MethodPatch:
+		off, _ := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		s.patches = append(s.patches, off)
+		if off != int64(len(up.data)) {
+			http.Error(w, "offset mismatch", http.StatusConflict)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sum := sha1.Sum(body)
+		if r.Header.Get("Upload-Checksum") != "sha1 "+base64.StdEncoding.EncodeToString(sum[:]) {
+			http.Error(w, "checksum mismatch", 460)
+			return
+		}
+		up.data = append(up.data, body...)
+		if s.onPatch != nil {
+			s.onPatch(int64(len(up.data)))
+		}
+		if s.lose > 0 {
+			s.lose--
+			http.Error(w, "lost", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(up.data)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeFile writes a 100 byte file and returns its path and sha256.
+func writeFile(t *testing.T) (string, []byte, string) {
+	t.Helper()
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	path := filepath.Join(t.TempDir(), "a.mcpr")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return path, data, hex.EncodeToString(sum[:])
+}
+
+func metadata(sum string) string {
+	return "sha256 " + base64.StdEncoding.EncodeToString([]byte(sum))
+}
+
+func newUploader(t *testing.T, s *tusServer) *Uploader {
+	return &Uploader{Endpoint: s.URL + "/files", ChunkSize: 30, Logf: t.Logf}
+}
+
+func TestUploadResume(t *testing.T) {
+	s := newTusServer(t)
+	path, data, sum := writeFile(t)
+	url := s.add(append([]byte(nil), data[:40]...), 100, metadata(sum), 0)
+	if err := saveState(path, &state{URL: url, Size: 100, SHA256: sum}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := newUploader(t, s).Upload(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != url {
+		t.Errorf("url = %s, want %s", got, url)
+	}
+	creates, patches := s.requests()
+	if creates != 0 {
+		t.Errorf("created %d uploads, want 0", creates)
+	}
+	if want := []int64{40, 70}; !reflect.DeepEqual(patches, want) {
+		t.Errorf("patched at %v, want %v", patches, want)
+	}
+	if !bytes.Equal(s.data(url), data) {
+		t.Error("server data differs from the file")
+	}
+	if _, err := os.Stat(StatePath(path)); !os.IsNotExist(err) {
+		t.Errorf("stat state: %v, want not exist", err)
+	}
+}
+
+func TestUploadConflict(t *testing.T) {
+	s := newTusServer(t)
+	s.lose = 1
+	path, data, _ := writeFile(t)
+
+	url, err := newUploader(t, s).Upload(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first chunk is stored but its response lost; the retry at offset
+	// 0 conflicts and the client continues where the server is
+	if _, patches := s.requests(); !reflect.DeepEqual(patches, []int64{0, 0, 30, 60, 90}) {
+		t.Errorf("patched at %v, want [0 0 30 60 90]", patches)
+	}
+	if !bytes.Equal(s.data(url), data) {
+		t.Error("server data differs from the file")
+	}
+}
+
+func TestUploadExpired(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			s := newTusServer(t)
+			path, data, sum := writeFile(t)
+			old := s.add(data[:40], 100, metadata(sum), status)
+			if err := saveState(path, &state{URL: old, Size: 100, SHA256: sum}); err != nil {
+				t.Fatal(err)
+			}
+
+			url, err := newUploader(t, s).Upload(context.Background(), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			creates, patches := s.requests()
+			if url == old || creates != 1 {
+				t.Errorf("url = %s after %d creates, want a new upload", url, creates)
+			}
+			if want := []int64{0, 30, 60, 90}; !reflect.DeepEqual(patches, want) {
+				t.Errorf("patched at %v, want %v", patches, want)
+			}
+			if !bytes.Equal(s.data(url), data) {
+				t.Error("server data differs from the file")
+			}
+		})
+	}
+}
+
+func TestUploadFileChanged(t *testing.T) {
+	s := newTusServer(t)
+	path, data, _ := writeFile(t)
+	s.onPatch = func(offset int64) {
+		if offset == int64(len(data)) {
+			changed := append([]byte(nil), data...)
+			changed[0]++
+			if err := os.WriteFile(path, changed, 0o644); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	_, err := newUploader(t, s).Upload(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "file changed during upload") {
+		t.Fatalf("err = %v, want the file to have changed", err)
+	}
+	// The state is kept, so that the upload is not mistaken for complete
+	if _, err := os.Stat(StatePath(path)); err != nil {
+		t.Errorf("stat state: %v", err)
+	}
+}
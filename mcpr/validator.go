@@ -2,110 +2,273 @@ package mcpr
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"time"
+
+	"github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
 )
 
+// Validation is the outcome of validating a replay that passed.
+type Validation struct {
+	Meta     Meta
+	Size     int64
+	Warnings []string // problems ReplayMod tolerates, e.g. a missing mods.json
+}
+
 // ValidateFile performs comprehensive validation of an MCPR file.
 // It checks zip integrity, required files, and metadata validity.
 // This is automatically called by recorder.Close() when writing to a file.
 func ValidateFile(path string) error {
+	return validateFile(path, log.Printf, StrictMode())
+}
+
+// ValidateFileQuiet is like ValidateFile but suppresses all log output.
+//
+// Deprecated: Use ValidatePath, which also returns the warnings.
+func ValidateFileQuiet(path string) error {
+	_, err := ValidatePath(path)
+	return err
+}
+
+// ValidatePath validates the replay at path like ValidateFile, but returns
+// the warnings in the Validation instead of logging them, see Validate.
+// Useful for CLI tools that want to control output formatting.
+func ValidatePath(path string) (*Validation, error) {
+	defer validateTimer.Since(time.Now())
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("replay file not found: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return validate(f, info.Size(), StrictMode())
+}
+
+// validateFile validates the replay at path, logging its warnings or, if
+// strict, failing on them.
+func validateFile(path string, logf func(format string, args ...any), strict bool) error {
+	defer validateTimer.Since(time.Now())
 	// Check file exists and has size
 	info, err := os.Stat(path)
 	if err != nil {
 		return fmt.Errorf("replay file not found: %w", err)
 	}
-	if info.Size() == 0 {
-		return fmt.Errorf("replay file is empty (0 bytes)")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	v, err := validate(f, info.Size(), strict)
+	if v != nil && !errors.Is(err, ErrWarning) {
+		for _, w := range v.Warnings {
+			logf("[mcpr] WARNING: %s", w)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Log validation success with key info
+	logf("[mcpr] Validated %s: %s protocol %d, %d ms, %d bytes",
+		path, v.Meta.MCVersion, v.Meta.Protocol, v.Meta.Duration, v.Size)
+	return nil
+}
+
+// ValidateFS validates the replay name in fsys, see Validate.
+func ValidateFS(fsys fs.FS, name string) (*Validation, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("replay file not found: %w", err)
+	}
+	defer f.Close()
+	if ra, ok := f.(io.ReaderAt); ok {
+		if info, err := f.Stat(); err == nil {
+			return Validate(ra, info.Size())
+		}
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return Validate(bytes.NewReader(b), int64(len(b)))
+}
+
+// Validate runs the checks of ValidateFile on a replay of size bytes read
+// from r. It neither touches the file system nor logs: warnings are returned
+// in the Validation, which is also returned (without Meta) alongside an
+// error if any were found first. In strict mode (see SetStrictMode) warnings
+// are an error as well. It builds for js/wasm, for web pages that check
+// replays before uploading them.
+func Validate(r io.ReaderAt, size int64) (*Validation, error) {
+	return validate(r, size, StrictMode())
+}
+
+func validate(r io.ReaderAt, size int64, strict bool) (*Validation, error) {
+	v := &Validation{Size: size}
+	warn := func(format string, args ...any) {
+		v.Warnings = append(v.Warnings, fmt.Sprintf(format, args...))
+	}
+	if size == 0 {
+		return v, fmt.Errorf("replay file is empty (0 bytes)")
 	}
 
 	// Open as zip
-	zr, err := zip.OpenReader(path)
+	zr, err := zip.NewReader(r, size)
 	if err != nil {
-		return fmt.Errorf("not a valid zip file: %w", err)
+		return v, fmt.Errorf("not a valid zip file: %w", err)
 	}
-	defer zr.Close()
 
-	// Check for required files
+	// Check for required files; of duplicate names the first counts
 	fileMap := make(map[string]*zip.File)
 	for _, f := range zr.File {
-		fileMap[f.Name] = f
+		if _, dup := fileMap[f.Name]; !dup {
+			fileMap[f.Name] = f
+		}
+	}
+
+	// Reject archives crafted to trick readers and extractors, and flag
+	// entries that do not belong in a replay (see CleanFile)
+	if err := checkLayout(zr.File, DefaultArchiveLimits); err != nil {
+		return v, err
+	}
+	for _, p := range CheckEntries(zr.File) {
+		if p.Reason == "unsafe name" {
+			return v, fmt.Errorf("%w: entry name %q", ErrUnsafeArchive, p.Name)
+		}
+		if p.Reason == "duplicate" && (p.Name == "recording.tmcpr" || p.Name == "metaData.json") {
+			return v, fmt.Errorf("duplicate entry %s: readers may pick either copy", p.Name)
+		}
+		warn("unexpected entry: %s", p)
 	}
 
 	// Validate recording.tmcpr
 	recFile, hasRecording := fileMap["recording.tmcpr"]
 	if !hasRecording {
-		return fmt.Errorf("missing required file: recording.tmcpr")
+		return v, fmt.Errorf("missing required file: recording.tmcpr")
 	}
 	if recFile.UncompressedSize64 == 0 {
-		log.Printf("[mcpr] WARNING: recording.tmcpr is empty")
+		warn("recording.tmcpr is empty")
 	}
 
 	// Validate and parse metaData.json
 	metaFile, hasMetadata := fileMap["metaData.json"]
 	if !hasMetadata {
-		return fmt.Errorf("missing required file: metaData.json")
+		return v, fmt.Errorf("missing required file: metaData.json")
 	}
 
 	rc, err := metaFile.Open()
 	if err != nil {
-		return fmt.Errorf("failed to open metaData.json: %w", err)
+		return v, fmt.Errorf("failed to open metaData.json: %w", err)
 	}
 	defer rc.Close()
 
 	data, err := io.ReadAll(rc)
 	if err != nil {
-		return fmt.Errorf("failed to read metaData.json: %w", err)
+		return v, fmt.Errorf("failed to read metaData.json: %w", err)
 	}
 
 	var meta Meta
 	if err := json.Unmarshal(data, &meta); err != nil {
-		return fmt.Errorf("failed to parse metaData.json: %w", err)
+		return v, fmt.Errorf("failed to parse metaData.json: %w", err)
 	}
 
 	// Validate critical metadata fields
 	if meta.FileFormat != "MCPR" {
-		log.Printf("[mcpr] WARNING: unexpected file format: %s", meta.FileFormat)
+		warn("unexpected file format: %s", meta.FileFormat)
 	}
 	if meta.FileFormatVersion < 1 || meta.FileFormatVersion > 15 {
-		log.Printf("[mcpr] WARNING: unusual file format version: %d", meta.FileFormatVersion)
+		warn("unusual file format version: %d", meta.FileFormatVersion)
 	}
 	if meta.Protocol == 0 {
-		log.Printf("[mcpr] WARNING: protocol version is 0")
+		warn("protocol version is 0")
 	}
 	if meta.Duration == 0 {
-		log.Printf("[mcpr] WARNING: replay duration is 0 ms (very short)")
+		warn("replay duration is 0 ms (very short)")
 	}
 
 	// Check optional but expected files
 	if _, ok := fileMap["mods.json"]; !ok {
-		log.Printf("[mcpr] WARNING: missing optional file: mods.json")
+		warn("missing optional file: mods.json")
 	}
 	if _, ok := fileMap["recording.tmcpr.crc32"]; !ok {
-		log.Printf("[mcpr] WARNING: missing cache file: recording.tmcpr.crc32")
+		warn("missing cache file: recording.tmcpr.crc32")
 	}
 
-	// Log validation success with key info
-	log.Printf("[mcpr] Validated %s: %s protocol %d, %d ms, %d bytes",
-		path, meta.MCVersion, meta.Protocol, meta.Duration, info.Size())
+	// Verify the frame index against the stream, when present
+	if ixFile, ok := fileMap[tmcpr.IndexEntryName]; ok {
+		if err := verifyIndex(ixFile, recFile); err != nil {
+			return v, fmt.Errorf("invalid %s: %w", tmcpr.IndexEntryName, err)
+		}
+	}
 
-	return nil
+	// Dimension segments must be ordered and lie within the recording
+	if dimFile, ok := fileMap[DimensionsEntryName]; ok {
+		segs, err := readDimensions(dimFile)
+		if err != nil {
+			return v, err
+		}
+		var prev uint32
+		for i, sg := range segs {
+			if sg.Start < prev || sg.End < sg.Start || sg.End > uint32(meta.Duration) {
+				return v, fmt.Errorf("invalid %s: segment %d (%s %d-%d ms) out of order or beyond duration",
+					DimensionsEntryName, i, sg.Dimension, sg.Start, sg.End)
+			}
+			prev = sg.End
+		}
+	}
+
+	v.Meta = meta
+	if strict && len(v.Warnings) > 0 {
+		return v, warningsError(v.Warnings)
+	}
+	return v, nil
 }
 
-// ValidateFileQuiet is like ValidateFile but suppresses all log output.
-// Useful for CLI tools that want to control output formatting.
-func ValidateFileQuiet(path string) error {
-	// Temporarily suppress log output
-	oldFlags := log.Flags()
-	oldOutput := log.Writer()
-	log.SetOutput(io.Discard)
-	defer func() {
-		log.SetFlags(oldFlags)
-		log.SetOutput(oldOutput)
-	}()
-
-	return ValidateFile(path)
+// verifyIndex checks that every index entry points at a frame boundary with
+// the recorded timestamp.
+func verifyIndex(ixFile, recFile *zip.File) error {
+	rc, err := ixFile.Open()
+	if err != nil {
+		return err
+	}
+	ix, err := tmcpr.ReadIndex(rc)
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+
+	rec, err := recFile.Open()
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+	fr := tmcpr.NewReader(rec)
+	for i, e := range ix.Entries {
+		for fr.Offset() < e.Offset {
+			if _, err := fr.Next(); err != nil {
+				return fmt.Errorf("entry %d: offset %d beyond stream: %w", i, e.Offset, err)
+			}
+		}
+		if fr.Offset() != e.Offset {
+			return fmt.Errorf("entry %d: offset %d is not a frame boundary", i, e.Offset)
+		}
+		f, err := fr.Next()
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		if f.Time != e.Time {
+			return fmt.Errorf("entry %d: frame at offset %d has t=%d, index says %d", i, e.Offset, f.Time, e.Time)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,88 @@
+package mcpr
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "sync"
+)
+
+// Walk opens every .mcpr file under dir with OpenReader and calls fn with
+// its Reader, using up to workers goroutines at once (runtime.NumCPU() if
+// workers <= 0). fn is called concurrently for different files, each Reader
+// only from one goroutine, and the Reader is closed when fn returns.
+//
+// A replay that fails to open, or for which fn returns an error, does not
+// stop the walk: Walk returns all such errors joined, each prefixed with the
+// file's path. fn returning fs.SkipAll stops the walk after the files already
+// started. Errors reading dir itself end the walk and are returned as well.
+func Walk(dir string, workers int, fn func(path string, r *Reader) error) error {
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    var (
+        mu   sync.Mutex
+        errs []error
+        stop = make(chan struct{})
+        once sync.Once
+        wg   sync.WaitGroup
+    )
+    report := func(err error) {
+        mu.Lock()
+        errs = append(errs, err)
+        mu.Unlock()
+    }
+    paths := make(chan string)
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for path := range paths {
+                err := walkFile(path, fn)
+                if errors.Is(err, fs.SkipAll) {
+                    once.Do(func() { close(stop) })
+                } else if err != nil {
+                    report(err)
+                }
+            }
+        }()
+    }
+    werr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".mcpr") {
+            return nil
+        }
+        select {
+        case paths <- path:
+            return nil
+        case <-stop:
+            return fs.SkipAll
+        }
+    })
+    close(paths)
+    wg.Wait()
+    if werr != nil {
+        errs = append(errs, werr)
+    }
+    return errors.Join(errs...)
+}
+
+func walkFile(path string, fn func(string, *Reader) error) error {
+    r, err := OpenReader(path)
+    if err != nil {
+        return err // already names path
+    }
+    defer r.Close()
+    if err := fn(path, r); err != nil {
+        if errors.Is(err, fs.SkipAll) {
+            return err
+        }
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    return nil
+}
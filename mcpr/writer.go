@@ -4,12 +4,27 @@ import (
     "archive/zip"
     "encoding/binary"
     "encoding/json"
+    "errors"
     "fmt"
     "hash"
     "hash/crc32"
     "io"
+    "log"
+    "net"
     "os"
+    "strings"
+    "sync"
     "time"
+
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/internal/tmcpr"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/perf"
+    "github.com/reallyoldfogie/mc-replay-go/mcpr/protocol"
+)
+
+var (
+    writeTimer = perf.NewTimer("mcpr.WritePacket")
+    closeTimer = perf.NewTimer("mcpr.Close") // includes ValidateFile for Create writers
+    validateTimer = perf.NewTimer("mcpr.ValidateFile")
 )
 
 // Writer streams packets into a ReplayMod .mcpr file.
@@ -20,27 +35,88 @@ import (
 //  _ = w.WritePacket(0, 0x26, payload)
 //
 // Packets are written incrementally; the writer does not retain them in memory.
+// A Writer is not safe for concurrent use unless made WithLocking.
 type Writer struct {
     zw       *zip.Writer
+    prefix   string // entry name prefix, when embedded via NewWriterInZip
+    ownsZip  bool   // Close() closes zw (false for NewWriterInZip)
+    out      *output // zw's destination, nil for NewWriterInZip; see SetBufferSize
     recw     io.Writer
     meta     Meta
-    duration uint32
+    duration uint32 // latest timestamp written
+    fixedDuration uint32 // replaces duration in metaData.json if durationSet, see SetDuration
+    durationSet bool
     closed   bool
     file     *os.File  // optional, when using Create()
     filePath string    // optional, path to file for validation
     crc32    hash.Hash32 // CRC32 hash for recording.tmcpr validation
+    packets  int64       // number of frames written
+    recBytes int64       // uncompressed bytes written to recording.tmcpr
+    sidecar  bool        // write <path>.json on Close (Create only)
+    entries  map[string]bool // extra entries added via CreateEntry/CopyEntry
+    index    *tmcpr.Index    // optional time→offset index, see SetIndexInterval
+    dims     *dimensionTracker // optional, see TrackDimensions
+    markers  []Marker        // written to markers.json on Close, see AddMarker
+    timelines map[string]Timeline // written to timelines.json on Close, see SetTimeline
+    thumb    []byte          // written to thumb on Close, see SetThumbnail
+    processing []ProcessingStep // written to processing.json on Close, see AddProcessingStep
+    ext      ExtMeta         // written to metaDataExt.json on Close, see AddTags
+    annotations []Annotation // written to annotations.json on Close, see Annotate
+    hb       *heartbeat      // optional, see SetHeartbeat
+    samp     *sampler        // optional, see SetSampling
+    lat      *latencyTracker // optional, see TrackLatency
+    detect   *protocol.Detector // optional, see DetectProtocol
+    detected bool            // detect needs no more packets
+    ids      idRange         // packet id check against Meta.Protocol
+    strict   bool            // reject rather than warn, see SetStrict
+    broken   error           // a frame left incomplete, see WritePacketFrom
+    spool    *os.File        // uncompressed copy of recording.tmcpr, see EnableSnapshots
+    pack     int             // payload size from which frames are packed, see SetPackThreshold
+    async    *asyncQueue     // optional, see SetAsync
+    locking  bool            // exported methods hold mu, see WithLocking
+    mu       sync.Mutex
+    recComp  Compression     // of recording.tmcpr, see WithRecordingCompression
+    entryComp Compression    // of the other entries, see WithEntryCompression
+    level    int             // deflate level of the entry being created, see registerCompressor
+    hdr      [13]byte        // scratch for frame header and id, see writeHeader
 }
 
-// NewWriter creates a new MCPR writer onto the provided io.Writer.
-// It immediately creates the first ZIP entry "recording.tmcpr" and expects
-// packets to be written there until Close() is called.
-func NewWriter(out io.Writer, meta Meta) (*Writer, error) {
-    zw := zip.NewWriter(out)
-    rec, err := zw.Create("recording.tmcpr")
+// NewWriter creates a new MCPR writer onto the provided io.Writer, configured
+// by opts (see WriterOption). It immediately creates the first ZIP entry
+// "recording.tmcpr" and expects packets to be written there until Close() is
+// called.
+func NewWriter(out io.Writer, meta Meta, opts ...WriterOption) (*Writer, error) {
+    return newFileWriter(out, nil, meta, opts)
+}
+
+// newFileWriter is NewWriter for a writer owning file, which out writes to,
+// if it is not nil.
+func newFileWriter(out io.Writer, file *os.File, meta Meta, opts []WriterOption) (*Writer, error) {
+    o := &output{w: out}
+    w, err := newWriter(zip.NewWriter(o), "", meta, o, file, opts)
     if err != nil {
-        return nil, fmt.Errorf("create recording.tmcpr: %w", err)
+        return nil, err
     }
+    w.ownsZip = true
+    return w, nil
+}
+
+// NewWriterInZip creates a writer that adds the replay's entries to an
+// existing archive owned by the caller, e.g. to embed a replay inside a larger
+// export bundle. All entries are written under prefix (a directory name such
+// as "matches/final/"; a trailing slash is added if missing).
+//
+// Close() writes the remaining replay entries but does not close zw; the
+// caller may add further entries afterwards and must close zw itself. Entries
+// for other files must not be created while the replay is being recorded.
+func NewWriterInZip(zw *zip.Writer, prefix string, meta Meta, opts ...WriterOption) (*Writer, error) {
+    if prefix != "" && !strings.HasSuffix(prefix, "/") {
+        prefix += "/"
+    }
+    return newWriter(zw, prefix, meta, nil, nil, opts)
+}
 
+func newWriter(zw *zip.Writer, prefix string, meta Meta, out *output, file *os.File, opts []WriterOption) (*Writer, error) {
     if meta.FileFormat == "" {
         meta.FileFormat = "MCPR"
     }
@@ -50,31 +126,66 @@ func NewWriter(out io.Writer, meta Meta) (*Writer, error) {
     if meta.Date == 0 {
         meta.Date = time.Now().UnixMilli()
     }
+    if meta.ID == "" {
+        id, err := newID()
+        if err != nil {
+            return nil, fmt.Errorf("generate replay id: %w", err)
+        }
+        meta.ID = id
+    }
 
     // Initialize CRC32 hash for cache validation
     crc := crc32.NewIEEE()
 
-    return &Writer{
-        zw:    zw,
-        recw:  io.MultiWriter(rec, crc), // Write to both file and CRC
-        meta:  meta,
-        crc32: crc,
-    }, nil
+    w := &Writer{
+        zw:     zw,
+        prefix: prefix,
+        out:    out,
+        meta:   meta,
+        crc32:  crc,
+        file:   file,
+        ids:    newIDRange(meta.Protocol),
+        strict: StrictMode(),
+    }
+    // Options come first: they may set how the recording is compressed
+    if err := w.applyOptions(opts); err != nil {
+        return nil, err
+    }
+    w.registerCompressor()
+    rec, err := w.create("recording.tmcpr", w.recComp)
+    if err != nil {
+        w.abandon()
+        return nil, fmt.Errorf("create recording.tmcpr: %w", err)
+    }
+    w.recw = io.MultiWriter(rec, crc) // Write to both file and CRC
+    if w.spool != nil {
+        w.recw = io.MultiWriter(w.recw, w.spool)
+    }
+    return w, nil
+}
+
+// abandon releases what a writer that failed to be created holds: the async
+// goroutine, the snapshot spool and its file.
+func (w *Writer) abandon() {
+    _ = w.stopAsync()
+    w.closeSpool()
+    if w.file != nil {
+        _ = w.file.Close()
+    }
 }
 
 // Create opens/creates a file at path and returns a Writer that owns the file descriptor.
 // Close() will also close the underlying file and automatically validate it.
-func Create(path string, meta Meta) (*Writer, error) {
+// opts configure the writer, see WriterOption.
+func Create(path string, meta Meta, opts ...WriterOption) (*Writer, error) {
     f, err := os.Create(path)
     if err != nil {
         return nil, err
     }
-    w, err := NewWriter(f, meta)
+    w, err := newFileWriter(f, f, meta, opts) // closes f if it fails
     if err != nil {
-        _ = f.Close()
         return nil, err
     }
-    w.file = f
     w.filePath = path
     return w, nil
 }
@@ -82,43 +193,355 @@ func Create(path string, meta Meta) (*Writer, error) {
 // WritePacket writes a single packet frame to recording.tmcpr.
 // ts is a millisecond timestamp. packetID is the protocol packet id and
 // payload the raw packet bytes as they would appear on the wire after the varint id.
+// Framing the packet does not allocate, so recording adds no garbage per
+// packet beyond what optional features such as SetSampling keep.
 func (w *Writer) WritePacket(ts uint32, packetID int32, payload []byte) error {
-    if w.closed || w.recw == nil {
-        return fmt.Errorf("mcpr: writer closed")
+    defer w.lock().unlock()
+    defer writeTimer.Since(time.Now())
+    if err := w.writable(); err != nil {
+        return err
     }
+    if w.async != nil {
+        b := w.async.buffer(len(payload))
+        copy(*b, payload)
+        w.async.queue(ts, packetID, b)
+        return nil
+    }
+    return w.tear(w.write(ts, packetID, payload))
+}
 
-    // Header: time (int32 BE), length (int32 BE) of [varint id + payload]
-    var hdr [8]byte
-    binary.BigEndian.PutUint32(hdr[0:4], ts)
-    varid := encodeVarInt(packetID)
-    total := uint32(len(varid) + len(payload))
-    binary.BigEndian.PutUint32(hdr[4:8], total)
+// write checks, samples and writes a packet.
+func (w *Writer) write(ts uint32, packetID int32, payload []byte) error {
+    if err := w.checkID(ts, packetID); err != nil {
+        return err
+    }
+    if w.samp != nil {
+        for _, f := range w.samp.filter(ts, packetID, payload) {
+            if err := w.writePacket(f.ts, f.id, f.payload); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    return w.writePacket(ts, packetID, payload)
+}
 
-    if _, err := w.recw.Write(hdr[:]); err != nil {
+// WritePacketFrom is like WritePacket for a payload of size bytes read from
+// r: as the length is known up front, the frame header is written first and
+// the payload copied into the frame, so multi-megabyte packets such as chunk
+// batches need not be buffered by the caller. Features that look at payloads (SetSampling, SetHeartbeat,
+// TrackLatency, TrackDimensions, DetectProtocol, and SetPackThreshold for
+// payloads reaching it) need them whole, though; while any of them is in
+// effect the payload is read into memory and written as by WritePacket.
+//
+// If r fails or ends before size bytes, the frame is left incomplete and the
+// recording cannot be continued: the error is returned, as it is by later
+// writes and by Close, which still finishes the archive.
+func (w *Writer) WritePacketFrom(ts uint32, packetID int32, size int, r io.Reader) error {
+    defer w.lock().unlock()
+    if err := w.writable(); err != nil {
         return err
     }
-    if _, err := w.recw.Write(varid); err != nil {
+    if size < 0 {
+        return fmt.Errorf("mcpr: negative payload size %d", size)
+    }
+    if w.async != nil {
+        b := w.async.buffer(size)
+        if _, err := io.ReadFull(r, *b); err != nil {
+            return fmt.Errorf("mcpr: read payload: %w", err)
+        }
+        w.async.queue(ts, packetID, b)
+        return nil
+    }
+    if w.wholePayload(packetID, size) {
+        payload := make([]byte, size)
+        if _, err := io.ReadFull(r, payload); err != nil {
+            return fmt.Errorf("mcpr: read payload: %w", err)
+        }
+        return w.tear(w.write(ts, packetID, payload))
+    }
+    defer writeTimer.Since(time.Now())
+    if err := w.checkID(ts, packetID); err != nil {
         return err
     }
-    if _, err := w.recw.Write(payload); err != nil {
+    n, err := w.writeHeader(ts, packetID, size)
+    if err != nil {
+        return w.tear(err)
+    }
+    copied, err := io.CopyN(w.recw, r, int64(size))
+    w.recBytes += int64(n) + copied
+    if err != nil {
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        w.broken = fmt.Errorf("mcpr: frame at %d ms incomplete, %d of %d payload bytes written: %w", ts, copied, size, err)
+        return w.broken
+    }
+    w.written(ts)
+    return nil
+}
+
+// WritePacketBuffers is like WritePacket for a payload held in several
+// slices, e.g. a header and a body as an adapter received them: the slices
+// are written one after the other into the frame instead of being joined
+// first. While a feature that looks at payloads is in effect (see
+// WritePacketFrom) they are joined and written as by WritePacket. bufs is
+// not modified.
+func (w *Writer) WritePacketBuffers(ts uint32, packetID int32, bufs net.Buffers) error {
+    defer w.lock().unlock()
+    if err := w.writable(); err != nil {
         return err
     }
+    size := 0
+    for _, b := range bufs {
+        size += len(b)
+    }
+    if w.async != nil {
+        b := w.async.buffer(size)
+        n := 0
+        for _, buf := range bufs {
+            n += copy((*b)[n:], buf)
+        }
+        w.async.queue(ts, packetID, b)
+        return nil
+    }
+    if w.wholePayload(packetID, size) {
+        payload := make([]byte, 0, size)
+        for _, b := range bufs {
+            payload = append(payload, b...)
+        }
+        return w.tear(w.write(ts, packetID, payload))
+    }
+    defer writeTimer.Since(time.Now())
+    if err := w.checkID(ts, packetID); err != nil {
+        return err
+    }
+    n, err := w.writeHeader(ts, packetID, size)
+    if err != nil {
+        return w.tear(err)
+    }
+    w.recBytes += int64(n)
+    copied := 0
+    for _, b := range bufs {
+        k, err := w.recw.Write(b)
+        copied += k
+        w.recBytes += int64(k)
+        if err != nil {
+            w.broken = fmt.Errorf("mcpr: frame at %d ms incomplete, %d of %d payload bytes written: %w", ts, copied, size, err)
+            return w.broken
+        }
+    }
+    w.written(ts)
+    return nil
+}
+
+// wholePayload reports whether a payload of size bytes must be in memory to
+// be written, see WritePacketFrom.
+func (w *Writer) wholePayload(packetID int32, size int) bool {
+    return w.samp != nil || w.hb != nil || w.lat != nil || w.dims != nil || w.detect != nil && !w.detected ||
+        w.pack > 0 && size >= w.pack && packetID >= 0
+}
 
+// written counts a frame at ts.
+func (w *Writer) written(ts uint32) {
     if ts > w.duration {
         w.duration = ts
     }
+    w.packets++
+}
+
+// writable returns why packets cannot be written, if they cannot.
+func (w *Writer) writable() error {
+    if w.closed || w.recw == nil {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if w.async != nil {
+        if err := w.async.failed(); err != nil {
+            return err
+        }
+    }
+    return w.broken
+}
+
+// tornFrame is the error of a frame left incomplete in recording.tmcpr, after
+// which the recording cannot be continued.
+type tornFrame struct{ error }
+
+func (e tornFrame) Unwrap() error { return e.error }
+
+// tear makes err the Writer's if it left a frame incomplete, and returns it.
+// It runs on the caller's goroutine only: in async mode the writing
+// goroutine's errors stop the queue and reach w.broken through stopAsync.
+func (w *Writer) tear(err error) error {
+    if err == nil || w.broken != nil {
+        return err
+    }
+    if t := (tornFrame{}); errors.As(err, &t) {
+        w.broken = err
+    }
+    return err
+}
+
+// lock locks the writer if it was made WithLocking; defer w.lock().unlock()
+// guards an exported method.
+func (w *Writer) lock() *Writer {
+    if w.locking {
+        w.mu.Lock()
+    }
+    return w
+}
+
+func (w *Writer) unlock() {
+    if w.locking {
+        w.mu.Unlock()
+    }
+}
+
+// writePacket writes a packet that passed sampling.
+func (w *Writer) writePacket(ts uint32, packetID int32, payload []byte) error {
+    if w.hb != nil {
+        times, payloads := w.hb.fill(ts)
+        for i := range times {
+            if err := w.writeFrame(times[i], w.hb.setTime, payloads[i]); err != nil {
+                return err
+            }
+            if w.lat != nil {
+                w.lat.inserted()
+            }
+        }
+        w.hb.observe(ts, packetID, payload)
+    }
+    if w.lat != nil {
+        w.lat.observe(ts, packetID, payload)
+    }
+    if w.detect != nil && !w.detected {
+        w.detected = w.detect.Observe(packetID, payload)
+    }
+    return w.writeFrame(ts, packetID, payload)
+}
+
+func (w *Writer) writeFrame(ts uint32, packetID int32, payload []byte) error {
+    frameID, body := w.packFrame(packetID, payload)
+
+    if w.dims != nil && w.dims.observe(ts, packetID, payload) && w.index != nil {
+        w.index.Mark(ts, w.recBytes)
+    }
+    n, err := w.writeHeader(ts, frameID, len(body))
+    if err != nil {
+        return err
+    }
+    k, err := w.recw.Write(body)
+    w.recBytes += int64(n) + int64(k)
+    if err != nil {
+        return tornFrame{fmt.Errorf("mcpr: frame at %d ms incomplete, %d of %d body bytes written: %w", ts, k, len(body), err)}
+    }
+
+    w.written(ts)
     return nil
 }
 
+// writeHeader indexes and writes the header and id of a frame whose body of
+// size bytes follows, and returns how many bytes it wrote. It is on the path
+// of every packet and does not allocate: header and id are encoded into the
+// Writer's scratch buffer and written at once.
+func (w *Writer) writeHeader(ts uint32, frameID int32, size int) (int, error) {
+    // Header: time (int32 BE), length (int32 BE) of [varint id + payload]
+    hdr := tmcpr.AppendVarInt(w.hdr[:8], frameID)
+    binary.BigEndian.PutUint32(hdr[0:4], ts)
+    binary.BigEndian.PutUint32(hdr[4:8], uint32(len(hdr)-8+size))
+
+    if w.index != nil {
+        w.index.Add(ts, w.recBytes)
+    }
+    if k, err := w.recw.Write(hdr); err != nil {
+        w.recBytes += int64(k)
+        return 0, tornFrame{fmt.Errorf("mcpr: frame at %d ms incomplete, %d of %d header bytes written: %w", ts, k, len(hdr), err)}
+    }
+    return len(hdr), nil
+}
+
+// SetIndexInterval enables a time→offset index of recording.tmcpr with one
+// entry per interval of ms, written to "recording.tmcpr.index" on Close.
+// Readers use it to seek without parsing every frame; ReplayMod ignores it.
+// Call it before writing packets; 0 disables the index.
+//
+// Deprecated: Use WithIndexInterval.
+func (w *Writer) SetIndexInterval(ms uint32) {
+    defer w.lock().unlock()
+    if ms == 0 {
+        w.index = nil
+        return
+    }
+    w.index = &tmcpr.Index{Interval: ms}
+}
+
+// SetSidecar enables or disables writing a companion <path>.json file on Close
+// (see Sidecar). It only has an effect for writers created with Create().
+//
+// Deprecated: Use WithSidecar.
+func (w *Writer) SetSidecar(enabled bool) {
+    defer w.lock().unlock()
+    w.sidecar = enabled
+}
+
+// SetDuration sets the duration written to metaData.json to ms, instead of
+// the timestamp of the latest packet written. Replays assembled from filtered
+// or re-timed packets need it when their last packet does not mark their end,
+// e.g. a clip ending in a quiet stretch. A duration shorter than the latest
+// packet cuts off ReplayMod's timeline before it. Snapshots and dimension
+// segments end at it too.
+func (w *Writer) SetDuration(ms uint32) {
+    defer w.lock().unlock()
+    w.fixedDuration, w.durationSet = ms, true
+}
+
+// end returns the duration of the replay: the one set by SetDuration, or the
+// latest timestamp written.
+func (w *Writer) end() uint32 {
+    if w.durationSet {
+        return w.fixedDuration
+    }
+    return w.duration
+}
+
+// ID returns the unique identifier of this recording.
+// It is available immediately after NewWriter/Create, before the final
+// filename is known, and is stored in metaData.json as "id".
+func (w *Writer) ID() string {
+    return w.meta.ID
+}
+
+// Meta returns the metadata as it stands, including players and other fields
+// set since the writer was created. Duration is filled in by Close.
+func (w *Writer) Meta() Meta {
+    defer w.lock().unlock()
+    return w.metaCopy()
+}
+
+func (w *Writer) metaCopy() Meta {
+    m := w.meta
+    m.Players = append([]string(nil), w.meta.Players...)
+    return m
+}
+
 // SetSelfID updates the selfId field written to metaData.json.
 // ReplayMod uses this to identify the recorder's own player entity.
 func (w *Writer) SetSelfID(id int) {
+    defer w.lock().unlock()
     w.meta.SelfID = id
 }
 
+// SetModLoader flags the recording as made over a modded connection; name is
+// written to metaData.json as "modLoader".
+func (w *Writer) SetModLoader(name string) {
+    defer w.lock().unlock()
+    w.meta.ModLoader = name
+}
+
 // AddPlayer adds a player UUID to the replay metadata.
 // This populates the "players" array in metaData.json for ReplayMod compatibility.
 func (w *Writer) AddPlayer(uuid string) {
+    defer w.lock().unlock()
     // Ensure players array exists
     if w.meta.Players == nil {
         w.meta.Players = []string{}
@@ -136,19 +559,95 @@ func (w *Writer) AddPlayer(uuid string) {
 // Note: ZIP requires sequential entry writing. Only call this after you have
 // finished writing packets; you cannot resume writing to recording.tmcpr afterward.
 func (w *Writer) CreateEntry(name string) (io.Writer, error) {
+    defer w.lock().unlock()
+    w.drain()
     if w.closed {
         return nil, fmt.Errorf("mcpr: writer closed")
     }
-    return w.zw.Create(name)
+    if !SafeEntryName(name) {
+        return nil, fmt.Errorf("%w: entry name %q", ErrUnsafeArchive, name)
+    }
+    ew, err := w.createEntry(name)
+    if err != nil {
+        return nil, err
+    }
+    w.addEntry(name)
+    return ew, nil
+}
+
+// CopyEntry copies an entry from another archive without recompressing it.
+// The same ordering rules as CreateEntry apply.
+func (w *Writer) CopyEntry(f *zip.File) error {
+    defer w.lock().unlock()
+    w.drain()
+    if w.closed {
+        return fmt.Errorf("mcpr: writer closed")
+    }
+    if !SafeEntryName(f.Name) {
+        return fmt.Errorf("%w: entry name %q", ErrUnsafeArchive, f.Name)
+    }
+    hdr := f.FileHeader
+    hdr.Name = w.prefix + f.Name
+    dst, err := w.zw.CreateRaw(&hdr)
+    if err != nil {
+        return err
+    }
+    src, err := f.OpenRaw()
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(dst, src); err != nil {
+        return err
+    }
+    w.addEntry(f.Name)
+    return nil
+}
+
+func (w *Writer) addEntry(name string) {
+    if w.entries == nil {
+        w.entries = map[string]bool{}
+    }
+    w.entries[name] = true
+}
+
+// CloseWithMeta applies patch to the metadata and closes the writer, so
+// fields learned at the end of a session (final player list, custom server
+// name, outcome tags) land in the archive in the same step that finalizes it.
+func (w *Writer) CloseWithMeta(patch MetaPatch) error {
+    defer w.lock().unlock()
+    if w.closed {
+        return nil
+    }
+    w.drain()
+    patch.Apply(&w.meta)
+    w.addTags(patch.Tags)
+    return w.close()
 }
 
 // Close finalizes the recording, writes metaData.json, and closes the archive.
 func (w *Writer) Close() error {
+    defer w.lock().unlock()
+    return w.close()
+}
+
+func (w *Writer) close() error {
     if w.closed {
         return nil
     }
+    defer w.closeSpool()
+    defer closeTimer.Since(time.Now())
+    _ = w.stopAsync() // returned as w.broken
+    if w.samp != nil {
+        for _, f := range w.samp.finish(w.duration) {
+            if err := w.writePacket(f.ts, f.id, f.payload); err != nil {
+                return w.tear(err)
+            }
+        }
+        w.ext.Sampled = w.samp.periods
+    }
     // Write metaData.json as the last entry
-    w.meta.Duration = int(w.duration)
+    w.meta.Duration = int(w.end())
+    w.applyGuess()
     if w.meta.Generator == "" {
         w.meta.Generator = "mc-replay-go"
     }
@@ -159,7 +658,7 @@ func (w *Writer) Close() error {
         w.meta.FileFormatVersion = CurrentFileFormatVersion
     }
 
-    md, err := w.zw.Create("metaData.json")
+    md, err := w.createEntry("metaData.json")
     if err != nil {
         return fmt.Errorf("create metaData.json: %w", err)
     }
@@ -171,24 +670,56 @@ func (w *Writer) Close() error {
         return err
     }
 
-    // Write mods.json for compatibility with ReplayMod
-    modsJSON := map[string][]interface{}{
-        "requiredMods": {},
+    // Write mods.json for compatibility with ReplayMod, unless the caller
+    // already supplied one (e.g. carried over from a source replay)
+    if !w.entries["mods.json"] {
+        modsJSON := map[string][]interface{}{
+            "requiredMods": {},
+        }
+        modsEntry, err := w.createEntry("mods.json")
+        if err != nil {
+            return fmt.Errorf("create mods.json: %w", err)
+        }
+        modsBytes, err := json.Marshal(modsJSON)
+        if err != nil {
+            return fmt.Errorf("marshal mods.json: %w", err)
+        }
+        if _, err := modsEntry.Write(modsBytes); err != nil {
+            return err
+        }
     }
-    modsEntry, err := w.zw.Create("mods.json")
-    if err != nil {
-        return fmt.Errorf("create mods.json: %w", err)
+
+    if len(w.markers) > 0 && !w.entries[MarkersEntryName] {
+        mkEntry, err := w.createEntry(MarkersEntryName)
+        if err != nil {
+            return fmt.Errorf("create %s: %w", MarkersEntryName, err)
+        }
+        if err := json.NewEncoder(mkEntry).Encode(w.markers); err != nil {
+            return err
+        }
     }
-    modsBytes, err := json.Marshal(modsJSON)
-    if err != nil {
-        return fmt.Errorf("marshal mods.json: %w", err)
+
+    if err := w.writeTimelines(); err != nil {
+        return err
     }
-    if _, err := modsEntry.Write(modsBytes); err != nil {
+    if err := w.writeThumbnail(); err != nil {
+        return err
+    }
+    if err := w.writeProcessing(); err != nil {
+        return err
+    }
+    if err := w.writeExtMeta(); err != nil {
+        return err
+    }
+    if err := w.writeAnnotations(); err != nil {
+        return err
+    }
+    if err := w.writeLatency(); err != nil {
         return err
     }
 
     // Write recording.tmcpr.crc32 for cache validation
-    crc32Entry, err := w.zw.Create("recording.tmcpr.crc32")
+    crc32Entry, err := w.createEntry("recording.tmcpr.crc32")
     if err != nil {
         return fmt.Errorf("create recording.tmcpr.crc32: %w", err)
     }
@@ -197,7 +728,38 @@ func (w *Writer) Close() error {
         return err
     }
 
-    if err := w.zw.Close(); err != nil {
+    if w.index != nil {
+        ixEntry, err := w.createEntry(tmcpr.IndexEntryName)
+        if err != nil {
+            return fmt.Errorf("create %s: %w", tmcpr.IndexEntryName, err)
+        }
+        if _, err := w.index.WriteTo(ixEntry); err != nil {
+            return err
+        }
+    }
+
+    if w.dims != nil {
+        dimEntry, err := w.createEntry(DimensionsEntryName)
+        if err != nil {
+            return fmt.Errorf("create %s: %w", DimensionsEntryName, err)
+        }
+        segs := w.dimensions()
+        if segs == nil {
+            segs = []DimensionSegment{}
+        }
+        if err := json.NewEncoder(dimEntry).Encode(segs); err != nil {
+            return err
+        }
+    }
+
+    if w.ownsZip {
+        if err := w.zw.Close(); err != nil {
+            return err
+        }
+        if err := w.out.flush(); err != nil {
+            return err
+        }
+    } else if err := w.zw.Flush(); err != nil {
         return err
     }
     w.closed = true
@@ -209,10 +771,22 @@ func (w *Writer) Close() error {
 
     // Automatically validate the file if we created it
     if w.filePath != "" {
-        if err := ValidateFile(w.filePath); err != nil {
+        if err := validateFile(w.filePath, log.Printf, w.strict); err != nil {
             return fmt.Errorf("validation failed: %w", err)
         }
+        if w.sidecar {
+            sc := Sidecar{
+                Meta:           w.meta,
+                Packets:        w.packets,
+                RecordingBytes: w.recBytes,
+                RecordingCRC32: w.crc32.Sum32(),
+                Dimensions:     w.dimensions(),
+            }
+            if err := WriteSidecar(w.filePath, sc); err != nil {
+                return fmt.Errorf("write sidecar: %w", err)
+            }
+        }
     }
 
-    return nil
+    return w.broken
 }
@@ -0,0 +1,236 @@
+package mcpr
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newDiscardWriter(tb testing.TB, opts ...WriterOption) *Writer {
+	tb.Helper()
+	w, err := NewWriter(io.Discard, Meta{Protocol: 765}, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+// TestWritePacketAllocs checks that the frame path (header, id and payload)
+// does not allocate, see Writer.writeHeader.
+func TestWritePacketAllocs(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opts []WriterOption
+	}{
+		{"deflate", nil},
+		{"store", []WriterOption{WithRecordingCompression(Compression{Store: true})}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := newDiscardWriter(t, c.opts...)
+			payload := make([]byte, 256)
+			var ts uint32
+			// Let the compressor set up its buffers first
+			for i := 0; i < 100; i++ {
+				ts++
+				if err := w.WritePacket(ts, 0x27, payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+			allocs := testing.AllocsPerRun(1000, func() {
+				ts++
+				if err := w.WritePacket(ts, 0x27, payload); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("WritePacket allocates %.1f times per call, want 0", allocs)
+			}
+		})
+	}
+}
+
+// shortWriter accepts n bytes, then fails.
+type shortWriter struct{ n int }
+
+var errShort = errors.New("short write")
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > s.n {
+		k := s.n
+		s.n = 0
+		return k, errShort
+	}
+	s.n -= len(p)
+	return len(p), nil
+}
+
+// TestWritePacketTornFrame checks that a frame cut short by a failed write
+// breaks the writer instead of letting the next frame follow it.
+func TestWritePacketTornFrame(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		after int // bytes accepted before the write fails
+	}{
+		{"header", 4},
+		{"body", 9 + 10},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := newDiscardWriter(t)
+			w.recw = &shortWriter{n: c.after}
+			err := w.WritePacket(1, 0x27, make([]byte, 64))
+			if !errors.Is(err, errShort) {
+				t.Fatalf("WritePacket = %v, want %v", err, errShort)
+			}
+			next := &shortWriter{n: 1 << 20}
+			w.recw = next
+			if err := w.WritePacket(2, 0x27, make([]byte, 64)); !errors.Is(err, errShort) {
+				t.Errorf("WritePacket after a torn frame = %v, want the first error", err)
+			}
+			if next.n != 1<<20 {
+				t.Errorf("WritePacket after a torn frame wrote %d bytes", 1<<20-next.n)
+			}
+		})
+	}
+}
+
+// TestWritePacketAsyncFailure checks that a write failing on the async
+// goroutine stops the recording through the queue; run it with -race.
+func TestWritePacketAsyncFailure(t *testing.T) {
+	w := newDiscardWriter(t, WithAsync(4))
+	w.recw = &shortWriter{n: 100}
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = w.WritePacket(uint32(i), 0x27, make([]byte, 64))
+	}
+	if !errors.Is(err, errShort) {
+		t.Fatalf("WritePacket = %v, want %v", err, errShort)
+	}
+	if err := w.Close(); !errors.Is(err, errShort) {
+		t.Errorf("Close = %v, want %v", err, errShort)
+	}
+}
+
+// TestWriterConcurrent writes and annotates from several goroutines while
+// another closes the writer; run it with -race. Every packet accepted must be
+// in the recording and every annotation must refer to one of them. With
+// fail, the recording's writes fail partway instead.
+func TestWriterConcurrent(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opts []WriterOption
+		fail bool
+	}{
+		{"sync", []WriterOption{WithLocking()}, false},
+		{"async", []WriterOption{WithLocking(), WithAsync(16)}, false},
+		{"sync-fail", []WriterOption{WithLocking()}, true},
+		{"async-fail", []WriterOption{WithLocking(), WithAsync(16)}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.mcpr")
+			w, err := Create(path, Meta{Protocol: 765}, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.fail {
+				w.recw = &shortWriter{n: 1000}
+			}
+			var (
+				wg      sync.WaitGroup
+				written atomic.Int64
+				start   = make(chan struct{})
+			)
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					<-start
+					for i := 0; i < 200; i++ {
+						if err := w.WritePacket(uint32(i), 0x27, []byte{byte(g), byte(i)}); err != nil {
+							return
+						}
+						written.Add(1)
+						if i%50 == 49 {
+							w.Annotate(uint32(i), "g", strconv.Itoa(g))
+						}
+					}
+				}(g)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				for written.Load() < 400 && !c.fail {
+					runtime.Gosched()
+				}
+				if err := w.Close(); err != nil && !(c.fail && errors.Is(err, errShort)) {
+					t.Error(err)
+				}
+			}()
+			close(start)
+			wg.Wait()
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if c.fail {
+				return
+			}
+
+			r, err := OpenReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			var n int64
+			for {
+				if _, err := r.Next(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				n++
+			}
+			if n != written.Load() {
+				t.Errorf("recording has %d packets, want the %d accepted", n, written.Load())
+			}
+			as, err := r.Annotations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, a := range as {
+				if a.Frame < 0 || int64(a.Frame) >= n {
+					t.Errorf("annotation %+v refers to frame %d of %d", a, a.Frame, n)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWritePacket(b *testing.B) {
+	for _, size := range []int{16, 256, 4096} {
+		b.Run(byteSize(size), func(b *testing.B) {
+			w := newDiscardWriter(b)
+			payload := make([]byte, size)
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := w.WritePacket(uint32(i), 0x27, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func byteSize(n int) string {
+	if n >= 1024 {
+		return strconv.Itoa(n/1024) + "KiB"
+	}
+	return strconv.Itoa(n) + "B"
+}